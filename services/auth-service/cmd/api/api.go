@@ -2,11 +2,13 @@ package main
 
 import (
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/kaasikodes/shop-ease/services/auth-service/internal/oauth/provider"
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/ratelimiter"
 	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
 	"github.com/kaasikodes/shop-ease/shared/broker"
 	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
@@ -30,9 +32,14 @@ type config struct {
 	frontendUrl string
 	auth        authConfig
 	redis       redisConfig
+	// proxies whose X-Forwarded-For is trusted for the ip of the client, e.g. the load balancer
+	trustedProxies []*net.IPNet
 }
 
 type rateLimiterConfig struct {
+	forgotPassword *ratelimiter.FixedWindowLimiter // password reset tokens sent per email and per ip
+	resetPassword  *ratelimiter.FixedWindowLimiter // attempts to reset a password with a token per ip
+	twoFactor      *ratelimiter.FixedWindowLimiter // second factor attempts and email codes per user and per ip
 }
 type redisConfig struct {
 }
@@ -78,6 +85,7 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 	r.Use(app.metricsMiddleware)
 
 	r.Get("/healthz", app.healthzHandler)
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
 	r.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}).ServeHTTP(w, r)
 		// promhttp.Handler().ServeHTTP(w, r)
@@ -87,9 +95,13 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 			// TODO: add rate limiting for auth required endpoints to prevent abuse
 			r.Post("/register", app.registerHandler) // customer(happy path), vendor
 			r.Post("/login", app.loginHandler)
+			r.Post("/refresh", app.refreshHandler)
+			r.Post("/logout", app.logoutHandler)
 			r.Post("/verify", app.verifyHandler)
 			r.Post("/forgot-password", app.forgotPasswordHandler)
 			r.Post("/reset-password", app.resetPasswordHandler)
+			r.Post("/login/verify", app.verifyLoginHandler)
+			r.Post("/2fa/email/send", app.sendEmailOtpHandler)
 			// oauth providers
 			r.Route("/oauth", func(r chi.Router) {
 				r.Get("/github/login", app.githubOauthLoginHandler)
@@ -99,6 +111,13 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 			r.Group(func(r chi.Router) {
 				r.Use(app.authMiddleware)
 				r.Get("/me", app.retriveAuthAccountHandler)
+				r.Post("/logout-all", app.logoutAllHandler)
+				r.Route("/2fa", func(r chi.Router) {
+					r.Post("/totp/enroll", app.enrollTotpHandler)
+					r.Post("/totp/confirm", app.confirmTotpHandler)
+					r.Post("/recovery-codes", app.regenerateRecoveryCodesHandler)
+					r.Post("/disable", app.disableTwoFactorHandler)
+				})
 			})
 		})
 
@@ -108,7 +127,6 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 		// getUserById : vendor
 		// doesUserHaveRoleAsActive
 		// activateOrDeactivateUserRole: payment, admin
-		// Note on login in: user ought to provide the code sent to mail, 2-FA authentication
 
 		// Like wise
 		// The login for vendor will have to check if the user has an active subscription or not, if not don't allow login
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+
 	"go.opentelemetry.io/otel/codes"
 )
 
@@ -11,7 +13,7 @@ func (app *application) retriveAuthAccountHandler(w http.ResponseWriter, r *http
 	ctx := r.Context()
 	ctx, span := app.trace.Start(ctx, "retrieving authenticated user details")
 
-	user, ok := getUserFromContext(ctx)
+	userId, ok := getUserIdFromContext(ctx)
 	if !ok {
 		err := errors.New("unable to retrieve user")
 		app.logger.WithContext(ctx).Error("Retrieving user from context", err)
@@ -20,6 +22,15 @@ func (app *application) retriveAuthAccountHandler(w http.ResponseWriter, r *http
 		app.badRequestResponse(w, r, err)
 		return
 
+	}
+	user, err := app.store.Users().GetByEmailOrId(ctx, &store.User{ID: userId})
+	if err != nil {
+		app.logger.WithContext(ctx).Error("User not found", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.notFoundResponse(w, r, err)
+		return
+
 	}
 	if err := app.jsonResponse(w, http.StatusOK, "Authenticated user retrieved successfully!", user); err != nil {
 		app.internalServerError(w, r, err)
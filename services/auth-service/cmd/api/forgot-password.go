@@ -1,15 +1,105 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/ratelimiter"
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+	"github.com/kaasikodes/shop-ease/shared/proto/notification"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// forgotPasswordHandler sends a password reset token to the email, the response is the same whether or not an account exists for it
 func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{
-		"status":      "ok_Fgt",
-		"environment": app.config.env,
-		"version":     version,
+	parentTraceCtx, span := app.trace.Start(r.Context(), "forgot password")
+
+	defer span.End()
+
+	var payload ForgotPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading forgot password payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
 	}
-	if err := app.jsonResponse(w, http.StatusOK, "Health status retrieved successfully!", data); err != nil {
-		app.internalServerError(w, r, err)
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating forgot password payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
 	}
+	email := strings.ToLower(payload.Email)
+	if !app.allowRequest(w, r, app.rateLimiter.forgotPassword, "ip:"+app.clientIp(r), "email:"+email) {
+		return
+	}
+
+	// the lookup and sending happen after the response, so neither its content nor its timing tells whether the email has an account
+	sendCtx := trace.ContextWithSpan(context.Background(), span)
+	go app.sendPasswordResetToken(sendCtx, email)
+
+	app.jsonResponse(w, http.StatusOK, "If an account exists for the email, a password reset token has been sent to it!", nil)
+	return
+}
 
+func (app *application) sendPasswordResetToken(ctx context.Context, email string) {
+	ctx, span := app.trace.Start(ctx, "sending password reset token")
+	defer span.End()
+	span.SetAttributes(attribute.String("email", email))
+
+	user, err := app.store.Users().GetByEmailOrId(ctx, &store.User{Email: email})
+	if err != nil {
+		if !errors.Is(err, store.ErrNoUserFound) {
+			app.logger.WithContext(ctx).Error("Unable to locate user", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+	plainToken, err := newOpaqueToken()
+	if err != nil {
+		app.logger.WithContext(ctx).Error("Error generating password reset token", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	if err := app.store.Users().CreatePasswordResetToken(ctx, user.ID, hashToken(plainToken), PasswordResetTokenDuration); err != nil {
+		app.logger.WithContext(ctx).Error("Error saving password reset token", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	_, err = app.notificationService.Send(ctx, &notification.NotificationRequest{
+		Email:   user.Email,
+		Title:   "Password Reset",
+		Content: fmt.Sprintf("This is your password reset token %s, it expires in %v. Ignore this email if you did not ask to reset your password.", plainToken, PasswordResetTokenDuration),
+	})
+	if err != nil {
+		app.logger.WithContext(ctx).Error("Error interacting with the notification service", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// allowRequest counts the request against each key of the limiter, e.g. the ip and the email, and responds with 429 once any of them is over its limit
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, limiter *ratelimiter.FixedWindowLimiter, keys ...string) bool {
+	for _, key := range keys {
+		if allowed, retryAfter := limiter.Allow(key); !allowed {
+			app.rateLimitExceededResponse(w, r, strconv.Itoa(int(retryAfter.Seconds())+1))
+			return false
+		}
+	}
+	return true
 }
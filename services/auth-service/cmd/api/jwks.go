@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+// jwksHandler publishes the public keys tokens are verified with, it is served as a bare key set (RFC 7517) rather than in the response envelope so standard verifiers can read it
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// verifiers refetch on an unknown kid, so the set can be cached for a while
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJson(w, http.StatusOK, app.jwt.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
 	"go.opentelemetry.io/otel/attribute"
@@ -11,8 +11,10 @@ import (
 )
 
 type LoginResponse struct {
-	User        store.User `json:"user"`
-	AccessToken string     `json:"accessToken"`
+	User                 store.User `json:"user"`
+	AccessToken          string     `json:"accessToken"`
+	AccessTokenExpiresAt time.Time  `json:"accessTokenExpiresAt"`
+	RefreshToken         string     `json:"refreshToken"`
 }
 type LoginUserPayload struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
@@ -75,19 +77,5 @@ func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 
 	}
-	accessToken, err := app.jwt.CreateToken(strconv.Itoa(user.ID), user.Email, AccessTokenDuration)
-	if err != nil {
-		app.logger.WithContext(parentTraceCtx).Error("Jwt token err", err)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		app.badRequestResponse(w, r, err)
-		return
-
-	}
-
-	app.jsonResponse(w, http.StatusOK, "User logged in successfully!", LoginResponse{
-		User:        *user,
-		AccessToken: accessToken,
-	})
-
+	app.completeLogin(parentTraceCtx, w, r, user)
 }
@@ -2,14 +2,13 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"time"
 
-	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"go.opentelemetry.io/otel/codes"
 )
 
@@ -28,7 +27,7 @@ func (app *application) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Step 2: Retrieve user from DB
+		// Step 2: Read user id from the claims
 		userID, err := strconv.Atoi(claims.UserID)
 		if err != nil {
 			app.logger.WithContext(ctx).Error("Invalid user ID in token", err)
@@ -36,22 +35,21 @@ func (app *application) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.store.Users().GetByEmailOrId(ctx, &store.User{ID: userID})
+		// Step 3: Reject tokens whose session was logged out or revoked
+		active, err := app.store.Tokens().IsFamilyActive(ctx, claims.SessionID, userID)
 		if err != nil {
-			app.logger.WithContext(ctx).Error("User not found", err)
-			app.unauthorizedErrorResponse(w, r, fmt.Errorf("user not found"))
+			app.logger.WithContext(ctx).Error("Session lookup error", err)
+			app.internalServerError(w, r, err)
 			return
 		}
-
-		// Step 3: Check if verified
-		if !user.IsVerified {
-			app.badRequestResponse(w, r, errors.New("user is not verified"))
+		if !active {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("session has been revoked, please login again"))
 			return
 		}
 
-		// Step 4: Add user and claims to context
-		ctx = context.WithValue(ctx, ContextKeyUser{}, user)
-		ctx = context.WithValue(ctx, ContextKeyClaims{}, claims)
+		// Step 4: Add user id and claims to context, the roles and scopes of the claims are enough to authorize the request so the user is not loaded here
+		ctx = context.WithValue(ctx, ContextKeyUser{}, userID)
+		ctx = authz.WithClaims(ctx, claims)
 
 		// Step 5: Call next handler with the new context
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -78,20 +78,7 @@ func (app *application) githubOauthCallbackHandler(w http.ResponseWriter, r *htt
 		case store.CustomerID:
 
 			if user, _, err := app.registerCustomer(parentTraceCtx, RegisterUserPayload{Email: info.Email, Name: info.Name}, true); err == nil {
-				accessToken, err := app.jwt.CreateToken(strconv.Itoa(user.ID), user.Email, AccessTokenDuration)
-				if err != nil {
-					app.logger.WithContext(parentTraceCtx).Error("Jwt token err", err)
-					span.RecordError(err)
-					span.SetStatus(codes.Error, err.Error())
-					app.badRequestResponse(w, r, err)
-					return
-
-				}
-
-				app.jsonResponse(w, http.StatusOK, "User logged in successfully", LoginResponse{
-					User:        *user,
-					AccessToken: accessToken,
-				})
+				app.completeLogin(parentTraceCtx, w, r, user)
 				return
 			} else {
 				app.logger.WithContext(parentTraceCtx).Error("Customer Registeration Error", err)
@@ -107,18 +94,5 @@ func (app *application) githubOauthCallbackHandler(w http.ResponseWriter, r *htt
 		}
 
 	}
-	accessToken, err := app.jwt.CreateToken(strconv.Itoa(user.ID), user.Email, AccessTokenDuration)
-	if err != nil {
-		app.logger.WithContext(parentTraceCtx).Error("Jwt token err", err)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		app.badRequestResponse(w, r, err)
-		return
-
-	}
-
-	app.jsonResponse(w, http.StatusOK, "User logged in successfully", LoginResponse{
-		User:        *user,
-		AccessToken: accessToken,
-	})
+	app.completeLogin(parentTraceCtx, w, r, user)
 }
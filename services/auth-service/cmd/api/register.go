@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -14,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
 	"github.com/kaasikodes/shop-ease/services/payment-service/pkg/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/proto/notification"
 	"github.com/kaasikodes/shop-ease/shared/proto/payment"
 	"github.com/kaasikodes/shop-ease/shared/proto/subscription"
@@ -273,7 +273,7 @@ func (app *application) registerVendor(ctx context.Context, payload RegisterUser
 		Amount:            subscription.Plan.Amount,
 		MetaData: map[string]string{
 			"reason":      "first time payment for vendor subscription; new vendor registration",
-			"amount_paid": strconv.Itoa(int(subscription.Plan.Amount)),
+			"amount_paid": money.FromProto(subscription.Plan.Amount).String(),
 		},
 	})
 	if err != nil {
@@ -1,15 +1,106 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
 
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+	"github.com/kaasikodes/shop-ease/shared/proto/notification"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=200"`
+	Password string `json:"password" validate:"required,min=5,max=17"`
+}
+
+var errInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// resetPasswordHandler sets the password of the user the token was sent to, the token can only be used once and every session of the user is logged out
 func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{
-		"status":      "ok____reset",
-		"environment": app.config.env,
-		"version":     version,
+	parentTraceCtx, span := app.trace.Start(r.Context(), "reset password")
+
+	defer span.End()
+
+	var payload ResetPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading reset password payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating reset password payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
 	}
-	if err := app.jsonResponse(w, http.StatusOK, "Health status retrieved successfully!", data); err != nil {
+	if !app.allowRequest(w, r, app.rateLimiter.resetPassword, "ip:"+app.clientIp(r)) {
+		return
+	}
+
+	token, err := app.store.Tokens().GetByValue(parentTraceCtx, hashToken(payload.Token), store.PasswordResetTokenType)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrNoTokenFound) {
+			app.badRequestResponse(w, r, errInvalidResetToken)
+			return
+		}
 		app.internalServerError(w, r, err)
+		return
 	}
+	if token.ExpiresAt.Before(time.Now()) {
+		app.badRequestResponse(w, r, errInvalidResetToken)
+		return
+	}
+	span.SetAttributes(attribute.Int("userId", token.EntityId))
+
+	user, err := app.store.Users().GetByEmailOrId(parentTraceCtx, &store.User{ID: token.EntityId})
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Unable to locate user", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, errInvalidResetToken)
+		return
+	}
+	if err := user.Password.Set(payload.Password); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Users().ResetPassword(parentTraceCtx, user, token); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrNoTokenFound) {
+			// used by another request in the meantime
+			app.badRequestResponse(w, r, errInvalidResetToken)
+			return
+		}
+		app.logger.WithContext(parentTraceCtx).Error("Error resetting password", err)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	notifyCtx := trace.ContextWithSpan(context.Background(), span)
+	go func(ctx context.Context, email string) {
+		_, err := app.notificationService.Send(ctx, &notification.NotificationRequest{
+			Email:   email,
+			Title:   "Password Changed",
+			Content: "The password of your account was changed and all your sessions were logged out. Please reset your password again if this was not you.",
+		})
+		if err != nil {
+			app.logger.WithContext(ctx).Error("Error interacting with the notification service", err)
+		}
+	}(notifyCtx, user.Email)
 
+	app.jsonResponse(w, http.StatusOK, "Password reset successfully, please login again!", nil)
+	return
 }
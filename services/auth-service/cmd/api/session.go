@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+	"github.com/kaasikodes/shop-ease/shared/authz"
+	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
+	"github.com/kaasikodes/shop-ease/shared/proto/vendor_service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	grpc_codes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// createSession starts a new login session for the user, i.e. a new refresh token family
+func (app *application) createSession(ctx context.Context, user *store.User) (*LoginResponse, error) {
+	response, refreshToken, err := app.issueTokens(ctx, user, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+	tx, err := app.store.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := app.store.Tokens().Create(ctx, tx, refreshToken); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// issueTokens creates an access token and a refresh token of the session, only the hash of the refresh token is kept on the returned token
+func (app *application) issueTokens(ctx context.Context, user *store.User, familyId string) (*LoginResponse, *store.Token, error) {
+	accessToken, err := app.jwt.CreateIdentityToken(app.identityOf(ctx, user, familyId), AccessTokenDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+	plainRefreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	token := &store.Token{
+		EntityId:  user.ID,
+		TokenType: store.RefreshTokenType,
+		Value:     hashToken(plainRefreshToken),
+		ExpiresAt: time.Now().Add(RefreshTokenDuration),
+		FamilyId:  familyId,
+	}
+	return &LoginResponse{
+		User:                 *user,
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: time.Now().Add(AccessTokenDuration),
+		RefreshToken:         plainRefreshToken,
+	}, token, nil
+}
+
+// identityOf is what the access token asserts about the user, the roles, scopes and stores let services authorize requests without asking this service
+func (app *application) identityOf(ctx context.Context, user *store.User, familyId string) jwttoken.Identity {
+	identity := jwttoken.Identity{
+		UserID:    strconv.Itoa(user.ID),
+		Email:     user.Email,
+		SessionID: familyId,
+	}
+	for _, role := range user.Roles {
+		if role.IsActive {
+			identity.Roles = append(identity.Roles, string(role.Name))
+		}
+	}
+	identity.Scopes = authz.PermissionsFor(identity.Roles)
+	if !slices.Contains(identity.Roles, authz.Vendor) || app.clients.vendor == nil {
+		return identity
+	}
+
+	// a vendor without its stores in the token is only denied the store routes until the next refresh, so the token is still issued when this fails
+	access, err := app.clients.vendor.GetVendorAccess(ctx, &vendor_service.GetVendorAccessRequest{UserId: int64(user.ID)})
+	if err != nil {
+		if status.Code(err) != grpc_codes.NotFound {
+			app.logger.WithContext(ctx).Error("Error getting vendor access", err)
+		}
+		return identity
+	}
+	identity.VendorID = int(access.VendorId)
+	for _, storeId := range access.StoreIds {
+		identity.StoreIDs = append(identity.StoreIDs, int(storeId))
+	}
+	return identity
+}
+
+// newOpaqueToken generates the random tokens handed to users, e.g. refresh and password reset tokens
+func newOpaqueToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// hashToken is what is stored in place of an opaque token, so a leaked tokens table can not be used to refresh sessions
+func hashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshHandler exchanges a refresh token for a new access and refresh token, presenting a refresh token that was already exchanged revokes the whole session
+func (app *application) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "refresh token")
+
+	defer span.End()
+
+	var payload RefreshTokenPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading refresh token payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating refresh token payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	current, err := app.store.Tokens().GetByValue(parentTraceCtx, hashToken(payload.RefreshToken), store.RefreshTokenType)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrNoTokenFound) {
+			app.unauthorizedErrorResponse(w, r, errors.New("invalid refresh token"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("userId", current.EntityId),
+		attribute.String("sessionId", current.FamilyId),
+	)
+	if current.RevokedAt != nil {
+		app.revokeReusedSession(parentTraceCtx, w, r, current)
+		return
+	}
+	if current.ExpiresAt.Before(time.Now()) {
+		app.unauthorizedErrorResponse(w, r, errors.New("refresh token has expired"))
+		return
+	}
+
+	user, err := app.store.Users().GetByEmailOrId(parentTraceCtx, &store.User{ID: current.EntityId})
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Unable to locate user", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.unauthorizedErrorResponse(w, r, errors.New("user not found"))
+		return
+	}
+	if !user.IsVerified {
+		app.unauthorizedErrorResponse(w, r, errors.New("user is not verified"))
+		return
+	}
+
+	response, next, err := app.issueTokens(parentTraceCtx, user, current.FamilyId)
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Jwt token err", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Tokens().Rotate(parentTraceCtx, current, next); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrTokenReused) {
+			// another request exchanged the same token first
+			app.revokeReusedSession(parentTraceCtx, w, r, current)
+			return
+		}
+		app.logger.WithContext(parentTraceCtx).Error("Error rotating refresh token", err)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Tokens refreshed successfully!", response)
+	return
+}
+
+// revokeReusedSession ends the session of a refresh token that was presented after it was rotated, as either the user or whoever stole the token holds the latest one
+func (app *application) revokeReusedSession(ctx context.Context, w http.ResponseWriter, r *http.Request, token *store.Token) {
+	app.logger.WithContext(ctx).Warn("refresh token reuse detected, revoking session", "userId", token.EntityId, "sessionId", token.FamilyId)
+	if err := app.store.Tokens().RevokeFamily(ctx, token.FamilyId); err != nil {
+		app.logger.WithContext(ctx).Error("Error revoking session", err)
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.unauthorizedErrorResponse(w, r, fmt.Errorf("%w: the session has been revoked, please login again", store.ErrTokenReused))
+}
+
+// logoutHandler ends the session of the refresh token
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "logout")
+
+	defer span.End()
+
+	var payload RefreshTokenPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading logout payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating logout payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	token, err := app.store.Tokens().GetByValue(parentTraceCtx, hashToken(payload.RefreshToken), store.RefreshTokenType)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrNoTokenFound) {
+			app.unauthorizedErrorResponse(w, r, errors.New("invalid refresh token"))
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.String("sessionId", token.FamilyId))
+	if err := app.store.Tokens().RevokeFamily(parentTraceCtx, token.FamilyId); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error revoking session", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "User logged out successfully!", nil)
+	return
+}
+
+// logoutAllHandler ends every session of the authenticated user
+func (app *application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "logout everywhere")
+
+	defer span.End()
+
+	userId, ok := getUserIdFromContext(parentTraceCtx)
+	if !ok {
+		err := errors.New("unable to retrieve user")
+		app.logger.WithContext(parentTraceCtx).Error("Retrieving user from context", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("userId", userId))
+	if err := app.store.Tokens().RevokeAllForEntity(parentTraceCtx, userId, store.RefreshTokenType); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error revoking sessions", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "User logged out of all sessions successfully!", nil)
+	return
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
+	"github.com/kaasikodes/shop-ease/shared/logger"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Info(v ...any)                                   {}
+func (nopLogger) Warn(v ...any)                                   {}
+func (nopLogger) Error(v ...any)                                  {}
+func (nopLogger) Fatal(v ...any)                                  {}
+func (l nopLogger) WithContext(ctx context.Context) logger.Logger { return l }
+
+// memoryTokens keeps the refresh tokens by their hash, rotating and revoking them the way the sql store does
+type memoryTokens struct {
+	store.Tokens
+
+	byValue map[string]*store.Token
+	nextId  int
+	// rotatedMeanwhile has another request rotate the token between it being read and rotated
+	rotatedMeanwhile bool
+}
+
+func (m *memoryTokens) GetByValue(ctx context.Context, value string, tokenType store.TokenType) (*store.Token, error) {
+	token, ok := m.byValue[value]
+	if !ok || token.TokenType != tokenType {
+		return nil, store.ErrNoTokenFound
+	}
+	current := *token
+	return &current, nil
+}
+
+func (m *memoryTokens) Rotate(ctx context.Context, current *store.Token, next *store.Token) error {
+	stored := m.byValue[current.Value]
+	if m.rotatedMeanwhile {
+		now := time.Now()
+		stored.RevokedAt = &now
+	}
+	if stored.RevokedAt != nil {
+		return store.ErrTokenReused
+	}
+	now := time.Now()
+	stored.RevokedAt = &now
+	m.add(next)
+	return nil
+}
+
+func (m *memoryTokens) RevokeFamily(ctx context.Context, familyId string) error {
+	now := time.Now()
+	for _, token := range m.byValue {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryTokens) add(token *store.Token) {
+	m.nextId++
+	token.Id = m.nextId
+	stored := *token
+	m.byValue[token.Value] = &stored
+}
+
+// activeTokens is the number of refresh tokens of the session that can still be used
+func (m *memoryTokens) activeTokens(familyId string) int {
+	active := 0
+	for _, token := range m.byValue {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			active++
+		}
+	}
+	return active
+}
+
+type memoryUsers struct {
+	store.Users
+
+	user store.User
+}
+
+func (m *memoryUsers) GetByEmailOrId(ctx context.Context, user *store.User) (*store.User, error) {
+	found := m.user
+	return &found, nil
+}
+
+type memoryStorage struct {
+	store.Storage
+
+	users  *memoryUsers
+	tokens *memoryTokens
+}
+
+func (m *memoryStorage) Users() store.Users   { return m.users }
+func (m *memoryStorage) Tokens() store.Tokens { return m.tokens }
+
+func newSessionTestApp() (*application, *memoryTokens) {
+	tokens := &memoryTokens{byValue: map[string]*store.Token{}}
+	app := &application{
+		store:  &memoryStorage{users: &memoryUsers{user: store.User{ID: 7, Email: "user@shop-ease.com", IsVerified: true}}, tokens: tokens},
+		trace:  noop.NewTracerProvider().Tracer("test"),
+		logger: nopLogger{},
+		jwt:    jwttoken.NewJwtMaker("secret"),
+	}
+	return app, tokens
+}
+
+// login stores the refresh token of a new session and returns the plain token handed to the user
+func login(t *testing.T, app *application, tokens *memoryTokens, familyId string) string {
+	t.Helper()
+	response, token, err := app.issueTokens(context.Background(), &store.User{ID: 7, IsVerified: true}, familyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens.add(token)
+	return response.RefreshToken
+}
+
+// refresh exchanges the refresh token and returns the status and the new refresh token
+func refresh(t *testing.T, app *application, refreshToken string) (int, string) {
+	t.Helper()
+	body, err := json.Marshal(RefreshTokenPayload{RefreshToken: refreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	app.refreshHandler(w, httptest.NewRequest(http.MethodPost, "/v1/auth/refresh", strings.NewReader(string(body))))
+
+	var response struct {
+		Data LoginResponse `json:"data"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, response.Data.RefreshToken
+}
+
+func TestRefreshRotatesTheRefreshToken(t *testing.T) {
+	app, tokens := newSessionTestApp()
+	first := login(t, app, tokens, "session-1")
+
+	code, second := refresh(t, app, first)
+	if code != http.StatusOK || second == "" || second == first {
+		t.Fatalf("refresh returned %d and token %q, want 200 and a new refresh token", code, second)
+	}
+	if stored := tokens.byValue[hashToken(second)]; stored == nil || stored.FamilyId != "session-1" {
+		t.Errorf("new refresh token is stored as %+v, want it in the same session", stored)
+	}
+	if tokens.byValue[hashToken(first)].RevokedAt == nil {
+		t.Error("exchanged refresh token was not revoked")
+	}
+
+	// the new token keeps the session going
+	if code, third := refresh(t, app, second); code != http.StatusOK || third == "" {
+		t.Errorf("refresh with the rotated token returned %d, want 200", code)
+	}
+}
+
+func TestRefreshWithAReplayedTokenRevokesTheSession(t *testing.T) {
+	app, tokens := newSessionTestApp()
+	stolen := login(t, app, tokens, "session-1")
+	other := login(t, app, tokens, "session-2")
+
+	code, latest := refresh(t, app, stolen)
+	if code != http.StatusOK {
+		t.Fatalf("first refresh returned %d, want 200", code)
+	}
+	// the exchanged token is presented again, by whoever copied it or by the user after it was stolen
+	if code, _ := refresh(t, app, stolen); code != http.StatusUnauthorized {
+		t.Errorf("replayed refresh token returned %d, want 401", code)
+	}
+	if active := tokens.activeTokens("session-1"); active != 0 {
+		t.Errorf("session still has %d active refresh tokens, want it revoked", active)
+	}
+	if code, _ := refresh(t, app, latest); code != http.StatusUnauthorized {
+		t.Errorf("latest token of the revoked session returned %d, want 401", code)
+	}
+	if active := tokens.activeTokens("session-2"); active != 1 {
+		t.Errorf("other session has %d active refresh tokens, want it left alone", active)
+	}
+	if code, _ := refresh(t, app, other); code != http.StatusOK {
+		t.Errorf("refresh of the other session returned %d, want 200", code)
+	}
+}
+
+func TestConcurrentRefreshWithTheSameTokenRevokesTheSession(t *testing.T) {
+	app, tokens := newSessionTestApp()
+	first := login(t, app, tokens, "session-1")
+	tokens.rotatedMeanwhile = true
+
+	if code, _ := refresh(t, app, first); code != http.StatusUnauthorized {
+		t.Errorf("refresh that lost the rotation returned %d, want 401", code)
+	}
+	if active := tokens.activeTokens("session-1"); active != 0 {
+		t.Errorf("session still has %d active refresh tokens, want it revoked", active)
+	}
+}
+
+func TestRefreshRejectsUnknownAndExpiredTokens(t *testing.T) {
+	app, tokens := newSessionTestApp()
+	expired := login(t, app, tokens, "session-1")
+	tokens.byValue[hashToken(expired)].ExpiresAt = time.Now().Add(-time.Minute)
+
+	for name, token := range map[string]string{"unknown": "not-a-token", "expired": expired} {
+		if code, _ := refresh(t, app, token); code != http.StatusUnauthorized {
+			t.Errorf("%s refresh token returned %d, want 401", name, code)
+		}
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
+	"github.com/kaasikodes/shop-ease/services/auth-service/internal/totp"
+	"github.com/kaasikodes/shop-ease/shared/proto/notification"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TwoFactorMethod = string
+
+const (
+	TotpMethod         TwoFactorMethod = "totp"
+	EmailMethod        TwoFactorMethod = "email"
+	RecoveryCodeMethod TwoFactorMethod = "recovery_code"
+)
+
+var (
+	errInvalidChallenge = errors.New("invalid or expired login challenge, please login again")
+	errInvalidCode      = errors.New("invalid or expired code")
+)
+
+// LoginChallengeResponse is returned by login in place of the tokens when the user has to provide a second factor
+type LoginChallengeResponse struct {
+	ChallengeToken string            `json:"challengeToken"`
+	ExpiresAt      time.Time         `json:"expiresAt"`
+	Methods        []TwoFactorMethod `json:"methods"`
+}
+type VerifyLoginPayload struct {
+	ChallengeToken string          `json:"challengeToken" validate:"required"`
+	Method         TwoFactorMethod `json:"method" validate:"required,oneof=totp email recovery_code"`
+	Code           string          `json:"code" validate:"required,max=32"`
+}
+type SendEmailOtpPayload struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+}
+type TotpCodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+type DisableTwoFactorPayload struct {
+	Method TwoFactorMethod `json:"method" validate:"required,oneof=totp recovery_code"`
+	Code   string          `json:"code" validate:"required,max=32"`
+}
+type TotpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// completeLogin responds to a user whose password or oauth login checked out, with a session or with a challenge when a second factor is needed
+func (app *application) completeLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, user *store.User) {
+	span := trace.SpanFromContext(ctx)
+	if !user.TwoFactorEnabled && !user.RequiresTwoFactor() {
+		session, err := app.createSession(ctx, user)
+		if err != nil {
+			app.logger.WithContext(ctx).Error("Session creation err", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.jsonResponse(w, http.StatusOK, "User logged in successfully!", session)
+		return
+	}
+
+	challenge, err := app.createLoginChallenge(ctx, user)
+	if err != nil {
+		app.logger.WithContext(ctx).Error("Login challenge creation err", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.jsonResponse(w, http.StatusAccepted, "Please provide the second factor to complete the login!", challenge)
+}
+
+// createLoginChallenge saves the hash of a short lived token that stands in for the password while the user provides the second factor.
+// Accounts of roles that require two factor but have no authenticator enrolled can still complete the login with an email code, and enroll after.
+func (app *application) createLoginChallenge(ctx context.Context, user *store.User) (*LoginChallengeResponse, error) {
+	plainToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	token := &store.Token{
+		EntityId:  user.ID,
+		TokenType: store.TwoFactorChallengeTokenType,
+		Value:     hashToken(plainToken),
+		ExpiresAt: time.Now().Add(TwoFactorChallengeDuration),
+	}
+	tx, err := app.store.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := app.store.Tokens().Create(ctx, tx, token); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	methods := []TwoFactorMethod{EmailMethod}
+	if user.TwoFactorEnabled {
+		methods = []TwoFactorMethod{TotpMethod, RecoveryCodeMethod, EmailMethod}
+	}
+	return &LoginChallengeResponse{ChallengeToken: plainToken, ExpiresAt: token.ExpiresAt, Methods: methods}, nil
+}
+
+// challengeUser returns the user of an unexpired login challenge
+func (app *application) challengeUser(ctx context.Context, plainToken string) (*store.Token, *store.User, error) {
+	challenge, err := app.store.Tokens().GetByValue(ctx, hashToken(plainToken), store.TwoFactorChallengeTokenType)
+	if err != nil {
+		if errors.Is(err, store.ErrNoTokenFound) {
+			return nil, nil, errInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	if challenge.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errInvalidChallenge
+	}
+	user, err := app.store.Users().GetByEmailOrId(ctx, &store.User{ID: challenge.EntityId})
+	if err != nil {
+		if errors.Is(err, store.ErrNoUserFound) {
+			return nil, nil, errInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	return challenge, user, nil
+}
+
+// verifyLoginHandler exchanges a login challenge and a code of the second factor for a session
+func (app *application) verifyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "verify login")
+
+	defer span.End()
+
+	var payload VerifyLoginPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading verify login payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating verify login payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !app.allowTwoFactorAttempt(w, r, "ip:"+app.clientIp(r)) {
+		return
+	}
+
+	challenge, user, err := app.challengeUser(parentTraceCtx, payload.ChallengeToken)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, errInvalidChallenge) {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("userId", user.ID),
+		attribute.String("method", payload.Method),
+	)
+	// codes are short, so the attempts are limited per user as well as per ip
+	if !app.allowTwoFactorAttempt(w, r, "user:"+strconv.Itoa(user.ID)) {
+		return
+	}
+
+	valid, err := app.verifySecondFactor(parentTraceCtx, user, payload.Method, payload.Code)
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error verifying second factor", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !valid {
+		span.SetStatus(codes.Error, errInvalidCode.Error())
+		app.unauthorizedErrorResponse(w, r, errInvalidCode)
+		return
+	}
+	if err := app.store.Tokens().Consume(parentTraceCtx, challenge.Value, user.ID, store.TwoFactorChallengeTokenType); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrNoTokenFound) {
+			// completed by another request in the meantime
+			app.unauthorizedErrorResponse(w, r, errInvalidChallenge)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	session, err := app.createSession(parentTraceCtx, user)
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Session creation err", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "User logged in successfully!", session)
+	return
+}
+
+// verifySecondFactor checks the code of the method, a code that checks out can not be used again
+func (app *application) verifySecondFactor(ctx context.Context, user *store.User, method TwoFactorMethod, code string) (bool, error) {
+	switch method {
+	case TotpMethod:
+		if !user.TwoFactorEnabled {
+			return false, nil
+		}
+		step, ok := totp.Validate(user.TwoFactorSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return app.store.Users().UseTotpStep(ctx, user.ID, step)
+	case RecoveryCodeMethod:
+		if !user.TwoFactorEnabled {
+			return false, nil
+		}
+		return app.store.Users().UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	case EmailMethod:
+		value := emailOtpHash(user.ID, strings.TrimSpace(code))
+		token, err := app.store.Tokens().GetByValue(ctx, value, store.EmailOtpTokenType)
+		if err != nil {
+			if errors.Is(err, store.ErrNoTokenFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		if token.EntityId != user.ID || token.ExpiresAt.Before(time.Now()) {
+			return false, nil
+		}
+		if err := app.store.Tokens().Consume(ctx, value, user.ID, store.EmailOtpTokenType); err != nil {
+			if errors.Is(err, store.ErrNoTokenFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// sendEmailOtpHandler emails a one time code for the login challenge, sending another code invalidates the previous one
+func (app *application) sendEmailOtpHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "send email otp")
+
+	defer span.End()
+
+	var payload SendEmailOtpPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading send email otp payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating send email otp payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	_, user, err := app.challengeUser(parentTraceCtx, payload.ChallengeToken)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, errInvalidChallenge) {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("userId", user.ID))
+	if !app.allowTwoFactorAttempt(w, r, "email:"+strconv.Itoa(user.ID)) {
+		return
+	}
+
+	code, err := newEmailOtp()
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error generating email otp", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	err = app.store.Tokens().Replace(parentTraceCtx, &store.Token{
+		EntityId:  user.ID,
+		TokenType: store.EmailOtpTokenType,
+		Value:     emailOtpHash(user.ID, code),
+		ExpiresAt: time.Now().Add(EmailOtpDuration),
+	})
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error saving email otp", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	_, err = app.notificationService.Send(parentTraceCtx, &notification.NotificationRequest{
+		Email:   user.Email,
+		Title:   "Login Code",
+		Content: fmt.Sprintf("This is your login code %s, it expires in %v. Please reset your password if you did not try to login.", code, EmailOtpDuration),
+	})
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error interacting with the notification service", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Login code sent successfully!", nil)
+	return
+}
+
+// enrollTotpHandler generates a totp secret for the authenticated user, it is only used for login once a code confirms it
+func (app *application) enrollTotpHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "enroll totp")
+
+	defer span.End()
+
+	user, ok := app.authenticatedUser(parentTraceCtx, w, r)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled {
+		app.conflictResponse(w, r, errors.New("two factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error generating totp secret", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Users().SetTwoFactorSecret(parentTraceCtx, user.ID, secret); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error saving totp secret", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Totp enrollment started successfully!", TotpEnrollmentResponse{
+		Secret: secret,
+		URI:    totp.URI(TwoFactorIssuer, user.Email, secret),
+	})
+	return
+}
+
+// confirmTotpHandler enables two factor authentication once a code of the enrolled secret checks out, the recovery codes are only ever shown in its response
+func (app *application) confirmTotpHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "confirm totp")
+
+	defer span.End()
+
+	var payload TotpCodePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading confirm totp payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating confirm totp payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user, ok := app.authenticatedUser(parentTraceCtx, w, r)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled {
+		app.conflictResponse(w, r, errors.New("two factor authentication is already enabled"))
+		return
+	}
+	if user.TwoFactorSecret == "" {
+		app.badRequestResponse(w, r, errors.New("please enroll totp first"))
+		return
+	}
+	if !app.allowTwoFactorAttempt(w, r, "user:"+strconv.Itoa(user.ID)) {
+		return
+	}
+	step, valid := totp.Validate(user.TwoFactorSecret, payload.Code, time.Now())
+	if valid {
+		var err error
+		if valid, err = app.store.Users().UseTotpStep(parentTraceCtx, user.ID, step); err != nil {
+			app.logger.WithContext(parentTraceCtx).Error("Error saving totp step", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if !valid {
+		span.SetStatus(codes.Error, errInvalidCode.Error())
+		app.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error generating recovery codes", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Users().EnableTwoFactor(parentTraceCtx, user.ID, hashes); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error enabling two factor authentication", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	// admins and vendors may have logged in with email codes only, end those sessions so every session left went through the authenticator
+	if user.RequiresTwoFactor() {
+		if err := app.store.Tokens().RevokeAllForEntity(parentTraceCtx, user.ID, store.RefreshTokenType); err != nil {
+			app.logger.WithContext(parentTraceCtx).Error("Error revoking sessions", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	app.notifyTwoFactorChange(span, user.Email, "Two Factor Authentication Enabled", "Two factor authentication was enabled on your account. Please reset your password if this was not you.")
+
+	app.jsonResponse(w, http.StatusOK, "Two factor authentication enabled successfully, please store the recovery codes safely!", RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	return
+}
+
+// regenerateRecoveryCodesHandler replaces the recovery codes of the user, e.g. when most were used or they were lost
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "regenerate recovery codes")
+
+	defer span.End()
+
+	var payload TotpCodePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading recovery codes payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating recovery codes payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user, ok := app.authenticatedUser(parentTraceCtx, w, r)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled {
+		app.badRequestResponse(w, r, errors.New("two factor authentication is not enabled"))
+		return
+	}
+	if !app.allowTwoFactorAttempt(w, r, "user:"+strconv.Itoa(user.ID)) {
+		return
+	}
+	valid, err := app.verifySecondFactor(parentTraceCtx, user, TotpMethod, payload.Code)
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error verifying second factor", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !valid {
+		span.SetStatus(codes.Error, errInvalidCode.Error())
+		app.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error generating recovery codes", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Users().ReplaceRecoveryCodes(parentTraceCtx, user.ID, hashes); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error saving recovery codes", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Recovery codes regenerated successfully!", RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	return
+}
+
+// disableTwoFactorHandler turns two factor authentication off, accounts of roles that require it can not
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	parentTraceCtx, span := app.trace.Start(r.Context(), "disable two factor")
+
+	defer span.End()
+
+	var payload DisableTwoFactorPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error reading disable two factor payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error validating disable two factor payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user, ok := app.authenticatedUser(parentTraceCtx, w, r)
+	if !ok {
+		return
+	}
+	if user.RequiresTwoFactor() {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	if !user.TwoFactorEnabled {
+		app.badRequestResponse(w, r, errors.New("two factor authentication is not enabled"))
+		return
+	}
+	if !app.allowTwoFactorAttempt(w, r, "user:"+strconv.Itoa(user.ID)) {
+		return
+	}
+	valid, err := app.verifySecondFactor(parentTraceCtx, user, payload.Method, payload.Code)
+	if err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error verifying second factor", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !valid {
+		span.SetStatus(codes.Error, errInvalidCode.Error())
+		app.badRequestResponse(w, r, errInvalidCode)
+		return
+	}
+
+	if err := app.store.Users().DisableTwoFactor(parentTraceCtx, user.ID); err != nil {
+		app.logger.WithContext(parentTraceCtx).Error("Error disabling two factor authentication", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.notifyTwoFactorChange(span, user.Email, "Two Factor Authentication Disabled", "Two factor authentication was disabled on your account. Please reset your password and enable it again if this was not you.")
+
+	app.jsonResponse(w, http.StatusOK, "Two factor authentication disabled successfully!", nil)
+	return
+}
+
+// authenticatedUser loads the user of the access token, the token may predate changes to the two factor settings so they are read from the database
+func (app *application) authenticatedUser(ctx context.Context, w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	span := trace.SpanFromContext(ctx)
+	userId, ok := getUserIdFromContext(ctx)
+	if !ok {
+		err := errors.New("unable to retrieve user")
+		app.logger.WithContext(ctx).Error("Retrieving user from context", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	span.SetAttributes(attribute.Int("userId", userId))
+	user, err := app.store.Users().GetByEmailOrId(ctx, &store.User{ID: userId})
+	if err != nil {
+		app.logger.WithContext(ctx).Error("Unable to locate user", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrNoUserFound) {
+			app.unauthorizedErrorResponse(w, r, errors.New("user not found"))
+			return nil, false
+		}
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// notifyTwoFactorChange lets the user know the two factor settings of the account changed, in case it was not them
+func (app *application) notifyTwoFactorChange(span trace.Span, email string, title string, content string) {
+	notifyCtx := trace.ContextWithSpan(context.Background(), span)
+	go func(ctx context.Context) {
+		_, err := app.notificationService.Send(ctx, &notification.NotificationRequest{Email: email, Title: title, Content: content})
+		if err != nil {
+			app.logger.WithContext(ctx).Error("Error interacting with the notification service", err)
+		}
+	}(notifyCtx)
+}
+
+// allowTwoFactorAttempt counts the attempt against each key and responds with 429 once any of them is over its limit
+func (app *application) allowTwoFactorAttempt(w http.ResponseWriter, r *http.Request, keys ...string) bool {
+	return app.allowRequest(w, r, app.rateLimiter.twoFactor, keys...)
+}
+
+// newEmailOtp generates a 6 digit code to be sent by email
+func newEmailOtp() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// emailOtpHash salts the code with the user, as two users can be sent the same code and token values are unique
+func emailOtpHash(userId int, code string) string {
+	return hashToken(strconv.Itoa(userId) + ":" + code)
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes generates the recovery codes shown to the user, e.g. abcde-fghij, and the hashes that are stored in their place
+func newRecoveryCodes() ([]string, []string, error) {
+	recoveryCodes := make([]string, 0, RecoveryCodeCount)
+	hashes := make([]string, 0, RecoveryCodeCount)
+	for len(recoveryCodes) < RecoveryCodeCount {
+		bytes := make([]byte, 7)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(bytes)[:10])
+		recoveryCodes = append(recoveryCodes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	return recoveryCodes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts the codes as typed, with or without the dash and in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
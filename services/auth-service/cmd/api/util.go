@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
 	"time"
-
-	"github.com/kaasikodes/shop-ease/services/auth-service/internal/store"
-	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
 )
 
 const (
 	ExpiresAtVerificationToken = time.Hour * 24 * 5
-	AccessTokenDuration        = time.Duration(time.Hour * 24 * 3)
+	AccessTokenDuration        = time.Duration(time.Minute * 15) // kept short as access tokens are verified without a lookup, refresh tokens renew them
+	RefreshTokenDuration       = time.Duration(time.Hour * 24 * 30)
+	PasswordResetTokenDuration = time.Duration(time.Minute * 30)
+	TwoFactorChallengeDuration = time.Duration(time.Minute * 5) // time to provide the second factor after the password checks out
+	EmailOtpDuration           = time.Duration(time.Minute * 5)
+	RecoveryCodeCount          = 10
+	TwoFactorIssuer            = "ShopEase" // the name authenticator apps show the codes under
 )
 
 type ContextKeyUser struct{}
-type ContextKeyClaims struct{}
 
 type paginatedResponse struct {
 	Total  int   `json:"total"`
@@ -32,12 +38,74 @@ func createPaginatedResponse(result []any, total int) paginatedResponse {
 func (app *application) isProduction() bool {
 	return app.config.env == "production"
 }
-func getUserFromContext(ctx context.Context) (*store.User, bool) {
-	user, ok := ctx.Value(ContextKeyUser{}).(*store.User)
-	return user, ok
+func getUserIdFromContext(ctx context.Context) (int, bool) {
+	userId, ok := ctx.Value(ContextKeyUser{}).(int)
+	return userId, ok
+}
+
+// parseTrustedProxies reads a comma separated list of the ips or cidr ranges of the proxies in front of the service
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
 }
 
-func getClaimsFromContext(ctx context.Context) (*jwttoken.CustomClaims, bool) {
-	claims, ok := ctx.Value(ContextKeyClaims{}).(*jwttoken.CustomClaims)
-	return claims, ok
+func (app *application) isTrustedProxy(ip net.IP) bool {
+	for _, proxy := range app.config.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIp returns the ip of the client the request came from. X-Forwarded-For is only read when the request came through a trusted proxy,
+// and then from the right, as the entries left of the last untrusted one were written by the client and can be anything
+func (app *application) clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !app.isTrustedProxy(ip) {
+		return host
+	}
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			// not written by a proxy we trust, the hop before it is the client as far as we can tell
+			return ip.String()
+		}
+		if !app.isTrustedProxy(hop) {
+			return hop.String()
+		}
+		ip = hop
+	}
+	return ip.String()
 }
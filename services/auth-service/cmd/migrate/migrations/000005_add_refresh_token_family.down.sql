@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    DROP INDEX idx_tokens_familyId,
+    DROP COLUMN revokedAt,
+    DROP COLUMN familyId;
@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    ADD COLUMN familyId VARCHAR(36) NOT NULL DEFAULT '', -- refresh tokens rotated from the same login share a family
+    ADD COLUMN revokedAt TIMESTAMP NULL DEFAULT NULL,
+    ADD INDEX idx_tokens_familyId (familyId);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS recoveryCodes;
+
+ALTER TABLE users
+    DROP COLUMN totpLastStep,
+    DROP COLUMN twoFactorEnabled,
+    DROP COLUMN twoFactorSecret;
@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN twoFactorSecret VARCHAR(64) NULL DEFAULT NULL, -- totp secret, set on enrollment and kept once confirmed
+    ADD COLUMN twoFactorEnabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totpLastStep BIGINT NOT NULL DEFAULT 0; -- time step of the last accepted code, so a code can not be replayed
+
+CREATE TABLE IF NOT EXISTS recoveryCodes (
+    id SERIAL PRIMARY KEY,
+    userId BIGINT UNSIGNED NOT NULL,
+    codeHash VARCHAR(64) NOT NULL,
+    usedAt TIMESTAMP NULL DEFAULT NULL,
+    createdAt TIMESTAMP DEFAULT NOW(),
+    UNIQUE KEY (userId, codeHash),
+    CONSTRAINT fk_recoveryCodes_user FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
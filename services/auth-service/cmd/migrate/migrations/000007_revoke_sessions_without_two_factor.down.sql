@@ -0,0 +1,2 @@
+-- revoked sessions are not restored
+SELECT 1;
@@ -0,0 +1,6 @@
+-- admins and vendors now always login with a second factor, end the sessions they started before it was required
+UPDATE tokens t
+JOIN userRoles ur ON ur.userId = t.entityId AND ur.isActive = TRUE
+JOIN roles r ON r.id = ur.roleId
+SET t.revokedAt = NOW(), t.updatedAt = NOW()
+WHERE t.tokenType = 'REFRESH_TOKEN' AND t.revokedAt IS NULL AND r.name IN ('admin', 'vendor');
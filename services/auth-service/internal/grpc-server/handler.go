@@ -58,3 +58,19 @@ func (n *AuthGrpcHandler) GetUserById(ctx context.Context, payload *auth.GetUser
 	}, nil
 
 }
+
+// IsSessionActive lets services that verify access tokens on their own check that the session of the token was not logged out or revoked
+func (n *AuthGrpcHandler) IsSessionActive(ctx context.Context, payload *auth.IsSessionActiveRequest) (*auth.IsSessionActiveResponse, error) {
+	ctx, span := n.trace.Start(ctx, "checking session")
+	defer span.End()
+	if payload.SessionId == "" {
+		return &auth.IsSessionActiveResponse{Active: false}, nil
+	}
+	active, err := n.store.Tokens().IsFamilyActive(ctx, payload.SessionId, int(payload.UserId))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return &auth.IsSessionActiveResponse{Active: active}, nil
+}
@@ -0,0 +1,64 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FixedWindowLimiter allows a number of requests per key in each window, e.g. per email or ip.
+// The counts are kept in memory so each instance of the service limits on its own.
+type FixedWindowLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewFixedWindowLimiter(limit int, period time.Duration) *FixedWindowLimiter {
+	return &FixedWindowLimiter{limit: limit, window: period, windows: map[string]*window{}}
+}
+
+// Allow counts a request of the key, when the limit of the window was already reached it returns false and the time until the window resets
+func (l *FixedWindowLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &window{resetAt: now.Add(l.window)}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false, w.resetAt.Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// Run drops the windows that have reset until the context is cancelled, so keys seen once do not pile up
+func (l *FixedWindowLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, w := range l.windows {
+				if !now.Before(w.resetAt) {
+					delete(l.windows, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
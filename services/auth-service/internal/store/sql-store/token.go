@@ -19,6 +19,7 @@ const (
 
 var (
 	ErrNoTokenFound = store.ErrNoTokenFound
+	ErrTokenReused  = store.ErrTokenReused
 )
 
 type Token = store.Token
@@ -33,11 +34,11 @@ func (t *SQLTokenStore) Create(ctx context.Context, tx *sql.Tx, token *Token) er
 }
 func createToken(ctx context.Context, tx *sql.Tx, token *Token) error {
 	query := `
-		INSERT INTO tokens (entityId, tokenType, value, expiresAt)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO tokens (entityId, tokenType, value, expiresAt, familyId)
+		VALUES (?, ?, ?, ?, ?)
 	`
 	log.Println("expires at ...", token.ExpiresAt)
-	result, err := tx.ExecContext(ctx, query, token.EntityId, token.TokenType, token.Value, token.ExpiresAt)
+	result, err := tx.ExecContext(ctx, query, token.EntityId, token.TokenType, token.Value, token.ExpiresAt, token.FamilyId)
 	if err != nil {
 		return err
 	}
@@ -84,3 +85,131 @@ func (t *SQLTokenStore) GetOne(ctx context.Context, value string, entityId int,
 	}
 	return &token, nil
 }
+
+// GetByValue retrieves a token by its value alone, as is the case for refresh tokens which are presented without the user
+func (t *SQLTokenStore) GetByValue(ctx context.Context, value string, tokenType TokenType) (*Token, error) {
+	query := `
+		SELECT id, entityId, tokenType, value, expiresAt, familyId, revokedAt
+		FROM tokens
+		WHERE value = ? AND tokenType = ?
+		LIMIT 1
+	`
+	var (
+		token     Token
+		revokedAt sql.NullTime
+	)
+	err := t.db.QueryRowContext(ctx, query, value, tokenType).
+		Scan(&token.Id, &token.EntityId, &token.TokenType, &token.Value, &token.ExpiresAt, &token.FamilyId, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoTokenFound
+		}
+		return nil, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return &token, nil
+}
+
+// Rotate revokes the current token and stores the next one in its place, ErrTokenReused is returned when the current token was revoked in the meantime
+func (t *SQLTokenStore) Rotate(ctx context.Context, current *Token, next *Token) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the revokedAt check makes two concurrent refreshes with the same token rotate it only once
+	result, err := tx.ExecContext(ctx, `UPDATE tokens SET revokedAt = NOW(), updatedAt = NOW() WHERE id = ? AND revokedAt IS NULL`, current.Id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTokenReused
+	}
+	if err := createToken(ctx, tx, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeFamily revokes every token of the family, ending the login session it belongs to
+func (t *SQLTokenStore) RevokeFamily(ctx context.Context, familyId string) error {
+	query := `
+		UPDATE tokens
+		SET revokedAt = NOW(), updatedAt = NOW()
+		WHERE familyId = ? AND revokedAt IS NULL
+	`
+	_, err := t.db.ExecContext(ctx, query, familyId)
+	return err
+}
+
+// RevokeAllForEntity revokes every token of the given type that belongs to the entity
+func (t *SQLTokenStore) RevokeAllForEntity(ctx context.Context, entityId int, tokenType TokenType) error {
+	query := `
+		UPDATE tokens
+		SET revokedAt = NOW(), updatedAt = NOW()
+		WHERE entityId = ? AND tokenType = ? AND revokedAt IS NULL
+	`
+	_, err := t.db.ExecContext(ctx, query, entityId, tokenType)
+	return err
+}
+
+// IsFamilyActive reports whether the family still has a refresh token that can be used, i.e. the session has not been logged out or revoked
+func (t *SQLTokenStore) IsFamilyActive(ctx context.Context, familyId string, entityId int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM tokens
+			WHERE familyId = ? AND entityId = ? AND tokenType = ? AND revokedAt IS NULL AND expiresAt > NOW()
+		)
+	`
+	var active bool
+	err := t.db.QueryRowContext(ctx, query, familyId, entityId, RefreshTokenType).Scan(&active)
+	if err != nil {
+		return false, err
+	}
+	return active, nil
+}
+
+// Replace removes the tokens of the same type of the entity and creates the token, e.g. only the latest email code sent is valid
+func (t *SQLTokenStore) Replace(ctx context.Context, token *Token) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE entityId = ? AND tokenType = ?`, token.EntityId, token.TokenType)
+	if err != nil {
+		return err
+	}
+	if err := createToken(ctx, tx, token); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Consume removes a single use token, only one of two concurrent consumers of the same token succeeds
+func (t *SQLTokenStore) Consume(ctx context.Context, value string, entityId int, tokenType TokenType) error {
+	query := `
+		DELETE FROM tokens
+		WHERE value = ? AND entityId = ? AND tokenType = ?
+	`
+	result, err := t.db.ExecContext(ctx, query, value, entityId, tokenType)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoTokenFound
+	}
+	return nil
+}
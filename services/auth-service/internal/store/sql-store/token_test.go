@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestTokenStore(t *testing.T) (*SQLTokenStore, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &SQLTokenStore{db}, mock
+}
+
+func TestRotate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		revoked int64 // rows the revocation of the current token updates, none when it was rotated by another request
+		wantErr error
+	}{
+		"rotates an unused token":          {revoked: 1},
+		"token rotated by another request": {revoked: 0, wantErr: ErrTokenReused},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tokens, mock := newTestTokenStore(t)
+			current := &Token{Id: 4, EntityId: 7, TokenType: RefreshTokenType, FamilyId: "session-1"}
+			next := &Token{EntityId: 7, TokenType: RefreshTokenType, Value: "next-hash", ExpiresAt: time.Now().Add(time.Hour), FamilyId: "session-1"}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE tokens SET revokedAt = NOW(), updatedAt = NOW() WHERE id = ? AND revokedAt IS NULL`)).
+				WithArgs(4).
+				WillReturnResult(sqlmock.NewResult(0, tc.revoked))
+			if tc.wantErr == nil {
+				mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO tokens (entityId, tokenType, value, expiresAt, familyId)`)).
+					WithArgs(7, RefreshTokenType, "next-hash", next.ExpiresAt, "session-1").
+					WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectCommit()
+			} else {
+				// the next token is not stored, the session is left to be revoked by the caller
+				mock.ExpectRollback()
+			}
+
+			err := tokens.Rotate(context.Background(), current, next)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("rotate returned %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && next.Id != 5 {
+				t.Errorf("next token has id %d, want the inserted id 5", next.Id)
+			}
+		})
+	}
+}
+
+func TestRevokeFamilyRevokesTheUnrevokedTokensOfTheSession(t *testing.T) {
+	tokens, mock := newTestTokenStore(t)
+	mock.ExpectExec(regexp.QuoteMeta(`WHERE familyId = ? AND revokedAt IS NULL`)).
+		WithArgs("session-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := tokens.RevokeFamily(context.Background(), "session-1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
@@ -61,6 +60,154 @@ func (u *SQLUserStore) CreateWithVerificationToken(ctx context.Context, user *Us
 	}
 	return nil
 }
+func (u *SQLUserStore) CreatePasswordResetToken(ctx context.Context, userId int, tokenValue string, tokenIsValidFor time.Duration) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE entityId = ? AND tokenType = ?`, userId, store.PasswordResetTokenType)
+	if err != nil {
+		return err
+	}
+	err = createToken(ctx, tx, &store.Token{
+		EntityId:  userId,
+		TokenType: store.PasswordResetTokenType,
+		ExpiresAt: time.Now().Add(tokenIsValidFor),
+		Value:     tokenValue,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (u *SQLUserStore) ResetPassword(ctx context.Context, user *User, token *store.Token) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// deleting the token first makes two resets with the same token succeed only once
+	result, err := tx.ExecContext(ctx, `DELETE FROM tokens WHERE id = ? AND tokenType = ?`, token.Id, store.PasswordResetTokenType)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return store.ErrNoTokenFound
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET password = ?, updatedAt = NOW() WHERE id = ?`, user.Password.GetHash(), user.ID)
+	if err != nil {
+		return err
+	}
+	// whoever knew the old password may hold a session
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET revokedAt = NOW(), updatedAt = NOW() WHERE entityId = ? AND tokenType = ? AND revokedAt IS NULL`, user.ID, store.RefreshTokenType)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (u *SQLUserStore) SetTwoFactorSecret(ctx context.Context, userId int, secret string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	_, err := u.db.ExecContext(ctx, `UPDATE users SET twoFactorSecret = ?, twoFactorEnabled = FALSE, totpLastStep = 0, updatedAt = NOW() WHERE id = ?`, secret, userId)
+	return err
+}
+
+func (u *SQLUserStore) EnableTwoFactor(ctx context.Context, userId int, recoveryCodeHashes []string) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET twoFactorEnabled = TRUE, updatedAt = NOW() WHERE id = ? AND twoFactorSecret IS NOT NULL`, userId)
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (u *SQLUserStore) DisableTwoFactor(ctx context.Context, userId int) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET twoFactorSecret = NULL, twoFactorEnabled = FALSE, totpLastStep = 0, updatedAt = NOW() WHERE id = ?`, userId)
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userId, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (u *SQLUserStore) ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryCodeHashes []string) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int, recoveryCodeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recoveryCodes WHERE userId = ?`, userId); err != nil {
+		return err
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recoveryCodes (userId, codeHash) VALUES (?, ?)`, userId, codeHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *SQLUserStore) UseRecoveryCode(ctx context.Context, userId int, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	result, err := u.db.ExecContext(ctx, `UPDATE recoveryCodes SET usedAt = NOW() WHERE userId = ? AND codeHash = ? AND usedAt IS NULL`, userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (u *SQLUserStore) UseTotpStep(ctx context.Context, userId int, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	result, err := u.db.ExecContext(ctx, `UPDATE users SET totpLastStep = ? WHERE id = ? AND totpLastStep < ?`, step, userId, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
 func (u *SQLUserStore) RemoveMultipleUsers(ctx context.Context, tx *sql.Tx, emails []string) error {
 	if len(emails) == 0 {
 		return nil // No emails provided, nothing to remove
@@ -286,19 +433,21 @@ func (u *SQLUserStore) Update(ctx context.Context, user *User) (*User, error) {
 
 }
 func (u *SQLUserStore) GetByEmailOrId(ctx context.Context, user *User) (*User, error) {
-	var pwdHash string
-	queryU := `SELECT id, email, name, isVerified, password, verifiedAt FROM users WHERE id = ? OR email = ?`
+	var (
+		pwdHash         string
+		twoFactorSecret sql.NullString
+	)
+	queryU := `SELECT id, email, name, isVerified, password, verifiedAt, twoFactorSecret, twoFactorEnabled FROM users WHERE id = ? OR email = ?`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	log.Println(user, "user 1 ...")
 	defer cancel()
-	err := u.db.QueryRowContext(ctx, queryU, user.ID, user.Email).Scan(&user.ID, &user.Email, &user.Name, &user.IsVerified, &pwdHash, &user.VerifiedAt)
+	err := u.db.QueryRowContext(ctx, queryU, user.ID, user.Email).Scan(&user.ID, &user.Email, &user.Name, &user.IsVerified, &pwdHash, &user.VerifiedAt, &twoFactorSecret, &user.TwoFactorEnabled)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, store.ErrNoUserFound
 		}
 		return nil, err
 	}
-	log.Println(user, "user 2 ...")
+	user.TwoFactorSecret = twoFactorSecret.String
 	queryR := `
 		SELECT ur.roleId, r.name, ur.isActive 
 		FROM userRoles ur
@@ -320,10 +469,8 @@ func (u *SQLUserStore) GetByEmailOrId(ctx context.Context, user *User) (*User, e
 		user.Roles = append(user.Roles, role)
 
 	}
-	log.Println("PWD ________________________________________B4", string(user.Password.Hash))
 	// set password hash
 	user.Password.Hash = []byte(pwdHash)
-	log.Println("PWD ________________________________________AFTER", string(user.Password.Hash))
 
 	return user, nil
 }
@@ -9,6 +9,20 @@ import (
 
 type Users interface {
 	CreateWithVerificationToken(ctx context.Context, user *User, tokenValue string, tokenIsValidFor time.Duration) error
+	// CreatePasswordResetToken replaces any reset token of the user, so only the latest one sent can be used
+	CreatePasswordResetToken(ctx context.Context, userId int, tokenValue string, tokenIsValidFor time.Duration) error
+	// ResetPassword consumes the reset token, saves the password hash of the user and revokes the sessions of the user
+	ResetPassword(ctx context.Context, user *User, token *Token) error
+	// SetTwoFactorSecret saves a pending totp secret, two factor stays disabled until EnableTwoFactor
+	SetTwoFactorSecret(ctx context.Context, userId int, secret string) error
+	// EnableTwoFactor enables two factor authentication and replaces the recovery codes of the user
+	EnableTwoFactor(ctx context.Context, userId int, recoveryCodeHashes []string) error
+	DisableTwoFactor(ctx context.Context, userId int) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, recoveryCodeHashes []string) error
+	// UseRecoveryCode marks the recovery code as used, it returns false when the user has no unused code with the hash
+	UseRecoveryCode(ctx context.Context, userId int, codeHash string) (bool, error)
+	// UseTotpStep records the time step of an accepted totp code, it returns false when a code of the step or a later one was already used
+	UseTotpStep(ctx context.Context, userId int, step int64) (bool, error)
 	RemoveMultipleUsers(ctx context.Context, tx *sql.Tx, emails []string) error
 	Create(context.Context, *sql.Tx, *User, *UserRole) error
 	Verify(context.Context, *sql.Tx, *User) error
@@ -22,6 +36,15 @@ type Tokens interface {
 	Create(context.Context, *sql.Tx, *Token) error
 	Remove(context.Context, *Token) error
 	GetOne(ctx context.Context, value string, entityId int, tokenType TokenType) (*Token, error)
+	GetByValue(ctx context.Context, value string, tokenType TokenType) (*Token, error)
+	Rotate(ctx context.Context, current *Token, next *Token) error
+	RevokeFamily(ctx context.Context, familyId string) error
+	RevokeAllForEntity(ctx context.Context, entityId int, tokenType TokenType) error
+	IsFamilyActive(ctx context.Context, familyId string, entityId int) (bool, error)
+	// Replace removes the tokens of the same type of the entity and creates the token
+	Replace(ctx context.Context, token *Token) error
+	// Consume removes the token, ErrNoTokenFound is returned when it does not exist or was already consumed
+	Consume(ctx context.Context, value string, entityId int, tokenType TokenType) error
 }
 type Roles interface {
 	CreateDefaultRoles(ctx context.Context) ([]Role, error)
@@ -12,17 +12,24 @@ const (
 	PasswordResetTokenType TokenType = "PASSWORD_RESET"
 	AccessTokenType        TokenType = "ACCESS_TOKEN"
 	RefreshTokenType       TokenType = "REFRESH_TOKEN"
+	// issued after the password of a user with two factor authentication checks out, exchanged for a session with the second factor
+	TwoFactorChallengeTokenType TokenType = "TWO_FACTOR_CHALLENGE"
+	EmailOtpTokenType           TokenType = "EMAIL_OTP"
 )
 
 var (
 	ErrNoTokenFound error = errors.New("no token found")
+	// ErrTokenReused is returned when a refresh token that has already been rotated or revoked is presented again
+	ErrTokenReused error = errors.New("token has already been used")
 )
 
 type Token struct {
-	Id        int       `json:"id"`
-	EntityId  int       `json:"entityId"`
-	TokenType TokenType `json:"type"`
-	Value     string    `json:"value"`
-	ExpiresAt time.Time `json:"expiresAt"`
+	Id        int        `json:"id"`
+	EntityId  int        `json:"entityId"`
+	TokenType TokenType  `json:"type"`
+	Value     string     `json:"value"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	FamilyId  string     `json:"familyId,omitempty"`  // the login session a refresh token belongs to
+	RevokedAt *time.Time `json:"revokedAt,omitempty"` // set once a refresh token is rotated or revoked
 	Common
 }
@@ -2,6 +2,7 @@ package store
 
 import (
 	"errors"
+	"slices"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -25,9 +26,25 @@ type User struct {
 	IsVerified bool       `json:"isVerified"`
 	VerifiedAt *string    `json:"verifiedAt"`
 	Roles      []UserRole `json:"roles"`
+	// TwoFactorSecret is the totp secret, it is pending until the first code confirms the enrollment
+	TwoFactorSecret  string `json:"-"`
+	TwoFactorEnabled bool   `json:"twoFactorEnabled"`
 	Common
 }
 
+// TwoFactorRequiredRoles are the roles whose accounts can not login with a password alone
+var TwoFactorRequiredRoles = []DefaultRoleName{Admin, Vendor}
+
+// RequiresTwoFactor reports whether one of the active roles of the user requires two factor authentication
+func (u *User) RequiresTwoFactor() bool {
+	for _, role := range u.Roles {
+		if role.IsActive && slices.Contains(TwoFactorRequiredRoles, role.Name) {
+			return true
+		}
+	}
+	return false
+}
+
 type password struct {
 	Hash []byte
 }
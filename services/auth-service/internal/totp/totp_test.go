@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA1 key of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCodeMatchesRFC6238 checks the SHA1 test vectors of RFC 6238 appendix B, the 6 digit codes are the last 6 of the 8 digit ones listed
+func TestCodeMatchesRFC6238(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d is %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateAcceptsTheStepsAroundTheTime(t *testing.T) {
+	at := time.Unix(1111111109, 0)
+	step := Step(at)
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := Code(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matched, ok := Validate(rfcSecret, code, at); !ok || matched != step+offset {
+			t.Errorf("code of step %+d returned step %d and %v, want step %d", offset, matched, ok, step+offset)
+		}
+	}
+	code, err := Code(rfcSecret, step+Skew+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(rfcSecret, code, at); ok {
+		t.Errorf("code outside the skew was accepted")
+	}
+}
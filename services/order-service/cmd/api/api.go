@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/cache"
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/checkout"
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/repository"
 	"github.com/kaasikodes/shop-ease/shared/broker"
 	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
@@ -39,8 +41,11 @@ type application struct {
 	// message broker
 	broker broker.MessageBroker
 	store  repository.OrderRepo
+	// places orders, resuming and compensating them in the background
+	checkouts *checkout.Orchestrator
 	// jwt
-	jwt *jwttoken.JwtMaker
+	jwt      *jwttoken.JwtMaker
+	sessions *authz.SessionCache // whether the session of a token was revoked
 	//grpc clients
 	clients Clients
 	// cache
@@ -67,15 +72,24 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 
 	})
 
+	authorizer := authz.NewAuthorizer(app.unauthorizedErrorResponse, app.forbiddenResponse)
 	r.Route("/v1", func(r chi.Router) {
 		r.Use((app.authMiddleware))
-		r.Use(app.isCustomerActiveMiddleware)
 		r.Route("/order", func(r chi.Router) {
-			r.Get("/", app.getOrdersHandler)
-			r.Get("/{orderId}", app.getOrderByIdHandler)
-			r.Patch("/{orderId}/change-status", app.changeOrderStatusHandler)
-			r.Post("/", app.createOrderHandler)
-			r.Patch("/item/{orderItemId}/change-status", app.changeOrderItemStatusHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(authorizer.RequireRoles(authz.Customer)) // only users whose customer role is active
+				r.With(authorizer.RequirePermissions(authz.ReadOrder)).Get("/", app.getOrdersHandler)
+				r.With(authorizer.RequirePermissions(authz.ReadOrder)).Get("/{orderId}", app.getOrderByIdHandler)
+				r.With(authorizer.RequirePermissions(authz.CreateOrder)).Post("/", app.createOrderHandler)
+				r.With(authorizer.RequirePermissions(authz.ReadOrder)).Get("/checkouts/{checkoutId}", app.getCheckoutByIdHandler)
+			})
+			r.Group(func(r chi.Router) {
+				// vendors change the status of the items of their stores, admins of any order
+				r.Use(authorizer.RequireRoles(authz.Vendor, authz.Admin))
+				r.Use(authorizer.RequirePermissions(authz.UpdateOrder))
+				r.Patch("/{orderId}/change-status", app.changeOrderStatusHandler)
+				r.Patch("/item/{orderItemId}/change-status", app.changeOrderItemStatusHandler)
+			})
 
 		})
 
@@ -9,112 +9,10 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/kaasikodes/shop-ease/services/order-service/internal/cache"
-	"github.com/kaasikodes/shop-ease/shared/proto/auth"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"go.opentelemetry.io/otel/codes"
 )
 
-func (app *application) getUserWithReadThrough(ctx context.Context, id int) (*cache.UserInfo, error) {
-	// 1. In-memory
-	if info, err := app.cache.memory.GetUserInfo(ctx, id); err == nil {
-		app.logger.Info("from memory", info)
-		return info, nil
-	}
-
-	// 2. Redis
-	if info, err := app.cache.redis.GetUserInfo(ctx, id); err == nil {
-		go func() {
-			err := app.cache.memory.StoreUserInfo(context.Background(), *info) // populate in-memory
-			if err != nil {
-				app.logger.Error("failed to store in memory", err)
-
-			}
-
-		}()
-		app.logger.Info("from redis", info)
-		return info, nil
-	}
-
-	// 3. Get from auth client(the source)
-	user, err := app.clients.auth.GetUserById(ctx, &auth.GetUserByIdRequest{UserId: int32(id)})
-	if err != nil {
-		return nil, err
-	}
-	roles := make([]cache.Role, len(user.User.Roles))
-	for i, r := range user.User.Roles {
-		roles[i] = cache.Role{
-			Id:       int(r.Id),
-			IsActive: r.IsActive,
-			Name:     r.Name,
-		}
-	}
-	info := cache.UserInfo{
-		Id:    int(user.User.Id),
-		Name:  user.User.Name,
-		Email: user.User.Email,
-		Roles: roles,
-	}
-	app.logger.Info("from auth client", info)
-	go func() {
-		err = app.cache.redis.StoreUserInfo(context.Background(), info) // populate redis
-		if err != nil {
-			app.logger.Error("failed to store in Redis", err)
-
-		}
-		_ = app.cache.memory.StoreUserInfo(context.Background(), info) // populate in-memory
-		if err != nil {
-			app.logger.Error("failed to store in Memory", err)
-
-		}
-
-	}()
-	return &info, nil
-
-}
-func (app *application) isCustomerActiveMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		ctx, span := app.trace.Start(ctx, "Customer middleware")
-		defer span.End()
-		userId, ok := getUserIdFromContext(ctx)
-		if !ok {
-			err := errors.New("unable to retrieve userId")
-			app.logger.WithContext(ctx).Error("Unable to retrieve userId", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			app.badRequestResponse(w, r, err)
-			return
-		}
-
-		// get user from auth service
-		user, err := app.getUserWithReadThrough(ctx, userId)
-		if err != nil {
-			app.logger.WithContext(ctx).Error("err", err)
-			span.RecordError(err)
-			span.SetStatus(codes.Error, err.Error())
-			app.unauthorizedErrorResponse(w, r, fmt.Errorf("unable to retrieve client: %w", err))
-			return
-		}
-		userRoles := user.Roles
-		isCustomerActive := false
-		for _, role := range userRoles {
-			if role.IsActive && role.Name == "customer" {
-				isCustomerActive = true
-				break
-			}
-		}
-		app.logger.WithContext(ctx).Info("user info for customer", user)
-
-		if !isCustomerActive {
-			app.unauthorizedErrorResponse(w, r, errors.New("customer account is deactivated"))
-			return
-
-		}
-
-		// Step 5: Call next handler with the new context
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
 func (app *application) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -139,8 +37,22 @@ func (app *application) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Step 4: Add user and claims to context
+		// Step 3: Reject the token of a session that was logged out or revoked, the answer of the auth service is cached for a while
+		if err := app.sessions.Check(ctx, claims); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if errors.Is(err, authz.ErrSessionRevoked) {
+				app.unauthorizedErrorResponse(w, r, err)
+				return
+			}
+			app.logger.WithContext(ctx).Error("Error checking session", err)
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// Step 4: Add user and claims to context, the claims carry the roles the routes require
 		ctx = context.WithValue(ctx, ContextKeyUser{}, userId)
+		ctx = authz.WithClaims(ctx, claims)
 
 		// Step 5: Call next handler with the new context
 		next.ServeHTTP(w, r.WithContext(ctx))
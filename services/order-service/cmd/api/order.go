@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/go-chi/chi"
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"github.com/kaasikodes/shop-ease/shared/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 )
 
@@ -87,6 +93,26 @@ func (app *application) changeOrderStatusHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	order, err := app.store.GetOrderById(ctx, orderId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r, errors.New("order does not exist"))
+			return
+		}
+		app.logger.Error("GetOrderById failed", err)
+		app.internalServerError(w, r, err)
+		return
+	}
+	storeIds := make([]int, len(order.Items))
+	for i, item := range order.Items {
+		storeIds[i] = item.StoreId
+	}
+	// the status of the whole order is only changed by a vendor that owns every item of it
+	if !canChangeStatus(ctx, storeIds...) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
 	err = app.store.UpdateOrderStatus(ctx, orderId, model.OrderStatus(payload.Status))
 	if err != nil {
 		app.logger.Error("UpdateOrderStatus failed", err)
@@ -116,6 +142,21 @@ func (app *application) changeOrderItemStatusHandler(w http.ResponseWriter, r *h
 		return
 	}
 
+	storeId, err := app.store.GetOrderItemStoreId(ctx, orderItemId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFoundResponse(w, r, errors.New("order item does not exist"))
+			return
+		}
+		app.logger.Error("GetOrderItemStoreId failed", err)
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !canChangeStatus(ctx, storeId) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
 	err = app.store.UpdateOrderItemStatus(ctx, orderItemId, model.OrderStatus(payload.Status))
 	if err != nil {
 		app.logger.Error("UpdateOrderItemStatus failed", err)
@@ -127,6 +168,27 @@ func (app *application) changeOrderItemStatusHandler(w http.ResponseWriter, r *h
 
 }
 
+// canChangeStatus reports whether the user may change the status of items of the stores, admins may change any and vendors those of the stores in their token
+func canChangeStatus(ctx context.Context, storeIds ...int) bool {
+	claims, ok := authz.ClaimsFromContext(ctx)
+	if !ok {
+		return false
+	}
+	if slices.Contains(claims.Roles, authz.Admin) {
+		return true
+	}
+	if len(storeIds) == 0 {
+		return false
+	}
+	for _, storeId := range storeIds {
+		if !slices.Contains(claims.StoreIDs, storeId) {
+			return false
+		}
+	}
+	return true
+}
+
+// createOrderHandler places the order through a checkout, the items are priced by product-service and the customer pays with the payment url returned
 func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userId, ok := getUserIdFromContext(ctx)
@@ -140,7 +202,7 @@ func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Reques
 	app.logger.Info("userId", userId)
 
 	var body struct {
-		Items []repository.CreateOrderInputItem `json:"items" validate:"min=1,dive,required"`
+		Items []model.CheckoutItem `json:"items" validate:"min=1,dive,required"`
 	}
 
 	err := app.readJSON(w, r, &body)
@@ -149,19 +211,70 @@ func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	if err := Validate.Struct(body); err != nil {
-		app.logger.WithContext(ctx).Error("Error validating registration payload", err)
+		app.logger.WithContext(ctx).Error("Error validating order payload", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	orderId, err := app.store.CreateOrder(ctx, userId, body.Items)
+	checkout, err := app.checkouts.Start(ctx, userId, body.Items)
+	if err != nil && checkout == nil {
+		app.logger.WithContext(ctx).Error("Checkout failed", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err != nil {
+		// the checkout was saved and is resumed by the sweep, the customer follows it with the checkout id
+		app.logger.WithContext(ctx).Error("Checkout interrupted", err)
+		span.RecordError(err)
+		app.jsonResponse(w, http.StatusAccepted, "Order is being placed, please check the checkout for the payment link!", map[string]any{
+			"checkoutId": checkout.Id,
+			"status":     checkout.Status,
+			"itemCount":  len(body.Items),
+		})
+		return
+	}
+	span.SetAttributes(attribute.Int("checkoutId", checkout.Id), attribute.String("checkoutStatus", string(checkout.Status)))
+	if checkout.Status == model.CompensatedCheckoutStatus {
+		app.conflictResponse(w, r, fmt.Errorf("order could not be placed: %s", checkout.Error))
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, "Order created successfully, please use the payment link to pay for it!", map[string]any{
+		"orderId":    checkout.OrderId,
+		"checkoutId": checkout.Id,
+		"status":     checkout.Status,
+		"paymentUrl": checkout.PaymentUrl,
+		"expiresAt":  checkout.ExpiresAt,
+		"itemCount":  len(body.Items),
+	})
+
+}
+
+func (app *application) getCheckoutByIdHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := app.trace.Start(r.Context(), "http.order.getCheckoutById")
+	defer span.End()
+
+	id := utils.ParseInt(chi.URLParam(r, "checkoutId"))
+	if id == 0 {
+		app.badRequestResponse(w, r, errors.New("invalid checkout id"))
+		return
+	}
+
+	checkout, err := app.checkouts.GetCheckout(ctx, id)
 	if err != nil {
-		app.logger.Error("CreateOrder failed", err)
+		app.logger.Error("getCheckoutById failed", err)
 		app.internalServerError(w, r, err)
 		return
 	}
+	userId, _ := getUserIdFromContext(r.Context())
+	if checkout == nil || checkout.UserId != userId {
+		app.notFoundResponse(w, r, fmt.Errorf("checkout %d does not exist", id))
+		return
+	}
 
-	app.jsonResponse(w, http.StatusOK, "Order created successfully!", map[string]any{"orderId": orderId, "itemCount": len(body.Items)})
+	app.jsonResponse(w, http.StatusOK, "Checkout retrieved successfully!", checkout)
 
 }
@@ -0,0 +1,13 @@
+-- Outbox Events Table, written in the same transaction as the order and drained to the broker by the relay
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(200) NOT NULL,
+    event_type VARCHAR(200) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT now(),
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished ON outbox_events (id) WHERE published_at IS NULL;
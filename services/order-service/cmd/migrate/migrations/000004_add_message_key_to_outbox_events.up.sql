@@ -0,0 +1,2 @@
+-- partition key of the event, events of the same key are published to the same partition
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS message_key VARCHAR(200) NOT NULL DEFAULT '';
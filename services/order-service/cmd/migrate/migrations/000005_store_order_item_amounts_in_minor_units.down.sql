@@ -0,0 +1,5 @@
+ALTER TABLE order_items
+    ALTER COLUMN price TYPE NUMERIC(12, 2) USING price / 100.0,
+    ALTER COLUMN discount TYPE NUMERIC(12, 2) USING discount / 100.0,
+    ALTER COLUMN amount_to_be_paid TYPE NUMERIC(12, 2) USING amount_to_be_paid / 100.0;
+ALTER TABLE order_items DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,7 @@
+-- amounts are kept in the minor unit (kobo, cents) of the currency of the item
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'NGN';
+ALTER TABLE order_items
+    ALTER COLUMN price TYPE BIGINT USING ROUND(price * 100),
+    ALTER COLUMN discount TYPE BIGINT USING ROUND(COALESCE(discount, 0) * 100),
+    ALTER COLUMN amount_to_be_paid TYPE BIGINT USING ROUND(amount_to_be_paid * 100);
+ALTER TABLE order_items ALTER COLUMN discount SET DEFAULT 0;
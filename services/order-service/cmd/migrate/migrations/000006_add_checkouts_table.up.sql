@@ -0,0 +1,17 @@
+-- Checkouts are the persisted state of placing an order, so a checkout interrupted by a crash is resumed
+CREATE TABLE IF NOT EXISTS checkouts (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    order_id INT REFERENCES orders(id),
+    status VARCHAR(50) NOT NULL,
+    items JSONB NOT NULL,
+    transaction_id INT,
+    payment_url TEXT,
+    error TEXT,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_checkouts_order_id ON checkouts(order_id);
+CREATE INDEX IF NOT EXISTS idx_checkouts_status_updated_at ON checkouts(status, updated_at);
@@ -0,0 +1,482 @@
+// Package checkout places orders as a saga: the items are priced by product-service, saved as an order, their stock is reserved by vendor-service
+// and a payment is created by payment-service. A checkout that fails or is not paid in time is compensated by releasing the reservation and
+// canceling the order. Every step is saved so a checkout interrupted by a crash is resumed by the sweep
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/repository"
+	paymentmodel "github.com/kaasikodes/shop-ease/services/payment-service/pkg/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/proto/payment"
+	"github.com/kaasikodes/shop-ease/shared/proto/product"
+	"github.com/kaasikodes/shop-ease/shared/proto/vendor_service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultPaymentTimeout = time.Minute * 30
+	DefaultInterval       = time.Minute
+	DefaultStaleAfter     = time.Minute * 2
+	DefaultBatchSize      = 100
+)
+
+var ErrCheckoutNotFound = errors.New("checkout does not exist")
+
+type Config struct {
+	PaymentTimeout time.Duration // an order not paid for within this is canceled and its stock released
+	ReservationTTL time.Duration // vendor-service releases the stock after this if the checkout did not, twice the payment timeout by default as the payment window starts after the reservation
+	Interval       time.Duration // time between sweeps for the checkouts that were interrupted or have expired
+	StaleAfter     time.Duration // a checkout not updated for longer is assumed interrupted (e.g. the service stopped) and resumed
+	BatchSize      int           // checkouts resumed per sweep
+	Provider       string        // payment provider, payment-service picks one when empty
+}
+
+type Clients struct {
+	Product product.ProductServiceClient
+	Vendor  vendor_service.VendorServiceClient
+	Payment payment.PaymentServiceClient
+}
+
+type Orchestrator struct {
+	orders    repository.OrderRepo
+	checkouts repository.CheckoutRepo
+	clients   Clients
+	config    Config
+}
+
+func NewOrchestrator(orders repository.OrderRepo, checkouts repository.CheckoutRepo, clients Clients, config Config) *Orchestrator {
+	if config.PaymentTimeout <= 0 {
+		config.PaymentTimeout = DefaultPaymentTimeout
+	}
+	if config.ReservationTTL <= 0 {
+		config.ReservationTTL = config.PaymentTimeout * 2
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = DefaultStaleAfter
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	return &Orchestrator{orders: orders, checkouts: checkouts, clients: clients, config: config}
+}
+
+// failure is a step that cannot succeed by retrying it (e.g. a product is out of stock), the checkout is compensated
+type failure struct {
+	reason string
+}
+
+func (f *failure) Error() string {
+	return f.reason
+}
+
+// Start places the order of the items and returns the checkout once it is waiting for payment or has failed.
+// An error with a checkout means the checkout was interrupted, it is resumed by the sweep. An error without one means it was never saved
+func (o *Orchestrator) Start(ctx context.Context, userId int, items []model.CheckoutItem) (*model.Checkout, error) {
+	if len(items) == 0 {
+		return nil, errors.New("a checkout must have at least one item")
+	}
+	checkout, err := o.checkouts.CreateCheckout(ctx, userId, items, time.Now().Add(o.config.PaymentTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return o.advance(ctx, checkout)
+}
+
+func (o *Orchestrator) GetCheckout(ctx context.Context, checkoutId int) (*model.Checkout, error) {
+	return o.checkouts.GetCheckoutById(ctx, checkoutId)
+}
+
+// Run sweeps for the checkouts that were interrupted or have expired until the context is cancelled
+func (o *Orchestrator) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("shutting down the checkout sweep")
+			return
+		case <-ticker.C:
+			o.sweep(ctx)
+		}
+	}
+}
+
+func (o *Orchestrator) sweep(ctx context.Context) {
+	now := time.Now()
+	pending, err := o.checkouts.GetPendingCheckouts(ctx, now.Add(-o.config.StaleAfter), now, o.config.BatchSize)
+	if err != nil {
+		log.Printf("error getting pending checkouts: %v", err)
+		return
+	}
+	for i := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		checkout := &pending[i]
+		if checkout.ExpiresAt.Before(now) && compensable(checkout.Status) {
+			_, err = o.compensate(ctx, checkout, "checkout expired before the order was paid for")
+		} else {
+			_, err = o.advance(ctx, checkout)
+		}
+		if err != nil {
+			log.Printf("error resuming checkout %d (%s): %v", checkout.Id, checkout.Status, err)
+		}
+	}
+}
+
+// compensable is whether a checkout in the status can still be abandoned, once paid it can only be completed
+func compensable(status model.CheckoutStatus) bool {
+	switch status {
+	case model.StartedCheckoutStatus, model.OrderCreatedCheckoutStatus, model.InventoryReservedCheckoutStatus, model.AwaitingPaymentCheckoutStatus:
+		return true
+	}
+	return false
+}
+
+// advance runs the steps of the checkout from its current status until it waits for payment or is final
+func (o *Orchestrator) advance(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	for {
+		var err error
+		switch checkout.Status {
+		case model.StartedCheckoutStatus:
+			checkout, err = o.createOrder(ctx, checkout)
+		case model.OrderCreatedCheckoutStatus:
+			checkout, err = o.reserveInventory(ctx, checkout)
+		case model.InventoryReservedCheckoutStatus:
+			checkout, err = o.createPayment(ctx, checkout)
+		case model.PaymentReceivedCheckoutStatus:
+			checkout, err = o.complete(ctx, checkout)
+		case model.CompensatingCheckoutStatus:
+			checkout, err = o.release(ctx, checkout)
+		default: // awaiting payment, completed or compensated
+			return checkout, nil
+		}
+
+		var f *failure
+		if errors.As(err, &f) {
+			return o.compensate(ctx, checkout, f.reason)
+		}
+		if err != nil {
+			return checkout, err
+		}
+	}
+}
+
+// transition moves the checkout to the status, when the checkout was moved elsewhere (e.g. by a payment event) its current state is returned
+func (o *Orchestrator) transition(ctx context.Context, checkout *model.Checkout, to model.CheckoutStatus) (*model.Checkout, error) {
+	next := *checkout
+	next.Status = to
+	updated, err := o.checkouts.TransitionCheckout(ctx, &next, checkout.Status)
+	if err != nil {
+		return checkout, err
+	}
+	if !updated {
+		current, err := o.checkouts.GetCheckoutById(ctx, checkout.Id)
+		if err != nil {
+			return checkout, err
+		}
+		if current == nil {
+			return checkout, fmt.Errorf("%w: %d", ErrCheckoutNotFound, checkout.Id)
+		}
+		return current, nil
+	}
+	return &next, nil
+}
+
+// createOrder prices the items with product-service and saves them as an unpaid order
+func (o *Orchestrator) createOrder(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	productIds := make([]int64, len(checkout.Items))
+	for i, item := range checkout.Items {
+		productIds[i] = int64(item.ProductId)
+	}
+	res, err := o.clients.Product.GetProductPrices(ctx, &product.GetProductPricesRequest{ProductIds: productIds})
+	if err != nil {
+		return checkout, fmt.Errorf("error pricing the items: %w", err)
+	}
+	prices := make(map[int64]*product.ProductPrice, len(res.Prices))
+	for _, price := range res.Prices {
+		prices[price.ProductId] = price
+	}
+
+	items := make([]repository.CreateOrderInputItem, len(checkout.Items))
+	for i, item := range checkout.Items {
+		price, ok := prices[int64(item.ProductId)]
+		if !ok {
+			return checkout, &failure{fmt.Sprintf("product %d does not exist", item.ProductId)}
+		}
+		// the amounts of an order item are for its whole quantity
+		unit, payable := money.FromProto(price.Price), money.FromProto(price.Payable)
+		total, err := unit.Mul(int64(item.Quantity))
+		if err != nil {
+			return checkout, &failure{fmt.Sprintf("price of product %d: %v", item.ProductId, err)}
+		}
+		amountToBePaid, err := payable.Mul(int64(item.Quantity))
+		if err != nil {
+			return checkout, &failure{fmt.Sprintf("price of product %d: %v", item.ProductId, err)}
+		}
+		discount, err := total.Sub(amountToBePaid)
+		if err != nil {
+			return checkout, &failure{fmt.Sprintf("price of product %d: %v", item.ProductId, err)}
+		}
+		if i > 0 && !amountToBePaid.SameCurrency(items[0].AmountToBePaid) {
+			return checkout, &failure{fmt.Sprintf("%v: product %d is priced in %s", money.ErrCurrencyMismatch, item.ProductId, amountToBePaid.Currency)}
+		}
+		items[i] = repository.CreateOrderInputItem{
+			ProductId:      item.ProductId,
+			StoreId:        item.StoreId,
+			Quantity:       item.Quantity,
+			Price:          total,
+			Discount:       discount,
+			AmountToBePaid: amountToBePaid,
+		}
+	}
+
+	next, _, err := o.checkouts.CreateCheckoutOrder(ctx, checkout.Id, items)
+	if err != nil {
+		return checkout, err
+	}
+	return next, nil
+}
+
+// reserveInventory holds the stock of the order with vendor-service, reserving again for the same order returns the same reservation
+func (o *Orchestrator) reserveInventory(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	items := make([]*vendor_service.ReservationItem, len(checkout.Items))
+	for i, item := range checkout.Items {
+		items[i] = &vendor_service.ReservationItem{ProductId: int64(item.ProductId), StoreId: int64(item.StoreId), Quantity: int32(item.Quantity)}
+	}
+	_, err := o.clients.Vendor.ReserveInventory(ctx, &vendor_service.ReserveInventoryRequest{
+		OrderId:    int64(*checkout.OrderId),
+		Items:      items,
+		TtlSeconds: int64(o.config.ReservationTTL.Seconds()),
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.FailedPrecondition, codes.InvalidArgument, codes.Aborted:
+			return checkout, &failure{status.Convert(err).Message()}
+		}
+		return checkout, fmt.Errorf("error reserving inventory: %w", err)
+	}
+	return o.transition(ctx, checkout, model.InventoryReservedCheckoutStatus)
+}
+
+// createPayment creates the payment of the order with payment-service and starts the time the customer has to pay
+func (o *Orchestrator) createPayment(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	order, err := o.orders.GetOrderById(ctx, *checkout.OrderId)
+	if err != nil {
+		return checkout, err
+	}
+	if len(order.Items) == 0 {
+		return checkout, &failure{fmt.Sprintf("order %d has no items", order.Id)}
+	}
+	amount := money.New(0, order.Items[0].AmountToBePaid.Currency)
+	for _, item := range order.Items {
+		if amount, err = amount.Add(item.AmountToBePaid); err != nil {
+			return checkout, &failure{err.Error()}
+		}
+	}
+
+	// the key is the same every time the checkout is resumed, so payment-service returns the transaction it created if the checkout was interrupted after
+	res, err := o.clients.Payment.CreateTransaction(ctx, &payment.CreateTransactionRequest{
+		EntityId:          int64(order.Id),
+		EntityPaymentType: string(paymentmodel.EntityPaymentTypeOrderPayment),
+		Provider:          o.config.Provider,
+		Amount:            money.ToProto(amount),
+		MetaData: map[string]string{
+			"userId":                        strconv.Itoa(checkout.UserId),
+			"checkoutId":                    strconv.Itoa(checkout.Id),
+			paymentmodel.MetaIdempotencyKey: fmt.Sprintf("checkout-%d", checkout.Id),
+		},
+	})
+	if err != nil {
+		return checkout, fmt.Errorf("error creating payment: %w", err)
+	}
+
+	next := *checkout
+	next.Status = model.AwaitingPaymentCheckoutStatus
+	next.PaymentUrl = res.PaymentUrl
+	next.ExpiresAt = time.Now().Add(o.config.PaymentTimeout)
+	if res.Data != nil {
+		transactionId := int(res.Data.Id)
+		next.TransactionId = &transactionId
+	}
+	updated, err := o.checkouts.TransitionCheckout(ctx, &next, checkout.Status)
+	if err != nil {
+		return checkout, err
+	}
+	if !updated {
+		return o.reload(ctx, checkout)
+	}
+	return &next, nil
+}
+
+// complete takes the reserved stock out of the inventories and marks the order paid
+func (o *Orchestrator) complete(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	if _, err := o.clients.Vendor.CommitReservation(ctx, &vendor_service.ReservationRequest{OrderId: int64(*checkout.OrderId)}); err != nil {
+		switch status.Code(err) {
+		case codes.Aborted, codes.NotFound, codes.FailedPrecondition:
+			// the stock is no longer held for the order (e.g. the reservation expired before the payment arrived)
+			return o.abandonPaid(ctx, checkout, status.Convert(err).Message())
+		}
+		return checkout, fmt.Errorf("error committing reservation: %w", err)
+	}
+	if err := o.orders.UpdateOrderStatus(ctx, *checkout.OrderId, model.PaidOrderStatus); err != nil {
+		return checkout, err
+	}
+	return o.transition(ctx, checkout, model.CompletedCheckoutStatus)
+}
+
+// abandonPaid refunds the payment of a checkout that cannot be completed and compensates it
+func (o *Orchestrator) abandonPaid(ctx context.Context, checkout *model.Checkout, reason string) (*model.Checkout, error) {
+	if checkout.TransactionId != nil {
+		if err := o.refund(ctx, checkout, *checkout.TransactionId, "order could not be fulfilled: "+reason); err != nil {
+			return checkout, err
+		}
+	}
+	next := *checkout
+	next.Status = model.CompensatingCheckoutStatus
+	next.Error = reason
+	updated, err := o.checkouts.TransitionCheckout(ctx, &next, checkout.Status)
+	if err != nil {
+		return checkout, err
+	}
+	if !updated {
+		return o.reload(ctx, checkout)
+	}
+	return &next, nil
+}
+
+// compensate abandons the checkout, what was done is undone by release
+func (o *Orchestrator) compensate(ctx context.Context, checkout *model.Checkout, reason string) (*model.Checkout, error) {
+	if !compensable(checkout.Status) {
+		return checkout, nil
+	}
+	log.Printf("compensating checkout %d (%s): %s", checkout.Id, checkout.Status, reason)
+	next := *checkout
+	next.Status = model.CompensatingCheckoutStatus
+	next.Error = reason
+	if checkout.OrderId == nil {
+		// nothing was created, so there is nothing to undo
+		next.Status = model.CompensatedCheckoutStatus
+	}
+	updated, err := o.checkouts.TransitionCheckout(ctx, &next, checkout.Status)
+	if err != nil {
+		return checkout, err
+	}
+	if !updated {
+		current, err := o.reload(ctx, checkout)
+		if err != nil {
+			return checkout, err
+		}
+		if current.Status == checkout.Status {
+			return current, nil
+		}
+		// moved on since it was read (e.g. paid), compensate it from where it is if it still can be
+		if compensable(current.Status) {
+			return o.compensate(ctx, current, reason)
+		}
+		return o.advance(ctx, current)
+	}
+	return o.advance(ctx, &next)
+}
+
+// release returns the reserved stock and cancels the order of a compensating checkout
+func (o *Orchestrator) release(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	if _, err := o.clients.Vendor.ReleaseReservation(ctx, &vendor_service.ReservationRequest{OrderId: int64(*checkout.OrderId)}); err != nil {
+		return checkout, fmt.Errorf("error releasing reservation: %w", err)
+	}
+	if err := o.orders.UpdateOrderStatus(ctx, *checkout.OrderId, model.CancelledOrderStatus); err != nil {
+		return checkout, err
+	}
+	return o.transition(ctx, checkout, model.CompensatedCheckoutStatus)
+}
+
+func (o *Orchestrator) reload(ctx context.Context, checkout *model.Checkout) (*model.Checkout, error) {
+	current, err := o.checkouts.GetCheckoutById(ctx, checkout.Id)
+	if err != nil {
+		return checkout, err
+	}
+	if current == nil {
+		return checkout, fmt.Errorf("%w: %d", ErrCheckoutNotFound, checkout.Id)
+	}
+	return current, nil
+}
+
+// PaymentMade completes the checkout of the order. A payment that arrives after the checkout was abandoned, or a second payment of the order, is refunded
+func (o *Orchestrator) PaymentMade(ctx context.Context, orderId int, transactionId int) error {
+	checkout, err := o.checkouts.GetCheckoutByOrderId(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	if checkout == nil {
+		// not placed through a checkout
+		return o.orders.UpdateOrderStatus(ctx, orderId, model.PaidOrderStatus)
+	}
+
+	switch checkout.Status {
+	case model.OrderCreatedCheckoutStatus, model.InventoryReservedCheckoutStatus, model.AwaitingPaymentCheckoutStatus:
+		next := *checkout
+		next.Status = model.PaymentReceivedCheckoutStatus
+		next.TransactionId = &transactionId
+		updated, err := o.checkouts.TransitionCheckout(ctx, &next, checkout.Status)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			// compensated or paid meanwhile, handle the payment against where it is now
+			return o.PaymentMade(ctx, orderId, transactionId)
+		}
+		_, err = o.advance(ctx, &next)
+		return err
+	case model.PaymentReceivedCheckoutStatus, model.CompletedCheckoutStatus:
+		if checkout.TransactionId != nil && *checkout.TransactionId == transactionId {
+			_, err := o.advance(ctx, checkout)
+			return err
+		}
+		return o.refund(ctx, checkout, transactionId, "order was already paid for")
+	default: // compensating or compensated
+		return o.refund(ctx, checkout, transactionId, "order was canceled before it was paid for: "+checkout.Error)
+	}
+}
+
+// PaymentFailed abandons the checkout of the order when the payment it is waiting for fails
+func (o *Orchestrator) PaymentFailed(ctx context.Context, orderId int, transactionId int, reason string) error {
+	checkout, err := o.checkouts.GetCheckoutByOrderId(ctx, orderId)
+	if err != nil {
+		return err
+	}
+	if checkout == nil || checkout.Status != model.AwaitingPaymentCheckoutStatus {
+		return nil
+	}
+	if checkout.TransactionId != nil && *checkout.TransactionId != transactionId {
+		// not the payment the checkout is waiting for
+		return nil
+	}
+	if reason == "" {
+		reason = "payment failed"
+	}
+	_, err = o.compensate(ctx, checkout, reason)
+	return err
+}
+
+// refund returns a payment the checkout cannot keep, the key makes a redelivered event return the refund already created
+func (o *Orchestrator) refund(ctx context.Context, checkout *model.Checkout, transactionId int, reason string) error {
+	log.Printf("refunding transaction %d of checkout %d: %s", transactionId, checkout.Id, reason)
+	_, err := o.clients.Payment.RefundTransaction(ctx, &payment.RefundTransactionRequest{
+		TransactionId:  int64(transactionId),
+		IdempotencyKey: fmt.Sprintf("checkout-%d-%d", checkout.Id, transactionId),
+		Reason:         reason,
+	})
+	return err
+}
@@ -0,0 +1,501 @@
+package checkout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/repository"
+	paymentmodel "github.com/kaasikodes/shop-ease/services/payment-service/pkg/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/proto/payment"
+	"github.com/kaasikodes/shop-ease/shared/proto/product"
+	"github.com/kaasikodes/shop-ease/shared/proto/vendor_service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memoryOrders keeps the orders created by the checkouts, the methods the orchestrator does not use are left to the embedded nil repo
+type memoryOrders struct {
+	repository.OrderRepo
+
+	orders map[int]*model.Order
+}
+
+func (m *memoryOrders) GetOrderById(ctx context.Context, orderId int) (model.Order, error) {
+	return *m.orders[orderId], nil
+}
+
+func (m *memoryOrders) UpdateOrderStatus(ctx context.Context, orderId int, status model.OrderStatus) error {
+	if order, ok := m.orders[orderId]; ok {
+		order.Status = status
+		return nil
+	}
+	// orders not placed through a checkout
+	m.orders[orderId] = &model.Order{Id: orderId, Status: status}
+	return nil
+}
+
+// memoryCheckouts moves checkouts between statuses the way the sql repo does, only when they are still in the status they were read in
+type memoryCheckouts struct {
+	repository.CheckoutRepo
+
+	orders    *memoryOrders
+	checkouts map[int]*model.Checkout
+}
+
+func (m *memoryCheckouts) GetCheckoutById(ctx context.Context, checkoutId int) (*model.Checkout, error) {
+	checkout, ok := m.checkouts[checkoutId]
+	if !ok {
+		return nil, nil
+	}
+	current := *checkout
+	return &current, nil
+}
+
+func (m *memoryCheckouts) GetCheckoutByOrderId(ctx context.Context, orderId int) (*model.Checkout, error) {
+	for _, checkout := range m.checkouts {
+		if checkout.OrderId != nil && *checkout.OrderId == orderId {
+			current := *checkout
+			return &current, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryCheckouts) CreateCheckoutOrder(ctx context.Context, checkoutId int, items []repository.CreateOrderInputItem) (*model.Checkout, bool, error) {
+	checkout := m.checkouts[checkoutId]
+	if checkout.Status != model.StartedCheckoutStatus {
+		current := *checkout
+		return &current, false, nil
+	}
+	orderId := len(m.orders.orders) + 100
+	order := &model.Order{Id: orderId, UserId: checkout.UserId, Status: model.UnpaidOrPendingOrderStatus}
+	for _, item := range items {
+		order.Items = append(order.Items, model.OrderItem{ProductId: item.ProductId, StoreId: item.StoreId, Quantity: item.Quantity, Price: item.Price, Discount: item.Discount, AmountToBePaid: item.AmountToBePaid})
+	}
+	m.orders.orders[orderId] = order
+	checkout.OrderId = &orderId
+	checkout.Status = model.OrderCreatedCheckoutStatus
+	current := *checkout
+	return &current, true, nil
+}
+
+func (m *memoryCheckouts) TransitionCheckout(ctx context.Context, checkout *model.Checkout, from model.CheckoutStatus) (bool, error) {
+	if m.checkouts[checkout.Id].Status != from {
+		return false, nil
+	}
+	next := *checkout
+	m.checkouts[checkout.Id] = &next
+	return true, nil
+}
+
+// GetPendingCheckouts returns every checkout that is not final, the staleness is left to the sql repo
+func (m *memoryCheckouts) GetPendingCheckouts(ctx context.Context, staleBefore time.Time, now time.Time, limit int) ([]model.Checkout, error) {
+	var pending []model.Checkout
+	for _, checkout := range m.checkouts {
+		if checkout.Status != model.CompletedCheckoutStatus && checkout.Status != model.CompensatedCheckoutStatus {
+			pending = append(pending, *checkout)
+		}
+	}
+	return pending, nil
+}
+
+type fakeProduct struct {
+	product.ProductServiceClient
+
+	calls int
+}
+
+func (f *fakeProduct) GetProductPrices(ctx context.Context, in *product.GetProductPricesRequest, opts ...grpc.CallOption) (*product.ProductPriceList, error) {
+	f.calls++
+	var prices []*product.ProductPrice
+	for _, id := range in.ProductIds {
+		prices = append(prices, &product.ProductPrice{ProductId: id, Price: money.ToProto(money.New(50000, money.NGN)), Payable: money.ToProto(money.New(45000, money.NGN))})
+	}
+	return &product.ProductPriceList{Prices: prices}, nil
+}
+
+type fakeVendor struct {
+	vendor_service.VendorServiceClient
+
+	reserveErr, commitErr         error
+	reserved, committed, released int
+}
+
+func (f *fakeVendor) ReserveInventory(ctx context.Context, in *vendor_service.ReserveInventoryRequest, opts ...grpc.CallOption) (*vendor_service.Reservation, error) {
+	f.reserved++
+	if f.reserveErr != nil {
+		return nil, f.reserveErr
+	}
+	return &vendor_service.Reservation{OrderId: in.OrderId, Status: "held"}, nil
+}
+
+func (f *fakeVendor) CommitReservation(ctx context.Context, in *vendor_service.ReservationRequest, opts ...grpc.CallOption) (*vendor_service.Reservation, error) {
+	f.committed++
+	if f.commitErr != nil {
+		return nil, f.commitErr
+	}
+	return &vendor_service.Reservation{OrderId: in.OrderId, Status: "committed"}, nil
+}
+
+func (f *fakeVendor) ReleaseReservation(ctx context.Context, in *vendor_service.ReservationRequest, opts ...grpc.CallOption) (*vendor_service.Reservation, error) {
+	f.released++
+	return &vendor_service.Reservation{OrderId: in.OrderId, Status: "released"}, nil
+}
+
+type fakePayment struct {
+	payment.PaymentServiceClient
+
+	created []*payment.CreateTransactionRequest
+	refunds []*payment.RefundTransactionRequest
+}
+
+func (f *fakePayment) CreateTransaction(ctx context.Context, in *payment.CreateTransactionRequest, opts ...grpc.CallOption) (*payment.CreateTransactionResponse, error) {
+	f.created = append(f.created, in)
+	return &payment.CreateTransactionResponse{Data: &payment.Transaction{Id: 55, EntityId: in.EntityId}, PaymentUrl: "https://pay.example/55"}, nil
+}
+
+func (f *fakePayment) RefundTransaction(ctx context.Context, in *payment.RefundTransactionRequest, opts ...grpc.CallOption) (*payment.Refund, error) {
+	f.refunds = append(f.refunds, in)
+	return &payment.Refund{}, nil
+}
+
+type harness struct {
+	orchestrator *Orchestrator
+	orders       *memoryOrders
+	checkouts    *memoryCheckouts
+	product      *fakeProduct
+	vendor       *fakeVendor
+	payment      *fakePayment
+}
+
+func newHarness() *harness {
+	orders := &memoryOrders{orders: map[int]*model.Order{}}
+	h := &harness{
+		orders:    orders,
+		checkouts: &memoryCheckouts{orders: orders, checkouts: map[int]*model.Checkout{}},
+		product:   &fakeProduct{},
+		vendor:    &fakeVendor{},
+		payment:   &fakePayment{},
+	}
+	h.orchestrator = NewOrchestrator(h.orders, h.checkouts, Clients{Product: h.product, Vendor: h.vendor, Payment: h.payment}, Config{})
+	return h
+}
+
+// seed saves a checkout in the status with the order it has by then, as if an earlier run stopped there
+func (h *harness) seed(status model.CheckoutStatus, transactionId *int) *model.Checkout {
+	checkout := &model.Checkout{
+		Id:            1,
+		UserId:        7,
+		Status:        status,
+		Items:         []model.CheckoutItem{{ProductId: 3, StoreId: 4, Quantity: 2}},
+		TransactionId: transactionId,
+		ExpiresAt:     time.Now().Add(time.Minute * 10),
+	}
+	if status != model.StartedCheckoutStatus {
+		orderId := 100
+		checkout.OrderId = &orderId
+		h.orders.orders[orderId] = &model.Order{Id: orderId, UserId: 7, Status: model.UnpaidOrPendingOrderStatus, Items: []model.OrderItem{
+			{ProductId: 3, StoreId: 4, Quantity: 2, AmountToBePaid: money.New(90000, money.NGN)},
+		}}
+	}
+	h.checkouts.checkouts[checkout.Id] = checkout
+	current := *checkout
+	return &current
+}
+
+func (h *harness) status(t *testing.T) model.CheckoutStatus {
+	t.Helper()
+	return h.checkouts.checkouts[1].Status
+}
+
+func (h *harness) orderStatus(t *testing.T) model.OrderStatus {
+	t.Helper()
+	checkout := h.checkouts.checkouts[1]
+	if checkout.OrderId == nil {
+		return ""
+	}
+	return h.orders.orders[*checkout.OrderId].Status
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestAdvance(t *testing.T) {
+	for name, tc := range map[string]struct {
+		from          model.CheckoutStatus
+		transactionId *int
+		reserveErr    error
+		commitErr     error
+
+		wantErr         bool
+		wantStatus      model.CheckoutStatus
+		wantOrderStatus model.OrderStatus
+		wantPriced      int
+		wantReserved    int
+		wantPayments    int
+		wantCommitted   int
+		wantReleased    int
+		wantRefunds     int
+	}{
+		"started runs to awaiting payment": {
+			from:       model.StartedCheckoutStatus,
+			wantStatus: model.AwaitingPaymentCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+			wantPriced: 1, wantReserved: 1, wantPayments: 1,
+		},
+		"resumes after the order was created": {
+			from:       model.OrderCreatedCheckoutStatus,
+			wantStatus: model.AwaitingPaymentCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+			wantReserved: 1, wantPayments: 1,
+		},
+		"resumes after the stock was reserved": {
+			from:       model.InventoryReservedCheckoutStatus,
+			wantStatus: model.AwaitingPaymentCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+			wantPayments: 1,
+		},
+		"out of stock is compensated": {
+			from:       model.OrderCreatedCheckoutStatus,
+			reserveErr: status.Error(codes.FailedPrecondition, "product 3 is out of stock"),
+			wantStatus: model.CompensatedCheckoutStatus, wantOrderStatus: model.CancelledOrderStatus,
+			wantReserved: 1, wantReleased: 1,
+		},
+		"unavailable vendor-service is left for the sweep": {
+			from:       model.OrderCreatedCheckoutStatus,
+			reserveErr: status.Error(codes.Unavailable, "connection refused"),
+			wantErr:    true,
+			wantStatus: model.OrderCreatedCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+			wantReserved: 1,
+		},
+		"resumes a paid checkout to completion": {
+			from:          model.PaymentReceivedCheckoutStatus,
+			transactionId: intPtr(55),
+			wantStatus:    model.CompletedCheckoutStatus, wantOrderStatus: model.PaidOrderStatus,
+			wantCommitted: 1,
+		},
+		"paid checkout whose reservation expired is refunded": {
+			from:          model.PaymentReceivedCheckoutStatus,
+			transactionId: intPtr(55),
+			commitErr:     status.Error(codes.Aborted, "reservation of order 100 expired"),
+			wantStatus:    model.CompensatedCheckoutStatus, wantOrderStatus: model.CancelledOrderStatus,
+			wantCommitted: 1, wantReleased: 1, wantRefunds: 1,
+		},
+		"resumes compensating": {
+			from:       model.CompensatingCheckoutStatus,
+			wantStatus: model.CompensatedCheckoutStatus, wantOrderStatus: model.CancelledOrderStatus,
+			wantReleased: 1,
+		},
+		"awaiting payment is left waiting": {
+			from:          model.AwaitingPaymentCheckoutStatus,
+			transactionId: intPtr(55),
+			wantStatus:    model.AwaitingPaymentCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := newHarness()
+			h.vendor.reserveErr, h.vendor.commitErr = tc.reserveErr, tc.commitErr
+			checkout, err := h.orchestrator.advance(context.Background(), h.seed(tc.from, tc.transactionId))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("advance returned %v, want error %v", err, tc.wantErr)
+			}
+			if checkout.Status != tc.wantStatus || h.status(t) != tc.wantStatus {
+				t.Errorf("checkout is %s (saved %s), want %s", checkout.Status, h.status(t), tc.wantStatus)
+			}
+			if got := h.orderStatus(t); got != tc.wantOrderStatus {
+				t.Errorf("order is %s, want %s", got, tc.wantOrderStatus)
+			}
+			calls := map[string][2]int{
+				"pricing":     {h.product.calls, tc.wantPriced},
+				"reservation": {h.vendor.reserved, tc.wantReserved},
+				"payment":     {len(h.payment.created), tc.wantPayments},
+				"commit":      {h.vendor.committed, tc.wantCommitted},
+				"release":     {h.vendor.released, tc.wantReleased},
+				"refund":      {len(h.payment.refunds), tc.wantRefunds},
+			}
+			for call, counts := range calls {
+				if counts[0] != counts[1] {
+					t.Errorf("%s was called %d times, want %d", call, counts[0], counts[1])
+				}
+			}
+		})
+	}
+}
+
+func TestAdvanceCreatesThePaymentWithTheKeyOfTheCheckout(t *testing.T) {
+	h := newHarness()
+	checkout, err := h.orchestrator.advance(context.Background(), h.seed(model.InventoryReservedCheckoutStatus, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.payment.created) != 1 {
+		t.Fatalf("%d payments were created, want 1", len(h.payment.created))
+	}
+	created := h.payment.created[0]
+	if created.MetaData[paymentmodel.MetaIdempotencyKey] != "checkout-1" {
+		t.Errorf("payment metadata %v does not have the key of checkout 1, a resumed checkout would pay twice", created.MetaData)
+	}
+	if amount := money.FromProto(created.Amount); amount != money.New(90000, money.NGN) {
+		t.Errorf("payment of %s, want the 900 NGN of the order", amount)
+	}
+	if checkout.TransactionId == nil || *checkout.TransactionId != 55 || checkout.PaymentUrl == "" {
+		t.Errorf("checkout %+v does not have the payment that was created", checkout)
+	}
+}
+
+func TestPaymentMade(t *testing.T) {
+	for name, tc := range map[string]struct {
+		from          model.CheckoutStatus
+		transactionId *int
+		paid          int
+
+		wantStatus      model.CheckoutStatus
+		wantOrderStatus model.OrderStatus
+		wantCommitted   int
+		wantRefunded    []int
+	}{
+		"payment of an awaiting checkout completes it": {
+			from: model.AwaitingPaymentCheckoutStatus, transactionId: intPtr(55), paid: 55,
+			wantStatus: model.CompletedCheckoutStatus, wantOrderStatus: model.PaidOrderStatus, wantCommitted: 1,
+		},
+		"payment arriving before the checkout saved it is kept": {
+			from: model.InventoryReservedCheckoutStatus, paid: 55,
+			wantStatus: model.CompletedCheckoutStatus, wantOrderStatus: model.PaidOrderStatus, wantCommitted: 1,
+		},
+		"redelivered payment of a completed checkout is ignored": {
+			from: model.CompletedCheckoutStatus, transactionId: intPtr(55), paid: 55,
+			wantStatus: model.CompletedCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+		},
+		"duplicate payment of a completed checkout is refunded": {
+			from: model.CompletedCheckoutStatus, transactionId: intPtr(55), paid: 56,
+			wantStatus: model.CompletedCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus, wantRefunded: []int{56},
+		},
+		"late payment of a compensated checkout is refunded": {
+			from: model.CompensatedCheckoutStatus, transactionId: intPtr(55), paid: 55,
+			wantStatus: model.CompensatedCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus, wantRefunded: []int{55},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := newHarness()
+			h.seed(tc.from, tc.transactionId)
+			if err := h.orchestrator.PaymentMade(context.Background(), 100, tc.paid); err != nil {
+				t.Fatal(err)
+			}
+			if got := h.status(t); got != tc.wantStatus {
+				t.Errorf("checkout is %s, want %s", got, tc.wantStatus)
+			}
+			if got := h.orderStatus(t); got != tc.wantOrderStatus {
+				t.Errorf("order is %s, want %s", got, tc.wantOrderStatus)
+			}
+			if h.vendor.committed != tc.wantCommitted {
+				t.Errorf("reservation was committed %d times, want %d", h.vendor.committed, tc.wantCommitted)
+			}
+			if len(h.payment.refunds) != len(tc.wantRefunded) {
+				t.Fatalf("got %d refunds, want transactions %v refunded", len(h.payment.refunds), tc.wantRefunded)
+			}
+			for i, refund := range h.payment.refunds {
+				if refund.TransactionId != int64(tc.wantRefunded[i]) {
+					t.Errorf("refunded transaction %d, want %d", refund.TransactionId, tc.wantRefunded[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentMadeOfAnOrderWithoutACheckoutMarksItPaid(t *testing.T) {
+	h := newHarness()
+	if err := h.orchestrator.PaymentMade(context.Background(), 300, 55); err != nil {
+		t.Fatal(err)
+	}
+	if order := h.orders.orders[300]; order == nil || order.Status != model.PaidOrderStatus {
+		t.Errorf("order 300 is %+v, want it paid", order)
+	}
+}
+
+func TestPaymentFailed(t *testing.T) {
+	for name, tc := range map[string]struct {
+		from       model.CheckoutStatus
+		failed     int
+		wantStatus model.CheckoutStatus
+	}{
+		"failure of the awaited payment compensates": {from: model.AwaitingPaymentCheckoutStatus, failed: 55, wantStatus: model.CompensatedCheckoutStatus},
+		"failure of another payment is ignored":      {from: model.AwaitingPaymentCheckoutStatus, failed: 56, wantStatus: model.AwaitingPaymentCheckoutStatus},
+		"failure after the checkout was paid":        {from: model.CompletedCheckoutStatus, failed: 55, wantStatus: model.CompletedCheckoutStatus},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := newHarness()
+			h.seed(tc.from, intPtr(55))
+			if err := h.orchestrator.PaymentFailed(context.Background(), 100, tc.failed, "card declined"); err != nil {
+				t.Fatal(err)
+			}
+			if got := h.status(t); got != tc.wantStatus {
+				t.Errorf("checkout is %s, want %s", got, tc.wantStatus)
+			}
+			if tc.wantStatus == model.CompensatedCheckoutStatus && h.checkouts.checkouts[1].Error != "card declined" {
+				t.Errorf("checkout error is %q, want the reason of the failure", h.checkouts.checkouts[1].Error)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	for name, tc := range map[string]struct {
+		from            model.CheckoutStatus
+		expired         bool
+		wantStatus      model.CheckoutStatus
+		wantOrderStatus model.OrderStatus
+	}{
+		"expired awaiting payment is compensated": {
+			from: model.AwaitingPaymentCheckoutStatus, expired: true,
+			wantStatus: model.CompensatedCheckoutStatus, wantOrderStatus: model.CancelledOrderStatus,
+		},
+		"interrupted checkout is resumed": {
+			from:       model.InventoryReservedCheckoutStatus,
+			wantStatus: model.AwaitingPaymentCheckoutStatus, wantOrderStatus: model.UnpaidOrPendingOrderStatus,
+		},
+		"expired paid checkout is completed rather than compensated": {
+			from: model.PaymentReceivedCheckoutStatus, expired: true,
+			wantStatus: model.CompletedCheckoutStatus, wantOrderStatus: model.PaidOrderStatus,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := newHarness()
+			h.seed(tc.from, intPtr(55))
+			if tc.expired {
+				h.checkouts.checkouts[1].ExpiresAt = time.Now().Add(-time.Minute)
+			}
+			h.orchestrator.sweep(context.Background())
+			if got := h.status(t); got != tc.wantStatus {
+				t.Errorf("checkout is %s, want %s", got, tc.wantStatus)
+			}
+			if got := h.orderStatus(t); got != tc.wantOrderStatus {
+				t.Errorf("order is %s, want %s", got, tc.wantOrderStatus)
+			}
+		})
+	}
+}
+
+func TestPaymentAfterExpiryIsRefunded(t *testing.T) {
+	h := newHarness()
+	h.seed(model.AwaitingPaymentCheckoutStatus, intPtr(55))
+	h.checkouts.checkouts[1].ExpiresAt = time.Now().Add(-time.Minute)
+	h.orchestrator.sweep(context.Background())
+	if got := h.status(t); got != model.CompensatedCheckoutStatus {
+		t.Fatalf("expired checkout is %s, want it compensated", got)
+	}
+
+	if err := h.orchestrator.PaymentMade(context.Background(), 100, 55); err != nil {
+		t.Fatal(err)
+	}
+	if h.vendor.committed != 0 {
+		t.Errorf("released reservation was committed")
+	}
+	if len(h.payment.refunds) != 1 || h.payment.refunds[0].TransactionId != 55 || h.payment.refunds[0].IdempotencyKey != "checkout-1-55" {
+		t.Errorf("got refunds %v, want transaction 55 refunded once", h.payment.refunds)
+	}
+	if got := h.orderStatus(t); got != model.CancelledOrderStatus {
+		t.Errorf("order is %s, want it left cancelled", got)
+	}
+}
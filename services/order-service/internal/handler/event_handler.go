@@ -2,47 +2,40 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"log"
-	"strings"
 
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/checkout"
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/repository"
 	"github.com/kaasikodes/shop-ease/shared/events"
 )
 
-type EventPayload struct {
-	Event string          `json:"event"`
-	Data  json.RawMessage `json:"data"`
-}
-type EventVendorAcceptedOrderItemPayload struct {
-	OrderItemId int `json:"orderItemId"`
-}
 type EventHandler struct {
-	store repository.OrderRepo
+	store     repository.OrderRepo
+	checkouts *checkout.Orchestrator
 }
 
-func InitEventHandler(store repository.OrderRepo) *EventHandler {
+func InitEventHandler(store repository.OrderRepo, checkouts *checkout.Orchestrator) *EventHandler {
 
 	return &EventHandler{
 		store,
+		checkouts,
 	}
 
 }
 
-func (p *EventHandler) HandleVendorEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+func (p *EventHandler) HandleVendorEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.VendorAcceptedOrderItem:
-		return p.vendorAccepetedOrderItem(msg)
+	switch payload := data.(type) {
+	case *events.VendorAcceptedOrderItemPayload:
+		return p.vendorAccepetedOrderItem(ctx, payload)
 	default:
-		log.Printf("unhandled event type: %s", event.Event)
+		log.Printf("unhandled event type: %s", envelope.Type)
 
 	}
 
@@ -50,14 +43,40 @@ func (p *EventHandler) HandleVendorEvents(msg []byte) error {
 
 }
 
-func (p *EventHandler) vendorAccepetedOrderItem(msg []byte) error {
-	var payload EventVendorAcceptedOrderItemPayload
-	if err := json.Unmarshal(msg, &payload); err != nil {
-		log.Printf("an error occured while unmarshaling the event payload: %v", err)
-		return err
-	}
-	ctx := context.Background()
+func (p *EventHandler) vendorAccepetedOrderItem(ctx context.Context, payload *events.VendorAcceptedOrderItemPayload) error {
 	err := p.store.UpdateOrderItemStatus(ctx, payload.OrderItemId, model.ProcessingOrderStatus)
 	return err
 
 }
+
+func (p *EventHandler) HandlePaymentEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
+		return err
+	}
+
+	switch payload := data.(type) {
+	case *events.OrderRefundedPayload:
+		return p.orderRefunded(ctx, payload)
+	case *events.OrderPaymentMadePayload:
+		return p.checkouts.PaymentMade(ctx, payload.OrderId, payload.TransactionId)
+	case *events.OrderPaymentFailedPayload:
+		return p.checkouts.PaymentFailed(ctx, payload.OrderId, payload.TransactionId, payload.Reason)
+	default:
+		log.Printf("unhandled event type: %s", envelope.Type)
+
+	}
+
+	return nil
+
+}
+
+func (p *EventHandler) orderRefunded(ctx context.Context, payload *events.OrderRefundedPayload) error {
+	orderItemIds := make([]int, len(payload.Items))
+	for i, item := range payload.Items {
+		orderItemIds[i] = item.OrderItemId
+	}
+	return p.store.RefundOrder(ctx, payload.OrderId, orderItemIds, payload.FullRefund)
+
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/kaasikodes/shop-ease/shared/logger"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
@@ -91,12 +92,16 @@ func (h *OrderGrpcHandler) GetOrderById(ctx context.Context, req *order.GetOrder
 	var items []*order.OrderItem
 	for _, item := range ord.Items {
 		items = append(items, &order.OrderItem{
-			Id:        int32(item.Id),
-			ProductId: int32(item.ProductId),
-			StoreId:   int32(item.StoreId),
-			Quantity:  int32(item.Quantity),
-			CreatedAt: item.CreatedAt.String(),
-			UpdatedAt: item.UpdatedAt.String(),
+			Id:             int32(item.Id),
+			ProductId:      int32(item.ProductId),
+			StoreId:        int32(item.StoreId),
+			Quantity:       int32(item.Quantity),
+			Status:         string(item.Status),
+			CreatedAt:      item.CreatedAt.String(),
+			UpdatedAt:      item.UpdatedAt.String(),
+			Price:          money.ToProto(item.Price),
+			Discount:       money.ToProto(item.Discount),
+			AmountToBePaid: money.ToProto(item.AmountToBePaid),
 		})
 	}
 
@@ -3,18 +3,21 @@ package model
 import (
 	"time"
 
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/types"
 )
 
 type OrderStatus string
 
 var (
-	UnpaidOrPendingOrderStatus OrderStatus = "pending/unpaid"
-	PaidOrderStatus            OrderStatus = "paid"
-	ProcessingOrderStatus      OrderStatus = "processing"
-	DeliveredOrderStatus       OrderStatus = "delivered"
-	FulfilledOrderStatus       OrderStatus = "fulfilled"
-	CancelledOrderStatus       OrderStatus = "canceled"
+	UnpaidOrPendingOrderStatus   OrderStatus = "pending/unpaid"
+	PaidOrderStatus              OrderStatus = "paid"
+	ProcessingOrderStatus        OrderStatus = "processing"
+	DeliveredOrderStatus         OrderStatus = "delivered"
+	FulfilledOrderStatus         OrderStatus = "fulfilled"
+	CancelledOrderStatus         OrderStatus = "canceled"
+	RefundedOrderStatus          OrderStatus = "refunded"
+	PartiallyRefundedOrderStatus OrderStatus = "partially_refunded"
 )
 
 type OrderListItem struct {
@@ -48,8 +51,42 @@ type OrderItem struct {
 	ProductId      int
 	StoreId        int
 	Quantity       int
-	Price          float64
-	Discount       float64
-	AmountToBePaid float64
+	Price          money.Money
+	Discount       money.Money
+	AmountToBePaid money.Money
+	types.Common
+}
+
+type CheckoutStatus string
+
+var (
+	StartedCheckoutStatus           CheckoutStatus = "started"
+	OrderCreatedCheckoutStatus      CheckoutStatus = "order_created"      // priced and saved as an unpaid order
+	InventoryReservedCheckoutStatus CheckoutStatus = "inventory_reserved" // stock held by vendor-service
+	AwaitingPaymentCheckoutStatus   CheckoutStatus = "awaiting_payment"   // payment created, waiting for the customer to pay
+	PaymentReceivedCheckoutStatus   CheckoutStatus = "payment_received"   // paid, the reservation is being committed
+	CompletedCheckoutStatus         CheckoutStatus = "completed"
+	CompensatingCheckoutStatus      CheckoutStatus = "compensating" // failed or timed out, the reservation is being released and the order canceled
+	CompensatedCheckoutStatus       CheckoutStatus = "compensated"
+)
+
+type CheckoutItem struct {
+	ProductId int `json:"productId" validate:"required"`
+	StoreId   int `json:"storeId" validate:"required"`
+	Quantity  int `json:"quantity" validate:"required,min=1"`
+}
+
+// Checkout is the state of placing an order, it is saved after every step so it can be resumed after a crash
+type Checkout struct {
+	Id            int
+	UserId        int
+	OrderId       *int // set once the order is created
+	Status        CheckoutStatus
+	Items         []CheckoutItem
+	TransactionId *int // id of the payment-service transaction the order is paid with
+	PaymentUrl    string
+	Error         string // why the checkout was compensated
+	ExpiresAt     time.Time
+
 	types.Common
 }
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
+)
+
+const checkoutColumns = `id, user_id, order_id, status, items, transaction_id, COALESCE(payment_url, ''), COALESCE(error, ''), expires_at, created_at, updated_at`
+
+type PostgresCheckoutRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresCheckoutRepo(db *sql.DB) *PostgresCheckoutRepo {
+	return &PostgresCheckoutRepo{db}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCheckout(row rowScanner) (*model.Checkout, error) {
+	var (
+		checkout      model.Checkout
+		orderId       sql.NullInt64
+		transactionId sql.NullInt64
+		items         []byte
+	)
+	err := row.Scan(
+		&checkout.Id,
+		&checkout.UserId,
+		&orderId,
+		&checkout.Status,
+		&items,
+		&transactionId,
+		&checkout.PaymentUrl,
+		&checkout.Error,
+		&checkout.ExpiresAt,
+		&checkout.CreatedAt,
+		&checkout.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(items, &checkout.Items); err != nil {
+		return nil, fmt.Errorf("error decoding items of checkout %d: %w", checkout.Id, err)
+	}
+	if orderId.Valid {
+		id := int(orderId.Int64)
+		checkout.OrderId = &id
+	}
+	if transactionId.Valid {
+		id := int(transactionId.Int64)
+		checkout.TransactionId = &id
+	}
+	return &checkout, nil
+}
+
+func (r *PostgresCheckoutRepo) getCheckout(ctx context.Context, query string, args ...any) (*model.Checkout, error) {
+	checkout, err := scanCheckout(r.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return checkout, err
+}
+
+func (r *PostgresCheckoutRepo) CreateCheckout(ctx context.Context, userId int, items []model.CheckoutItem, expiresAt time.Time) (*model.Checkout, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	return scanCheckout(r.db.QueryRowContext(ctx, `
+		INSERT INTO checkouts (user_id, status, items, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING `+checkoutColumns,
+		userId, model.StartedCheckoutStatus, data, expiresAt,
+	))
+}
+
+func (r *PostgresCheckoutRepo) GetCheckoutById(ctx context.Context, checkoutId int) (*model.Checkout, error) {
+	return r.getCheckout(ctx, `SELECT `+checkoutColumns+` FROM checkouts WHERE id = $1`, checkoutId)
+}
+
+func (r *PostgresCheckoutRepo) GetCheckoutByOrderId(ctx context.Context, orderId int) (*model.Checkout, error) {
+	return r.getCheckout(ctx, `SELECT `+checkoutColumns+` FROM checkouts WHERE order_id = $1`, orderId)
+}
+
+func (r *PostgresCheckoutRepo) CreateCheckoutOrder(ctx context.Context, checkoutId int, items []CreateOrderInputItem) (*model.Checkout, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// the lock stops a resumed checkout from creating a second order
+	checkout, err := scanCheckout(tx.QueryRowContext(ctx, `SELECT `+checkoutColumns+` FROM checkouts WHERE id = $1 FOR UPDATE`, checkoutId))
+	if err == sql.ErrNoRows {
+		return nil, false, fmt.Errorf("checkout %d does not exist", checkoutId)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if checkout.Status != model.StartedCheckoutStatus {
+		return checkout, false, nil
+	}
+
+	orderId, err := InsertOrder(ctx, tx, checkout.UserId, items)
+	if err != nil {
+		return nil, false, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE checkouts SET order_id = $1, status = $2, updated_at = NOW() WHERE id = $3`, orderId, model.OrderCreatedCheckoutStatus, checkoutId)
+	if err != nil {
+		return nil, false, err
+	}
+	checkout.OrderId = &orderId
+	checkout.Status = model.OrderCreatedCheckoutStatus
+
+	return checkout, true, tx.Commit()
+}
+
+func (r *PostgresCheckoutRepo) TransitionCheckout(ctx context.Context, checkout *model.Checkout, from model.CheckoutStatus) (bool, error) {
+	var transactionId *int64
+	if checkout.TransactionId != nil {
+		id := int64(*checkout.TransactionId)
+		transactionId = &id
+	}
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE checkouts
+		SET status = $1, transaction_id = $2, payment_url = $3, error = $4, expires_at = $5, updated_at = NOW()
+		WHERE id = $6 AND status = $7
+	`, checkout.Status, transactionId, checkout.PaymentUrl, checkout.Error, checkout.ExpiresAt, checkout.Id, from)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *PostgresCheckoutRepo) GetPendingCheckouts(ctx context.Context, staleBefore time.Time, now time.Time, limit int) ([]model.Checkout, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+checkoutColumns+`
+		FROM checkouts
+		WHERE status NOT IN ($1, $2) AND ((status <> $3 AND updated_at < $4) OR expires_at < $5)
+		ORDER BY updated_at ASC
+		LIMIT $6
+	`, model.CompletedCheckoutStatus, model.CompensatedCheckoutStatus, model.AwaitingPaymentCheckoutStatus, staleBefore, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkouts []model.Checkout
+	for rows.Next() {
+		checkout, err := scanCheckout(rows)
+		if err != nil {
+			return nil, err
+		}
+		checkouts = append(checkouts, *checkout)
+	}
+	return checkouts, rows.Err()
+}
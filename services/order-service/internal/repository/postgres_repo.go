@@ -4,13 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/outbox"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 )
 
+const eventProducer = "order-service"
+
 type PostgresOrderRepo struct {
 	db *sql.DB
 }
@@ -26,29 +32,69 @@ func (r *PostgresOrderRepo) CreateOrder(ctx context.Context, userId int, items [
 	}
 	defer tx.Rollback()
 
+	orderId, err := InsertOrder(ctx, tx, userId, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return &orderId, tx.Commit()
+}
+
+// InsertOrder saves the order with its items and its order created event in the transaction, so the order can be created along with other records
+func InsertOrder(ctx context.Context, tx *sql.Tx, userId int, items []CreateOrderInputItem) (int, error) {
+	if len(items) == 0 {
+		return 0, fmt.Errorf("an order must have at least one item")
+	}
+
 	// Insert Order
 	var orderId int
-	err = tx.QueryRowContext(ctx, `
+	err := tx.QueryRowContext(ctx, `
 		INSERT INTO orders (user_id, status, is_paid, is_canceled, created_at, updated_at)
 		VALUES ($1, $2, false, false, NOW(), NOW())
 		RETURNING id
 	`, userId, string(model.UnpaidOrPendingOrderStatus)).Scan(&orderId)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	// Insert Order Items
+	payload := events.OrderCreatedPayload{OrderId: orderId, UserId: userId, Amount: money.New(0, items[0].AmountToBePaid.Currency)}
 	for _, item := range items {
-		_, err := tx.ExecContext(ctx, `
-			INSERT INTO order_items (order_id, product_id, store_id, price, quantity,amount_to_be_paid, created_at, updated_at, status)
-			VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), $7)
-		`, orderId, item.ProductId, item.StoreId, item.Price, item.Quantity, item.AmountToBePaid, model.UnpaidOrPendingOrderStatus)
+		// the amounts of an item are in the currency it is paid in
+		if !item.AmountToBePaid.SameCurrency(item.Price) || !item.AmountToBePaid.SameCurrency(item.Discount) {
+			return 0, fmt.Errorf("%w: the price, discount and amount of product %d", money.ErrCurrencyMismatch, item.ProductId)
+		}
+		var orderItemId int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, store_id, price, discount, quantity, amount_to_be_paid, currency, created_at, updated_at, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW(), $9)
+			RETURNING id
+		`, orderId, item.ProductId, item.StoreId, item.Price.Amount, item.Discount.Amount, item.Quantity, item.AmountToBePaid.Amount, item.AmountToBePaid.Currency, model.UnpaidOrPendingOrderStatus).Scan(&orderItemId)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
+		if payload.Amount, err = payload.Amount.Add(item.AmountToBePaid); err != nil {
+			return 0, err
+		}
+		payload.Items = append(payload.Items, events.OrderCreatedItem{
+			OrderItemId:    orderItemId,
+			ProductId:      item.ProductId,
+			StoreId:        item.StoreId,
+			Quantity:       item.Quantity,
+			AmountToBePaid: item.AmountToBePaid,
+		})
 	}
 
-	return &orderId, tx.Commit()
+	// record the event in the same transaction, so it is only published if the order is saved
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.OrderCreated, payload)
+	if err != nil {
+		return 0, err
+	}
+	if err := outbox.Enqueue(ctx, tx, outbox.Postgres, events.OrderTopic, strconv.Itoa(orderId), envelope); err != nil {
+		return 0, err
+	}
+
+	return orderId, nil
 }
 
 func (r *PostgresOrderRepo) UpdateOrderStatus(ctx context.Context, orderId int, status model.OrderStatus) error {
@@ -95,7 +141,7 @@ func (r *PostgresOrderRepo) GetOrderById(ctx context.Context, orderId int) (mode
 	}
 
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, product_id, store_id, quantity, created_at, updated_at
+		SELECT id, status, product_id, store_id, quantity, price, COALESCE(discount, 0), amount_to_be_paid, currency, created_at, updated_at
 		FROM order_items
 		WHERE order_id = $1
 	`, orderId)
@@ -108,21 +154,34 @@ func (r *PostgresOrderRepo) GetOrderById(ctx context.Context, orderId int) (mode
 		var item model.OrderItem
 		err := rows.Scan(
 			&item.Id,
+			&item.Status,
 			&item.ProductId,
 			&item.StoreId,
 			&item.Quantity,
+			&item.Price.Amount,
+			&item.Discount.Amount,
+			&item.AmountToBePaid.Amount,
+			&item.AmountToBePaid.Currency,
 			&item.CreatedAt,
 			&item.UpdatedAt,
 		)
 		if err != nil {
 			return order, err
 		}
+		item.Price.Currency = item.AmountToBePaid.Currency
+		item.Discount.Currency = item.AmountToBePaid.Currency
 		order.Items = append(order.Items, item)
 	}
 
 	return order, nil
 }
 
+func (r *PostgresOrderRepo) GetOrderItemStoreId(ctx context.Context, orderItemId int) (int, error) {
+	var storeId int
+	err := r.db.QueryRowContext(ctx, `SELECT store_id FROM order_items WHERE id = $1`, orderItemId).Scan(&storeId)
+	return storeId, err
+}
+
 func (r *PostgresOrderRepo) GetOrders(ctx context.Context, pagination *utils.PaginationPayload, filter *OrderFilter) (result []model.OrderListItem, total int, err error) {
 	var (
 		args       []interface{}
@@ -225,3 +284,38 @@ func (r *PostgresOrderRepo) UpdateOrderItemStatus(ctx context.Context, orderItem
 	_, err := r.db.ExecContext(ctx, query, status, orderItemId)
 	return err
 }
+
+// RefundOrder marks the refunded items, and the order as refunded once all it was paid has been returned (partially refunded until then)
+func (r *PostgresOrderRepo) RefundOrder(ctx context.Context, orderId int, orderItemIds []int, fullRefund bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if fullRefund {
+		_, err = tx.ExecContext(ctx, `UPDATE order_items SET status = $1, updated_at = NOW() WHERE order_id = $2`, model.RefundedOrderStatus, orderId)
+	} else if len(orderItemIds) > 0 {
+		args := []interface{}{model.RefundedOrderStatus, orderId}
+		placeholders := make([]string, len(orderItemIds))
+		for i, id := range orderItemIds {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", i+3)
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE order_items SET status = $1, updated_at = NOW() WHERE order_id = $2 AND id IN (%s)`, strings.Join(placeholders, ", ")), args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	status := model.PartiallyRefundedOrderStatus
+	if fullRefund {
+		status = model.RefundedOrderStatus
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2`, status, orderId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
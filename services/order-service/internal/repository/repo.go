@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/kaasikodes/shop-ease/services/order-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 )
 
@@ -11,9 +13,9 @@ type CreateOrderInputItem struct {
 	ProductId      int
 	StoreId        int
 	Quantity       int
-	Price          float64 //TODO: Come up with a better discount logic/model, when you have a bit of spare time
-	Discount       float64
-	AmountToBePaid float64
+	Price          money.Money //TODO: Come up with a better discount logic/model, when you have a bit of spare time
+	Discount       money.Money
+	AmountToBePaid money.Money // all items of an order must be in the same currency
 }
 type OrderFilter struct {
 	Status    model.OrderStatus
@@ -25,6 +27,20 @@ type OrderRepo interface {
 	CreateOrder(ctx context.Context, userId int, items []CreateOrderInputItem) (*int, error)
 	UpdateOrderStatus(ctx context.Context, orderId int, status model.OrderStatus) error
 	UpdateOrderItemStatus(ctx context.Context, orderItemId int, status model.OrderStatus) error
+	RefundOrder(ctx context.Context, orderId int, orderItemIds []int, fullRefund bool) error // a full refund marks every item refunded
 	GetOrderById(ctx context.Context, orderId int) (model.Order, error)
+	GetOrderItemStoreId(ctx context.Context, orderItemId int) (int, error) // sql.ErrNoRows when the item does not exist
 	GetOrders(ctx context.Context, pagination *utils.PaginationPayload, filter *OrderFilter) (result []model.OrderListItem, total int, err error)
 }
+
+type CheckoutRepo interface {
+	CreateCheckout(ctx context.Context, userId int, items []model.CheckoutItem, expiresAt time.Time) (*model.Checkout, error)
+	GetCheckoutById(ctx context.Context, checkoutId int) (*model.Checkout, error) // nil when the checkout does not exist
+	GetCheckoutByOrderId(ctx context.Context, orderId int) (*model.Checkout, error)
+	// creates the order of a started checkout and moves it to order created in the same transaction, created is false when the checkout was no longer started
+	CreateCheckoutOrder(ctx context.Context, checkoutId int, items []CreateOrderInputItem) (checkout *model.Checkout, created bool, err error)
+	// moves the checkout from the status to its status and saves its payment, error and expiry, updated is false when the checkout was no longer in that status
+	TransitionCheckout(ctx context.Context, checkout *model.Checkout, from model.CheckoutStatus) (updated bool, err error)
+	// checkouts that are not final and were not updated since staleBefore (other than those awaiting payment) or have expired
+	GetPendingCheckouts(ctx context.Context, staleBefore time.Time, now time.Time, limit int) ([]model.Checkout, error)
+}
@@ -5,10 +5,17 @@ import (
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/ledger"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/payout"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/reconciliation"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/refund"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/webhook"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"github.com/kaasikodes/shop-ease/shared/broker"
+	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
 	"github.com/kaasikodes/shop-ease/shared/logger"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -38,7 +45,15 @@ type application struct {
 	broker          broker.MessageBroker
 	store           repository.PaymentRepo
 	paymentRegistry map[model.PaymentProvider]providers.PaymentGateway // done this way, so if certain types of payments are to be made with a certain provider we can flexibly implement this, lets say vendor payment to flutter and order payment to paystack based on customer requirements
-
+	router          *providers.Router                                  // picks the provider of a payment from the registry using the routing rules
+	reconciler      *reconciliation.Reconciler
+	refunds         *refund.Service
+	ledger          *ledger.Ledger
+	payouts         *payout.Scheduler
+	webhooks        *webhook.Processor
+	// jwt
+	jwt      *jwttoken.JwtMaker
+	sessions *authz.SessionCache // whether the session of a token was revoked
 }
 
 func (app *application) mount(reg *prometheus.Registry) http.Handler {
@@ -53,12 +68,51 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 
 	})
 	//TODO: Add middleware for webhook, so you ensure that only certain ip addresses that belong to a provider can call it
-	r.Get("/webhook", app.webHookHandler) //will be called by providers and in here will check and update transaction record, and then send event
+	r.Post("/webhook", app.webHookHandler) //will be called by providers and in here will check and update transaction record, and then send event
+	authorizer := authz.NewAuthorizer(app.unauthorizedErrorResponse, app.forbiddenResponse)
 	r.Route("/v1", func(r chi.Router) {
+		// the api is for the admins of the platform, customers and vendors reach payments through the order and vendor services
+		r.Use(app.authMiddleware)
+		r.Use(authorizer.RequireRoles(authz.Admin))
+		read := authorizer.RequirePermissions(authz.ReadPayments)
+		manage := authorizer.RequirePermissions(authz.ManagePayments)
 
 		r.Route("/transactions", func(r chi.Router) {
-			r.Get("/:transactionId", app.getTransactionByIdHandler)
-			r.Get("/", app.getTransactionsHandler)
+			r.With(read).Get("/:transactionId", app.getTransactionByIdHandler)
+			r.With(read).Get("/", app.getTransactionsHandler)
+			r.Route("/{transactionId}/refunds", func(r chi.Router) {
+				r.With(manage).Post("/", app.refundTransactionHandler)
+				r.With(read).Get("/", app.getTransactionRefundsHandler)
+
+			})
+
+		})
+		r.Route("/reconciliations", func(r chi.Router) {
+			r.With(read).Get("/", app.getReconciliationReportsHandler)
+			r.With(manage).Post("/", app.runReconciliationHandler)
+			r.With(read).Get("/{reportId}", app.getReconciliationReportByIdHandler)
+
+		})
+		r.Route("/payouts", func(r chi.Router) {
+			r.With(read).Get("/", app.getPayoutsHandler)
+			r.With(read).Get("/batches", app.getPayoutBatchesHandler)
+			r.With(manage).Post("/batches", app.runPayoutBatchHandler)
+			r.With(read).Get("/{payoutId}", app.getPayoutByIdHandler)
+
+		})
+		r.Route("/webhooks", func(r chi.Router) {
+			r.With(read).Get("/", app.getWebhooksHandler)
+			r.With(read).Get("/{webhookId}", app.getWebhookByIdHandler)
+			r.With(manage).Post("/{webhookId}/replay", app.replayWebhookHandler)
+
+		})
+		r.Route("/ledger", func(r chi.Router) {
+			r.With(read).Get("/check", app.checkLedgerHandler)
+			r.With(read).Get("/stores/{storeId}/balance", app.getStoreBalanceHandler)
+			r.Route("/sharing-formulas", func(r chi.Router) {
+				r.With(read).Get("/", app.getSharingFormulasHandler)
+				r.With(manage).Post("/", app.createSharingFormulaHandler)
+			})
 
 		})
 
@@ -78,17 +132,17 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
-	app.logger.Info("Api running starting to run on .....", app.config.addr)
-
-	err := server.ListenAndServe()
-
+	// checkouts create and refund their payments over grpc, so it is served before the http server blocks
 	go func() {
-		app.logger.Info("Grpc server running in the background on .....", app.config.addr)
-		grpcServer := NewPaymentGRPCServer(app.config.grpcAddr, app.config, app.logger)
-		grpcServer.Run() //has a graceful shutdown built in, consider revisting ...
+		app.logger.Info("Grpc server running in the background on .....", app.config.grpcAddr)
+		grpcServer := NewPaymentGRPCServer(app.config.grpcAddr, app.config, app.router, app.refunds, app.logger)
+		app.logger.Fatal(grpcServer.Run()) //has a graceful shutdown built in, consider revisting ...
 
 	}()
 
+	app.logger.Info("Api running starting to run on .....", app.config.addr)
+
+	err := server.ListenAndServe()
 	if err != nil {
 		return err
 	}
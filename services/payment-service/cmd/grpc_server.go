@@ -6,6 +6,8 @@ import (
 
 	"github.com/kaasikodes/shop-ease/services/notification-service/db"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/handler"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/refund"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
 	"github.com/kaasikodes/shop-ease/shared/logger"
 	"github.com/kaasikodes/shop-ease/shared/observability"
@@ -15,14 +17,16 @@ import (
 )
 
 type gRPCServer struct {
-	addr   string
-	config config
-	logger logger.Logger
+	addr    string
+	config  config
+	router  *providers.Router
+	refunds *refund.Service
+	logger  logger.Logger
 }
 
-func NewPaymentGRPCServer(addr string, config config, logger logger.Logger) *gRPCServer {
+func NewPaymentGRPCServer(addr string, config config, router *providers.Router, refunds *refund.Service, logger logger.Logger) *gRPCServer {
 	logger.Info("addr for payment grpc server", addr)
-	return &gRPCServer{addr, config, logger}
+	return &gRPCServer{addr, config, router, refunds, logger}
 
 }
 
@@ -47,7 +51,7 @@ func (s *gRPCServer) Run() error {
 
 	trace := otel.Tracer("app.notification/trace")
 
-	handler.NewPaymentGRPCHandler(grpcServer, store, trace, s.logger)
+	handler.NewPaymentGRPCHandler(grpcServer, db, store, s.router, s.refunds, trace, s.logger)
 	s.logger.Info("The GRPC SERVER IS UP >>>>>>")
 
 	return grpcServer.Serve(lis)
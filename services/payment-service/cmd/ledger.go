@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/ledger"
+	"github.com/kaasikodes/shop-ease/shared/types"
+	"github.com/kaasikodes/shop-ease/shared/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// getStoreBalanceHandler returns what is owed to the vendor of the store in every currency, amounts are in minor units
+func (app *application) getStoreBalanceHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Store Balance")
+
+	defer span.End()
+	storeId, err := strconv.Atoi(chi.URLParam(r, "storeId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading storeId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("storeId", storeId))
+
+	balances, err := app.ledger.VendorBalances(initialTraceCtx, storeId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting store balance", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Store balance retrieved successfully!", balances)
+	return
+
+}
+
+// checkLedgerHandler verifies that the postings of the ledger balance
+func (app *application) checkLedgerHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Check Ledger")
+
+	defer span.End()
+
+	report, err := app.ledger.Check(initialTraceCtx)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error checking ledger", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !report.Balanced {
+		app.logger.WithContext(initialTraceCtx).Error("Ledger does not balance", report.Totals, len(report.Unbalanced))
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Ledger checked successfully!", report)
+	return
+
+}
+
+type createSharingFormulaPayload struct {
+	App           int                         `json:"app" validate:"gte=0,lte=100"`
+	Vendor        int                         `json:"vendor" validate:"gte=0,lte=100"`
+	BasedOn       types.SharingFormulaBasedOn `json:"basedOn" validate:"omitempty,oneof=sale profit"`
+	Description   string                      `json:"description" validate:"max=255"`
+	EffectiveFrom *time.Time                  `json:"effectiveFrom"` // defaults to now
+}
+
+func (app *application) createSharingFormulaHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Create Sharing Formula")
+
+	defer span.End()
+
+	var payload createSharingFormulaPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	formula := ledger.SharingFormula{
+		SharingFormula: types.SharingFormula{
+			App:         payload.App,
+			Vendor:      payload.Vendor,
+			BasedOn:     payload.BasedOn,
+			Description: payload.Description,
+		},
+	}
+	if payload.EffectiveFrom != nil {
+		formula.EffectiveFrom = *payload.EffectiveFrom
+	}
+	data, err := app.ledger.CreateSharingFormula(initialTraceCtx, formula)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error creating sharing formula", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if errors.Is(err, ledger.ErrInvalidSharingFormula) {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, "Sharing formula created successfully!", data)
+	return
+
+}
+
+func (app *application) getSharingFormulasHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Sharing Formulas")
+
+	defer span.End()
+
+	app.logger.WithContext(initialTraceCtx).Info("getting sharing formulas")
+	pagination := utils.GetPaginationFromQuery(r)
+
+	formulas, total, err := app.ledger.GetSharingFormulas(initialTraceCtx, &types.PaginationPayload{
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting sharing formulas", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var result = make([]any, len(formulas))
+	for i, formula := range formulas {
+		result[i] = formula
+
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Sharing formulas retrieved successfully!", createPaginatedResponse(result, total))
+	return
+
+}
@@ -1,12 +1,61 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/authz"
+	"go.opentelemetry.io/otel/codes"
 )
 
+func (app *application) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := app.trace.Start(r.Context(), "Auth middleware")
+		defer span.End()
+
+		// Step 1: Verify token
+		claims, err := app.jwt.ExtractAndVerifyToken(r)
+		if err != nil {
+			app.logger.WithContext(ctx).Error("JWT token error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("please provide a valid token: %w", err))
+			return
+		}
+
+		userId, err := strconv.Atoi(claims.UserID)
+		if err != nil {
+			app.logger.WithContext(ctx).Error("Invalid user ID in token", err)
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("invalid user ID in token"))
+			return
+		}
+
+		// Step 2: Reject the token of a session that was logged out or revoked, the answer of the auth service is cached for a while
+		if err := app.sessions.Check(ctx, claims); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if errors.Is(err, authz.ErrSessionRevoked) {
+				app.unauthorizedErrorResponse(w, r, err)
+				return
+			}
+			app.logger.WithContext(ctx).Error("Error checking session", err)
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// Step 3: Add user and claims to context, the claims carry the roles and permissions the routes require
+		ctx = context.WithValue(ctx, ContextKeyUser{}, userId)
+		ctx = authz.WithClaims(ctx, claims)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) metricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		normalizedPath := normalizePath(r.URL.Path)
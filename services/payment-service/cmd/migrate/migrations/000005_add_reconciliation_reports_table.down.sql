@@ -0,0 +1,2 @@
+DROP INDEX idx_transactions_status_created_at ON transactions;
+DROP TABLE IF EXISTS reconciliation_reports;
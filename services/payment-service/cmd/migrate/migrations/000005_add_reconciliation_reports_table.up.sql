@@ -0,0 +1,17 @@
+-- Reports of the reconciliation runs, the outcome of every transaction checked is kept in items
+CREATE TABLE IF NOT EXISTS reconciliation_reports (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NOT NULL,
+    checked INT NOT NULL DEFAULT 0,
+    matched INT NOT NULL DEFAULT 0,
+    fixed INT NOT NULL DEFAULT 0,
+    mismatched_amount INT NOT NULL DEFAULT 0,
+    unknown_at_provider INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    items JSON,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_transactions_status_created_at ON transactions (status, created_at);
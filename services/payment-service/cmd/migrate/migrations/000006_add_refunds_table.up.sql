@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS refunds (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    transaction_id INT NOT NULL,
+    reference VARCHAR(100) NOT NULL UNIQUE,
+    provider_refund_id VARCHAR(100) NULL,
+    idempotency_key VARCHAR(100) NOT NULL UNIQUE,
+    amount DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    items JSON,
+    status VARCHAR(50) NOT NULL,
+    failure_reason VARCHAR(255) NULL,
+    refunded_at DATETIME NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id),
+    INDEX idx_refunds_provider_refund_id (provider_refund_id)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_accounts;
+DROP TABLE IF EXISTS ledger_order_shares;
+DROP TABLE IF EXISTS sharing_formulas;
@@ -0,0 +1,52 @@
+-- Sharing formulas of the app and vendors, the one in effect when an order is placed is used to split its payment
+CREATE TABLE IF NOT EXISTS sharing_formulas (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    app INT NOT NULL,
+    vendor INT NOT NULL,
+    based_on VARCHAR(20) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    effective_from DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_sharing_formulas_effective_from (effective_from)
+);
+
+-- Share of every store in an order, fixed with the sharing formula in effect when the order was placed. Amounts are in minor units
+CREATE TABLE IF NOT EXISTS ledger_order_shares (
+    order_id INT NOT NULL,
+    store_id INT NOT NULL,
+    amount BIGINT NOT NULL,
+    app_percent INT NOT NULL,
+    vendor_percent INT NOT NULL,
+    sharing_formula_id INT NULL,
+    ordered_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (order_id, store_id)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(100) NOT NULL UNIQUE,
+    type VARCHAR(20) NOT NULL,
+    store_id INT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Entries and their postings are only ever inserted, a correction is a new entry
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    reference VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    entry_id INT NOT NULL,
+    account_id INT NOT NULL,
+    direction VARCHAR(6) NOT NULL,
+    amount BIGINT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (entry_id) REFERENCES ledger_entries(id),
+    FOREIGN KEY (account_id) REFERENCES ledger_accounts(id),
+    INDEX idx_ledger_postings_account_id (account_id)
+);
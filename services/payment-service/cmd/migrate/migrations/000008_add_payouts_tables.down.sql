@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS payouts;
+DROP TABLE IF EXISTS payout_batches;
+DROP TABLE IF EXISTS payout_accounts;
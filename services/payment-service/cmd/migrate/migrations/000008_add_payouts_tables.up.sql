@@ -0,0 +1,45 @@
+-- Accounts the earnings of stores are paid out to, kept in sync with vendor-service
+CREATE TABLE IF NOT EXISTS payout_accounts (
+    store_id INT PRIMARY KEY,
+    vendor_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    bank VARCHAR(100) NOT NULL,
+    number VARCHAR(50) NOT NULL,
+    swift_code VARCHAR(50) NOT NULL DEFAULT '',
+    recipient_code VARCHAR(100) NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS payout_batches (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    currency VARCHAR(10) NOT NULL,
+    payouts INT NOT NULL DEFAULT 0,
+    total_amount DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS payouts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    batch_id INT NOT NULL,
+    store_id INT NOT NULL,
+    reference VARCHAR(100) NOT NULL UNIQUE,
+    provider VARCHAR(50) NOT NULL,
+    provider_transfer_id VARCHAR(100) NULL,
+    amount DECIMAL(12, 2) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    bank VARCHAR(100) NOT NULL,
+    account_number VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    failure_reason VARCHAR(255) NULL,
+    paid_at DATETIME NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (batch_id) REFERENCES payout_batches(id),
+    INDEX idx_payouts_store_id (store_id),
+    INDEX idx_payouts_status (status)
+);
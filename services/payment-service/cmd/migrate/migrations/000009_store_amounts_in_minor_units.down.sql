@@ -0,0 +1,19 @@
+ALTER TABLE payouts MODIFY currency VARCHAR(10) NOT NULL;
+ALTER TABLE payouts MODIFY amount DECIMAL(20, 2) NOT NULL;
+UPDATE payouts SET amount = amount / 100;
+ALTER TABLE payouts MODIFY amount DECIMAL(12, 2) NOT NULL;
+
+ALTER TABLE payout_batches MODIFY currency VARCHAR(10) NOT NULL;
+ALTER TABLE payout_batches MODIFY total_amount DECIMAL(20, 2) NOT NULL DEFAULT 0;
+UPDATE payout_batches SET total_amount = total_amount / 100;
+ALTER TABLE payout_batches MODIFY total_amount DECIMAL(12, 2) NOT NULL DEFAULT 0;
+
+ALTER TABLE refunds DROP COLUMN currency;
+ALTER TABLE refunds MODIFY amount DECIMAL(20, 2) NOT NULL;
+UPDATE refunds SET amount = amount / 100;
+ALTER TABLE refunds MODIFY amount DECIMAL(10, 2) NOT NULL;
+
+ALTER TABLE transactions DROP COLUMN currency;
+ALTER TABLE transactions MODIFY amount DECIMAL(20, 2) NOT NULL;
+UPDATE transactions SET amount = amount / 100;
+ALTER TABLE transactions MODIFY amount DECIMAL(10, 2) NOT NULL;
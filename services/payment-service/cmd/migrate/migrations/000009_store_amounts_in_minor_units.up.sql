@@ -0,0 +1,23 @@
+-- amounts are kept in the minor unit (kobo, cents) of their currency, widened first so the multiplied amounts fit
+ALTER TABLE transactions MODIFY amount DECIMAL(20, 2) NOT NULL;
+UPDATE transactions SET amount = ROUND(amount * 100);
+ALTER TABLE transactions MODIFY amount BIGINT NOT NULL;
+ALTER TABLE transactions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'NGN' AFTER amount;
+-- the currency used to be kept in the meta data by the providers
+UPDATE transactions SET currency = UPPER(JSON_UNQUOTE(JSON_EXTRACT(meta_data, '$.currency'))) WHERE JSON_EXTRACT(meta_data, '$.currency') IS NOT NULL;
+
+ALTER TABLE refunds MODIFY amount DECIMAL(20, 2) NOT NULL;
+UPDATE refunds SET amount = ROUND(amount * 100);
+ALTER TABLE refunds MODIFY amount BIGINT NOT NULL;
+ALTER TABLE refunds ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'NGN' AFTER amount;
+UPDATE refunds r JOIN transactions t ON t.id = r.transaction_id SET r.currency = t.currency;
+
+ALTER TABLE payout_batches MODIFY total_amount DECIMAL(20, 2) NOT NULL DEFAULT 0;
+UPDATE payout_batches SET total_amount = ROUND(total_amount * 100);
+ALTER TABLE payout_batches MODIFY total_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payout_batches MODIFY currency CHAR(3) NOT NULL;
+
+ALTER TABLE payouts MODIFY amount DECIMAL(20, 2) NOT NULL;
+UPDATE payouts SET amount = ROUND(amount * 100);
+ALTER TABLE payouts MODIFY amount BIGINT NOT NULL;
+ALTER TABLE payouts MODIFY currency CHAR(3) NOT NULL;
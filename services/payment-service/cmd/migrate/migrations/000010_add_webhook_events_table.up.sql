@@ -0,0 +1,19 @@
+-- Webhooks as received from the providers, stored before they are processed so a webhook that fails can be retried and replayed
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NULL, -- NULL when the signature is invalid so a forged webhook cannot take the id of a real one
+    event_type VARCHAR(100) NOT NULL DEFAULT '',
+    headers JSON,
+    body MEDIUMTEXT NOT NULL,
+    signature_valid BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    received_at DATETIME NOT NULL,
+    processed_at DATETIME NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_webhook_events_provider_event_id (provider, event_id),
+    INDEX idx_webhook_events_status_received_at (status, received_at)
+);
@@ -0,0 +1,2 @@
+-- The transaction of what was paid for is looked up before the payment of a redelivered event is initiated again
+ALTER TABLE transactions ADD INDEX idx_transactions_entity (entity_payment_type, entity_id);
@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP INDEX idx_transactions_status_last_checked_at;
+ALTER TABLE transactions DROP COLUMN last_checked_at;
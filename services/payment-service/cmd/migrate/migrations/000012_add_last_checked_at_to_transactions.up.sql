@@ -0,0 +1,3 @@
+-- The reconciler checks the pending transactions it checked longest ago first, so transactions their provider keeps failing for do not starve the others
+ALTER TABLE transactions ADD COLUMN last_checked_at DATETIME NULL AFTER paid_at;
+ALTER TABLE transactions ADD INDEX idx_transactions_status_last_checked_at (status, last_checked_at);
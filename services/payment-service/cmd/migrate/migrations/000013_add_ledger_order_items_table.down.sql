@@ -0,0 +1,2 @@
+ALTER TABLE refunds DROP INDEX idx_refunds_status_created_at;
+DROP TABLE IF EXISTS ledger_order_items;
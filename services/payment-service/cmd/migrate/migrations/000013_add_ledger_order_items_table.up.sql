@@ -0,0 +1,12 @@
+-- Items of every order with the amount paid for them, refunds of order items are checked against them. Amounts are in minor units
+CREATE TABLE IF NOT EXISTS ledger_order_items (
+    order_id INT NOT NULL,
+    order_item_id INT NOT NULL,
+    store_id INT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (order_id, order_item_id)
+);
+-- The reconciler looks for the refunds left pending without a provider refund id, the provider did not answer when they were requested
+ALTER TABLE refunds ADD INDEX idx_refunds_status_created_at (status, created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE ledger_order_shares DROP COLUMN currency;
+ALTER TABLE ledger_postings
+    DROP INDEX idx_ledger_postings_account_id_currency,
+    DROP COLUMN currency;
@@ -0,0 +1,31 @@
+-- Postings are in the currency of their entry, the balances of an account are kept per currency and never added up across currencies
+ALTER TABLE ledger_postings
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'NGN' AFTER amount,
+    ADD INDEX idx_ledger_postings_account_id_currency (account_id, currency);
+
+-- the postings so far are in the currency of the payment, refund or payout their entry records
+UPDATE ledger_postings p
+JOIN ledger_entries e ON e.id = p.entry_id
+JOIN transactions t ON e.reference = CONCAT('payment:', t.id)
+SET p.currency = t.currency;
+
+UPDATE ledger_postings p
+JOIN ledger_entries e ON e.id = p.entry_id
+JOIN refunds r ON e.reference = CONCAT('refund:', r.id)
+SET p.currency = r.currency;
+
+UPDATE ledger_postings p
+JOIN ledger_entries e ON e.id = p.entry_id
+JOIN payouts po ON e.reference = CONCAT('payout:', po.id) OR e.reference LIKE CONCAT('payout:', po.id, ':%')
+SET p.currency = po.currency;
+
+ALTER TABLE ledger_postings ALTER COLUMN currency DROP DEFAULT;
+
+-- the share of a store is in the currency of its items
+ALTER TABLE ledger_order_shares ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'NGN' AFTER amount;
+
+UPDATE ledger_order_shares s
+JOIN (SELECT order_id, store_id, MIN(currency) AS currency FROM ledger_order_items GROUP BY order_id, store_id) i ON i.order_id = s.order_id AND i.store_id = s.store_id
+SET s.currency = i.currency;
+
+ALTER TABLE ledger_order_shares ALTER COLUMN currency DROP DEFAULT;
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/payout"
+	"github.com/kaasikodes/shop-ease/shared/types"
+	"github.com/kaasikodes/shop-ease/shared/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func (app *application) getPayoutsHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Payouts")
+
+	defer span.End()
+
+	app.logger.WithContext(initialTraceCtx).Info("getting payouts")
+	storeId := utils.ParseInt(r.URL.Query().Get("storeId"))
+	batchId := utils.ParseInt(r.URL.Query().Get("batchId"))
+	status := r.URL.Query().Get("status")
+	span.SetAttributes(
+		attribute.Int("filter.storeId", storeId),
+		attribute.Int("filter.batchId", batchId),
+		attribute.String("filter.status", status),
+	)
+	pagination := utils.GetPaginationFromQuery(r)
+
+	payouts, total, err := app.store.GetPayouts(&types.PaginationPayload{
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	}, &model.PayoutFilter{StoreId: storeId, BatchId: batchId, Status: model.PayoutStatus(status)})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting payouts", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var result = make([]any, len(payouts))
+	for i, payout := range payouts {
+		result[i] = payout
+
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Payouts retrieved successfully!", createPaginatedResponse(result, total))
+	return
+
+}
+
+func (app *application) getPayoutByIdHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Payout")
+
+	defer span.End()
+	payoutId, err := strconv.Atoi(chi.URLParam(r, "payoutId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading payoutId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("payoutId", payoutId))
+
+	data, err := app.store.GetPayoutById(payoutId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting payout", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	if data == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("payout %d does not exist", payoutId))
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Payout retrieved successfully!", data)
+	return
+
+}
+
+func (app *application) getPayoutBatchesHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Payout Batches")
+
+	defer span.End()
+
+	app.logger.WithContext(initialTraceCtx).Info("getting payout batches")
+	pagination := utils.GetPaginationFromQuery(r)
+
+	batches, total, err := app.store.GetPayoutBatches(&types.PaginationPayload{
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting payout batches", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var result = make([]any, len(batches))
+	for i, batch := range batches {
+		result[i] = batch
+
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Payout batches retrieved successfully!", createPaginatedResponse(result, total))
+	return
+
+}
+
+// runPayoutBatchHandler pays out the vendors now instead of waiting for the next batch
+func (app *application) runPayoutBatchHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Run Payout Batch")
+
+	defer span.End()
+
+	batch, err := app.payouts.RunBatch(initialTraceCtx)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error paying out vendors", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if errors.Is(err, payout.ErrAlreadyRunning) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, "Payout batch created successfully!", batch)
+	return
+
+}
@@ -0,0 +1,19 @@
+// paystack-fake serves the paystack stand-in so the payment flows can be run locally without a paystack account, point the service at it with PAYSTACK_BASE_URL
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers/paystackfake"
+	"github.com/kaasikodes/shop-ease/shared/env"
+)
+
+func main() {
+	addr := env.GetString("PAYSTACK_FAKE_ADDR", ":4010")
+	server := paystackfake.NewServer(env.GetString("PAYSTACK_API_KEY", "sk_test_local"), env.GetString("PAYSTACK_FAKE_WEBHOOK_URL", "http://localhost:3010/webhook"))
+	server.SetBaseURL(env.GetString("PAYSTACK_FAKE_BASE_URL", "http://localhost"+addr))
+
+	log.Printf("paystack stand-in running on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, server))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/reconciliation"
+	"github.com/kaasikodes/shop-ease/shared/types"
+	"github.com/kaasikodes/shop-ease/shared/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func (app *application) getReconciliationReportsHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Reconciliation Reports")
+
+	defer span.End()
+
+	app.logger.WithContext(initialTraceCtx).Info("getting reconciliation reports")
+	pagination := utils.GetPaginationFromQuery(r)
+
+	reports, total, err := app.store.GetReconciliationReports(&types.PaginationPayload{
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting reconciliation reports", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var result = make([]any, len(reports))
+	for i, report := range reports {
+		result[i] = report
+
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Reconciliation reports retrieved successfully!", createPaginatedResponse(result, total))
+	return
+
+}
+
+func (app *application) getReconciliationReportByIdHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Reconciliation Report")
+
+	defer span.End()
+	reportId, err := strconv.Atoi(chi.URLParam(r, "reportId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading reportId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("reportId", reportId))
+
+	report, err := app.store.GetReconciliationReportById(reportId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting reconciliation report", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	if report == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("reconciliation report %d does not exist", reportId))
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Reconciliation report retrieved successfully!", report)
+	return
+
+}
+
+// runReconciliationHandler reconciles the pending transactions now instead of waiting for the next run
+func (app *application) runReconciliationHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Run Reconciliation")
+
+	defer span.End()
+
+	report, err := app.reconciler.Reconcile(initialTraceCtx)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reconciling transactions", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if errors.Is(err, reconciliation.ErrAlreadyRunning) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, "Transactions reconciled successfully!", report)
+	return
+
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/refund"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type refundTransactionPayload struct {
+	Amount money.Money        `json:"amount"` // in the currency of the transaction when the currency is left out
+	Items  []model.RefundItem `json:"items" validate:"dive"`
+	Reason string             `json:"reason" validate:"max=255"`
+}
+
+// refundTransactionHandler refunds the transaction in full when neither amount nor items are sent, the Idempotency-Key header is required
+func (app *application) refundTransactionHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Refund Transaction")
+
+	defer span.End()
+	transactionId, err := strconv.Atoi(chi.URLParam(r, "transactionId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading transactionId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	span.SetAttributes(attribute.Int("transactionId", transactionId), attribute.String("idempotencyKey", idempotencyKey))
+
+	var payload refundTransactionPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	data, err := app.refunds.Refund(initialTraceCtx, refund.Input{
+		TransactionId:  transactionId,
+		IdempotencyKey: idempotencyKey,
+		Amount:         payload.Amount,
+		Items:          payload.Items,
+		Reason:         payload.Reason,
+	})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error refunding transaction", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		switch {
+		case errors.Is(err, refund.ErrIdempotencyKeyRequired), errors.Is(err, refund.ErrInvalidRefund), errors.Is(err, repository.ErrRefundItemNotInOrder):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, refund.ErrTransactionNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, repository.ErrTransactionNotRefundable), errors.Is(err, repository.ErrRefundExceedsAmount), errors.Is(err, repository.ErrIdempotencyKeyReused):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, "Refund requested successfully!", data)
+	return
+
+}
+
+func (app *application) getTransactionRefundsHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Transaction Refunds")
+
+	defer span.End()
+	transactionId, err := strconv.Atoi(chi.URLParam(r, "transactionId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading transactionId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("transactionId", transactionId))
+
+	refunds, err := app.store.GetRefundsByTransactionId(transactionId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting refunds", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Refunds retrieved successfully!", refunds)
+	return
+
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/types"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 	"go.opentelemetry.io/otel/attribute"
@@ -25,16 +27,30 @@ func (app *application) getTransactionsHandler(w http.ResponseWriter, r *http.Re
 	amountStr := r.URL.Query().Get("amount")
 	provider := r.URL.Query().Get("provider")
 	entityPaymentType := r.URL.Query().Get("entityPaymentType")
+	entityId := r.URL.Query().Get("entityId")
 	status := r.URL.Query().Get("status")
+	currency := r.URL.Query().Get("currency")
 	span.SetAttributes(
 		attribute.String("filter.amount", amountStr),
+		attribute.String("filter.currency", currency),
 		attribute.String("filter.provider", provider),
 		attribute.String("filter.entityPaymentType", entityPaymentType),
+		attribute.String("filter.entityId", entityId),
 		attribute.String("filter.status", status),
 	)
-	var amount int
+	// the amount is in minor units of the currency
+	var amount money.Money
 	if amountStr != "" {
-		amount, _ = strconv.Atoi(amountStr)
+		cur, err := money.ParseCurrency(currency)
+		if err != nil {
+			app.logger.WithContext(initialTraceCtx).Error("Error reading currency from query", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		value, _ := strconv.ParseInt(amountStr, 10, 64)
+		amount = money.New(value, cur)
 
 	}
 	pagination := utils.GetPaginationFromQuery(r)
@@ -42,7 +58,7 @@ func (app *application) getTransactionsHandler(w http.ResponseWriter, r *http.Re
 	transactions, total, err := app.store.GetTransactions(&types.PaginationPayload{
 		Limit:  pagination.Limit,
 		Offset: pagination.Offset,
-	}, &model.TransactionFilter{Provider: model.PaymentProvider(provider), Amount: float64(amount), EntityPaymentType: model.EntityPaymentType(entityPaymentType), Status: model.PaymentStatus(status)})
+	}, &model.TransactionFilter{Provider: model.PaymentProvider(provider), Amount: amount, EntityPaymentType: model.EntityPaymentType(entityPaymentType), EntityId: utils.ParseInt(entityId), Status: model.PaymentStatus(status)})
 	if err != nil {
 		app.logger.WithContext(initialTraceCtx).Error("Error getting transactions", err)
 		span.RecordError(err)
@@ -63,31 +79,27 @@ func (app *application) getTransactionsHandler(w http.ResponseWriter, r *http.Re
 	return
 
 }
-func determinePaymentProvider(r *http.Request) (model.PaymentProvider, error) {
-	// Case 1 -> From Header
-	if provider := r.Header.Get("X-Payment-Provider"); provider != "" {
-		return model.PaymentProvider(provider), nil
-	}
-
-	// Case 2 -> Infer from unique JSON fields
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read request body")
-	}
-	defer r.Body.Close()
-	r.Body = io.NopCloser(bytes.NewReader(body)) // Reset
 
-	if bytes.Contains(body, []byte(`"event":"charge.success"`)) {
+// determinePaymentProvider works out the provider of a webhook from the header each provider signs its webhooks with, the signature itself is validated by the provider.
+// A header naming the provider is not trusted as anyone can send it and have the webhook checked against the provider of their choosing
+func determinePaymentProvider(r *http.Request) (model.PaymentProvider, error) {
+	if r.Header.Get(providers.PaystackSignatureHeader) != "" {
 		return model.PaymentProviderPaystack, nil
-	} else if bytes.Contains(body, []byte(`"data":"flutter_event"`)) {
+	}
+	if r.Header.Get(providers.FlutterSignatureHeader) != "" {
 		return model.PaymentProviderFlutter, nil
 	}
 
 	return "", fmt.Errorf("could not determine payment provider")
 }
 
+// maxWebhookSize is the largest webhook body accepted from a provider
+const maxWebhookSize = 1 << 20
+
+// webHookHandler stores the webhook before it is processed in the background, so a webhook that fails to process is retried instead of lost.
+// A webhook the provider sends again is acknowledged without being stored or processed twice
 func (app *application) webHookHandler(w http.ResponseWriter, r *http.Request) {
-	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Payment Transactions")
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Receive Payment Webhook")
 
 	defer span.End()
 	provider, err := determinePaymentProvider(r)
@@ -107,17 +119,78 @@ func (app *application) webHookHandler(w http.ResponseWriter, r *http.Request) {
 		app.badRequestResponse(w, r, fmt.Errorf("unsupported payment provider"))
 		return
 	}
-	err = handler.HandleWebhook(w, r)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading webhook body", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	event := model.WebhookEvent{
+		Provider:   provider,
+		Headers:    r.Header.Clone(),
+		Body:       string(body),
+		Status:     model.WebhookStatusReceived,
+		ReceivedAt: time.Now(),
+	}
+	parsed, parseErr := handler.ParseWebhook(r.Header, body)
+	switch {
+	case parseErr != nil:
+		event.Status = model.WebhookStatusRejected
+		event.LastError = parseErr.Error()
+	case !parsed.SignatureValid:
+		event.EventType = parsed.EventType
+		event.Status = model.WebhookStatusRejected
+		event.LastError = providers.ErrInvalidSignature.Error()
+	default:
+		event.EventId = parsed.EventId
+		event.EventType = parsed.EventType
+		event.SignatureValid = true
+	}
+	stored, created, err := app.store.CreateWebhookEvent(event)
 	if err != nil {
-		app.logger.WithContext(initialTraceCtx).Error("Error handling webhook", err)
+		// the provider retries the webhook when it is not acknowledged
+		app.logger.WithContext(initialTraceCtx).Error("Error storing webhook", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 
 		app.internalServerError(w, r, err)
 		return
 	}
-	span.SetStatus(codes.Ok, "Webhook processed")
-	app.jsonResponse(w, http.StatusOK, "Payment web hook processed successfully!", nil)
+	span.SetAttributes(
+		attribute.Int("webhookId", stored.ID),
+		attribute.String("eventId", stored.EventId),
+		attribute.String("eventType", stored.EventType),
+		attribute.Bool("duplicate", !created),
+	)
+	if parseErr != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error parsing webhook", parseErr)
+		span.RecordError(parseErr)
+		span.SetStatus(codes.Error, parseErr.Error())
+
+		app.badRequestResponse(w, r, parseErr)
+		return
+	}
+	if !event.SignatureValid {
+		app.logger.WithContext(initialTraceCtx).Error("Error validating webhook", providers.ErrInvalidSignature)
+		span.RecordError(providers.ErrInvalidSignature)
+		span.SetStatus(codes.Error, providers.ErrInvalidSignature.Error())
+
+		app.unauthorizedErrorResponse(w, r, providers.ErrInvalidSignature)
+		return
+	}
+	if !created {
+		app.logger.WithContext(initialTraceCtx).Info("webhook already received", stored.EventId)
+		app.jsonResponse(w, http.StatusOK, "Payment web hook already received!", nil)
+		return
+	}
+
+	app.webhooks.Enqueue(stored.ID)
+	span.SetStatus(codes.Ok, "Webhook received")
+	app.jsonResponse(w, http.StatusOK, "Payment web hook received successfully!", nil)
 	return
 }
 func (app *application) getTransactionByIdHandler(w http.ResponseWriter, r *http.Request) {
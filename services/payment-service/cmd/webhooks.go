@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/types"
+	"github.com/kaasikodes/shop-ease/shared/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func (app *application) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Webhooks")
+
+	defer span.End()
+
+	app.logger.WithContext(initialTraceCtx).Info("getting webhooks")
+	provider := r.URL.Query().Get("provider")
+	eventType := r.URL.Query().Get("eventType")
+	status := r.URL.Query().Get("status")
+	span.SetAttributes(
+		attribute.String("filter.provider", provider),
+		attribute.String("filter.eventType", eventType),
+		attribute.String("filter.status", status),
+	)
+	pagination := utils.GetPaginationFromQuery(r)
+
+	webhooks, total, err := app.store.GetWebhookEvents(&types.PaginationPayload{
+		Limit:  pagination.Limit,
+		Offset: pagination.Offset,
+	}, &model.WebhookEventFilter{Provider: model.PaymentProvider(provider), EventType: eventType, Status: model.WebhookStatus(status)})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting webhooks", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var result = make([]any, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = webhook
+
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Webhooks retrieved successfully!", createPaginatedResponse(result, total))
+	return
+
+}
+
+func (app *application) getWebhookByIdHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Webhook")
+
+	defer span.End()
+	webhookId, err := strconv.Atoi(chi.URLParam(r, "webhookId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading webhookId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("webhookId", webhookId))
+
+	data, err := app.store.GetWebhookEventById(webhookId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting webhook", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	if data == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("webhook %d does not exist", webhookId))
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Webhook retrieved successfully!", data)
+	return
+
+}
+
+// replayWebhookHandler processes a stored webhook again and responds with the result
+func (app *application) replayWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Replay Webhook")
+
+	defer span.End()
+	webhookId, err := strconv.Atoi(chi.URLParam(r, "webhookId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading webhookId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("webhookId", webhookId))
+
+	existing, err := app.store.GetWebhookEventById(webhookId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting webhook", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	if existing == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("webhook %d does not exist", webhookId))
+		return
+	}
+
+	data, err := app.webhooks.Replay(initialTraceCtx, webhookId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error replaying webhook", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if errors.Is(err, repository.ErrWebhookNotReplayable) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Webhook replayed successfully!", data)
+	return
+
+}
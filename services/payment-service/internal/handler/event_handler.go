@@ -2,80 +2,77 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"strconv"
-	"strings"
 
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/ledger"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
-	"github.com/kaasikodes/shop-ease/shared/env"
 	"github.com/kaasikodes/shop-ease/shared/events"
 )
 
-type EventPayload struct {
-	Event string          `json:"event"`
-	Data  json.RawMessage `json:"data"`
-}
-type EventVendorSubscriptionPayload struct {
-	UserId         int     `json:"userId"`
-	VendorId       int     `json:"vendorId"`
-	SubscriptionId int     `json:"subscriptionId"`
-	Amount         float64 `json:"amount"`
-}
-type EventOrderPlacedPayload struct {
-	UserId   int     `json:"userId"`
-	VendorId int     `json:"vendorId"`
-	OrderId  int     `json:"orderId"`
-	Amount   float64 `json:"amount"`
-}
-
 type EventHandler struct {
-	paymentRegistry map[model.PaymentProvider]providers.PaymentGateway
+	router *providers.Router
+	ledger *ledger.Ledger
+	store  repository.PaymentRepo
 }
 
-func InitEventHandler(store repository.PaymentRepo) *EventHandler {
-	providers.RegisterProvider(model.PaymentProviderPaystack, providers.NewPaystackGateway(env.GetString("PAYSTACK_API_KEY", ""), store))
-	providers.RegisterProvider(model.PaymentProviderFlutter, providers.NewFlutterkGateway(env.GetString("FLUTTER_API_KEY", ""), store))
+// InitEventHandler takes the router that picks the provider of each payment, the ledger the shares of orders are recorded in and the store the payout accounts are saved to
+func InitEventHandler(router *providers.Router, ledger *ledger.Ledger, store repository.PaymentRepo) *EventHandler {
 	return &EventHandler{
-		paymentRegistry: providers.ProviderRegistry,
+		router: router,
+		ledger: ledger,
+		store:  store,
 	}
 
 }
 
-func (p *EventHandler) HandleSubscriptionEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+func (p *EventHandler) HandleSubscriptionEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.VendorSubscriptionCreated:
-		return p.payForVendorSubscription(msg)
+	switch payload := data.(type) {
+	case *events.VendorSubscriptionCreatedPayload:
+		return p.payForVendorSubscription(ctx, payload)
 	default:
-		log.Printf("unhandled event type: %s", event.Event)
+		log.Printf("unhandled event type: %s", envelope.Type)
 
 	}
 
 	return nil
 
 }
-func (p *EventHandler) HandleOrderEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+
+// SubscriptionPaymentInitiated is the check of the subscription consumer, a subscription whose delivery took too long may have had its payment initiated already
+func (p *EventHandler) SubscriptionPaymentInitiated(ctx context.Context, msg []byte) (bool, error) {
+	_, data, err := events.Decode(msg)
+	if err != nil {
+		return false, err
+	}
+	payload, ok := data.(*events.VendorSubscriptionCreatedPayload)
+	if !ok {
+		return false, nil
+	}
+	transaction, err := p.subscriptionTransaction(payload.SubscriptionId)
+	return transaction != nil, err
+
+}
+func (p *EventHandler) HandleOrderEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.OrderCreated:
-		return p.payForOrder(msg)
+	switch payload := data.(type) {
+	case *events.OrderCreatedPayload:
+		return p.recordOrderShares(ctx, envelope, payload)
 	default:
-		log.Printf("unhandled event type: %s", event.Event)
+		log.Printf("unhandled event type: %s", envelope.Type)
 
 	}
 
@@ -83,35 +80,77 @@ func (p *EventHandler) HandleOrderEvents(msg []byte) error {
 
 }
 
-func (p *EventHandler) payForOrder(msg []byte) error {
-	var payload EventOrderPlacedPayload
-	if err := json.Unmarshal(msg, &payload); err != nil {
-		log.Printf("an error occured while unmarshaling the event payload: %v", err)
+func (p *EventHandler) HandleVendorEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
-	ctx := context.Background()
-	p.paymentRegistry[model.PaymentProviderPaystack].InitiateTransaction(ctx, providers.PaymentRequest{
-		Amount:     payload.Amount,
-		EntityID:   strconv.Itoa(payload.OrderId),
-		EntityType: model.EntityPaymentTypeVendorSubscriptionPayment,
-		MetaData:   map[string]string{"vendorId": strconv.Itoa(payload.VendorId), "userId": strconv.Itoa(payload.UserId), "orderId": strconv.Itoa(payload.OrderId)},
+
+	switch payload := data.(type) {
+	case *events.VendorStoreAccountSavedPayload:
+		return p.savePayoutAccount(payload)
+	default:
+		log.Printf("unhandled event type: %s", envelope.Type)
+
+	}
+
+	return nil
+
+}
+
+func (p *EventHandler) savePayoutAccount(payload *events.VendorStoreAccountSavedPayload) error {
+	return p.store.SavePayoutAccount(model.PayoutAccount{
+		StoreId:   payload.StoreId,
+		VendorId:  payload.VendorId,
+		Name:      payload.Name,
+		Bank:      payload.Bank,
+		Number:    payload.Number,
+		SwiftCode: payload.SwiftCode,
 	})
+
+}
+
+// recordOrderShares fixes how the payment of the order is split, the payment itself is created by the checkout of order-service
+func (p *EventHandler) recordOrderShares(ctx context.Context, envelope *events.Envelope, payload *events.OrderCreatedPayload) error {
+	// the split of the payment is fixed by the sharing formula in effect when the order was placed, not when it is paid
+	if err := p.ledger.RecordOrderShares(ctx, payload.OrderId, envelope.OccurredAt, payload.Items); err != nil {
+		log.Printf("error recording the shares of order %d: %v", payload.OrderId, err)
+		return err
+	}
 	return nil
 
 }
-func (p *EventHandler) payForVendorSubscription(msg []byte) error {
-	var payload EventVendorSubscriptionPayload
-	if err := json.Unmarshal(msg, &payload); err != nil {
-		log.Printf("an error occured while unmarshaling the event payload: %v", err)
+
+// subscriptionTransaction returns the transaction the subscription is being or was paid with, nil when the providers tried did not initiate one or the payment failed
+func (p *EventHandler) subscriptionTransaction(subscriptionId int) (*model.Transaction, error) {
+	transaction, err := p.store.GetTransactionByEntity(model.EntityPaymentTypeVendorSubscriptionPayment, subscriptionId)
+	if err != nil || transaction == nil {
+		return nil, err
+	}
+	if transaction.Status == model.PaymentStatusNotInitiated || transaction.Status == model.PaymentStatusFailed {
+		return nil, nil
+	}
+	return transaction, nil
+}
+
+func (p *EventHandler) payForVendorSubscription(ctx context.Context, payload *events.VendorSubscriptionCreatedPayload) error {
+	// a retry after a provider left it unknown whether it initiated the payment finds the pending transaction, its webhook or the reconciler settles it
+	existing, err := p.subscriptionTransaction(payload.SubscriptionId)
+	if err != nil {
 		return err
 	}
-	ctx := context.Background()
-	p.paymentRegistry[model.PaymentProviderPaystack].InitiateTransaction(ctx, providers.PaymentRequest{
+	if existing != nil {
+		log.Printf("subscription %d already has transaction %s", payload.SubscriptionId, existing.TransactionId)
+		return nil
+	}
+	_, _, _, _, err = p.router.InitiateTransaction(ctx, providers.PaymentRequest{
 		Amount:     payload.Amount,
 		EntityID:   strconv.Itoa(payload.SubscriptionId),
 		EntityType: model.EntityPaymentTypeVendorSubscriptionPayment,
 		MetaData:   map[string]string{"vendorId": strconv.Itoa(payload.VendorId), "userId": strconv.Itoa(payload.UserId), "subscriptionId": strconv.Itoa(payload.SubscriptionId)},
 	})
-	return nil
+	// every provider failed or one left the outcome unknown, returning the error lets the broker retry the payment initiation
+	return err
 
 }
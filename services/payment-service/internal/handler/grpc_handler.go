@@ -2,58 +2,124 @@ package handler
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"strconv"
 
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/refund"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
-	"github.com/kaasikodes/shop-ease/shared/env"
+	"github.com/kaasikodes/shop-ease/shared/database"
 	"github.com/kaasikodes/shop-ease/shared/logger"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/types"
 
 	"github.com/kaasikodes/shop-ease/shared/proto/payment"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type PaymentGrpcHandler struct {
+	db              *sql.DB
 	trace           trace.Tracer
 	logger          logger.Logger
 	store           repository.PaymentRepo
 	paymentRegistry map[model.PaymentProvider]providers.PaymentGateway
+	router          *providers.Router
+	refunds         *refund.Service
 	payment.UnimplementedPaymentServiceServer
 }
 
-func NewPaymentGRPCHandler(s *grpc.Server, store repository.PaymentRepo, trace trace.Tracer, logger logger.Logger) {
-	providers.RegisterProvider(model.PaymentProviderPaystack, providers.NewPaystackGateway(env.GetString("PAYSTACK_API_KEY", ""), store))
-	providers.RegisterProvider(model.PaymentProviderFlutter, providers.NewFlutterkGateway(env.GetString("FLUTTER_API_KEY", ""), store))
-
-	handler := &PaymentGrpcHandler{trace: trace, logger: logger, store: store, paymentRegistry: providers.ProviderRegistry}
+func NewPaymentGRPCHandler(s *grpc.Server, db *sql.DB, store repository.PaymentRepo, router *providers.Router, refunds *refund.Service, trace trace.Tracer, logger logger.Logger) {
+	// the providers are registered at start up
+	handler := &PaymentGrpcHandler{db: db, trace: trace, logger: logger, store: store, paymentRegistry: providers.ProviderRegistry, router: router, refunds: refunds}
 
 	// register the NotificationServiceServer
 	payment.RegisterPaymentServiceServer(s, handler)
 
 }
 
+// CreateTransaction initiates the payment with the provider. A caller that passes an idempotency key in the meta data gets the transaction
+// already created with the key back, so retrying after a crash or a lost response does not have the customer pay twice
 func (n *PaymentGrpcHandler) CreateTransaction(ctx context.Context, payload *payment.CreateTransactionRequest) (*payment.CreateTransactionResponse, error) {
-	provider, ok := n.paymentRegistry[model.PaymentProvider(payload.Provider)]
-	if !ok {
-		return nil, errors.New("could not retrieve specified provider")
-	}
-	_, paymentUrl, _, err := provider.InitiateTransaction(ctx, providers.PaymentRequest{
-		Amount:     float64(payload.Amount),
+	req := providers.PaymentRequest{
+		Amount:     money.FromProto(payload.Amount),
 		EntityID:   strconv.Itoa(int(payload.EntityId)),
 		EntityType: model.EntityPaymentType(payload.EntityPaymentType),
 		MetaData:   map[string]string{"provider": (payload.Provider)},
-	})
+	}
+	for key, value := range payload.MetaData {
+		req.MetaData[key] = value
+	}
+	if key := payload.MetaData[model.MetaIdempotencyKey]; key != "" {
+		// a retry that arrives while the first call is still initiating the transaction must not initiate another
+		unlock, ok, err := database.TryLock(ctx, n.db, database.MySQL, "payment-transaction:"+key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, status.Errorf(grpccodes.Aborted, "a transaction with the idempotency key %s is being created", key)
+		}
+		defer unlock()
+		existing, err := n.store.GetTransactionByEntity(req.EntityType, int(payload.EntityId))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.MetaData[model.MetaIdempotencyKey] == key && existing.Status != model.PaymentStatusNotInitiated && existing.Status != model.PaymentStatusFailed {
+			paymentUrl := providers.PaymentUrl(existing.MetaData)
+			if paymentUrl == "" && existing.Status == model.PaymentStatusPending {
+				// the outcome of the initiation is unknown, the caller retries once the reconciler has settled it
+				return nil, status.Errorf(grpccodes.Unavailable, "the initiation of transaction %s has not been settled", existing.TransactionId)
+			}
+			return &payment.CreateTransactionResponse{PaymentUrl: paymentUrl, Data: transactionToProto(existing)}, nil
+		}
+	}
+	var (
+		reference  string
+		paymentUrl string
+		err        error
+	)
+	// the router picks the provider when the caller does not specify one
+	if payload.Provider == "" {
+		_, reference, paymentUrl, _, err = n.router.InitiateTransaction(ctx, req)
+	} else {
+		provider, ok := n.paymentRegistry[model.PaymentProvider(payload.Provider)]
+		if !ok {
+			return nil, errors.New("could not retrieve specified provider")
+		}
+		reference, paymentUrl, _, err = provider.InitiateTransaction(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the caller keeps the id of the transaction to refund it or match it with its events
+	transaction, err := n.store.GetTransactionByTransactionId(reference)
 	if err != nil {
 		return nil, err
 	}
-	return &payment.CreateTransactionResponse{
+	res := &payment.CreateTransactionResponse{
 		PaymentUrl: paymentUrl,
-	}, nil
+	}
+	if transaction != nil {
+		res.Data = transactionToProto(transaction)
+	}
+	return res, nil
+}
+
+func transactionToProto(transaction *model.Transaction) *payment.Transaction {
+	return &payment.Transaction{
+		Id:                int64(transaction.ID),
+		EntityId:          int64(transaction.EntityId),
+		Status:            string(transaction.Status),
+		EntityPaymentType: string(transaction.EntityPaymentType),
+		Provider:          string(transaction.Provider),
+		MetaData:          transaction.MetaData,
+		Amount:            money.ToProto(transaction.Amount),
+	}
 }
 func (n *PaymentGrpcHandler) GetTransactions(ctx context.Context, payload *payment.GetTransactionsRequest) (*payment.TransactionList, error) {
 
@@ -78,6 +144,7 @@ func (n *PaymentGrpcHandler) GetTransactions(ctx context.Context, payload *payme
 		transactions[i].Provider = string(row.Provider)
 		transactions[i].MetaData = row.MetaData
 		transactions[i].Status = string(row.Status)
+		transactions[i].Amount = money.ToProto(row.Amount)
 
 	}
 
@@ -102,6 +169,45 @@ func (n *PaymentGrpcHandler) GetTransactionById(ctx context.Context, payload *pa
 		EntityPaymentType: string(data.EntityPaymentType),
 		Provider:          string(data.Provider),
 		MetaData:          data.MetaData,
+		Amount:            money.ToProto(data.Amount),
 	}, nil
 
 }
+
+func (n *PaymentGrpcHandler) RefundTransaction(ctx context.Context, payload *payment.RefundTransactionRequest) (*payment.Refund, error) {
+	ctx, span := n.trace.Start(ctx, "refunding transaction")
+	defer span.End()
+	n.logger.WithContext(ctx).Info("refunding transaction starts")
+
+	items := make([]model.RefundItem, len(payload.Items))
+	for i, item := range payload.Items {
+		items[i] = model.RefundItem{OrderItemId: int(item.OrderItemId), Amount: money.FromProto(item.Amount)}
+	}
+	data, err := n.refunds.Refund(ctx, refund.Input{
+		TransactionId:  int(payload.TransactionId),
+		IdempotencyKey: payload.IdempotencyKey,
+		Amount:         money.FromProto(payload.Amount),
+		Items:          items,
+		Reason:         payload.Reason,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	refundItems := make([]*payment.RefundItem, len(data.Items))
+	for i, item := range data.Items {
+		refundItems[i] = &payment.RefundItem{OrderItemId: int64(item.OrderItemId), Amount: money.ToProto(item.Amount)}
+	}
+	n.logger.WithContext(ctx).Info("refunding transaction ends")
+	return &payment.Refund{
+		Id:            int64(data.ID),
+		TransactionId: int64(data.TransactionId),
+		Reference:     data.Reference,
+		Amount:        money.ToProto(data.Amount),
+		Status:        string(data.Status),
+		Reason:        data.Reason,
+		Items:         refundItems,
+	}, nil
+}
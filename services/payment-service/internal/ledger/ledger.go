@@ -0,0 +1,172 @@
+// Package ledger records the money moved through the marketplace as balanced double-entry postings: what the providers hold for the app (clearing),
+// what is owed to the vendor of every store (payable), the revenue of the app and the refunds it has absorbed. Amounts are in minor units of the currency of their entry,
+// every account has a balance per currency and amounts of different currencies are never added up
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+var (
+	ErrUnbalancedEntry = errors.New("entry does not balance")
+	ErrInvalidPosting  = errors.New("invalid posting")
+)
+
+type AccountType string
+
+var (
+	AccountTypeAsset         AccountType = "asset"          // debit normal
+	AccountTypeLiability     AccountType = "liability"      // credit normal
+	AccountTypeRevenue       AccountType = "revenue"        // credit normal
+	AccountTypeContraRevenue AccountType = "contra_revenue" // debit normal, reduces revenue
+)
+
+type Direction string
+
+var (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+const (
+	PlatformRevenueAccount  = "platform:revenue"
+	PlatformRefundsAccount  = "platform:refunds"  // the share of the app in refunds
+	PlatformSuspenseAccount = "platform:suspense" // money that could not be allocated (no shares or sharing formula for the order), for manual review
+)
+
+// ProviderClearingAccount holds what a provider has collected for the app and not yet settled
+func ProviderClearingAccount(provider model.PaymentProvider) string {
+	return "provider:" + string(provider) + ":clearing"
+}
+
+// VendorPayableAccount holds what is owed to the vendor of a store
+func VendorPayableAccount(storeId int) string {
+	return "vendor:store:" + strconv.Itoa(storeId) + ":payable"
+}
+
+func accountType(code string) AccountType {
+	switch {
+	case strings.HasPrefix(code, "provider:"):
+		return AccountTypeAsset
+	case strings.HasPrefix(code, "vendor:"), code == PlatformSuspenseAccount, code == PayoutsInTransitAccount:
+		return AccountTypeLiability
+	case code == PlatformRefundsAccount:
+		return AccountTypeContraRevenue
+	default:
+		return AccountTypeRevenue
+	}
+}
+
+func accountStoreId(code string) *int {
+	if !strings.HasPrefix(code, "vendor:store:") {
+		return nil
+	}
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(code, "vendor:store:"), ":payable"))
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+type Posting struct {
+	Account   string    `json:"account"`
+	Direction Direction `json:"direction"`
+	Amount    int64     `json:"amount"`
+}
+
+type Entry struct {
+	Reference   string         `json:"reference"` // unique, posting an entry with a reference that exists is a no-op
+	Description string         `json:"description"`
+	Currency    money.Currency `json:"currency"` // of every posting of the entry
+	Postings    []Posting      `json:"postings"`
+}
+
+// Validate checks that every posting has an account, a direction and a positive amount and that the debits equal the credits
+func (e Entry) Validate() error {
+	if e.Reference == "" || len(e.Postings) < 2 {
+		return fmt.Errorf("%w: an entry needs a reference and at least two postings", ErrInvalidPosting)
+	}
+	if e.Currency == "" {
+		return fmt.Errorf("%w: entry %s has no currency", ErrInvalidPosting, e.Reference)
+	}
+	var debits, credits int64
+	for _, posting := range e.Postings {
+		if posting.Account == "" || posting.Amount <= 0 {
+			return fmt.Errorf("%w: %+v", ErrInvalidPosting, posting)
+		}
+		switch posting.Direction {
+		case Debit:
+			debits += posting.Amount
+		case Credit:
+			credits += posting.Amount
+		default:
+			return fmt.Errorf("%w: unknown direction %s", ErrInvalidPosting, posting.Direction)
+		}
+	}
+	if debits != credits {
+		return fmt.Errorf("%w: %s debits %d, credits %d", ErrUnbalancedEntry, e.Reference, debits, credits)
+	}
+	return nil
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Post writes the entry in the transaction of the change it records, postings are never updated or deleted
+func Post(ctx context.Context, tx *sql.Tx, entry Entry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	var exists int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM ledger_entries WHERE reference = ?`, entry.Reference).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries (reference, description) VALUES (?, ?)`, entry.Reference, entry.Description)
+	if err != nil {
+		return fmt.Errorf("error saving ledger entry %s: %w", entry.Reference, err)
+	}
+	entryId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range entry.Postings {
+		accountId, err := accountId(ctx, tx, posting.Account)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO ledger_postings (entry_id, account_id, direction, amount, currency) VALUES (?, ?, ?, ?, ?)`, entryId, accountId, posting.Direction, posting.Amount, entry.Currency)
+		if err != nil {
+			return fmt.Errorf("error saving ledger posting of %s: %w", entry.Reference, err)
+		}
+	}
+	return nil
+}
+
+// accountId returns the id of the account, opening it on its first posting
+func accountId(ctx context.Context, q querier, code string) (int64, error) {
+	_, err := q.ExecContext(ctx, `INSERT IGNORE INTO ledger_accounts (code, type, store_id) VALUES (?, ?, ?)`, code, accountType(code), accountStoreId(code))
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = q.QueryRowContext(ctx, `SELECT id FROM ledger_accounts WHERE code = ?`, code).Scan(&id)
+	return id, err
+}
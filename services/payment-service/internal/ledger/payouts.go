@@ -0,0 +1,83 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+// PayoutsInTransitAccount holds what has been taken from the payable of vendors for payouts the provider has not paid (or failed) yet
+const PayoutsInTransitAccount = "platform:payouts_in_transit"
+
+type StoreBalance struct {
+	StoreId int         `json:"storeId"`
+	Amount  money.Money `json:"amount"`
+}
+
+// PayableBalances returns what can be paid out in the currency to the vendor of every store that is owed something: the earnings posted before settledBefore less everything taken
+// from the payable since (refunds, payouts). Holding back recent earnings leaves room for their refunds
+func (l *Ledger) PayableBalances(ctx context.Context, currency money.Currency, settledBefore time.Time) ([]StoreBalance, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT a.store_id, SUM(CASE WHEN p.direction = 'credit' AND e.created_at <= ? THEN p.amount WHEN p.direction = 'debit' THEN -p.amount ELSE 0 END) AS available
+		FROM ledger_postings p
+		JOIN ledger_entries e ON e.id = p.entry_id
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE a.store_id IS NOT NULL AND p.currency = ?
+		GROUP BY a.store_id
+		HAVING available > 0
+		ORDER BY a.store_id
+	`, settledBefore, currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []StoreBalance
+	for rows.Next() {
+		balance := StoreBalance{Amount: money.New(0, currency)}
+		if err := rows.Scan(&balance.StoreId, &balance.Amount.Amount); err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
+
+// PostPayout moves the amount of a created payout from the payable of the vendor to the payouts in transit, so it cannot be paid out twice
+func PostPayout(ctx context.Context, tx *sql.Tx, payout model.Payout) error {
+	amount := payout.Amount.Amount
+	return Post(ctx, tx, Entry{
+		Reference:   fmt.Sprintf("payout:%d", payout.ID),
+		Description: fmt.Sprintf("payout %s to store %d", payout.Reference, payout.StoreId),
+		Currency:    payout.Amount.Currency,
+		Postings: []Posting{
+			{Account: VendorPayableAccount(payout.StoreId), Direction: Debit, Amount: amount},
+			{Account: PayoutsInTransitAccount, Direction: Credit, Amount: amount},
+		},
+	})
+}
+
+// PostPayoutSettled records the outcome of a payout, a paid payout has left the balance of the provider and a failed one is owed to the vendor again
+func PostPayoutSettled(ctx context.Context, tx *sql.Tx, payout model.Payout) error {
+	amount := payout.Amount.Amount
+	entry := Entry{
+		Reference: fmt.Sprintf("payout:%d:%s", payout.ID, payout.Status),
+		Currency:  payout.Amount.Currency,
+		Postings:  []Posting{{Account: PayoutsInTransitAccount, Direction: Debit, Amount: amount}},
+	}
+	switch payout.Status {
+	case model.PayoutStatusPaid:
+		entry.Description = fmt.Sprintf("payout %s paid by %s", payout.Reference, payout.Provider)
+		entry.Postings = append(entry.Postings, Posting{Account: ProviderClearingAccount(payout.Provider), Direction: Credit, Amount: amount})
+	case model.PayoutStatusFailed:
+		entry.Description = fmt.Sprintf("payout %s failed, returned to store %d", payout.Reference, payout.StoreId)
+		entry.Postings = append(entry.Postings, Posting{Account: VendorPayableAccount(payout.StoreId), Direction: Credit, Amount: amount})
+	default:
+		return fmt.Errorf("%w: payout %d is not settled", ErrInvalidPosting, payout.ID)
+	}
+	return Post(ctx, tx, entry)
+}
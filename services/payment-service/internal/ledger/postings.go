@@ -0,0 +1,342 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/types"
+)
+
+// RecordOrderShares fixes the share of every store in the order using the sharing formula in effect when the order was placed, so a later change of formula does not change how the order is split.
+// Recording the shares of an order again is a no-op
+func (l *Ledger) RecordOrderShares(ctx context.Context, orderId int, orderedAt time.Time, items []events.OrderCreatedItem) error {
+	formula, err := l.SharingFormulaAt(ctx, orderedAt)
+	if err != nil {
+		return err
+	}
+	var (
+		formulaId                 *int
+		appPercent, vendorPercent int
+	)
+	switch {
+	case formula == nil:
+		log.Printf("no sharing formula in effect for order %d placed at %s, its payment will be held in suspense", orderId, orderedAt)
+	case formula.BasedOn == types.SharingFormulaOnProfitBasis:
+		// the cost of an item (and so its profit) is not known here, the payment is left for an admin to split rather than split on the sale amount
+		log.Printf("sharing formula %d in effect for order %d is based on profit which cannot be split here, its payment will be held in suspense", formula.Id, orderId)
+	default:
+		formulaId, appPercent, vendorPercent = &formula.Id, formula.App, formula.Vendor
+	}
+
+	// the split is on the sale amount of the items, all items of an order are in the same currency
+	amounts := map[int]money.Money{}
+	for _, item := range items {
+		amount, ok := amounts[item.StoreId]
+		if !ok {
+			amount = money.New(0, item.AmountToBePaid.Currency)
+		}
+		amount, err := amount.Add(item.AmountToBePaid)
+		if err != nil {
+			return fmt.Errorf("error adding up the share of store %d in order %d: %w", item.StoreId, orderId, err)
+		}
+		amounts[item.StoreId] = amount
+	}
+	for storeId, amount := range amounts {
+		_, err := l.db.ExecContext(ctx, `
+			INSERT IGNORE INTO ledger_order_shares (order_id, store_id, amount, currency, app_percent, vendor_percent, sharing_formula_id, ordered_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, orderId, storeId, amount.Amount, amount.Currency, appPercent, vendorPercent, formulaId, orderedAt)
+		if err != nil {
+			return fmt.Errorf("error recording share of store %d in order %d: %w", storeId, orderId, err)
+		}
+	}
+	// the items are kept so a refund can only return what was paid for an item of the order
+	for _, item := range items {
+		if item.OrderItemId == 0 {
+			continue
+		}
+		_, err := l.db.ExecContext(ctx, `
+			INSERT IGNORE INTO ledger_order_items (order_id, order_item_id, store_id, amount, currency)
+			VALUES (?, ?, ?, ?, ?)
+		`, orderId, item.OrderItemId, item.StoreId, item.AmountToBePaid.Amount, item.AmountToBePaid.Currency)
+		if err != nil {
+			return fmt.Errorf("error recording item %d of order %d: %w", item.OrderItemId, orderId, err)
+		}
+	}
+	return nil
+}
+
+type orderShare struct {
+	storeId       int
+	amount        int64
+	currency      money.Currency
+	appPercent    int
+	vendorPercent int
+	hasFormula    bool
+}
+
+func orderShares(ctx context.Context, q querier, orderId int) ([]orderShare, error) {
+	rows, err := q.QueryContext(ctx, `SELECT store_id, amount, currency, app_percent, vendor_percent, sharing_formula_id IS NOT NULL FROM ledger_order_shares WHERE order_id = ? ORDER BY store_id`, orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []orderShare
+	for rows.Next() {
+		var share orderShare
+		if err := rows.Scan(&share.storeId, &share.amount, &share.currency, &share.appPercent, &share.vendorPercent, &share.hasFormula); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func paymentReference(transactionId int) string {
+	return fmt.Sprintf("payment:%d", transactionId)
+}
+
+// PostPayment records a successful transaction. The provider clearing account is debited with the amount paid, for an order that is credited to the vendor of every store
+// and the app by the shares of the order, anything the shares do not account for (or a share in another currency than the payment) is held in suspense. A subscription is revenue of the app
+func PostPayment(ctx context.Context, tx *sql.Tx, transaction model.Transaction) error {
+	amount := transaction.Amount.Amount
+	entry := Entry{
+		Reference:   paymentReference(transaction.ID),
+		Description: fmt.Sprintf("%s payment %s for %d", transaction.EntityPaymentType, transaction.TransactionId, transaction.EntityId),
+		Currency:    transaction.Amount.Currency,
+		Postings:    []Posting{{Account: ProviderClearingAccount(transaction.Provider), Direction: Debit, Amount: amount}},
+	}
+	if transaction.EntityPaymentType != model.EntityPaymentTypeOrderPayment {
+		entry.Postings = append(entry.Postings, Posting{Account: PlatformRevenueAccount, Direction: Credit, Amount: amount})
+		return Post(ctx, tx, entry)
+	}
+
+	shares, err := orderShares(ctx, tx, transaction.EntityId)
+	if err != nil {
+		return err
+	}
+	if len(shares) == 0 {
+		log.Printf("no shares recorded for order %d, its payment is held in suspense", transaction.EntityId)
+	}
+	var allocated, revenue int64
+	for _, share := range shares {
+		if share.currency != transaction.Amount.Currency {
+			// left out of what is allocated, the amount of the payment for it ends up in suspense
+			log.Printf("share of store %d in order %d is in %s but it was paid in %s, its payment is held in suspense", share.storeId, transaction.EntityId, share.currency, transaction.Amount.Currency)
+			continue
+		}
+		allocated += share.amount
+		if !share.hasFormula {
+			entry.Postings = append(entry.Postings, Posting{Account: PlatformSuspenseAccount, Direction: Credit, Amount: share.amount})
+			continue
+		}
+		// the vendor gets what is left after the share of the app so the parts always add up to the amount of the store
+		vendorShare, appShare, err := money.New(share.amount, transaction.Amount.Currency).ApplyDiscount(int64(share.appPercent))
+		if err != nil {
+			return fmt.Errorf("error splitting the share of store %d in order %d: %w", share.storeId, transaction.EntityId, err)
+		}
+		revenue += appShare.Amount
+		entry.Postings = append(entry.Postings, Posting{Account: VendorPayableAccount(share.storeId), Direction: Credit, Amount: vendorShare.Amount})
+	}
+	entry.Postings = append(entry.Postings, Posting{Account: PlatformRevenueAccount, Direction: Credit, Amount: revenue})
+
+	// paid more or less than the items of the order add up to (e.g. a discount the app pays for)
+	switch difference := amount - allocated; {
+	case difference > 0:
+		entry.Postings = append(entry.Postings, Posting{Account: PlatformSuspenseAccount, Direction: Credit, Amount: difference})
+	case difference < 0:
+		entry.Postings = append(entry.Postings, Posting{Account: PlatformSuspenseAccount, Direction: Debit, Amount: -difference})
+	}
+	return Post(ctx, tx, nonZero(entry))
+}
+
+// PostRefund records a processed refund. The provider clearing account is credited with the amount refunded, which is taken back from the accounts the payment was credited to.
+// A refund of order items is taken from the shares of the stores the items were bought from, any other refund in proportion to what each account was credited.
+// The share of the app goes to the refunds account rather than reducing revenue directly
+func PostRefund(ctx context.Context, tx *sql.Tx, refund model.Refund, transaction model.Transaction) error {
+	credited, err := paymentCredits(ctx, tx, transaction)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Reference:   fmt.Sprintf("refund:%d", refund.ID),
+		Description: fmt.Sprintf("refund %s of %s payment %s", refund.Reference, transaction.EntityPaymentType, transaction.TransactionId),
+		Currency:    refund.Amount.Currency,
+		Postings:    []Posting{{Account: ProviderClearingAccount(transaction.Provider), Direction: Credit, Amount: refund.Amount.Amount}},
+	}
+	var debits []Posting
+	switch {
+	case len(credited) == 0:
+		// the payment was never posted
+		debits = []Posting{{Account: PlatformSuspenseAccount, Direction: Debit, Amount: refund.Amount.Amount}}
+	case len(refund.Items) > 0 && transaction.EntityPaymentType == model.EntityPaymentTypeOrderPayment:
+		shares, err := orderShares(ctx, tx, transaction.EntityId)
+		if err != nil {
+			return err
+		}
+		stores, err := orderItemStores(ctx, tx, transaction.EntityId)
+		if err != nil {
+			return err
+		}
+		if debits, err = itemRefundDebits(refund.Items, stores, shares); err != nil {
+			return fmt.Errorf("error splitting refund %s: %w", refund.Reference, err)
+		}
+	default:
+		if debits, err = refundDebits(refund.Amount, credited); err != nil {
+			return fmt.Errorf("error splitting refund %s: %w", refund.Reference, err)
+		}
+	}
+	entry.Postings = append(entry.Postings, debits...)
+	return Post(ctx, tx, nonZero(entry))
+}
+
+// paymentCredits returns what the payment of the transaction credited to every account other than the clearing account of its provider, an account it debited has a negative amount
+func paymentCredits(ctx context.Context, tx *sql.Tx, transaction model.Transaction) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT a.code, p.direction, p.amount
+		FROM ledger_postings p
+		JOIN ledger_entries e ON e.id = p.entry_id
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE e.reference = ? AND a.code != ? AND p.currency = ?
+	`, paymentReference(transaction.ID), ProviderClearingAccount(transaction.Provider), transaction.Amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credited := map[string]int64{}
+	for rows.Next() {
+		var (
+			code      string
+			direction Direction
+			amount    int64
+		)
+		if err := rows.Scan(&code, &direction, &amount); err != nil {
+			return nil, err
+		}
+		if direction == Debit {
+			amount = -amount
+		}
+		credited[code] += amount
+	}
+	return credited, rows.Err()
+}
+
+// orderItemStores returns the store every item of the order was bought from
+func orderItemStores(ctx context.Context, q querier, orderId int) (map[int]int, error) {
+	rows, err := q.QueryContext(ctx, `SELECT order_item_id, store_id FROM ledger_order_items WHERE order_id = ?`, orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stores := map[int]int{}
+	for rows.Next() {
+		var orderItemId, storeId int
+		if err := rows.Scan(&orderItemId, &storeId); err != nil {
+			return nil, err
+		}
+		stores[orderItemId] = storeId
+	}
+	return stores, rows.Err()
+}
+
+// itemRefundDebits takes the amount of every refunded item from the share of its store, split between the vendor and the app like the payment was.
+// An item whose store or share is not known, or whose share was held in suspense or is in another currency, is taken from suspense
+func itemRefundDebits(items []model.RefundItem, stores map[int]int, shares []orderShare) ([]Posting, error) {
+	byStore := map[int]orderShare{}
+	for _, share := range shares {
+		byStore[share.storeId] = share
+	}
+	var debits []Posting
+	for _, item := range items {
+		storeId, ok := stores[item.OrderItemId]
+		share, hasShare := byStore[storeId]
+		if !ok || !hasShare || !share.hasFormula || share.currency != item.Amount.Currency {
+			debits = append(debits, Posting{Account: PlatformSuspenseAccount, Direction: Debit, Amount: item.Amount.Amount})
+			continue
+		}
+		vendorShare, appShare, err := item.Amount.ApplyDiscount(int64(share.appPercent))
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", item.OrderItemId, err)
+		}
+		debits = append(debits,
+			Posting{Account: VendorPayableAccount(storeId), Direction: Debit, Amount: vendorShare.Amount},
+			Posting{Account: PlatformRefundsAccount, Direction: Debit, Amount: appShare.Amount},
+		)
+	}
+	return debits, nil
+}
+
+// refundDebits takes the amount back from the accounts the payment credited in proportion to what each was credited. An account the payment debited
+// (e.g. suspense when less was paid than the items add up to) has nothing to give back and is left alone, so no account is ever debited a negative amount
+func refundDebits(amount money.Money, credited map[string]int64) ([]Posting, error) {
+	codes := make([]string, 0, len(credited))
+	for code, value := range credited {
+		if value > 0 {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return []Posting{{Account: PlatformSuspenseAccount, Direction: Debit, Amount: amount.Amount}}, nil
+	}
+	sort.Strings(codes)
+	ratios := make([]int64, len(codes))
+	for i, code := range codes {
+		ratios[i] = credited[code]
+	}
+
+	shares, err := amount.Allocate(ratios...)
+	if err != nil {
+		return nil, err
+	}
+	debits := make([]Posting, len(codes))
+	for i, code := range codes {
+		account := code
+		if code == PlatformRevenueAccount {
+			account = PlatformRefundsAccount
+		}
+		debits[i] = Posting{Account: account, Direction: Debit, Amount: shares[i].Amount}
+	}
+	return debits, nil
+}
+
+// nonZero drops the postings of nothing, e.g. the revenue of an order with no formula
+func nonZero(entry Entry) Entry {
+	postings := entry.Postings[:0]
+	for _, posting := range entry.Postings {
+		if posting.Amount != 0 {
+			postings = append(postings, posting)
+		}
+	}
+	entry.Postings = postings
+	return entry
+}
+
+// SharingFormulaAt returns the sharing formula in effect at the time, nil when there was none
+func (l *Ledger) SharingFormulaAt(ctx context.Context, at time.Time) (*types.SharingFormula, error) {
+	var formula types.SharingFormula
+	err := l.db.QueryRowContext(ctx, `
+		SELECT id, app, vendor, based_on, description
+		FROM sharing_formulas
+		WHERE effective_from <= ?
+		ORDER BY effective_from DESC, id DESC
+		LIMIT 1
+	`, at).Scan(&formula.Id, &formula.App, &formula.Vendor, &formula.BasedOn, &formula.Description)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &formula, nil
+}
@@ -0,0 +1,93 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+func TestItemRefundDebitsTakeTheItemsFromTheSharesOfTheirStores(t *testing.T) {
+	stores := map[int]int{10: 4, 11: 9, 12: 7, 13: 5}
+	shares := []orderShare{
+		{storeId: 4, amount: 200000, currency: money.NGN, appPercent: 10, vendorPercent: 90, hasFormula: true},
+		{storeId: 9, amount: 300000, currency: money.NGN, appPercent: 10, vendorPercent: 90, hasFormula: true},
+		{storeId: 7, amount: 100000, currency: money.NGN},
+		{storeId: 5, amount: 2000, currency: money.USD, appPercent: 10, vendorPercent: 90, hasFormula: true},
+	}
+	items := []model.RefundItem{
+		{OrderItemId: 10, Amount: money.New(100000, money.NGN)},
+		{OrderItemId: 12, Amount: money.New(50000, money.NGN)},
+		{OrderItemId: 99, Amount: money.New(1000, money.NGN)},
+		{OrderItemId: 13, Amount: money.New(3000, money.NGN)},
+	}
+
+	debits, err := itemRefundDebits(items, stores, shares)
+	if err != nil {
+		t.Fatalf("item refund debits: %v", err)
+	}
+	want := []Posting{
+		// only the store the item was bought from gives back, store 9 is left alone
+		{Account: VendorPayableAccount(4), Direction: Debit, Amount: 90000},
+		{Account: PlatformRefundsAccount, Direction: Debit, Amount: 10000},
+		// the share of store 7 was held in suspense, as is an item whose store is not known
+		{Account: PlatformSuspenseAccount, Direction: Debit, Amount: 50000},
+		{Account: PlatformSuspenseAccount, Direction: Debit, Amount: 1000},
+		// the share of store 5 is in dollars, the refund in naira is not taken from it
+		{Account: PlatformSuspenseAccount, Direction: Debit, Amount: 3000},
+	}
+	if !reflect.DeepEqual(debits, want) {
+		t.Errorf("got debits %+v, want %+v", debits, want)
+	}
+}
+
+func TestRefundDebits(t *testing.T) {
+	for name, tc := range map[string]struct {
+		amount   int64
+		credited map[string]int64
+		want     []Posting
+	}{
+		"in proportion to the credits": {
+			amount:   1000,
+			credited: map[string]int64{VendorPayableAccount(4): 2700, VendorPayableAccount(9): 1800, PlatformRevenueAccount: 500},
+			want: []Posting{
+				{Account: PlatformRefundsAccount, Direction: Debit, Amount: 100},
+				{Account: VendorPayableAccount(4), Direction: Debit, Amount: 540},
+				{Account: VendorPayableAccount(9), Direction: Debit, Amount: 360},
+			},
+		},
+		"an account the payment debited gives nothing back": {
+			amount:   1000,
+			credited: map[string]int64{VendorPayableAccount(4): 4500, PlatformRevenueAccount: 500, PlatformSuspenseAccount: -1000},
+			want: []Posting{
+				{Account: PlatformRefundsAccount, Direction: Debit, Amount: 100},
+				{Account: VendorPayableAccount(4), Direction: Debit, Amount: 900},
+			},
+		},
+		"the remainder goes to the largest fraction": {
+			amount:   100,
+			credited: map[string]int64{VendorPayableAccount(4): 1, VendorPayableAccount(9): 1, PlatformRevenueAccount: 1},
+			want: []Posting{
+				{Account: PlatformRefundsAccount, Direction: Debit, Amount: 34},
+				{Account: VendorPayableAccount(4), Direction: Debit, Amount: 33},
+				{Account: VendorPayableAccount(9), Direction: Debit, Amount: 33},
+			},
+		},
+		"nothing was credited": {
+			amount:   1000,
+			credited: map[string]int64{PlatformSuspenseAccount: -1000},
+			want:     []Posting{{Account: PlatformSuspenseAccount, Direction: Debit, Amount: 1000}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			debits, err := refundDebits(money.New(tc.amount, money.NGN), tc.credited)
+			if err != nil {
+				t.Fatalf("refund debits: %v", err)
+			}
+			if !reflect.DeepEqual(debits, tc.want) {
+				t.Errorf("got debits %+v, want %+v", debits, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/types"
+)
+
+var ErrInvalidSharingFormula = errors.New("invalid sharing formula")
+
+type Balance struct {
+	Account  string         `json:"account"`
+	Type     AccountType    `json:"type"`
+	Currency money.Currency `json:"currency"`
+	Debits   int64          `json:"debits"`
+	Credits  int64          `json:"credits"`
+	Balance  int64          `json:"balance"` // on the normal side of the account, what is owed to the vendor for a payable account
+}
+
+type UnbalancedEntry struct {
+	Reference string         `json:"reference"`
+	Currency  money.Currency `json:"currency"`
+	Debits    int64          `json:"debits"`
+	Credits   int64          `json:"credits"`
+}
+
+// CurrencyTotals are the debits and credits of the ledger in a currency, they are equal when the ledger balances
+type CurrencyTotals struct {
+	Currency money.Currency `json:"currency"`
+	Debits   int64          `json:"debits"`
+	Credits  int64          `json:"credits"`
+}
+
+type CheckReport struct {
+	Entries    int               `json:"entries"`
+	Totals     []CurrencyTotals  `json:"totals"`
+	Balanced   bool              `json:"balanced"`
+	Unbalanced []UnbalancedEntry `json:"unbalanced"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+}
+
+type SharingFormula struct {
+	types.SharingFormula
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type Ledger struct {
+	db *sql.DB
+}
+
+func NewLedger(db *sql.DB) *Ledger {
+	return &Ledger{db: db}
+}
+
+// Balances returns the balance of the account in every currency it has postings in, an account with no postings has no balances
+func (l *Ledger) Balances(ctx context.Context, code string) ([]Balance, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT
+			p.currency,
+			COALESCE(SUM(CASE WHEN p.direction = 'debit' THEN p.amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE 0 END), 0)
+		FROM ledger_postings p
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE a.code = ?
+		GROUP BY p.currency
+		ORDER BY p.currency
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []Balance{}
+	for rows.Next() {
+		balance := Balance{Account: code, Type: accountType(code)}
+		if err := rows.Scan(&balance.Currency, &balance.Debits, &balance.Credits); err != nil {
+			return nil, err
+		}
+		switch balance.Type {
+		case AccountTypeAsset, AccountTypeContraRevenue:
+			balance.Balance = balance.Debits - balance.Credits
+		default:
+			balance.Balance = balance.Credits - balance.Debits
+		}
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
+
+// VendorBalances returns what is owed to the vendor of the store in every currency
+func (l *Ledger) VendorBalances(ctx context.Context, storeId int) ([]Balance, error) {
+	return l.Balances(ctx, VendorPayableAccount(storeId))
+}
+
+// Check verifies that every entry balances in its currency and so that the debits of the ledger equal its credits in every currency
+func (l *Ledger) Check(ctx context.Context) (*CheckReport, error) {
+	report := CheckReport{Totals: []CurrencyTotals{}, Unbalanced: []UnbalancedEntry{}, CheckedAt: time.Now()}
+	// an entry with postings in more than one currency shows up once per currency, and unbalanced in each
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT
+			e.reference,
+			COALESCE(p.currency, ''),
+			COALESCE(SUM(CASE WHEN p.direction = 'debit' THEN p.amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE 0 END), 0)
+		FROM ledger_entries e
+		LEFT JOIN ledger_postings p ON p.entry_id = e.id
+		GROUP BY e.id, e.reference, p.currency
+		ORDER BY e.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := map[string]bool{}
+	totals := map[money.Currency]int{} // index of the totals of the currency in the report
+	for rows.Next() {
+		var entry UnbalancedEntry
+		if err := rows.Scan(&entry.Reference, &entry.Currency, &entry.Debits, &entry.Credits); err != nil {
+			return nil, err
+		}
+		entries[entry.Reference] = true
+		if entry.Currency != "" {
+			i, ok := totals[entry.Currency]
+			if !ok {
+				i = len(report.Totals)
+				totals[entry.Currency] = i
+				report.Totals = append(report.Totals, CurrencyTotals{Currency: entry.Currency})
+			}
+			report.Totals[i].Debits += entry.Debits
+			report.Totals[i].Credits += entry.Credits
+		}
+		if entry.Debits != entry.Credits || entry.Debits == 0 {
+			report.Unbalanced = append(report.Unbalanced, entry)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	report.Entries = len(entries)
+	report.Balanced = len(report.Unbalanced) == 0
+	for _, total := range report.Totals {
+		if total.Debits != total.Credits {
+			report.Balanced = false
+		}
+	}
+	return &report, nil
+}
+
+// CreateSharingFormula adds a formula that applies to the orders placed from when it is effective, the formulas before it are kept for the orders placed while they were in effect
+func (l *Ledger) CreateSharingFormula(ctx context.Context, formula SharingFormula) (*SharingFormula, error) {
+	if formula.App < 0 || formula.Vendor < 0 || formula.App+formula.Vendor != 100 {
+		return nil, fmt.Errorf("%w: the app and vendor shares must add up to 100", ErrInvalidSharingFormula)
+	}
+	if formula.BasedOn == "" {
+		formula.BasedOn = types.SharingFormulaOnVendorBasis
+	}
+	if formula.BasedOn == types.SharingFormulaOnProfitBasis {
+		// the cost of the items is not known to payments, an order placed under it would be held in suspense
+		return nil, fmt.Errorf("%w: payments can only be split on the sale amount", ErrInvalidSharingFormula)
+	}
+	if formula.EffectiveFrom.IsZero() {
+		formula.EffectiveFrom = time.Now()
+	}
+	result, err := l.db.ExecContext(ctx, `
+		INSERT INTO sharing_formulas (app, vendor, based_on, description, effective_from)
+		VALUES (?, ?, ?, ?, ?)
+	`, formula.App, formula.Vendor, formula.BasedOn, formula.Description, formula.EffectiveFrom)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	formula.Id = int(id)
+	formula.CreatedAt = time.Now()
+	return &formula, nil
+}
+
+func (l *Ledger) GetSharingFormulas(ctx context.Context, pagination *types.PaginationPayload) ([]SharingFormula, int, error) {
+	var total int
+	if err := l.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sharing_formulas`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := pagination.Limit
+	offset := (pagination.Offset - 1) * limit
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT id, app, vendor, based_on, description, effective_from, created_at
+		FROM sharing_formulas
+		ORDER BY effective_from DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SharingFormula
+	for rows.Next() {
+		var formula SharingFormula
+		err := rows.Scan(&formula.Id, &formula.App, &formula.Vendor, &formula.BasedOn, &formula.Description, &formula.EffectiveFrom, &formula.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, formula)
+	}
+	return results, total, rows.Err()
+}
@@ -1,14 +1,19 @@
 package model
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/money"
 )
 
 type PaymentProvider string
 type EntityPaymentType string
 type PaymentStatus string
+type RefundStatus string
+type PayoutStatus string
+type WebhookStatus string
 
 var (
 	EntityPaymentTypeVendorSubscriptionPayment EntityPaymentType = "vendor"
@@ -19,10 +24,97 @@ var (
 	PaymentProviderFlutter  PaymentProvider = "flutter"
 )
 
+// MetaIdempotencyKey is the meta data key a caller creates a transaction with so a retry returns the transaction already created
+const MetaIdempotencyKey = "idempotencyKey"
+
+var (
+	PaymentStatusPending        PaymentStatus = "pending"
+	PaymentStatusSuccessful     PaymentStatus = "success"
+	PaymentStatusFailed         PaymentStatus = "failed"
+	PaymentStatusNotInitiated   PaymentStatus = "not_initiated"   // the provider refused the transaction or has no record of it, nothing was paid
+	PaymentStatusAmountMismatch PaymentStatus = "amount_mismatch" // paid, but not the amount of the transaction, left for an admin to settle with the customer
+)
+var (
+	RefundStatusPending   RefundStatus = "pending"   // waiting on the provider
+	RefundStatusProcessed RefundStatus = "processed" // the money has been returned
+	RefundStatusFailed    RefundStatus = "failed"
+)
+var (
+	PayoutStatusPending    PayoutStatus = "pending"    // created, not yet accepted by the provider
+	PayoutStatusProcessing PayoutStatus = "processing" // accepted by the provider, waiting on the bank
+	PayoutStatusPaid       PayoutStatus = "paid"
+	PayoutStatusFailed     PayoutStatus = "failed" // the amount is owed to the vendor again and paid out in a later batch
+)
+
+var (
+	WebhookStatusReceived   WebhookStatus = "received" // stored, waiting to be processed
+	WebhookStatusProcessing WebhookStatus = "processing"
+	WebhookStatusProcessed  WebhookStatus = "processed"
+	WebhookStatusFailed     WebhookStatus = "failed"   // retried until it runs out of attempts, can be replayed after
+	WebhookStatusRejected   WebhookStatus = "rejected" // the signature is invalid or the body could not be read, never processed
+)
+
+// Final reports whether the status of the payout can no longer change
+func (s PayoutStatus) Final() bool {
+	return s == PayoutStatusPaid || s == PayoutStatusFailed
+}
+
+type ReconciliationOutcome string
+
+var (
+	ReconciliationOutcomeMatched           ReconciliationOutcome = "matched"             // the provider agrees with the record
+	ReconciliationOutcomeFixed             ReconciliationOutcome = "fixed"               // the record was updated to the status at the provider
+	ReconciliationOutcomeMismatchedAmount  ReconciliationOutcome = "mismatched_amount"   // paid at the provider but not the amount (or currency) of the record, left for review
+	ReconciliationOutcomeUnknownAtProvider ReconciliationOutcome = "unknown_at_provider" // the provider has no record of the transaction
+	ReconciliationOutcomeFailed            ReconciliationOutcome = "failed"              // the provider could not be reached or the record could not be updated
+)
+
+type ReconciliationItem struct {
+	TransactionId  int                   `json:"transactionId"`
+	Reference      string                `json:"reference"`
+	Provider       PaymentProvider       `json:"provider"`
+	Outcome        ReconciliationOutcome `json:"outcome"`
+	PreviousStatus PaymentStatus         `json:"previousStatus"`
+	ProviderStatus PaymentStatus         `json:"providerStatus,omitempty"`
+	Detail         string                `json:"detail,omitempty"`
+}
+type ReconciliationReport struct {
+	ID                int                  `json:"id"`
+	StartedAt         time.Time            `json:"startedAt"`
+	FinishedAt        time.Time            `json:"finishedAt"`
+	Checked           int                  `json:"checked"`
+	Matched           int                  `json:"matched"`
+	Fixed             int                  `json:"fixed"`
+	MismatchedAmount  int                  `json:"mismatchedAmount"`
+	UnknownAtProvider int                  `json:"unknownAtProvider"`
+	Failed            int                  `json:"failed"`
+	Items             []ReconciliationItem `json:"items,omitempty"` // not returned when listing reports
+	types.Common
+}
+
+// Add counts the item in the totals of the report
+func (r *ReconciliationReport) Add(item ReconciliationItem) {
+	r.Checked++
+	switch item.Outcome {
+	case ReconciliationOutcomeMatched:
+		r.Matched++
+	case ReconciliationOutcomeFixed:
+		r.Fixed++
+	case ReconciliationOutcomeMismatchedAmount:
+		r.MismatchedAmount++
+	case ReconciliationOutcomeUnknownAtProvider:
+		r.UnknownAtProvider++
+	default:
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
+
 type TransactionFilter struct {
 	Provider          PaymentProvider   `json:"provider"`
-	Amount            float64           `json:"amount"`
+	Amount            money.Money       `json:"amount"` // matched when not zero
 	EntityPaymentType EntityPaymentType `json:"entityPaymentType"`
+	EntityId          int               `json:"entityId"` // matched when not zero, lists every provider a payment was attempted with
 	Status            PaymentStatus     `json:"status"`
 	PaidAt            *time.Time        `json:"paidAt"`
 }
@@ -32,9 +124,93 @@ type Transaction struct {
 	TransactionId     string            `json:"transactionId"`
 	MetaData          map[string]string `json:"metaData"`
 	EntityId          int               `json:"entityId"`
-	Amount            float64           `json:"amount"`
+	Amount            money.Money       `json:"amount"`
 	EntityPaymentType EntityPaymentType `json:"entityPaymentType"`
 	Status            PaymentStatus     `json:"status"`
 	PaidAt            *time.Time        `json:"paidAt"`
 	types.Common
 }
+
+// RefundItem is the part of a refund that returns the amount paid for an order item
+type RefundItem struct {
+	OrderItemId int         `json:"orderItemId"`
+	Amount      money.Money `json:"amount"`
+}
+type Refund struct {
+	ID               int          `json:"id"`
+	TransactionId    int          `json:"transactionId"` // id of the refunded transaction
+	Reference        string       `json:"reference"`
+	ProviderRefundId string       `json:"providerRefundId"`
+	IdempotencyKey   string       `json:"idempotencyKey"`
+	Amount           money.Money  `json:"amount"`
+	Reason           string       `json:"reason"`
+	Items            []RefundItem `json:"items"`
+	Status           RefundStatus `json:"status"`
+	FailureReason    string       `json:"failureReason,omitempty"`
+	RefundedAt       *time.Time   `json:"refundedAt"`
+	types.Common
+}
+
+// PayoutAccount is the bank account the earnings of a store are paid out to, as saved in vendor-service
+type PayoutAccount struct {
+	StoreId       int    `json:"storeId"`
+	VendorId      int    `json:"vendorId"`
+	Name          string `json:"name"`
+	Bank          string `json:"bank"`
+	Number        string `json:"number"`
+	SwiftCode     string `json:"swiftCode"`
+	RecipientCode string `json:"-"` // the account as registered with the payout provider, cleared when the account changes
+	types.Common
+}
+type PayoutBatch struct {
+	ID          int         `json:"id"`
+	Payouts     int         `json:"payouts"`
+	TotalAmount money.Money `json:"totalAmount"` // in the currency of the payouts of the batch
+	Skipped     int         `json:"skipped"`     // stores above the minimum with no payout account
+	StartedAt   time.Time   `json:"startedAt"`
+	FinishedAt  time.Time   `json:"finishedAt"`
+	types.Common
+}
+type PayoutFilter struct {
+	StoreId int          `json:"storeId"`
+	BatchId int          `json:"batchId"`
+	Status  PayoutStatus `json:"status"`
+}
+type Payout struct {
+	ID                 int             `json:"id"`
+	BatchId            int             `json:"batchId"`
+	StoreId            int             `json:"storeId"`
+	Reference          string          `json:"reference"`
+	Provider           PaymentProvider `json:"provider"`
+	ProviderTransferId string          `json:"providerTransferId"`
+	Amount             money.Money     `json:"amount"`
+	Bank               string          `json:"bank"`
+	AccountNumber      string          `json:"accountNumber"`
+	Status             PayoutStatus    `json:"status"`
+	FailureReason      string          `json:"failureReason,omitempty"`
+	PaidAt             *time.Time      `json:"paidAt"`
+	types.Common
+}
+
+type WebhookEventFilter struct {
+	Provider  PaymentProvider `json:"provider"`
+	EventType string          `json:"eventType"`
+	Status    WebhookStatus   `json:"status"`
+}
+
+// WebhookEvent is a webhook as received from a provider, it is stored before it is processed so a webhook that fails is not lost
+type WebhookEvent struct {
+	ID             int             `json:"id"`
+	Provider       PaymentProvider `json:"provider"`
+	EventId        string          `json:"eventId,omitempty"` // id of the event with the provider, webhooks are deduplicated by it. Not set when the signature is invalid
+	EventType      string          `json:"eventType"`
+	Headers        http.Header     `json:"headers,omitempty"` // not returned when listing webhooks
+	Body           string          `json:"body,omitempty"`    // raw, not returned when listing webhooks
+	SignatureValid bool            `json:"signatureValid"`
+	Status         WebhookStatus   `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError,omitempty"`
+	ReceivedAt     time.Time       `json:"receivedAt"`
+	ProcessedAt    *time.Time      `json:"processedAt"`
+	types.Common
+}
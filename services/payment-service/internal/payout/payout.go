@@ -0,0 +1,214 @@
+// Package payout pays the settled earnings of vendors out to the bank accounts of their stores in batches
+package payout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/ledger"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/database"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+var ErrAlreadyRunning = errors.New("a payout batch is already running")
+
+const (
+	DefaultInterval      = time.Hour * 24
+	DefaultHoldingPeriod = time.Hour * 24 * 7
+	DefaultMinimumAmount = 100000 // in minor units, 1000 naira
+
+	// batchLock is the advisory lock a batch runs under, held by one replica of the service at a time
+	batchLock = "payment-service.payout-batch"
+	// resendPageSize is the number of pending payouts read at a time when sending them again
+	resendPageSize = 100
+)
+
+type Config struct {
+	Interval      time.Duration         // time between batches
+	HoldingPeriod time.Duration         // earnings younger than this are held back, refunds are taken from them first
+	MinimumAmount int64                 // in minor units of the currency, stores owed less are left for a later batch
+	Currency      money.Currency        // of the payouts, only the earnings in it are paid out
+	Provider      model.PaymentProvider // the payouts are sent with
+}
+
+type Scheduler struct {
+	db       *sql.DB
+	store    repository.PaymentRepo
+	ledger   *ledger.Ledger
+	registry map[model.PaymentProvider]providers.PayoutProvider
+	config   Config
+}
+
+// NewScheduler takes the database the batches are locked in, so replicas of the service do not pay the same earnings out twice
+func NewScheduler(db *sql.DB, store repository.PaymentRepo, ledger *ledger.Ledger, registry map[model.PaymentProvider]providers.PayoutProvider, config Config) *Scheduler {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.HoldingPeriod <= 0 {
+		config.HoldingPeriod = DefaultHoldingPeriod
+	}
+	if config.MinimumAmount <= 0 {
+		config.MinimumAmount = DefaultMinimumAmount
+	}
+	if config.Currency == "" {
+		config.Currency = money.DefaultCurrency
+	}
+	if config.Provider == "" {
+		config.Provider = model.PaymentProviderPaystack
+	}
+	return &Scheduler{db: db, store: store, ledger: ledger, registry: registry, config: config}
+}
+
+// Run pays out a batch every interval until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			batch, err := s.RunBatch(ctx)
+			if err != nil {
+				if !errors.Is(err, ErrAlreadyRunning) {
+					log.Printf("error paying out vendors: %v", err)
+				}
+				continue
+			}
+			log.Printf("payout batch %d: %d payouts of %s, %d stores skipped", batch.ID, batch.Payouts, batch.TotalAmount, batch.Skipped)
+		}
+	}
+}
+
+// RunBatch creates a payout for every store owed at least the minimum in earnings past the holding period and sends it to the provider.
+// Payouts left pending by an earlier batch (e.g. the service stopped before sending them) are sent again first, the provider does not pay a reference twice
+func (s *Scheduler) RunBatch(ctx context.Context) (*model.PayoutBatch, error) {
+	// the balances are read and the payouts created under the lock, two batches running at once would both pay out the same balances
+	unlock, ok, err := database.TryLock(ctx, s.db, database.MySQL, batchLock)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAlreadyRunning
+	}
+	defer unlock()
+
+	provider, ok := s.registry[s.config.Provider]
+	if !ok {
+		return nil, fmt.Errorf("payout provider %s is not registered", s.config.Provider)
+	}
+	s.resendPending(ctx, provider)
+
+	batch, err := s.store.CreatePayoutBatch(model.PayoutBatch{TotalAmount: money.New(0, s.config.Currency), StartedAt: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	balances, err := s.ledger.PayableBalances(ctx, s.config.Currency, time.Now().Add(-s.config.HoldingPeriod))
+	if err != nil {
+		return nil, err
+	}
+	for _, balance := range balances {
+		if ctx.Err() != nil {
+			break
+		}
+		amount := balance.Amount
+		if amount.Amount < s.config.MinimumAmount {
+			continue
+		}
+		account, err := s.store.GetPayoutAccount(balance.StoreId)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			log.Printf("store %d is owed %s but has no payout account", balance.StoreId, amount)
+			batch.Skipped++
+			continue
+		}
+
+		payout, err := s.store.CreatePayout(model.Payout{
+			BatchId:       batch.ID,
+			StoreId:       balance.StoreId,
+			Reference:     fmt.Sprintf("payout-%d-%s", balance.StoreId, uuid.NewString()),
+			Provider:      s.config.Provider,
+			Amount:        amount,
+			Bank:          account.Bank,
+			AccountNumber: account.Number,
+			Status:        model.PayoutStatusPending,
+		})
+		if err != nil {
+			return nil, err
+		}
+		total, err := batch.TotalAmount.Add(amount)
+		if err != nil {
+			return nil, err
+		}
+		batch.Payouts++
+		batch.TotalAmount = total
+		s.send(ctx, provider, *payout, *account)
+	}
+	batch.FinishedAt = time.Now()
+
+	return s.store.UpdatePayoutBatch(batch.ID, *batch)
+}
+
+// resendPending sends every pending payout again a page at a time, the pages go by id as a payout the provider does not answer for stays pending
+func (s *Scheduler) resendPending(ctx context.Context, provider providers.PayoutProvider) {
+	afterId := 0
+	for ctx.Err() == nil {
+		pending, err := s.store.GetPendingPayouts(afterId, resendPageSize)
+		if err != nil {
+			log.Printf("error getting pending payouts: %v", err)
+			return
+		}
+		for _, payout := range pending {
+			afterId = payout.ID
+			account, err := s.store.GetPayoutAccount(payout.StoreId)
+			if err != nil || account == nil {
+				log.Printf("error getting the payout account of store %d: %v", payout.StoreId, err)
+				continue
+			}
+			// the payout is sent to the account it was created for
+			if account.Number != payout.AccountNumber {
+				account = &model.PayoutAccount{StoreId: payout.StoreId, Name: account.Name, Bank: payout.Bank, Number: payout.AccountNumber}
+			}
+			s.send(ctx, provider, payout, *account)
+		}
+		if len(pending) < resendPageSize {
+			return
+		}
+	}
+}
+
+// send transfers the payout, a payout the provider rejects is failed which returns its amount to the vendor. On any other error the payout stays pending
+// and is sent again with the next batch, failing it could pay the vendor twice if the transfer went through
+func (s *Scheduler) send(ctx context.Context, provider providers.PayoutProvider, payout model.Payout, account model.PayoutAccount) {
+	transfer, err := provider.Transfer(ctx, providers.TransferRequest{
+		Reference: payout.Reference,
+		Amount:    payout.Amount,
+		Reason:    fmt.Sprintf("shop-ease payout %s", payout.Reference),
+		Account:   account,
+	})
+	if err != nil {
+		log.Printf("error sending payout %s: %v", payout.Reference, err)
+		if !errors.Is(err, providers.ErrTransferRejected) {
+			return
+		}
+		transfer = &providers.ProviderTransfer{Reference: payout.Reference, Status: model.PayoutStatusFailed, FailureReason: err.Error()}
+	}
+	if transfer.RecipientCode != "" && transfer.RecipientCode != account.RecipientCode {
+		if err := s.store.SetPayoutRecipientCode(account.StoreId, account.Number, transfer.RecipientCode); err != nil {
+			log.Printf("error saving the recipient code of store %d: %v", account.StoreId, err)
+		}
+	}
+	if _, err := providers.ApplyPayout(s.store, *transfer); err != nil {
+		log.Printf("error updating payout %s: %v", payout.Reference, err)
+	}
+}
@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+var (
+	BreakerStateClosed   BreakerState = "closed"    // requests go through
+	BreakerStateOpen     BreakerState = "open"      // requests are not sent to the provider until the cool down is over
+	BreakerStateHalfOpen BreakerState = "half-open" // a single trial request is let through to decide whether to close again
+)
+
+type BreakerConfig struct {
+	Window      time.Duration // period the error rate is calculated over
+	MinRequests int           // requests needed in the window before the error rate can open the breaker
+	FailureRate float64       // 0 - 1, error rate that opens the breaker
+	CoolDown    time.Duration // how long the breaker stays open before a trial request is allowed
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	Window:      time.Minute,
+	MinRequests: 5,
+	FailureRate: 0.5,
+	CoolDown:    time.Second * 30,
+}
+
+// CircuitBreaker tracks the error rate of a provider and stops sending it requests while it keeps failing
+type CircuitBreaker struct {
+	config BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trialActive bool
+}
+
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.Window <= 0 {
+		config.Window = DefaultBreakerConfig.Window
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = DefaultBreakerConfig.MinRequests
+	}
+	if config.FailureRate <= 0 || config.FailureRate > 1 {
+		config.FailureRate = DefaultBreakerConfig.FailureRate
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = DefaultBreakerConfig.CoolDown
+	}
+	return &CircuitBreaker{config: config, state: BreakerStateClosed, windowStart: time.Now()}
+}
+
+// Allow reports whether a request can be sent, every allowed request must be followed by Record
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerStateOpen:
+		if time.Since(b.openedAt) < b.config.CoolDown {
+			return false
+		}
+		b.state = BreakerStateHalfOpen
+		b.trialActive = true
+		return true
+	case BreakerStateHalfOpen:
+		// only the one trial request at a time
+		if b.trialActive {
+			return false
+		}
+		b.trialActive = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record records the outcome of an allowed request
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+
+	if b.state == BreakerStateHalfOpen {
+		b.trialActive = false
+		if err != nil {
+			b.state = BreakerStateOpen
+			b.openedAt = now
+			return
+		}
+		b.state = BreakerStateClosed
+		b.windowStart, b.requests, b.failures = now, 0, 0
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.config.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if err != nil {
+		b.failures++
+	}
+	if b.requests >= b.config.MinRequests && float64(b.failures)/float64(b.requests) >= b.config.FailureRate {
+		b.state = BreakerStateOpen
+		b.openedAt = now
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
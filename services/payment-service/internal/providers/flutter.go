@@ -1,19 +1,362 @@
 package providers
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
 )
 
+const (
+	DefaultFlutterBaseURL  = "https://api.flutterwave.com/v3"
+	FlutterSignatureHeader = "verif-hash"
+)
+
+type FlutterConfig struct {
+	SecretKey    string
+	SecretHash   string // set on the flutterwave dashboard, sent back as is in the verif-hash header of webhooks
+	BaseURL      string
+	Currency     string
+	RedirectURL  string // where the customer is sent after paying
+	DefaultEmail string // used when the payment request has no email, flutterwave requires one
+}
+
 type FlutterGateway struct {
-	apiKey string
+	config FlutterConfig
+	client *http.Client
 	store  repository.PaymentRepo
 }
 
-func NewFlutterkGateway(apiKey string, store repository.PaymentRepo) *FlutterGateway {
-	return &FlutterGateway{apiKey, store}
+func NewFlutterGateway(config FlutterConfig, store repository.PaymentRepo) *FlutterGateway {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultFlutterBaseURL
+	}
+	if config.Currency == "" {
+		config.Currency = "NGN"
+	}
+	if config.DefaultEmail == "" {
+		config.DefaultEmail = "payments@shop-ease.com"
+	}
+	return &FlutterGateway{config: config, client: &http.Client{Timeout: time.Second * 30}, store: store}
+}
+
+// flutterError is a request flutterwave responded to with an error
+type flutterError struct {
+	path       string
+	statusCode int
+	message    string
+}
+
+func (e *flutterError) Error() string {
+	return fmt.Sprintf("flutterwave %s failed (status %d): %s", e.path, e.statusCode, e.message)
+}
+
+func (e *flutterError) response() (int, string) {
+	return e.statusCode, e.message
+}
+
+type flutterResponse[T any] struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+}
+
+type flutterCustomer struct {
+	Email string `json:"email"`
+}
+
+type flutterPaymentRequest struct {
+	TxRef       string            `json:"tx_ref"`
+	Amount      float64           `json:"amount"`
+	Currency    string            `json:"currency"`
+	RedirectURL string            `json:"redirect_url,omitempty"`
+	Customer    flutterCustomer   `json:"customer"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+type flutterPaymentData struct {
+	Link string `json:"link"`
+}
+
+// FlutterTransaction is the transaction returned by verify and carried in the charge.completed webhook, amounts are in major units
+type FlutterTransaction struct {
+	ID                int64      `json:"id"`
+	TxRef             string     `json:"tx_ref"`
+	FlwRef            string     `json:"flw_ref"`
+	Amount            float64    `json:"amount"`
+	Currency          string     `json:"currency"`
+	Status            string     `json:"status"`
+	ProcessorResponse string     `json:"processor_response"`
+	CreatedAt         *time.Time `json:"created_at"`
+}
+
+type flutterWebhookEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type flutterRefundRequest struct {
+	Amount   float64 `json:"amount"`
+	Comments string  `json:"comments,omitempty"`
+}
+
+// flutterRefund is the refund returned when it is created and carried in the refund.completed webhook
+type flutterRefund struct {
+	ID             int64      `json:"id"`
+	TxID           int64      `json:"tx_id"` // flutterwave id of the refunded transaction
+	AmountRefunded float64    `json:"amount_refunded"`
+	Status         string     `json:"status"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
+
+// flutterRefundStatus maps the status of a flutterwave refund to the status of the refund record
+func flutterRefundStatus(status string) model.RefundStatus {
+	switch status {
+	case "completed", "successful":
+		return model.RefundStatusProcessed
+	case "failed":
+		return model.RefundStatusFailed
+	default: // pending, pending-completion
+		return model.RefundStatusPending
+	}
+}
+
+// flutterStatus maps the status of a flutterwave transaction to the status of the transaction record
+func flutterStatus(status string) model.PaymentStatus {
+	switch status {
+	case "successful":
+		return model.PaymentStatusSuccessful
+	case "failed", "cancelled":
+		return model.PaymentStatusFailed
+	default: // pending
+		return model.PaymentStatusPending
+	}
+}
+
+func (p *FlutterGateway) InitiateTransaction(ctx context.Context, req PaymentRequest) (transactionID string, paymentUrl string, meta map[string]string, err error) {
+	email := req.Email
+	if email == "" {
+		email = p.config.DefaultEmail
+	}
+	amount := req.Amount
+	if amount.Currency == "" {
+		amount.Currency = money.Currency(p.config.Currency)
+	}
+	reference := fmt.Sprintf("%s-%s-%s", req.EntityType, req.EntityID, uuid.NewString())
+	transaction, err := createPendingTransaction(p.store, model.PaymentProviderFlutter, req, reference, amount)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var res flutterResponse[flutterPaymentData]
+	err = p.do(ctx, http.MethodPost, "/payments", flutterPaymentRequest{
+		TxRef:       reference,
+		Amount:      amount.Major(),
+		Currency:    string(amount.Currency),
+		RedirectURL: p.config.RedirectURL,
+		Customer:    flutterCustomer{Email: email},
+		Meta:        req.MetaData,
+	}, &res)
+	meta, err = finishInitiation(p.store, transaction, initiationError(err), map[string]string{"paymentLink": res.Data.Link})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return reference, res.Data.Link, meta, nil
+}
+
+// VerifyTransaction fetches the current state of the transaction from flutterwave by its tx_ref
+func (p *FlutterGateway) VerifyTransaction(ctx context.Context, reference string) (*ProviderTransaction, error) {
+	data, err := p.verifyTransactionByReference(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	transaction := p.providerTransaction(*data)
+	return &transaction, nil
+}
+
+func (p *FlutterGateway) verifyTransactionByReference(ctx context.Context, reference string) (*FlutterTransaction, error) {
+	var res flutterResponse[FlutterTransaction]
+	if err := p.do(ctx, http.MethodGet, "/transactions/verify_by_reference?tx_ref="+url.QueryEscape(reference), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
+
+// verifyTransactionById fetches the current state of the transaction from flutterwave by the flutterwave id (not the tx_ref)
+func (p *FlutterGateway) verifyTransactionById(ctx context.Context, id int64) (*FlutterTransaction, error) {
+	var res flutterResponse[FlutterTransaction]
+	if err := p.do(ctx, http.MethodGet, fmt.Sprintf("/transactions/%d/verify", id), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res.Data, nil
+}
+
+// ParseWebhook validates the verif-hash of the webhook and reads the event it was sent for
+func (p *FlutterGateway) ParseWebhook(header http.Header, body []byte) (*ParsedWebhook, error) {
+	var event flutterWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	return &ParsedWebhook{
+		EventId:        webhookEventId(event.Event, event.Data, body),
+		EventType:      event.Event,
+		SignatureValid: p.validSignature(header.Get(FlutterSignatureHeader)),
+	}, nil
+}
+
+// ProcessWebhook applies the charge or refund of the event to its record.
+// The webhook is only a notification, the transaction is verified with flutterwave before it is applied
+func (p *FlutterGateway) ProcessWebhook(ctx context.Context, body []byte) error {
+	var event flutterWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return err
+	}
+	switch event.Event {
+	case "charge.completed":
+		var data FlutterTransaction
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		transaction, err := p.verifyTransactionById(ctx, data.ID)
+		if err != nil {
+			return err
+		}
+		if transaction.TxRef != data.TxRef {
+			return fmt.Errorf("flutterwave transaction %d has reference %s, webhook sent %s", data.ID, transaction.TxRef, data.TxRef)
+		}
+		return p.applyTransaction(*transaction)
+	case "refund.completed":
+		var data flutterRefund
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		refund := p.providerRefund(data)
+		if data.TxID != 0 {
+			// the refund is matched by the reference of its transaction when flutterwave did not answer the refund request
+			transaction, err := p.verifyTransactionById(ctx, data.TxID)
+			if err != nil {
+				return err
+			}
+			refund.TransactionReference = transaction.TxRef
+			refund.Amount = money.FromMajor(data.AmountRefunded, money.Currency(strings.ToUpper(transaction.Currency)))
+		}
+		_, err := ApplyRefund(p.store, refund)
+		return err
+	default:
+		log.Printf("unhandled flutterwave event: %s", event.Event)
+	}
+	return nil
+}
+
+// Refund asks flutterwave to return the amount to the customer, the refund is made against the flutterwave id of the transaction
+func (p *FlutterGateway) Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error) {
+	transaction, err := p.verifyTransactionByReference(ctx, req.TransactionReference)
+	if err != nil {
+		// the refund was not asked for
+		return nil, fmt.Errorf("%w: %w", ErrRefundRejected, err)
+	}
+	var res flutterResponse[flutterRefund]
+	err = p.do(ctx, http.MethodPost, fmt.Sprintf("/transactions/%d/refund", transaction.ID), flutterRefundRequest{
+		Amount:   req.Amount.Major(),
+		Comments: req.Reason,
+	}, &res)
+	if err != nil {
+		return nil, refundError(err)
+	}
+	refund := p.providerRefund(res.Data)
+	return &refund, nil
+}
+
+func (p *FlutterGateway) providerRefund(data flutterRefund) ProviderRefund {
+	refund := ProviderRefund{
+		ProviderRefundId: strconv.FormatInt(data.ID, 10),
+		Status:           flutterRefundStatus(data.Status),
+	}
+	if refund.Status == model.RefundStatusProcessed {
+		refund.RefundedAt = data.CreatedAt
+	}
+	if refund.Status == model.RefundStatusFailed {
+		refund.FailureReason = "refund failed at flutterwave"
+	}
+	return refund
+}
+
+func (p *FlutterGateway) validSignature(signature string) bool {
+	if p.config.SecretHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(p.config.SecretHash), []byte(signature)) == 1
+}
+
+func (p *FlutterGateway) applyTransaction(data FlutterTransaction) error {
+	_, err := ApplyTransaction(p.store, p.providerTransaction(data))
+	return err
+}
+
+func (p *FlutterGateway) providerTransaction(data FlutterTransaction) ProviderTransaction {
+	status := flutterStatus(data.Status)
+	var paidAt *time.Time
+	if status == model.PaymentStatusSuccessful {
+		paidAt = data.CreatedAt
+	}
+	return ProviderTransaction{
+		Reference:       data.TxRef,
+		Status:          status,
+		Amount:          money.FromMajor(data.Amount, money.Currency(strings.ToUpper(data.Currency))),
+		PaidAt:          paidAt,
+		GatewayResponse: data.ProcessorResponse,
+	}
+}
+
+func (p *FlutterGateway) do(ctx context.Context, method string, path string, body any, v any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.config.SecretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling flutterwave %s: %w", path, err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var envelope flutterResponse[json.RawMessage]
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("error decoding flutterwave %s response (status %d): %w", path, res.StatusCode, err)
+	}
+	if res.StatusCode == http.StatusNotFound || (res.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(envelope.Message), "no transaction was found")) {
+		return fmt.Errorf("%w: flutterwave %s: %s", ErrTransactionNotFound, path, envelope.Message)
+	}
+	if res.StatusCode >= http.StatusBadRequest || envelope.Status != "success" {
+		return &flutterError{path: path, statusCode: res.StatusCode, message: envelope.Message}
+	}
+	return json.Unmarshal(raw, v)
 }
-func (p *FlutterGateway) InitiateTransaction(ctx context.Context, req PaymentRequest) (transactionID string, paymentUrl string, meta map[string]string, err error)
-func (p *FlutterGateway) HandleWebhook(w http.ResponseWriter, r *http.Request) error
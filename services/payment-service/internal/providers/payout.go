@@ -0,0 +1,86 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+// ErrTransferRejected is returned when the provider refused the transfer, any other error leaves it unknown whether the transfer was sent
+var ErrTransferRejected = errors.New("transfer rejected by the provider")
+
+type TransferRequest struct {
+	Reference string      // reference of the payout, providers use it to not send a transfer twice
+	Amount    money.Money // the currency of the provider config is used when the currency is empty
+	Reason    string
+	Account   model.PayoutAccount // the recipient code is reused when the account has one
+}
+
+// ProviderTransfer is the state of a transfer as reported by a provider
+type ProviderTransfer struct {
+	Reference          string
+	ProviderTransferId string
+	RecipientCode      string // the account as registered with the provider
+	Status             model.PayoutStatus
+	FailureReason      string
+	PaidAt             *time.Time
+}
+
+// PayoutProvider sends money from the balance of the app to the bank account of a vendor
+type PayoutProvider interface {
+	Transfer(ctx context.Context, req TransferRequest) (*ProviderTransfer, error) // returns ErrTransferRejected when the transfer was refused
+}
+
+var PayoutRegistry = make(map[model.PaymentProvider]PayoutProvider)
+
+func RegisterPayoutProvider(providerType model.PaymentProvider, provider PayoutProvider) {
+	PayoutRegistry[providerType] = provider
+
+}
+
+// ApplyPayout updates the payout record with the state reported by the provider, updated is false when the record already had that state or was settled before.
+// Settling the payout posts its outcome to the ledger and informs vendor-service
+func ApplyPayout(store repository.PaymentRepo, data ProviderTransfer) (updated bool, err error) {
+	payout, err := store.GetPayoutByReference(data.Reference)
+	if err != nil {
+		return false, err
+	}
+	if payout == nil {
+		// not sent by this service, nothing to update and no point in the provider retrying
+		log.Printf("payout %s does not exist", data.Reference)
+		return false, nil
+	}
+	if payout.Status == data.Status || payout.Status.Final() {
+		if payout.Status != data.Status {
+			log.Printf("payout %s is already %s, ignoring %s from the provider", payout.Reference, payout.Status, data.Status)
+		}
+		return false, nil
+	}
+
+	payout.Status = data.Status
+	payout.FailureReason = data.FailureReason
+	if data.ProviderTransferId != "" {
+		payout.ProviderTransferId = data.ProviderTransferId
+	}
+	if data.Status == model.PayoutStatusPaid {
+		payout.PaidAt = data.PaidAt
+		if payout.PaidAt == nil {
+			now := time.Now()
+			payout.PaidAt = &now
+		}
+	}
+	if _, err := store.UpdatePayout(payout.ID, *payout); err != nil {
+		if errors.Is(err, repository.ErrPayoutSettled) {
+			// settled by a webhook while this was applied
+			return false, nil
+		}
+		return false, fmt.Errorf("error updating payout %s: %w", payout.Reference, err)
+	}
+	return true, nil
+}
@@ -1,19 +1,461 @@
 package providers
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
 )
 
+const (
+	DefaultPaystackBaseURL  = "https://api.paystack.co"
+	PaystackSignatureHeader = "X-Paystack-Signature"
+)
+
+type PaystackConfig struct {
+	SecretKey    string // also the key webhooks are signed with
+	BaseURL      string // points at the stand-in server for local runs
+	Currency     string
+	CallbackURL  string // where the customer is sent after paying
+	DefaultEmail string // used when the payment request has no email, paystack requires one
+}
+
 type PaystackGateway struct {
-	apiKey string
+	config PaystackConfig
+	client *http.Client
 	store  repository.PaymentRepo
 }
 
-func NewPaystackGateway(apiKey string, store repository.PaymentRepo) *PaystackGateway {
-	return &PaystackGateway{apiKey, store}
+func NewPaystackGateway(config PaystackConfig, store repository.PaymentRepo) *PaystackGateway {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultPaystackBaseURL
+	}
+	if config.Currency == "" {
+		config.Currency = "NGN"
+	}
+	if config.DefaultEmail == "" {
+		config.DefaultEmail = "payments@shop-ease.com"
+	}
+	return &PaystackGateway{config: config, client: &http.Client{Timeout: time.Second * 30}, store: store}
+}
+
+type paystackResponse[T any] struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+}
+
+type paystackInitializeRequest struct {
+	Email       string            `json:"email"`
+	Amount      int64             `json:"amount"`
+	Currency    string            `json:"currency"`
+	Reference   string            `json:"reference"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type paystackInitializeData struct {
+	AuthorizationURL string `json:"authorization_url"`
+	AccessCode       string `json:"access_code"`
+	Reference        string `json:"reference"`
+}
+
+// PaystackTransaction is the transaction returned by verify and carried in the charge webhooks
+type PaystackTransaction struct {
+	ID              int64      `json:"id"`
+	Status          string     `json:"status"`
+	Reference       string     `json:"reference"`
+	Amount          int64      `json:"amount"`
+	Currency        string     `json:"currency"`
+	GatewayResponse string     `json:"gateway_response"`
+	PaidAt          *time.Time `json:"paid_at"`
+}
+
+type paystackWebhookEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// paystackError is a request paystack responded to with an error
+type paystackError struct {
+	path       string
+	statusCode int
+	message    string
+}
+
+func (e *paystackError) Error() string {
+	return fmt.Sprintf("paystack %s failed (status %d): %s", e.path, e.statusCode, e.message)
+}
+
+func (e *paystackError) response() (int, string) {
+	return e.statusCode, e.message
+}
+
+// paystackID is an id paystack sends as a number in some payloads and a string in others
+type paystackID string
+
+func (id *paystackID) UnmarshalJSON(data []byte) error {
+	*id = paystackID(strings.Trim(string(data), `"`))
+	return nil
+}
+
+type paystackRefundRequest struct {
+	Transaction  string `json:"transaction"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency,omitempty"`
+	MerchantNote string `json:"merchant_note,omitempty"`
+}
+
+// paystackRefund is the refund returned when it is created and carried in the refund webhooks
+type paystackRefund struct {
+	ID                   paystackID `json:"id"`
+	Status               string     `json:"status"`
+	TransactionReference string     `json:"transaction_reference"`
+	Amount               int64      `json:"amount"`
+	Currency             string     `json:"currency"`
+	RefundedAt           *time.Time `json:"refunded_at"`
+}
+
+type paystackRecipientRequest struct {
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	AccountNumber string `json:"account_number"`
+	BankCode      string `json:"bank_code"`
+	Currency      string `json:"currency"`
+}
+
+type paystackRecipient struct {
+	RecipientCode string `json:"recipient_code"`
+}
+
+type paystackTransferRequest struct {
+	Source    string `json:"source"`
+	Amount    int64  `json:"amount"`
+	Recipient string `json:"recipient"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason,omitempty"`
+	Currency  string `json:"currency"`
+}
+
+// paystackTransfer is the transfer returned when it is initiated and carried in the transfer webhooks
+type paystackTransfer struct {
+	ID            paystackID `json:"id"`
+	Reference     string     `json:"reference"`
+	TransferCode  string     `json:"transfer_code"`
+	Status        string     `json:"status"`
+	TransferredAt *time.Time `json:"transferred_at"`
+}
+
+// paystackTransferStatus maps the status of a paystack transfer to the status of the payout record
+func paystackTransferStatus(status string) model.PayoutStatus {
+	switch status {
+	case "success":
+		return model.PayoutStatusPaid
+	case "failed", "reversed", "abandoned", "rejected":
+		return model.PayoutStatusFailed
+	default: // pending, received, processing, otp (otp has to be disabled on the integration for transfers to go through without a person)
+		return model.PayoutStatusProcessing
+	}
+}
+
+// paystackRefundStatus maps the status of a paystack refund to the status of the refund record
+func paystackRefundStatus(status string) model.RefundStatus {
+	switch status {
+	case "processed":
+		return model.RefundStatusProcessed
+	case "failed":
+		return model.RefundStatusFailed
+	default: // pending, processing, needs-attention
+		return model.RefundStatusPending
+	}
+}
+
+// paystackStatus maps the status of a paystack transaction to the status of the transaction record
+func paystackStatus(status string) model.PaymentStatus {
+	switch status {
+	case "success":
+		return model.PaymentStatusSuccessful
+	case "failed", "abandoned", "reversed":
+		return model.PaymentStatusFailed
+	default: // ongoing, pending, processing, queued
+		return model.PaymentStatusPending
+	}
+}
+
+func (p *PaystackGateway) InitiateTransaction(ctx context.Context, req PaymentRequest) (transactionID string, paymentUrl string, meta map[string]string, err error) {
+	email := req.Email
+	if email == "" {
+		email = p.config.DefaultEmail
+	}
+	amount := req.Amount
+	if amount.Currency == "" {
+		amount.Currency = money.Currency(p.config.Currency)
+	}
+	reference := fmt.Sprintf("%s-%s-%s", req.EntityType, req.EntityID, uuid.NewString())
+	transaction, err := createPendingTransaction(p.store, model.PaymentProviderPaystack, req, reference, amount)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var res paystackResponse[paystackInitializeData]
+	err = p.do(ctx, http.MethodPost, "/transaction/initialize", paystackInitializeRequest{
+		Email:       email,
+		Amount:      amount.Amount,
+		Currency:    string(amount.Currency),
+		Reference:   reference,
+		CallbackURL: p.config.CallbackURL,
+		Metadata:    req.MetaData,
+	}, &res)
+	meta, err = finishInitiation(p.store, transaction, initiationError(err), map[string]string{
+		"accessCode":       res.Data.AccessCode,
+		"authorizationUrl": res.Data.AuthorizationURL,
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return reference, res.Data.AuthorizationURL, meta, nil
+}
+
+// VerifyTransaction fetches the current state of the transaction from paystack
+func (p *PaystackGateway) VerifyTransaction(ctx context.Context, reference string) (*ProviderTransaction, error) {
+	var res paystackResponse[PaystackTransaction]
+	if err := p.do(ctx, http.MethodGet, "/transaction/verify/"+reference, nil, &res); err != nil {
+		return nil, err
+	}
+	transaction := p.providerTransaction(res.Data)
+	return &transaction, nil
+}
+
+// ParseWebhook validates the signature of the webhook and reads the event it was sent for
+func (p *PaystackGateway) ParseWebhook(header http.Header, body []byte) (*ParsedWebhook, error) {
+	var event paystackWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	return &ParsedWebhook{
+		EventId:        webhookEventId(event.Event, event.Data, body),
+		EventType:      event.Event,
+		SignatureValid: p.validSignature(body, header.Get(PaystackSignatureHeader)),
+	}, nil
+}
+
+// ProcessWebhook applies the charge, refund or transfer of the event to its record
+func (p *PaystackGateway) ProcessWebhook(ctx context.Context, body []byte) error {
+	var event paystackWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return err
+	}
+	switch event.Event {
+	case "charge.success":
+		var data PaystackTransaction
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		return p.applyTransaction(data)
+	case "refund.pending", "refund.processing", "refund.processed", "refund.failed":
+		var data paystackRefund
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		_, err := ApplyRefund(p.store, p.providerRefund(data))
+		return err
+	case "transfer.success", "transfer.failed", "transfer.reversed":
+		var data paystackTransfer
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		_, err := ApplyPayout(p.store, p.providerTransfer(data))
+		return err
+	default:
+		log.Printf("unhandled paystack event: %s", event.Event)
+	}
+	return nil
+}
+
+// Refund asks paystack to return the amount to the customer, paystack processes it later and sends the outcome in a refund webhook
+func (p *PaystackGateway) Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error) {
+	var res paystackResponse[paystackRefund]
+	err := p.do(ctx, http.MethodPost, "/refund", paystackRefundRequest{
+		Transaction:  req.TransactionReference,
+		Amount:       req.Amount.Amount,
+		Currency:     string(req.Amount.Currency),
+		MerchantNote: req.Reason,
+	}, &res)
+	if err != nil {
+		return nil, refundError(err)
+	}
+	refund := p.providerRefund(res.Data)
+	return &refund, nil
+}
+
+// VerifyRefunds lists the refunds paystack has of the transaction
+func (p *PaystackGateway) VerifyRefunds(ctx context.Context, transactionReference string) ([]ProviderRefund, error) {
+	var res paystackResponse[[]paystackRefund]
+	if err := p.do(ctx, http.MethodGet, "/refund?transaction="+url.QueryEscape(transactionReference), nil, &res); err != nil {
+		return nil, err
+	}
+	refunds := make([]ProviderRefund, len(res.Data))
+	for i, data := range res.Data {
+		if data.TransactionReference == "" {
+			data.TransactionReference = transactionReference
+		}
+		refunds[i] = p.providerRefund(data)
+	}
+	return refunds, nil
+}
+
+// Transfer sends the payout to the account, registering the account as a transfer recipient first when it has not been. Paystack sends the outcome in a transfer webhook
+func (p *PaystackGateway) Transfer(ctx context.Context, req TransferRequest) (*ProviderTransfer, error) {
+	amount := req.Amount
+	if amount.Currency == "" {
+		amount.Currency = money.Currency(p.config.Currency)
+	}
+	recipientCode := req.Account.RecipientCode
+	if recipientCode == "" {
+		// paystack expects the code of the bank (e.g. 058), the bank of the store is sent as is
+		var res paystackResponse[paystackRecipient]
+		err := p.do(ctx, http.MethodPost, "/transferrecipient", paystackRecipientRequest{
+			Type:          "nuban",
+			Name:          req.Account.Name,
+			AccountNumber: req.Account.Number,
+			BankCode:      req.Account.Bank,
+			Currency:      string(amount.Currency),
+		}, &res)
+		if err != nil {
+			return nil, paystackTransferError(err)
+		}
+		recipientCode = res.Data.RecipientCode
+	}
+
+	var res paystackResponse[paystackTransfer]
+	err := p.do(ctx, http.MethodPost, "/transfer", paystackTransferRequest{
+		Source:    "balance",
+		Amount:    amount.Amount,
+		Recipient: recipientCode,
+		Reference: req.Reference,
+		Reason:    req.Reason,
+		Currency:  string(amount.Currency),
+	}, &res)
+	if err != nil {
+		return nil, paystackTransferError(err)
+	}
+	if res.Data.Reference == "" {
+		res.Data.Reference = req.Reference
+	}
+	transfer := p.providerTransfer(res.Data)
+	transfer.RecipientCode = recipientCode
+	return &transfer, nil
+}
+
+// paystackTransferError marks the errors paystack rejected the transfer with, a reference that was already sent is not a rejection as the first transfer may go through
+func paystackTransferError(err error) error {
+	var apiErr *paystackError
+	if errors.As(err, &apiErr) && apiErr.statusCode < http.StatusInternalServerError && !strings.Contains(strings.ToLower(apiErr.message), "duplicate") {
+		return fmt.Errorf("%w: %w", ErrTransferRejected, err)
+	}
+	return err
+}
+
+func (p *PaystackGateway) providerTransfer(data paystackTransfer) ProviderTransfer {
+	transfer := ProviderTransfer{
+		Reference:          data.Reference,
+		ProviderTransferId: data.TransferCode,
+		Status:             paystackTransferStatus(data.Status),
+		PaidAt:             data.TransferredAt,
+	}
+	if transfer.Status == model.PayoutStatusFailed {
+		transfer.FailureReason = fmt.Sprintf("transfer %s at paystack", data.Status)
+	}
+	return transfer
+}
+
+func (p *PaystackGateway) providerRefund(data paystackRefund) ProviderRefund {
+	refund := ProviderRefund{
+		ProviderRefundId:     string(data.ID),
+		TransactionReference: data.TransactionReference,
+		Amount:               money.New(data.Amount, money.Currency(strings.ToUpper(data.Currency))),
+		Status:               paystackRefundStatus(data.Status),
+		RefundedAt:           data.RefundedAt,
+	}
+	if refund.Status == model.RefundStatusFailed {
+		refund.FailureReason = "refund failed at paystack"
+	}
+	return refund
+}
+
+func (p *PaystackGateway) validSignature(body []byte, signature string) bool {
+	mac := hmac.New(sha512.New, []byte(p.config.SecretKey))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (p *PaystackGateway) applyTransaction(data PaystackTransaction) error {
+	_, err := ApplyTransaction(p.store, p.providerTransaction(data))
+	return err
+}
+
+func (p *PaystackGateway) providerTransaction(data PaystackTransaction) ProviderTransaction {
+	return ProviderTransaction{
+		Reference:       data.Reference,
+		Status:          paystackStatus(data.Status),
+		Amount:          money.New(data.Amount, money.Currency(strings.ToUpper(data.Currency))),
+		PaidAt:          data.PaidAt,
+		GatewayResponse: data.GatewayResponse,
+	}
+}
+
+func (p *PaystackGateway) do(ctx context.Context, method string, path string, body any, v any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.config.SecretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling paystack %s: %w", path, err)
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var envelope paystackResponse[json.RawMessage]
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("error decoding paystack %s response (status %d): %w", path, res.StatusCode, err)
+	}
+	if res.StatusCode == http.StatusNotFound || (res.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(envelope.Message), "not found")) {
+		return fmt.Errorf("%w: paystack %s: %s", ErrTransactionNotFound, path, envelope.Message)
+	}
+	if res.StatusCode >= http.StatusBadRequest || !envelope.Status {
+		return &paystackError{path: path, statusCode: res.StatusCode, message: envelope.Message}
+	}
+	return json.Unmarshal(raw, v)
 }
-func (p *PaystackGateway) InitiateTransaction(ctx context.Context, req PaymentRequest) (transactionID string, paymentUrl string, meta map[string]string, err error)
-func (p *PaystackGateway) HandleWebhook(w http.ResponseWriter, r *http.Request) error
@@ -0,0 +1,316 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers/paystackfake"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+const testSecretKey = "sk_test_gateway"
+
+// memoryRepo keeps the transactions the gateway saves, the methods the gateway does not use are left to the embedded nil repo
+type memoryRepo struct {
+	repository.PaymentRepo
+
+	mu           sync.Mutex
+	transactions []model.Transaction
+	refunds      []model.Refund
+}
+
+func (m *memoryRepo) CreateTransaction(tx model.Transaction) (*model.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx.ID = len(m.transactions) + 1
+	m.transactions = append(m.transactions, tx)
+	return &tx, nil
+}
+
+func (m *memoryRepo) UpdateTransaction(id int, payload model.Transaction) (*model.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payload.ID = id
+	m.transactions[id-1] = payload
+	return &payload, nil
+}
+
+func (m *memoryRepo) MergeTransactionMetaData(id int, metaData map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	merged := map[string]string{}
+	for k, v := range m.transactions[id-1].MetaData {
+		merged[k] = v
+	}
+	for k, v := range metaData {
+		merged[k] = v
+	}
+	m.transactions[id-1].MetaData = merged
+	return nil
+}
+
+func (m *memoryRepo) GetTransactionByTransactionId(transactionId string) (*model.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tx := range m.transactions {
+		if tx.TransactionId == transactionId {
+			return &tx, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepo) GetRefundByProviderRefundId(providerRefundId string) (*model.Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, refund := range m.refunds {
+		if providerRefundId != "" && refund.ProviderRefundId == providerRefundId {
+			return &refund, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepo) GetUnmatchedRefund(transactionId int, amount money.Money) (*model.Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, refund := range m.refunds {
+		if refund.TransactionId == transactionId && refund.Status == model.RefundStatusPending && refund.ProviderRefundId == "" && refund.Amount == amount {
+			return &refund, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRepo) UpdateRefund(id int, payload model.Refund) (*model.Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payload.ID = id
+	m.refunds[id-1] = payload
+	return &payload, nil
+}
+
+func (m *memoryRepo) saved() []model.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.Transaction{}, m.transactions...)
+}
+
+// newTestGateway points a paystack gateway at the stand-in, handler wraps the stand-in so a test can see or replace what paystack responds
+func newTestGateway(t *testing.T, handler func(fake *paystackfake.Server) http.Handler) (*PaystackGateway, *paystackfake.Server, *memoryRepo) {
+	t.Helper()
+	fake := paystackfake.NewServer(testSecretKey, "")
+	server := httptest.NewServer(handler(fake))
+	t.Cleanup(server.Close)
+	store := &memoryRepo{}
+	return NewPaystackGateway(PaystackConfig{SecretKey: testSecretKey, BaseURL: server.URL}, store), fake, store
+}
+
+func asIs(fake *paystackfake.Server) http.Handler { return fake }
+
+func subscriptionPayment(amount int64) PaymentRequest {
+	return PaymentRequest{
+		Amount:     money.New(amount, money.NGN),
+		EntityID:   "7",
+		EntityType: model.EntityPaymentTypeVendorSubscriptionPayment,
+		MetaData:   map[string]string{"vendorId": "3"},
+	}
+}
+
+func TestPaystackInitiateSavesTheTransactionBeforeCallingPaystack(t *testing.T) {
+	var savedWhenCalled []model.Transaction
+	var store *memoryRepo
+	gateway, _, store := newTestGateway(t, func(fake *paystackfake.Server) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/transaction/initialize" {
+				savedWhenCalled = store.saved()
+			}
+			fake.ServeHTTP(w, r)
+		})
+	})
+
+	reference, paymentUrl, meta, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if err != nil {
+		t.Fatalf("initiate: %v", err)
+	}
+
+	if len(savedWhenCalled) != 1 || savedWhenCalled[0].TransactionId != reference || savedWhenCalled[0].Status != model.PaymentStatusPending {
+		t.Fatalf("saved %+v when paystack was called, want the pending transaction", savedWhenCalled)
+	}
+	saved := store.saved()
+	if len(saved) != 1 || saved[0].Status != model.PaymentStatusPending || saved[0].MetaData["authorizationUrl"] != paymentUrl || saved[0].MetaData["vendorId"] != "3" {
+		t.Errorf("saved %+v, want the pending transaction with the authorization url of paystack", saved)
+	}
+	if meta["accessCode"] == "" {
+		t.Errorf("got meta %v, want the access code of paystack", meta)
+	}
+}
+
+func TestPaystackInitiateMarksARefusedTransactionNotInitiated(t *testing.T) {
+	gateway, _, store := newTestGateway(t, asIs)
+
+	// the stand-in refuses an amount of zero like paystack does
+	_, _, _, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(0))
+	if !errors.Is(err, ErrInitiationRefused) {
+		t.Fatalf("initiate returned %v, want ErrInitiationRefused", err)
+	}
+	if saved := store.saved(); len(saved) != 1 || saved[0].Status != model.PaymentStatusNotInitiated {
+		t.Errorf("saved %+v, want the transaction marked not initiated", saved)
+	}
+}
+
+func TestPaystackInitiateMarksAServerErrorNotInitiated(t *testing.T) {
+	gateway, _, store := newTestGateway(t, func(fake *paystackfake.Server) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"status":false,"message":"upstream error"}`))
+		})
+	})
+
+	_, _, _, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Fatalf("initiate returned %v, want ErrProviderUnavailable", err)
+	}
+	if saved := store.saved(); len(saved) != 1 || saved[0].Status != model.PaymentStatusNotInitiated {
+		t.Errorf("saved %+v, want the transaction marked not initiated", saved)
+	}
+}
+
+func TestPaystackInitiateLeavesAnUnknownOutcomePending(t *testing.T) {
+	answer := make(chan struct{})
+	defer close(answer)
+	gateway, _, store := newTestGateway(t, func(fake *paystackfake.Server) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// paystack got the request but did not answer in time
+			<-answer
+		})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	_, _, _, err := gateway.InitiateTransaction(ctx, subscriptionPayment(500000))
+	if err == nil || errors.Is(err, ErrInitiationRefused) || errors.Is(err, ErrProviderUnavailable) {
+		t.Fatalf("initiate returned %v, want an error that leaves the outcome unknown", err)
+	}
+	if saved := store.saved(); len(saved) != 1 || saved[0].Status != model.PaymentStatusPending {
+		t.Errorf("saved %+v, want the transaction left pending for its webhook or the reconciler", saved)
+	}
+}
+
+func TestPaystackWebhookSettlesTheTransaction(t *testing.T) {
+	gateway, fake, store := newTestGateway(t, asIs)
+	reference, _, _, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if err != nil {
+		t.Fatalf("initiate: %v", err)
+	}
+	if err := fake.Complete(reference, "success"); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	body, signature, err := fake.WebhookBody(reference)
+	if err != nil {
+		t.Fatalf("webhook body: %v", err)
+	}
+
+	parsed, err := gateway.ParseWebhook(http.Header{PaystackSignatureHeader: []string{signature}}, body)
+	if err != nil || !parsed.SignatureValid || parsed.EventType != "charge.success" {
+		t.Fatalf("parsed %+v (%v), want a valid charge.success webhook", parsed, err)
+	}
+	if err := gateway.ProcessWebhook(context.Background(), body); err != nil {
+		t.Fatalf("process webhook: %v", err)
+	}
+	if saved := store.saved(); saved[0].Status != model.PaymentStatusSuccessful || saved[0].PaidAt == nil {
+		t.Errorf("saved %+v, want the transaction paid", saved[0])
+	}
+}
+
+func TestPaystackWebhookFlagsAPaymentOfTheWrongAmount(t *testing.T) {
+	gateway, fake, store := newTestGateway(t, asIs)
+	reference, _, _, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if err != nil {
+		t.Fatalf("initiate: %v", err)
+	}
+	// the transaction is for more than was sent to paystack
+	store.transactions[0].Amount = money.New(600000, money.NGN)
+	fake.Complete(reference, "success")
+	body, _, err := fake.WebhookBody(reference)
+	if err != nil {
+		t.Fatalf("webhook body: %v", err)
+	}
+
+	if err := gateway.ProcessWebhook(context.Background(), body); !errors.Is(err, ErrAmountMismatch) {
+		t.Fatalf("process webhook returned %v, want ErrAmountMismatch", err)
+	}
+	saved := store.saved()
+	if saved[0].Status != model.PaymentStatusAmountMismatch || saved[0].MetaData["amountPaid"] == "" {
+		t.Errorf("saved %+v, want the transaction flagged with the amount paid", saved[0])
+	}
+	// the webhook sent again leaves the flagged transaction as is
+	if err := gateway.ProcessWebhook(context.Background(), body); err != nil {
+		t.Errorf("processing the webhook again returned %v, want nil", err)
+	}
+}
+
+// paidTransaction initiates a transaction and has the customer pay it at the stand-in
+func paidTransaction(t *testing.T, gateway *PaystackGateway, fake *paystackfake.Server, store *memoryRepo) model.Transaction {
+	t.Helper()
+	reference, _, _, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if err != nil {
+		t.Fatalf("initiate: %v", err)
+	}
+	fake.Complete(reference, "success")
+	store.transactions[0].Status = model.PaymentStatusSuccessful
+	return store.saved()[0]
+}
+
+func TestPaystackRefundOfAnUnpaidTransactionIsRejected(t *testing.T) {
+	gateway, _, _ := newTestGateway(t, asIs)
+	reference, _, _, err := gateway.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if err != nil {
+		t.Fatalf("initiate: %v", err)
+	}
+
+	_, err = gateway.Refund(context.Background(), RefundRequest{TransactionReference: reference, Reference: "refund-1", Amount: money.New(500000, money.NGN)})
+	if !errors.Is(err, ErrRefundRejected) {
+		t.Errorf("refund returned %v, want ErrRefundRejected", err)
+	}
+}
+
+func TestPaystackRefundWebhookSettlesARefundPaystackDidNotAnswerFor(t *testing.T) {
+	gateway, fake, store := newTestGateway(t, asIs)
+	transaction := paidTransaction(t, gateway, fake, store)
+	// paystack made the refund but its answer was lost, the refund was left pending without the id of paystack
+	store.refunds = []model.Refund{{ID: 1, TransactionId: transaction.ID, Reference: "refund-1", Amount: money.New(200000, money.NGN), Status: model.RefundStatusPending}}
+	if _, err := gateway.Refund(context.Background(), RefundRequest{TransactionReference: transaction.TransactionId, Reference: "refund-1", Amount: money.New(200000, money.NGN)}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+
+	listed, err := gateway.VerifyRefunds(context.Background(), transaction.TransactionId)
+	if err != nil || len(listed) != 1 || listed[0].Amount != money.New(200000, money.NGN) {
+		t.Fatalf("listed %+v (%v), want the refund paystack made", listed, err)
+	}
+	body, err := json.Marshal(map[string]any{"event": "refund.processed", "data": map[string]any{
+		"id":                    listed[0].ProviderRefundId,
+		"status":                "processed",
+		"transaction_reference": transaction.TransactionId,
+		"amount":                200000,
+		"currency":              "NGN",
+	}})
+	if err != nil {
+		t.Fatalf("webhook body: %v", err)
+	}
+	if err := gateway.ProcessWebhook(context.Background(), body); err != nil {
+		t.Fatalf("process webhook: %v", err)
+	}
+	if refund := store.refunds[0]; refund.Status != model.RefundStatusProcessed || refund.ProviderRefundId != listed[0].ProviderRefundId {
+		t.Errorf("saved %+v, want the refund processed with the id of paystack", refund)
+	}
+}
@@ -0,0 +1,479 @@
+// Package paystackfake is a stand-in for the paystack api built from recorded responses, it is used by tests (wrapped in an httptest.Server) and for local runs through cmd/paystack-fake
+package paystackfake
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Fixture returns a recorded paystack payload by its file name without the extension, e.g. verify_success
+func Fixture(name string) []byte {
+	data, err := fixtures.ReadFile("fixtures/" + name + ".json")
+	if err != nil {
+		panic(fmt.Sprintf("paystack fixture %s does not exist", name))
+	}
+	return data
+}
+
+// Sign returns the signature paystack sends in the X-Paystack-Signature header of a webhook
+func Sign(secretKey string, body []byte) string {
+	mac := hmac.New(sha512.New, []byte(secretKey))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type transaction struct {
+	Reference string
+	Amount    int64
+	Currency  string
+	Email     string
+	Metadata  map[string]string
+	Status    string
+	PaidAt    *time.Time
+}
+
+type refund struct {
+	ID                   int64
+	TransactionReference string
+	Amount               int64
+	Currency             string
+	Status               string
+}
+
+type transfer struct {
+	ID            int64
+	Reference     string
+	TransferCode  string
+	Amount        int64
+	Currency      string
+	Reason        string
+	Recipient     string
+	Status        string
+	TransferredAt *time.Time
+}
+
+// Server implements the initialize, verify, refund, list refunds, transfer recipient and transfer endpoints, a checkout page that completes the payment and sends the signed charge.success webhook
+// and completes every transfer shortly after it is queued with the signed transfer.success webhook
+type Server struct {
+	secretKey  string
+	webhookURL string // the checkout page and transfers do not send a webhook when empty
+	baseURL    string
+
+	mu           sync.Mutex
+	transactions map[string]*transaction
+	refunds      []*refund
+	recipients   map[string]bool
+	transfers    map[string]*transfer
+}
+
+func NewServer(secretKey string, webhookURL string) *Server {
+	return &Server{secretKey: secretKey, webhookURL: webhookURL, transactions: make(map[string]*transaction), recipients: make(map[string]bool), transfers: make(map[string]*transfer)}
+}
+
+// SetBaseURL sets the url the authorization urls point to, it defaults to the host of the initialize request
+func (s *Server) SetBaseURL(url string) {
+	s.baseURL = strings.TrimSuffix(url, "/")
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.secretKey && !strings.HasPrefix(r.URL.Path, "/checkout/") {
+		writeJson(w, http.StatusUnauthorized, map[string]any{"status": false, "message": "Invalid key"})
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/transaction/initialize":
+		s.initialize(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/transaction/verify/"):
+		s.verify(w, strings.TrimPrefix(r.URL.Path, "/transaction/verify/"))
+	case r.Method == http.MethodPost && r.URL.Path == "/refund":
+		s.refund(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/refund":
+		s.listRefunds(w, r.URL.Query().Get("transaction"))
+	case r.Method == http.MethodPost && r.URL.Path == "/transferrecipient":
+		s.transferRecipient(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/transfer":
+		s.transfer(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/checkout/"):
+		s.checkout(w, strings.TrimPrefix(r.URL.Path, "/checkout/"))
+	default:
+		writeJson(w, http.StatusNotFound, map[string]any{"status": false, "message": "Not found"})
+	}
+}
+
+func (s *Server) initialize(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email     string            `json:"email"`
+		Amount    int64             `json:"amount"`
+		Currency  string            `json:"currency"`
+		Reference string            `json:"reference"`
+		Metadata  map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Amount <= 0 || req.Reference == "" {
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Invalid request, email, amount and reference are required"})
+		return
+	}
+
+	s.mu.Lock()
+	if _, exists := s.transactions[req.Reference]; exists {
+		s.mu.Unlock()
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Duplicate Transaction Reference"})
+		return
+	}
+	s.transactions[req.Reference] = &transaction{
+		Reference: req.Reference,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Email:     req.Email,
+		Metadata:  req.Metadata,
+		Status:    "ongoing",
+	}
+	s.mu.Unlock()
+
+	baseURL := s.baseURL
+	if baseURL == "" {
+		baseURL = "http://" + r.Host
+	}
+	response := fixture("initialize_success")
+	data := response["data"].(map[string]any)
+	data["reference"] = req.Reference
+	data["authorization_url"] = baseURL + "/checkout/" + req.Reference
+	writeJson(w, http.StatusOK, response)
+}
+
+func (s *Server) verify(w http.ResponseWriter, reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.transactions[reference]
+	if !ok {
+		writeJson(w, http.StatusBadRequest, fixture("verify_not_found"))
+		return
+	}
+	writeJson(w, http.StatusOK, s.transactionPayload("verify", tx))
+}
+
+// refund queues a refund of a successful transaction, it stays pending as the stand-in does not process refunds
+func (s *Server) refund(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Transaction  string `json:"transaction"`
+		Amount       int64  `json:"amount"`
+		MerchantNote string `json:"merchant_note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Transaction == "" {
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Transaction reference is required"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.transactions[req.Transaction]
+	if !ok {
+		writeJson(w, http.StatusBadRequest, fixture("verify_not_found"))
+		return
+	}
+	if tx.Status != "success" {
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Cannot refund a transaction that was not successful"})
+		return
+	}
+	if req.Amount == 0 {
+		req.Amount = tx.Amount
+	}
+	if req.Amount > tx.Amount {
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Refund amount cannot be more than the transaction amount"})
+		return
+	}
+	rf := &refund{ID: int64(len(s.refunds) + 1), TransactionReference: tx.Reference, Amount: req.Amount, Currency: tx.Currency, Status: "pending"}
+	s.refunds = append(s.refunds, rf)
+
+	response := fixture("refund_pending")
+	data := response["data"].(map[string]any)
+	data["id"] = rf.ID
+	data["amount"] = req.Amount
+	data["currency"] = tx.Currency
+	data["merchant_note"] = req.MerchantNote
+	if transaction, ok := data["transaction"].(map[string]any); ok {
+		transaction["reference"] = tx.Reference
+		transaction["amount"] = tx.Amount
+		transaction["currency"] = tx.Currency
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+// listRefunds lists the refunds of the transaction, the refunds are listed like the refund webhooks carry them
+func (s *Server) listRefunds(w http.ResponseWriter, reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := []map[string]any{}
+	for _, rf := range s.refunds {
+		if rf.TransactionReference != reference {
+			continue
+		}
+		data = append(data, map[string]any{
+			"id":                    rf.ID,
+			"transaction_reference": rf.TransactionReference,
+			"amount":                rf.Amount,
+			"currency":              rf.Currency,
+			"status":                rf.Status,
+		})
+	}
+	writeJson(w, http.StatusOK, map[string]any{"status": true, "message": "Refunds retrieved", "data": data})
+}
+
+func (s *Server) transferRecipient(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type          string `json:"type"`
+		Name          string `json:"name"`
+		AccountNumber string `json:"account_number"`
+		BankCode      string `json:"bank_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AccountNumber == "" || req.BankCode == "" {
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Account number and bank code are required"})
+		return
+	}
+
+	s.mu.Lock()
+	code := fmt.Sprintf("RCP_%s%s", req.BankCode, req.AccountNumber)
+	s.recipients[code] = true
+	s.mu.Unlock()
+
+	response := fixture("transferrecipient_success")
+	data := response["data"].(map[string]any)
+	data["recipient_code"] = code
+	data["name"] = req.Name
+	if details, ok := data["details"].(map[string]any); ok {
+		details["account_number"] = req.AccountNumber
+		details["bank_code"] = req.BankCode
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+// transfer queues the transfer to a recipient, it succeeds a moment later when the server has a webhook url
+func (s *Server) transfer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount    int64  `json:"amount"`
+		Recipient string `json:"recipient"`
+		Reference string `json:"reference"`
+		Reason    string `json:"reason"`
+		Currency  string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 || req.Recipient == "" || req.Reference == "" {
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Invalid request, amount, recipient and reference are required"})
+		return
+	}
+
+	s.mu.Lock()
+	if !s.recipients[req.Recipient] {
+		s.mu.Unlock()
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Recipient specified is invalid"})
+		return
+	}
+	if _, exists := s.transfers[req.Reference]; exists {
+		s.mu.Unlock()
+		writeJson(w, http.StatusBadRequest, map[string]any{"status": false, "message": "Duplicate Transfer Reference"})
+		return
+	}
+	tr := &transfer{
+		ID:           int64(len(s.transfers) + 1),
+		Reference:    req.Reference,
+		TransferCode: fmt.Sprintf("TRF_%d", len(s.transfers)+1),
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		Reason:       req.Reason,
+		Recipient:    req.Recipient,
+		Status:       "pending",
+	}
+	s.transfers[req.Reference] = tr
+	response := s.transferPayload("transfer_pending", tr)
+	s.mu.Unlock()
+
+	if s.webhookURL != "" {
+		go func() {
+			time.Sleep(time.Second)
+			if err := s.CompleteTransfer(req.Reference, "success"); err != nil {
+				log.Printf("error completing paystack transfer %s: %v", req.Reference, err)
+				return
+			}
+			if err := s.SendTransferWebhook(s.webhookURL, req.Reference); err != nil {
+				log.Printf("error sending paystack transfer webhook for %s: %v", req.Reference, err)
+			}
+		}()
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+// CompleteTransfer sets the status of the transfer as if the bank had paid it (success) or not (failed, reversed)
+func (s *Server) CompleteTransfer(reference string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tr, ok := s.transfers[reference]
+	if !ok {
+		return fmt.Errorf("transfer %s was not queued", reference)
+	}
+	tr.Status = status
+	if status == "success" {
+		now := time.Now().UTC()
+		tr.TransferredAt = &now
+	}
+	return nil
+}
+
+// SendTransferWebhook posts the signed transfer webhook (transfer.success, transfer.failed or transfer.reversed by the status of the transfer) to the url
+func (s *Server) SendTransferWebhook(url string, reference string) error {
+	s.mu.Lock()
+	tr, ok := s.transfers[reference]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("transfer %s was not queued", reference)
+	}
+	payload := s.transferPayload("webhook_transfer_success", tr)
+	payload["event"] = "transfer." + tr.Status
+	s.mu.Unlock()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(url, body, Sign(s.secretKey, body))
+}
+
+// transferPayload fills the recorded transfer response or webhook with the transfer, it is called with mu held
+func (s *Server) transferPayload(name string, tr *transfer) map[string]any {
+	payload := fixture(name)
+	data := payload["data"].(map[string]any)
+	data["id"] = tr.ID
+	data["reference"] = tr.Reference
+	data["transfer_code"] = tr.TransferCode
+	data["amount"] = tr.Amount
+	data["currency"] = tr.Currency
+	data["reason"] = tr.Reason
+	data["status"] = tr.Status
+	if _, ok := data["transferred_at"]; ok {
+		data["transferred_at"] = tr.TransferredAt
+	}
+	if recipient, ok := data["recipient"].(map[string]any); ok {
+		recipient["recipient_code"] = tr.Recipient
+	}
+	return payload
+}
+
+// checkout stands in for the page the customer pays on
+func (s *Server) checkout(w http.ResponseWriter, reference string) {
+	if err := s.Complete(reference, "success"); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if s.webhookURL != "" {
+		if err := s.SendWebhook(s.webhookURL, reference); err != nil {
+			log.Printf("error sending paystack webhook for %s: %v", reference, err)
+		}
+	}
+	fmt.Fprintf(w, "payment %s completed", reference)
+}
+
+// Complete sets the status of the transaction as if the customer had paid (success) or left (abandoned, failed)
+func (s *Server) Complete(reference string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.transactions[reference]
+	if !ok {
+		return fmt.Errorf("transaction %s was not initialized", reference)
+	}
+	tx.Status = status
+	if status == "success" {
+		now := time.Now().UTC()
+		tx.PaidAt = &now
+	}
+	return nil
+}
+
+// WebhookBody returns the charge.success webhook of the transaction and its signature
+func (s *Server) WebhookBody(reference string) (body []byte, signature string, err error) {
+	s.mu.Lock()
+	tx, ok := s.transactions[reference]
+	if !ok {
+		s.mu.Unlock()
+		return nil, "", fmt.Errorf("transaction %s was not initialized", reference)
+	}
+	body, err = json.Marshal(s.transactionPayload("webhook", tx))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	return body, Sign(s.secretKey, body), nil
+}
+
+// SendWebhook posts the signed charge.success webhook of the transaction to the url
+func (s *Server) SendWebhook(url string, reference string) error {
+	body, signature, err := s.WebhookBody(reference)
+	if err != nil {
+		return err
+	}
+	return post(url, body, signature)
+}
+
+func post(url string, body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Paystack-Signature", signature)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// transactionPayload fills the recorded verify response or webhook with the transaction, it is called with mu held
+func (s *Server) transactionPayload(kind string, tx *transaction) map[string]any {
+	name := "verify_success"
+	if kind == "webhook" {
+		name = "webhook_charge_success"
+	}
+	payload := fixture(name)
+	data := payload["data"].(map[string]any)
+	data["reference"] = tx.Reference
+	data["amount"] = tx.Amount
+	data["currency"] = tx.Currency
+	data["status"] = tx.Status
+	data["metadata"] = tx.Metadata
+	data["paid_at"] = tx.PaidAt
+	if tx.Status != "success" {
+		data["gateway_response"] = "The transaction was not completed"
+	}
+	if customer, ok := data["customer"].(map[string]any); ok {
+		customer["email"] = tx.Email
+	}
+	return payload
+}
+
+func fixture(name string) map[string]any {
+	var payload map[string]any
+	if err := json.Unmarshal(Fixture(name), &payload); err != nil {
+		panic(fmt.Sprintf("paystack fixture %s is not valid json: %v", name, err))
+	}
+	return payload
+}
+
+func writeJson(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
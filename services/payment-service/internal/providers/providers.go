@@ -2,21 +2,188 @@ package providers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
 )
 
+var (
+	ErrInvalidSignature    = errors.New("invalid webhook signature")
+	ErrAmountMismatch      = errors.New("amount paid does not match the transaction")
+	ErrTransactionNotFound = errors.New("transaction not found at provider")
+	// ErrInitiationRefused is returned when the provider refused to initiate the transaction
+	ErrInitiationRefused = errors.New("transaction refused by the provider")
+	// ErrProviderUnavailable is returned when the provider could not be reached or failed before it initiated the transaction.
+	// Any error other than this and ErrInitiationRefused leaves it unknown whether the provider initiated the transaction
+	ErrProviderUnavailable = errors.New("payment provider unavailable")
+	// ErrRefundRejected is returned when the provider refused the refund or was never asked for it, any other error leaves it unknown whether the refund was made
+	ErrRefundRejected = errors.New("refund rejected by the provider")
+)
+
+// apiError is a request a provider responded to with an error
+type apiError interface {
+	error
+	response() (statusCode int, message string)
+}
+
+// initiationError marks the errors of asking a provider to initiate a transaction that show the provider did not initiate it. A provider that could not be connected to,
+// or answered with a server error (which carries no reference of a transaction) is unavailable, one that answered with a client error refused the transaction.
+// A reference that was already sent is not a refusal as the first request may have gone through
+func initiationError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return fmt.Errorf("%w: %w", ErrProviderUnavailable, err)
+	}
+	var apiErr apiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	statusCode, message := apiErr.response()
+	switch {
+	case statusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: %w", ErrProviderUnavailable, err)
+	case !strings.Contains(strings.ToLower(message), "duplicate"):
+		return fmt.Errorf("%w: %w", ErrInitiationRefused, err)
+	}
+	return err
+}
+
+// refundError marks the errors of asking a provider for a refund that show the provider did not make it, the provider could not be connected to or answered with a client error.
+// A server error or no answer at all leaves it unknown whether the refund was made
+func refundError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return fmt.Errorf("%w: %w", ErrRefundRejected, err)
+	}
+	var apiErr apiError
+	if errors.As(err, &apiErr) {
+		if statusCode, _ := apiErr.response(); statusCode < http.StatusInternalServerError {
+			return fmt.Errorf("%w: %w", ErrRefundRejected, err)
+		}
+	}
+	return err
+}
+
 type PaymentRequest struct {
-	Amount     float64
+	Amount     money.Money // the currency of the provider config is used when the currency is empty
+	Email      string      // email of the customer, required by some providers
 	EntityID   string
 	EntityType model.EntityPaymentType
 	MetaData   map[string]string
 }
 
 type PaymentGateway interface {
-	InitiateTransaction(ctx context.Context, req PaymentRequest) (transactionID string, paymentUrl string, meta map[string]string, err error)
-	HandleWebhook(w http.ResponseWriter, r *http.Request) error
+	InitiateTransaction(ctx context.Context, req PaymentRequest) (transactionID string, paymentUrl string, meta map[string]string, err error) // returns ErrInitiationRefused or ErrProviderUnavailable when the transaction was not initiated
+	ParseWebhook(header http.Header, body []byte) (*ParsedWebhook, error)                                                                     // an invalid signature is reported in the result rather than as an error so the webhook can still be stored
+	ProcessWebhook(ctx context.Context, body []byte) error                                                                                    // applies the event of a webhook whose signature was valid
+	VerifyTransaction(ctx context.Context, transactionID string) (*ProviderTransaction, error)                                                // returns ErrTransactionNotFound when the provider has no record of the transaction
+	Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error)                                                                   // returns ErrRefundRejected when the refund was not made
+}
+
+// RefundVerifier is implemented by the providers whose refunds can be listed by transaction, the reconciler settles the refunds the provider did not answer for with it
+type RefundVerifier interface {
+	VerifyRefunds(ctx context.Context, transactionReference string) ([]ProviderRefund, error)
+}
+
+// ParsedWebhook is what a provider reads from a webhook before it is stored
+type ParsedWebhook struct {
+	EventId        string // identifies the event with the provider, the same event sent again has the same id
+	EventType      string
+	SignatureValid bool
+}
+
+// webhookEventId identifies the event by its type and the id of its data, providers send the same event again with the same data.
+// The hash of the body is used when the data has no id
+func webhookEventId(eventType string, data json.RawMessage, body []byte) string {
+	var ref struct {
+		ID any `json:"id"`
+	}
+	if err := json.Unmarshal(data, &ref); err == nil && ref.ID != nil {
+		return fmt.Sprintf("%s:%v", eventType, ref.ID)
+	}
+	sum := sha256.Sum256(body)
+	return eventType + ":" + hex.EncodeToString(sum[:])
+}
+
+type RefundRequest struct {
+	TransactionReference string // reference of the refunded transaction with the provider
+	Reference            string // reference of the refund
+	Amount               money.Money
+	Reason               string
+}
+
+// ProviderRefund is the state of a refund as reported by a provider
+type ProviderRefund struct {
+	ProviderRefundId     string
+	TransactionReference string      // reference of the refunded transaction, a refund whose provider refund id was not saved is matched by it and the amount
+	Amount               money.Money // the currency of the transaction when the currency is empty
+	Status               model.RefundStatus
+	FailureReason        string
+	RefundedAt           *time.Time
+}
+
+// createPendingTransaction saves the transaction before the provider is asked to initiate it, so a transaction the provider initiated always has a record for its webhook and the reconciler to settle
+func createPendingTransaction(store repository.PaymentRepo, provider model.PaymentProvider, req PaymentRequest, reference string, amount money.Money) (*model.Transaction, error) {
+	entityId, err := strconv.Atoi(req.EntityID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid entity id %q: %w", req.EntityID, err)
+	}
+	meta := map[string]string{}
+	for k, v := range req.MetaData {
+		meta[k] = v
+	}
+	return store.CreateTransaction(model.Transaction{
+		Provider:          provider,
+		TransactionId:     reference,
+		MetaData:          meta,
+		EntityId:          entityId,
+		Amount:            amount,
+		EntityPaymentType: req.EntityType,
+		Status:            model.PaymentStatusPending,
+	})
+}
+
+// finishInitiation records what the provider returned for the pending transaction and returns its meta data. A transaction the provider did not initiate is marked not initiated,
+// one whose outcome is unknown is left pending for its webhook or the reconciler
+func finishInitiation(store repository.PaymentRepo, transaction *model.Transaction, initiateErr error, providerMeta map[string]string) (map[string]string, error) {
+	if initiateErr != nil {
+		if errors.Is(initiateErr, ErrInitiationRefused) || errors.Is(initiateErr, ErrProviderUnavailable) {
+			transaction.Status = model.PaymentStatusNotInitiated
+			transaction.MetaData["initiationError"] = initiateErr.Error()
+			if _, err := store.UpdateTransaction(transaction.ID, *transaction); err != nil {
+				log.Printf("error marking transaction %s as not initiated: %v", transaction.TransactionId, err)
+			}
+		}
+		return nil, initiateErr
+	}
+	for k, v := range providerMeta {
+		transaction.MetaData[k] = v
+	}
+	if err := store.MergeTransactionMetaData(transaction.ID, providerMeta); err != nil {
+		// the transaction was initiated, failing here would have it initiated again
+		log.Printf("error saving the meta data of transaction %s: %v", transaction.TransactionId, err)
+	}
+	return transaction.MetaData, nil
+}
+
+// PaymentUrl returns the url the customer pays at from the meta data of a transaction the provider initiated
+func PaymentUrl(meta map[string]string) string {
+	if url := meta["authorizationUrl"]; url != "" {
+		return url
+	}
+	return meta["paymentLink"]
 }
 
 var ProviderRegistry = make(map[model.PaymentProvider]PaymentGateway)
@@ -25,3 +192,116 @@ func RegisterProvider(providerType model.PaymentProvider, gateway PaymentGateway
 	ProviderRegistry[providerType] = gateway
 
 }
+
+// ProviderTransaction is the state of a transaction as reported by a provider
+type ProviderTransaction struct {
+	Reference       string
+	Status          model.PaymentStatus
+	Amount          money.Money
+	PaidAt          *time.Time
+	GatewayResponse string
+}
+
+// ApplyTransaction updates the transaction record with the state reported by the provider, updated is false when the record already had that state.
+// Marking the transaction successful emits its payment made event, a payment of the wrong amount flags the transaction and returns ErrAmountMismatch
+func ApplyTransaction(store repository.PaymentRepo, data ProviderTransaction) (updated bool, err error) {
+	transaction, err := store.GetTransactionByTransactionId(data.Reference)
+	if err != nil {
+		return false, err
+	}
+	if transaction == nil {
+		// not initiated by this service, nothing to update and no point in the provider retrying
+		log.Printf("transaction %s does not exist", data.Reference)
+		return false, nil
+	}
+
+	if transaction.Status == data.Status || transaction.Status == model.PaymentStatusAmountMismatch {
+		return false, nil
+	}
+	if data.Status == model.PaymentStatusSuccessful && data.Amount != transaction.Amount {
+		// flagged so it is neither marked paid nor checked again, the error is for the caller to report it
+		transaction.Status = model.PaymentStatusAmountMismatch
+		if transaction.MetaData == nil {
+			transaction.MetaData = map[string]string{}
+		}
+		transaction.MetaData["amountPaid"] = data.Amount.String()
+		transaction.MetaData["gatewayResponse"] = data.GatewayResponse
+		if _, err := store.UpdateTransaction(transaction.ID, *transaction); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("%w: paid %s, expected %s for %s", ErrAmountMismatch, data.Amount, transaction.Amount, data.Reference)
+	}
+
+	transaction.Status = data.Status
+	if data.Status == model.PaymentStatusSuccessful {
+		transaction.PaidAt = data.PaidAt
+		if transaction.PaidAt == nil {
+			now := time.Now()
+			transaction.PaidAt = &now
+		}
+	}
+	if transaction.MetaData == nil {
+		transaction.MetaData = map[string]string{}
+	}
+	transaction.MetaData["gatewayResponse"] = data.GatewayResponse
+	if _, err := store.UpdateTransaction(transaction.ID, *transaction); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ApplyRefund updates the refund record with the state reported by the provider, updated is false when the record already had that state.
+// A processed refund of an order emits the order refunded event
+func ApplyRefund(store repository.PaymentRepo, data ProviderRefund) (updated bool, err error) {
+	refund, err := store.GetRefundByProviderRefundId(data.ProviderRefundId)
+	if err != nil {
+		return false, err
+	}
+	matched := false
+	if refund == nil {
+		// the provider did not answer when the refund was requested so its id was not saved
+		if refund, err = unmatchedRefund(store, data); err != nil {
+			return false, err
+		}
+		matched = refund != nil
+	}
+	if refund == nil {
+		// the provider can notify before the refund request has returned and its id is saved, erroring lets the provider retry the webhook
+		return false, fmt.Errorf("refund %s is not recorded", data.ProviderRefundId)
+	}
+	// a processed or failed refund is final
+	if refund.Status != model.RefundStatusPending || (refund.Status == data.Status && !matched) {
+		return false, nil
+	}
+
+	refund.ProviderRefundId = data.ProviderRefundId
+	refund.Status = data.Status
+	refund.FailureReason = data.FailureReason
+	if data.Status == model.RefundStatusProcessed {
+		refund.RefundedAt = data.RefundedAt
+		if refund.RefundedAt == nil {
+			now := time.Now()
+			refund.RefundedAt = &now
+		}
+	}
+	if _, err := store.UpdateRefund(refund.ID, *refund); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unmatchedRefund returns the pending refund without a provider refund id of the transaction and amount the provider reported, nil when there is none
+func unmatchedRefund(store repository.PaymentRepo, data ProviderRefund) (*model.Refund, error) {
+	if data.TransactionReference == "" || !data.Amount.IsPositive() {
+		return nil, nil
+	}
+	transaction, err := store.GetTransactionByTransactionId(data.TransactionReference)
+	if err != nil || transaction == nil {
+		return nil, err
+	}
+	amount := data.Amount
+	if amount.Currency == "" {
+		amount.Currency = transaction.Amount.Currency
+	}
+	return store.GetUnmatchedRefund(transaction.ID, amount)
+}
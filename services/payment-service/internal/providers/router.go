@@ -0,0 +1,211 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+var ErrNoProviderAvailable = errors.New("no payment provider available")
+
+// MetaAttemptedProviders is the meta data key of the providers tried (in order) before the transaction was created
+const MetaAttemptedProviders = "attemptedProviders"
+
+// Rule routes the payment requests it matches to a provider, an empty field matches any value
+type Rule struct {
+	Provider   model.PaymentProvider   `json:"provider"`
+	Currency   string                  `json:"currency"`
+	EntityType model.EntityPaymentType `json:"entityType"`
+	MinAmount  float64                 `json:"minAmount"` // in major units of the currency of the request
+	MaxAmount  float64                 `json:"maxAmount"` // no upper limit when 0
+	Weight     int                     `json:"weight"`    // share of the matched requests the provider is tried first for, defaults to 1
+}
+
+func (r Rule) matches(req PaymentRequest, currency money.Currency) bool {
+	if r.Currency != "" && !strings.EqualFold(r.Currency, string(currency)) {
+		return false
+	}
+	if r.EntityType != "" && r.EntityType != req.EntityType {
+		return false
+	}
+	if req.Amount.Amount < money.FromMajor(r.MinAmount, currency).Amount {
+		return false
+	}
+	if r.MaxAmount > 0 && req.Amount.Amount > money.FromMajor(r.MaxAmount, currency).Amount {
+		return false
+	}
+	return true
+}
+
+type RouterConfig struct {
+	Rules           []Rule                  `json:"rules"`
+	Fallback        []model.PaymentProvider `json:"fallback"`        // tried in order after the providers of the matched rules
+	DefaultCurrency string                  `json:"defaultCurrency"` // currency of requests that do not specify one
+	Breaker         BreakerConfig           `json:"-"`
+}
+
+// LoadRouterConfig reads the routing rules from a json file, an empty path returns a config that tries the fallback providers in order
+func LoadRouterConfig(path string, fallback ...model.PaymentProvider) (RouterConfig, error) {
+	config := RouterConfig{Fallback: fallback}
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading routing config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error decoding routing config: %w", err)
+	}
+	if len(config.Fallback) == 0 {
+		config.Fallback = fallback
+	}
+	return config, nil
+}
+
+// Router picks the provider of a payment using the routing rules and fails over to the next one when initiation fails. Providers that keep failing are skipped until their circuit breaker lets a trial request through
+type Router struct {
+	registry map[model.PaymentProvider]PaymentGateway
+	config   RouterConfig
+
+	mu       sync.Mutex
+	breakers map[model.PaymentProvider]*CircuitBreaker
+}
+
+func NewRouter(registry map[model.PaymentProvider]PaymentGateway, config RouterConfig) *Router {
+	if config.DefaultCurrency == "" {
+		config.DefaultCurrency = "NGN"
+	}
+	return &Router{registry: registry, config: config, breakers: make(map[model.PaymentProvider]*CircuitBreaker)}
+}
+
+func (r *Router) breaker(provider model.PaymentProvider) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[provider]
+	if !ok {
+		b = NewCircuitBreaker(r.config.Breaker)
+		r.breakers[provider] = b
+	}
+	return b
+}
+
+// BreakerState returns the state of the circuit breaker of the provider
+func (r *Router) BreakerState(provider model.PaymentProvider) BreakerState {
+	return r.breaker(provider).State()
+}
+
+// Route returns the registered providers to try for the request in order, the matched rules are ordered by a weighted draw and followed by the fallback providers
+func (r *Router) Route(req PaymentRequest) []model.PaymentProvider {
+	currency := req.Amount.Currency
+	if currency == "" {
+		currency = money.Currency(r.config.DefaultCurrency)
+	}
+
+	var matched []Rule
+	for _, rule := range r.config.Rules {
+		if rule.matches(req, currency) {
+			matched = append(matched, rule)
+		}
+	}
+
+	var route []model.PaymentProvider
+	seen := map[model.PaymentProvider]bool{}
+	add := func(provider model.PaymentProvider) {
+		if _, ok := r.registry[provider]; !ok || seen[provider] {
+			return
+		}
+		seen[provider] = true
+		route = append(route, provider)
+	}
+	for len(matched) > 0 {
+		i := weightedPick(matched)
+		add(matched[i].Provider)
+		matched = append(matched[:i], matched[i+1:]...)
+	}
+	for _, provider := range r.config.Fallback {
+		add(provider)
+	}
+	return route
+}
+
+func weightedPick(rules []Rule) int {
+	total := 0
+	for _, rule := range rules {
+		total += max(rule.Weight, 1)
+	}
+	n := rand.Intn(total)
+	for i, rule := range rules {
+		n -= max(rule.Weight, 1)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(rules) - 1
+}
+
+// InitiateTransaction initiates the transaction with the first provider on the route that succeeds. Every provider tried has a transaction record of its own,
+// the providers tried before it are also kept in the meta data of the transaction.
+// It only fails over when the provider did not initiate the transaction, an error that leaves that unknown is returned with the transaction left pending for its webhook or the reconciler,
+// as initiating it with another provider could have the customer pay twice
+func (r *Router) InitiateTransaction(ctx context.Context, req PaymentRequest) (provider model.PaymentProvider, transactionID string, paymentUrl string, meta map[string]string, err error) {
+	route := r.Route(req)
+	if len(route) == 0 {
+		return "", "", "", nil, fmt.Errorf("%w: no provider is registered for %s payment of %s", ErrNoProviderAvailable, req.EntityType, req.Amount)
+	}
+
+	var (
+		attempted []string
+		errs      []error
+	)
+	for _, provider := range route {
+		breaker := r.breaker(provider)
+		if !breaker.Allow() {
+			log.Printf("skipping payment provider %s, circuit breaker is open", provider)
+			continue
+		}
+		attempted = append(attempted, string(provider))
+
+		attemptReq := req
+		attemptReq.MetaData = map[string]string{}
+		for k, v := range req.MetaData {
+			attemptReq.MetaData[k] = v
+		}
+		attemptReq.MetaData[MetaAttemptedProviders] = strings.Join(attempted, ",")
+
+		transactionID, paymentUrl, meta, err := r.registry[provider].InitiateTransaction(ctx, attemptReq)
+		breaker.Record(breakerError(ctx, err))
+		if err == nil {
+			return provider, transactionID, paymentUrl, meta, nil
+		}
+		log.Printf("error initiating transaction with %s: %v", provider, err)
+		if !errors.Is(err, ErrInitiationRefused) && !errors.Is(err, ErrProviderUnavailable) {
+			return provider, "", "", nil, fmt.Errorf("%s may have initiated the transaction, not failing over: %w", provider, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(attempted) == 0 {
+		return "", "", "", nil, fmt.Errorf("%w: the circuit breakers of %v are open", ErrNoProviderAvailable, route)
+	}
+	return "", "", "", nil, fmt.Errorf("%w: %w", ErrNoProviderAvailable, errors.Join(errs...))
+}
+
+// breakerError is the error counted against the circuit breaker of the provider, a transaction the provider refused or that the caller gave up on says nothing about the health of the provider
+func breakerError(ctx context.Context, err error) error {
+	if errors.Is(err, ErrInitiationRefused) || ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
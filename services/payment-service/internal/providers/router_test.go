@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+)
+
+// stubGateway initiates every transaction with the error it is given
+type stubGateway struct {
+	err   error
+	calls int
+}
+
+func (s *stubGateway) InitiateTransaction(ctx context.Context, req PaymentRequest) (string, string, map[string]string, error) {
+	s.calls++
+	if s.err != nil {
+		return "", "", nil, s.err
+	}
+	return "ref-" + req.EntityID, "https://pay.example/" + req.EntityID, req.MetaData, nil
+}
+
+func (s *stubGateway) ParseWebhook(header http.Header, body []byte) (*ParsedWebhook, error) {
+	return nil, nil
+}
+
+func (s *stubGateway) ProcessWebhook(ctx context.Context, body []byte) error { return nil }
+
+func (s *stubGateway) VerifyTransaction(ctx context.Context, transactionID string) (*ProviderTransaction, error) {
+	return nil, nil
+}
+
+func (s *stubGateway) Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error) {
+	return nil, nil
+}
+
+func newTestRouter(paystack, flutter *stubGateway) *Router {
+	return NewRouter(map[model.PaymentProvider]PaymentGateway{
+		model.PaymentProviderPaystack: paystack,
+		model.PaymentProviderFlutter:  flutter,
+	}, RouterConfig{Fallback: []model.PaymentProvider{model.PaymentProviderPaystack, model.PaymentProviderFlutter}, Breaker: BreakerConfig{MinRequests: 1}})
+}
+
+func TestRouterFailsOverWhenTheTransactionWasNotInitiated(t *testing.T) {
+	for name, err := range map[string]error{
+		"refused":     ErrInitiationRefused,
+		"unavailable": ErrProviderUnavailable,
+	} {
+		t.Run(name, func(t *testing.T) {
+			paystack, flutter := &stubGateway{err: err}, &stubGateway{}
+			router := newTestRouter(paystack, flutter)
+
+			provider, _, _, meta, err := router.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+			if err != nil {
+				t.Fatalf("initiate: %v", err)
+			}
+			if provider != model.PaymentProviderFlutter || meta[MetaAttemptedProviders] != "paystack,flutter" {
+				t.Errorf("initiated with %s after %s, want flutter after paystack", provider, meta[MetaAttemptedProviders])
+			}
+		})
+	}
+}
+
+func TestRouterDoesNotFailOverWhenTheOutcomeIsUnknown(t *testing.T) {
+	paystack, flutter := &stubGateway{err: context.DeadlineExceeded}, &stubGateway{}
+	router := newTestRouter(paystack, flutter)
+
+	provider, _, _, _, err := router.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNoProviderAvailable) {
+		t.Fatalf("initiate returned %v, want the error of paystack", err)
+	}
+	if provider != model.PaymentProviderPaystack || flutter.calls != 0 {
+		t.Errorf("got provider %q and %d flutter calls, want the transaction left with paystack", provider, flutter.calls)
+	}
+}
+
+func TestRouterOnlyCountsUnavailableProvidersAgainstTheBreaker(t *testing.T) {
+	refusing, unavailable := &stubGateway{err: ErrInitiationRefused}, &stubGateway{err: ErrProviderUnavailable}
+	router := newTestRouter(refusing, unavailable)
+
+	router.InitiateTransaction(context.Background(), subscriptionPayment(500000))
+
+	if state := router.BreakerState(model.PaymentProviderPaystack); state != BreakerStateClosed {
+		t.Errorf("breaker of the refusing provider is %s, want closed", state)
+	}
+	if state := router.BreakerState(model.PaymentProviderFlutter); state != BreakerStateOpen {
+		t.Errorf("breaker of the unavailable provider is %s, want open", state)
+	}
+}
@@ -0,0 +1,231 @@
+// Package reconciliation settles transactions left pending (usually because a webhook was missed) by checking them against the records of their provider
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+)
+
+var ErrAlreadyRunning = errors.New("a reconciliation is already running")
+
+const (
+	DefaultInterval       = time.Minute * 30
+	DefaultGracePeriod    = time.Minute * 15
+	DefaultPaymentTimeout = time.Minute * 30
+	DefaultBatchSize      = 100
+)
+
+type Config struct {
+	Interval    time.Duration // time between runs
+	GracePeriod time.Duration // transactions younger than this are left for their webhook
+	// the time a customer has to pay with the link of a transaction (the checkout payment timeout). Some providers (flutterwave) only have a record of a
+	// transaction once the customer attempts to pay, so one they do not know of is only taken as never initiated after it
+	PaymentTimeout time.Duration
+	BatchSize      int // transactions checked per run
+}
+
+type Reconciler struct {
+	store    repository.PaymentRepo
+	registry map[model.PaymentProvider]providers.PaymentGateway
+	config   Config
+
+	running sync.Mutex
+}
+
+func NewReconciler(store repository.PaymentRepo, registry map[model.PaymentProvider]providers.PaymentGateway, config Config) *Reconciler {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = DefaultGracePeriod
+	}
+	if config.PaymentTimeout <= 0 {
+		config.PaymentTimeout = DefaultPaymentTimeout
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	return &Reconciler{store: store, registry: registry, config: config}
+}
+
+// Run reconciles every interval until the context is cancelled
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.Reconcile(ctx)
+			if err != nil {
+				if !errors.Is(err, ErrAlreadyRunning) {
+					log.Printf("error reconciling transactions: %v", err)
+				}
+				continue
+			}
+			log.Printf("reconciled %d transactions: %d matched, %d fixed, %d mismatched amount, %d unknown at provider, %d failed", report.Checked, report.Matched, report.Fixed, report.MismatchedAmount, report.UnknownAtProvider, report.Failed)
+		}
+	}
+}
+
+// Reconcile checks the pending transactions past the grace period with their provider, fixes the ones the provider has settled and saves the report of the run.
+// A transaction marked successful emits its payment made event like it would from the webhook. The refunds their provider did not answer for are settled in the same run
+func (r *Reconciler) Reconcile(ctx context.Context) (*model.ReconciliationReport, error) {
+	if !r.running.TryLock() {
+		return nil, ErrAlreadyRunning
+	}
+	defer r.running.Unlock()
+
+	report := model.ReconciliationReport{StartedAt: time.Now()}
+	transactions, err := r.store.GetUnsettledTransactions(time.Now().Add(-r.config.GracePeriod), r.config.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range transactions {
+		if ctx.Err() != nil {
+			break
+		}
+		report.Add(r.reconcile(ctx, transaction))
+	}
+	r.reconcileRefunds(ctx)
+	report.FinishedAt = time.Now()
+
+	return r.store.CreateReconciliationReport(report)
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, transaction model.Transaction) model.ReconciliationItem {
+	item := model.ReconciliationItem{
+		TransactionId:  transaction.ID,
+		Reference:      transaction.TransactionId,
+		Provider:       transaction.Provider,
+		PreviousStatus: transaction.Status,
+	}
+
+	// checked transactions go to the back of the queue, one the provider keeps failing for does not hold up the others
+	if err := r.store.SetTransactionCheckedAt(transaction.ID, time.Now()); err != nil {
+		log.Printf("error recording the check of transaction %s: %v", transaction.TransactionId, err)
+	}
+
+	gateway, ok := r.registry[transaction.Provider]
+	if !ok {
+		item.Outcome = model.ReconciliationOutcomeFailed
+		item.Detail = fmt.Sprintf("provider %s is not registered", transaction.Provider)
+		return item
+	}
+	data, err := gateway.VerifyTransaction(ctx, transaction.TransactionId)
+	if err != nil {
+		item.Outcome = model.ReconciliationOutcomeFailed
+		if errors.Is(err, providers.ErrTransactionNotFound) && time.Since(transaction.CreatedAt) < r.config.PaymentTimeout {
+			// the customer may not have tried to pay with the link yet, it stays pending
+			item.Outcome = model.ReconciliationOutcomeMatched
+			item.Detail = "not attempted at the provider yet, left pending until the payment times out"
+			return item
+		}
+		if errors.Is(err, providers.ErrTransactionNotFound) {
+			// saved before the provider was called and the provider never got it or the customer never paid, past the payment timeout nothing can be paid on it
+			item.Outcome = model.ReconciliationOutcomeUnknownAtProvider
+			transaction.Status = model.PaymentStatusNotInitiated
+			if _, uerr := r.store.UpdateTransaction(transaction.ID, transaction); uerr != nil {
+				item.Outcome = model.ReconciliationOutcomeFailed
+				err = fmt.Errorf("%w, marking it not initiated: %w", err, uerr)
+			}
+		}
+		item.Detail = err.Error()
+		return item
+	}
+	item.ProviderStatus = data.Status
+
+	updated, err := providers.ApplyTransaction(r.store, *data)
+	switch {
+	case errors.Is(err, providers.ErrAmountMismatch):
+		item.Outcome = model.ReconciliationOutcomeMismatchedAmount
+		item.Detail = err.Error()
+	case err != nil:
+		item.Outcome = model.ReconciliationOutcomeFailed
+		item.Detail = err.Error()
+	case updated:
+		item.Outcome = model.ReconciliationOutcomeFixed
+	default:
+		item.Outcome = model.ReconciliationOutcomeMatched
+	}
+	return item
+}
+
+// reconcileRefunds settles the refunds left pending because their provider did not answer when they were requested. The refund the provider has of the transaction for the amount
+// is applied to it, a refund the provider has no record of past the grace period was not made and is failed so its amount can be refunded again
+func (r *Reconciler) reconcileRefunds(ctx context.Context) {
+	refunds, err := r.store.GetUnmatchedRefunds(time.Now().Add(-r.config.GracePeriod), r.config.BatchSize)
+	if err != nil {
+		log.Printf("error getting the refunds to reconcile: %v", err)
+		return
+	}
+	var matched, notMade int
+	for _, refund := range refunds {
+		if ctx.Err() != nil {
+			break
+		}
+		found, err := r.reconcileRefund(ctx, refund)
+		if err != nil {
+			log.Printf("error reconciling refund %s: %v", refund.Reference, err)
+			continue
+		}
+		if found {
+			matched++
+		} else {
+			notMade++
+		}
+	}
+	if len(refunds) > 0 {
+		log.Printf("reconciled %d refunds: %d matched, %d not made", len(refunds), matched, notMade)
+	}
+}
+
+func (r *Reconciler) reconcileRefund(ctx context.Context, refund model.Refund) (found bool, err error) {
+	transaction, err := r.store.GetTransactionById(refund.TransactionId)
+	if err != nil {
+		return false, err
+	}
+	if transaction == nil {
+		return false, fmt.Errorf("transaction %d does not exist", refund.TransactionId)
+	}
+	verifier, ok := r.registry[transaction.Provider].(providers.RefundVerifier)
+	if !ok {
+		return false, fmt.Errorf("refunds of provider %s cannot be listed, the refund is left for its webhook", transaction.Provider)
+	}
+	providerRefunds, err := verifier.VerifyRefunds(ctx, transaction.TransactionId)
+	if err != nil {
+		return false, err
+	}
+	for _, data := range providerRefunds {
+		if data.Amount.Currency == "" {
+			data.Amount.Currency = transaction.Amount.Currency
+		}
+		if data.Amount != refund.Amount {
+			continue
+		}
+		recorded, err := r.store.GetRefundByProviderRefundId(data.ProviderRefundId)
+		if err != nil {
+			return false, err
+		}
+		if recorded != nil {
+			continue
+		}
+		data.TransactionReference = transaction.TransactionId
+		_, err = providers.ApplyRefund(r.store, data)
+		return true, err
+	}
+
+	refund.Status = model.RefundStatusFailed
+	refund.FailureReason = fmt.Sprintf("%s has no record of the refund", transaction.Provider)
+	_, err = r.store.UpdateRefund(refund.ID, refund)
+	return false, err
+}
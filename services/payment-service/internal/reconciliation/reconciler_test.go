@@ -0,0 +1,77 @@
+package reconciliation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+// memoryRepo records the updates of transactions, the methods the reconciler does not use are left to the embedded nil repo
+type memoryRepo struct {
+	repository.PaymentRepo
+
+	updated []model.Transaction
+}
+
+func (m *memoryRepo) SetTransactionCheckedAt(id int, at time.Time) error {
+	return nil
+}
+
+func (m *memoryRepo) UpdateTransaction(id int, payload model.Transaction) (*model.Transaction, error) {
+	m.updated = append(m.updated, payload)
+	return &payload, nil
+}
+
+// unknownGateway has no record of any transaction, like flutterwave before the customer attempts to pay
+type unknownGateway struct {
+	providers.PaymentGateway
+}
+
+func (unknownGateway) VerifyTransaction(ctx context.Context, transactionID string) (*providers.ProviderTransaction, error) {
+	return nil, providers.ErrTransactionNotFound
+}
+
+func TestReconcileLeavesTransactionsUnknownAtTheProviderPendingUntilThePaymentTimesOut(t *testing.T) {
+	for name, tc := range map[string]struct {
+		age         time.Duration
+		wantOutcome model.ReconciliationOutcome
+		wantStatus  model.PaymentStatus
+	}{
+		"payment link still open": {age: time.Minute * 20, wantOutcome: model.ReconciliationOutcomeMatched},
+		"payment timed out":       {age: time.Minute * 40, wantOutcome: model.ReconciliationOutcomeUnknownAtProvider, wantStatus: model.PaymentStatusNotInitiated},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := &memoryRepo{}
+			reconciler := NewReconciler(store, map[model.PaymentProvider]providers.PaymentGateway{model.PaymentProviderFlutter: unknownGateway{}}, Config{
+				GracePeriod:    time.Minute * 15,
+				PaymentTimeout: time.Minute * 30,
+			})
+			item := reconciler.reconcile(context.Background(), model.Transaction{
+				ID:            1,
+				Provider:      model.PaymentProviderFlutter,
+				TransactionId: "checkout-7",
+				Amount:        money.New(500000, money.NGN),
+				Status:        model.PaymentStatusPending,
+				Common:        types.Common{CreatedAt: time.Now().Add(-tc.age)},
+			})
+			if item.Outcome != tc.wantOutcome {
+				t.Errorf("outcome is %s (%s), want %s", item.Outcome, item.Detail, tc.wantOutcome)
+			}
+			if tc.wantStatus == "" {
+				if len(store.updated) != 0 {
+					t.Errorf("transaction was updated to %s, want it left pending", store.updated[0].Status)
+				}
+				return
+			}
+			if len(store.updated) != 1 || store.updated[0].Status != tc.wantStatus {
+				t.Errorf("got updates %+v, want the transaction marked %s", store.updated, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package refund returns the money of paid transactions, in full or in part by amount or order items, through the provider the transaction was paid with
+package refund
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+var (
+	ErrIdempotencyKeyRequired = errors.New("an idempotency key is required")
+	ErrTransactionNotFound    = errors.New("transaction does not exist")
+	ErrInvalidRefund          = errors.New("invalid refund")
+)
+
+type Input struct {
+	TransactionId  int
+	IdempotencyKey string             // retrying with the same key returns the refund already created instead of refunding again
+	Amount         money.Money        // amounts without a currency are in the currency of the transaction
+	Items          []model.RefundItem // only for orders, the amount is the sum of the items
+	Reason         string
+}
+
+type Service struct {
+	store    repository.PaymentRepo
+	registry map[model.PaymentProvider]providers.PaymentGateway
+}
+
+func NewService(store repository.PaymentRepo, registry map[model.PaymentProvider]providers.PaymentGateway) *Service {
+	return &Service{store: store, registry: registry}
+}
+
+// Refund records the refund as pending and requests it from the provider of the transaction. The refund is failed when the provider rejects it,
+// otherwise it stays pending until the provider reports it processed (most do so in a webhook) at which point a refunded order emits its event.
+// A refund the provider did not answer for stays pending too, the webhook or the reconciler matches it to the refund the provider made (if any)
+func (s *Service) Refund(ctx context.Context, input Input) (*model.Refund, error) {
+	if input.IdempotencyKey == "" {
+		return nil, ErrIdempotencyKeyRequired
+	}
+	transaction, err := s.store.GetTransactionById(input.TransactionId)
+	if err != nil {
+		return nil, err
+	}
+	if transaction == nil {
+		return nil, fmt.Errorf("%w: %d", ErrTransactionNotFound, input.TransactionId)
+	}
+	amount, err := refundAmount(input, transaction.Amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if len(input.Items) > 0 && transaction.EntityPaymentType != model.EntityPaymentTypeOrderPayment {
+		return nil, fmt.Errorf("%w: items can only be refunded on order payments", ErrInvalidRefund)
+	}
+	gateway, ok := s.registry[transaction.Provider]
+	if !ok {
+		return nil, fmt.Errorf("provider %s of transaction %d is not registered", transaction.Provider, transaction.ID)
+	}
+
+	refund, created, err := s.store.CreateRefund(model.Refund{
+		TransactionId:  transaction.ID,
+		Reference:      fmt.Sprintf("refund-%d-%s", transaction.ID, uuid.NewString()),
+		IdempotencyKey: input.IdempotencyKey,
+		Amount:         amount,
+		Reason:         input.Reason,
+		Items:          input.Items,
+		Status:         model.RefundStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return refund, nil
+	}
+
+	res, err := gateway.Refund(ctx, providers.RefundRequest{
+		TransactionReference: transaction.TransactionId,
+		Reference:            refund.Reference,
+		Amount:               refund.Amount,
+		Reason:               refund.Reason,
+	})
+	if errors.Is(err, providers.ErrRefundRejected) {
+		// the amount is released so the refund can be requested again with a new key
+		refund.Status = model.RefundStatusFailed
+		refund.FailureReason = err.Error()
+		if _, updateErr := s.store.UpdateRefund(refund.ID, *refund); updateErr != nil {
+			return nil, errors.Join(err, updateErr)
+		}
+		return nil, fmt.Errorf("error refunding transaction %d: %w", transaction.ID, err)
+	}
+	if err != nil {
+		// the provider may have made the refund, it stays pending (holding its amount) until the webhook of the provider or the reconciler settles it
+		log.Printf("outcome of refund %s of transaction %d is unknown, leaving it pending: %v", refund.Reference, transaction.ID, err)
+		return refund, nil
+	}
+
+	refund.ProviderRefundId = res.ProviderRefundId
+	refund.Status = res.Status
+	refund.FailureReason = res.FailureReason
+	if res.Status == model.RefundStatusProcessed {
+		refund.RefundedAt = res.RefundedAt
+		if refund.RefundedAt == nil {
+			now := time.Now()
+			refund.RefundedAt = &now
+		}
+	}
+	return s.store.UpdateRefund(refund.ID, *refund)
+}
+
+// refundAmount returns the amount of the refund in the currency of the transaction, zero refunds whatever is left of the transaction
+func refundAmount(input Input, currency money.Currency) (money.Money, error) {
+	amount := inCurrency(input.Amount, currency)
+	if amount.Currency != currency {
+		return money.Money{}, fmt.Errorf("%w: the transaction was paid in %s, not %s", ErrInvalidRefund, currency, amount.Currency)
+	}
+	if amount.IsNegative() {
+		return money.Money{}, fmt.Errorf("%w: amount cannot be negative", ErrInvalidRefund)
+	}
+	if len(input.Items) == 0 {
+		return amount, nil
+	}
+
+	total := money.New(0, currency)
+	seen := map[int]bool{}
+	for i, item := range input.Items {
+		item.Amount = inCurrency(item.Amount, currency)
+		if item.OrderItemId <= 0 || !item.Amount.IsPositive() {
+			return money.Money{}, fmt.Errorf("%w: every item needs an order item id and an amount", ErrInvalidRefund)
+		}
+		if seen[item.OrderItemId] {
+			return money.Money{}, fmt.Errorf("%w: order item %d is listed more than once", ErrInvalidRefund, item.OrderItemId)
+		}
+		seen[item.OrderItemId] = true
+		var err error
+		if total, err = total.Add(item.Amount); err != nil {
+			return money.Money{}, fmt.Errorf("%w: %v", ErrInvalidRefund, err)
+		}
+		input.Items[i] = item
+	}
+	if !amount.IsZero() && amount != total {
+		return money.Money{}, fmt.Errorf("%w: amount %s does not match the items total %s", ErrInvalidRefund, amount, total)
+	}
+	return total, nil
+}
+
+func inCurrency(m money.Money, currency money.Currency) money.Money {
+	if m.Currency == "" {
+		m.Currency = currency
+	}
+	return m
+}
@@ -0,0 +1,122 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+// memoryRepo keeps the refunds of a paid transaction, the methods the service does not use are left to the embedded nil repo
+type memoryRepo struct {
+	repository.PaymentRepo
+
+	transaction model.Transaction
+	refunds     []model.Refund
+}
+
+func (m *memoryRepo) GetTransactionById(id int) (*model.Transaction, error) {
+	if id != m.transaction.ID {
+		return nil, nil
+	}
+	transaction := m.transaction
+	return &transaction, nil
+}
+
+func (m *memoryRepo) CreateRefund(refund model.Refund) (*model.Refund, bool, error) {
+	for _, existing := range m.refunds {
+		if existing.IdempotencyKey == refund.IdempotencyKey {
+			return &existing, false, nil
+		}
+	}
+	if refund.Amount.IsZero() {
+		refund.Amount = m.transaction.Amount
+	}
+	refund.ID = len(m.refunds) + 1
+	m.refunds = append(m.refunds, refund)
+	return &refund, true, nil
+}
+
+func (m *memoryRepo) UpdateRefund(id int, payload model.Refund) (*model.Refund, error) {
+	payload.ID = id
+	m.refunds[id-1] = payload
+	return &payload, nil
+}
+
+// stubGateway answers every refund with the error it is given
+type stubGateway struct {
+	providers.PaymentGateway
+
+	err error
+}
+
+func (s *stubGateway) Refund(ctx context.Context, req providers.RefundRequest) (*providers.ProviderRefund, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &providers.ProviderRefund{ProviderRefundId: "rf-1", Amount: req.Amount, Status: model.RefundStatusPending}, nil
+}
+
+func newTestService(err error) (*Service, *memoryRepo) {
+	store := &memoryRepo{transaction: model.Transaction{
+		ID:                1,
+		Provider:          model.PaymentProviderPaystack,
+		TransactionId:     "order-21",
+		Amount:            money.New(500000, money.NGN),
+		EntityId:          21,
+		EntityPaymentType: model.EntityPaymentTypeOrderPayment,
+		Status:            model.PaymentStatusSuccessful,
+	}}
+	return NewService(store, map[model.PaymentProvider]providers.PaymentGateway{model.PaymentProviderPaystack: &stubGateway{err: err}}), store
+}
+
+func TestRefundFailsOnlyWhenTheProviderRejectsIt(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err        error
+		wantStatus model.RefundStatus
+		wantErr    bool
+	}{
+		"accepted": {wantStatus: model.RefundStatusPending},
+		"rejected": {err: providers.ErrRefundRejected, wantStatus: model.RefundStatusFailed, wantErr: true},
+		"unknown":  {err: context.DeadlineExceeded, wantStatus: model.RefundStatusPending},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service, store := newTestService(tc.err)
+
+			refund, err := service.Refund(context.Background(), Input{TransactionId: 1, IdempotencyKey: "key"})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("refund returned %v, want an error %v", err, tc.wantErr)
+			}
+			if tc.wantErr && !errors.Is(err, providers.ErrRefundRejected) {
+				t.Errorf("refund returned %v, want ErrRefundRejected", err)
+			}
+			if !tc.wantErr && refund.Status != tc.wantStatus {
+				t.Errorf("got refund %+v, want it %s", refund, tc.wantStatus)
+			}
+			if len(store.refunds) != 1 || store.refunds[0].Status != tc.wantStatus {
+				t.Errorf("saved %+v, want the refund %s", store.refunds, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRefundChecksItems(t *testing.T) {
+	service, _ := newTestService(nil)
+	for name, items := range map[string][]model.RefundItem{
+		"no order item id": {{Amount: money.New(1000, money.NGN)}},
+		"no amount":        {{OrderItemId: 4}},
+		"listed twice":     {{OrderItemId: 4, Amount: money.New(1000, money.NGN)}, {OrderItemId: 4, Amount: money.New(1000, money.NGN)}},
+		"other currency":   {{OrderItemId: 4, Amount: money.New(1000, money.USD)}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := service.Refund(context.Background(), Input{TransactionId: 1, IdempotencyKey: name, Items: items})
+			if !errors.Is(err, ErrInvalidRefund) {
+				t.Errorf("refund returned %v, want ErrInvalidRefund", err)
+			}
+		})
+	}
+}
@@ -1,13 +1,66 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/types"
 )
 
+var (
+	ErrTransactionNotRefundable = errors.New("only successful transactions can be refunded")
+	ErrRefundExceedsAmount      = errors.New("refund exceeds the amount left to refund on the transaction")
+	ErrRefundItemNotInOrder     = errors.New("refunded item is not an item of the order")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was used for a refund of another transaction")
+	ErrPayoutSettled            = errors.New("payout is already paid or failed")
+	ErrWebhookNotReplayable     = errors.New("only webhooks with a valid signature that are not being processed can be replayed")
+)
+
 type PaymentRepo interface {
 	GetTransactions(pagination *types.PaginationPayload, filter *model.TransactionFilter) (result []model.Transaction, total int, err error)
 	CreateTransaction(model.Transaction) (data *model.Transaction, err error)
 	UpdateTransaction(id int, payload model.Transaction) (data *model.Transaction, err error)
+	MergeTransactionMetaData(id int, metaData map[string]string) error // adds the keys to the meta data without touching the status a webhook may have changed
 	GetTransactionById(id int) (data *model.Transaction, err error)
+	GetTransactionByTransactionId(transactionId string) (data *model.Transaction, err error)                      // the reference of the transaction with the provider
+	GetTransactionByEntity(entityType model.EntityPaymentType, entityId int) (data *model.Transaction, err error) // the latest transaction of what was paid for
+	GetUnsettledTransactions(createdBefore time.Time, limit int) (result []model.Transaction, err error)          // pending transactions, the ones never checked and then the ones checked longest ago first
+	SetTransactionCheckedAt(id int, checkedAt time.Time) error                                                    // records when the transaction was last checked with its provider
+
+	CreateReconciliationReport(report model.ReconciliationReport) (data *model.ReconciliationReport, err error)
+	GetReconciliationReports(pagination *types.PaginationPayload) (result []model.ReconciliationReport, total int, err error)
+	GetReconciliationReportById(id int) (data *model.ReconciliationReport, err error)
+
+	CreateRefund(refund model.Refund) (data *model.Refund, created bool, err error) // returns the refund with the same idempotency key instead when there is one
+	UpdateRefund(id int, payload model.Refund) (data *model.Refund, err error)
+	GetRefundById(id int) (data *model.Refund, err error)
+	GetRefundByReference(reference string) (data *model.Refund, err error)
+	GetRefundByProviderRefundId(providerRefundId string) (data *model.Refund, err error)
+	GetUnmatchedRefund(transactionId int, amount money.Money) (data *model.Refund, err error)  // the oldest pending refund of the amount whose provider did not answer when it was requested, it has no provider refund id
+	GetUnmatchedRefunds(createdBefore time.Time, limit int) (result []model.Refund, err error) // pending refunds with no provider refund id, oldest first
+	GetRefundsByTransactionId(transactionId int) (result []model.Refund, err error)
+
+	SavePayoutAccount(account model.PayoutAccount) error
+	GetPayoutAccount(storeId int) (data *model.PayoutAccount, err error)
+	SetPayoutRecipientCode(storeId int, number string, recipientCode string) error
+	CreatePayoutBatch(batch model.PayoutBatch) (data *model.PayoutBatch, err error)
+	UpdatePayoutBatch(id int, payload model.PayoutBatch) (data *model.PayoutBatch, err error)
+	GetPayoutBatches(pagination *types.PaginationPayload) (result []model.PayoutBatch, total int, err error)
+	CreatePayout(payout model.Payout) (data *model.Payout, err error)
+	UpdatePayout(id int, payload model.Payout) (data *model.Payout, err error) // a paid or failed payout cannot change status
+	GetPayoutById(id int) (data *model.Payout, err error)
+	GetPayoutByReference(reference string) (data *model.Payout, err error)
+	GetPayouts(pagination *types.PaginationPayload, filter *model.PayoutFilter) (result []model.Payout, total int, err error)
+	GetPendingPayouts(afterId int, limit int) (result []model.Payout, err error) // pending payouts with an id above afterId, by id
+
+	CreateWebhookEvent(event model.WebhookEvent) (data *model.WebhookEvent, created bool, err error) // returns the webhook with the same provider event id instead when there is one
+	GetWebhookEventById(id int) (data *model.WebhookEvent, err error)
+	GetWebhookEvents(pagination *types.PaginationPayload, filter *model.WebhookEventFilter) (result []model.WebhookEvent, total int, err error)
+	GetPendingWebhookEvents(staleBefore time.Time, maxAttempts int, limit int) (result []model.WebhookEvent, err error) // received, failed with attempts left or processing since before staleBefore, oldest first
+	ClaimWebhookEvent(id int, staleBefore time.Time) (claimed bool, err error)                                          // marks the webhook as processing and counts the attempt, false when it is settled or processed elsewhere
+	FinishWebhookEvent(id int, status model.WebhookStatus, lastError string) error
+	ReplayWebhookEvent(id int) error                             // marks the webhook as received again, returns ErrWebhookNotReplayable when it cannot be
+	DeleteWebhookEvents(receivedBefore time.Time) (int64, error) // deletes the processed, failed and rejected webhooks received before the time
 }
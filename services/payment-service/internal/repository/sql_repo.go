@@ -1,15 +1,25 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/ledger"
 	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/outbox"
 	"github.com/kaasikodes/shop-ease/shared/types"
+	"github.com/kaasikodes/shop-ease/shared/utils"
 )
 
+const eventProducer = "payment-service"
+
 type SqlPaymentRepo struct {
 	db *sql.DB
 }
@@ -21,8 +31,8 @@ func NewSqlPaymentRepo(db *sql.DB) *SqlPaymentRepo {
 
 func (p *SqlPaymentRepo) CreateTransaction(tx model.Transaction) (*model.Transaction, error) {
 	const query = `
-		INSERT INTO transactions (provider, transaction_id, meta_data, entity_id, amount, entity_payment_type, status, paid_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO transactions (provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type, status, paid_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	metaDataJson, err := json.Marshal(tx.MetaData)
@@ -35,7 +45,8 @@ func (p *SqlPaymentRepo) CreateTransaction(tx model.Transaction) (*model.Transac
 		tx.TransactionId,
 		string(metaDataJson),
 		tx.EntityId,
-		tx.Amount,
+		tx.Amount.Amount,
+		tx.Amount.Currency,
 		tx.EntityPaymentType,
 		tx.Status,
 		tx.PaidAt,
@@ -55,7 +66,7 @@ func (p *SqlPaymentRepo) CreateTransaction(tx model.Transaction) (*model.Transac
 
 func (p *SqlPaymentRepo) GetTransactionById(id int) (*model.Transaction, error) {
 	const query = `
-		SELECT id, provider, transaction_id, meta_data, entity_id, amount, entity_payment_type, status, paid_at, created_at, updated_at
+		SELECT id, provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type, status, paid_at, created_at, updated_at
 		FROM transactions WHERE id = ?
 	`
 
@@ -67,7 +78,83 @@ func (p *SqlPaymentRepo) GetTransactionById(id int) (*model.Transaction, error)
 		&tx.TransactionId,
 		&metaDataStr,
 		&tx.EntityId,
-		&tx.Amount,
+		&tx.Amount.Amount,
+		&tx.Amount.Currency,
+		&tx.EntityPaymentType,
+		&tx.Status,
+		&tx.PaidAt,
+		&tx.CreatedAt,
+		&tx.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(metaDataStr), &tx.MetaData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+func (p *SqlPaymentRepo) GetTransactionByTransactionId(transactionId string) (*model.Transaction, error) {
+	const query = `
+		SELECT id, provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type, status, paid_at, created_at, updated_at
+		FROM transactions WHERE transaction_id = ?
+	`
+
+	var tx model.Transaction
+	var metaDataStr string
+	err := p.db.QueryRow(query, transactionId).Scan(
+		&tx.ID,
+		&tx.Provider,
+		&tx.TransactionId,
+		&metaDataStr,
+		&tx.EntityId,
+		&tx.Amount.Amount,
+		&tx.Amount.Currency,
+		&tx.EntityPaymentType,
+		&tx.Status,
+		&tx.PaidAt,
+		&tx.CreatedAt,
+		&tx.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(metaDataStr), &tx.MetaData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+func (p *SqlPaymentRepo) GetTransactionByEntity(entityType model.EntityPaymentType, entityId int) (*model.Transaction, error) {
+	const query = `
+		SELECT id, provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type, status, paid_at, created_at, updated_at
+		FROM transactions WHERE entity_payment_type = ? AND entity_id = ?
+		ORDER BY id DESC LIMIT 1
+	`
+
+	var tx model.Transaction
+	var metaDataStr string
+	err := p.db.QueryRow(query, entityType, entityId).Scan(
+		&tx.ID,
+		&tx.Provider,
+		&tx.TransactionId,
+		&metaDataStr,
+		&tx.EntityId,
+		&tx.Amount.Amount,
+		&tx.Amount.Currency,
 		&tx.EntityPaymentType,
 		&tx.Status,
 		&tx.PaidAt,
@@ -89,10 +176,73 @@ func (p *SqlPaymentRepo) GetTransactionById(id int) (*model.Transaction, error)
 	return &tx, nil
 }
 
+func (p *SqlPaymentRepo) GetUnsettledTransactions(createdBefore time.Time, limit int) ([]model.Transaction, error) {
+	const query = `
+		SELECT id, provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type, status, paid_at, created_at, updated_at
+		FROM transactions
+		WHERE status = ? AND created_at < ?
+		ORDER BY last_checked_at ASC, created_at ASC
+		LIMIT ?
+	`
+
+	rows, err := p.db.Query(query, model.PaymentStatusPending, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.Transaction
+	for rows.Next() {
+		var tx model.Transaction
+		var metaDataStr string
+		err := rows.Scan(
+			&tx.ID,
+			&tx.Provider,
+			&tx.TransactionId,
+			&metaDataStr,
+			&tx.EntityId,
+			&tx.Amount.Amount,
+			&tx.Amount.Currency,
+			&tx.EntityPaymentType,
+			&tx.Status,
+			&tx.PaidAt,
+			&tx.CreatedAt,
+			&tx.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(metaDataStr), &tx.MetaData); err != nil {
+			return nil, fmt.Errorf("error decoding the meta data of transaction %d: %w", tx.ID, err)
+		}
+		results = append(results, tx)
+	}
+	return results, rows.Err()
+}
+
+func (p *SqlPaymentRepo) SetTransactionCheckedAt(id int, checkedAt time.Time) error {
+	_, err := p.db.Exec(`UPDATE transactions SET last_checked_at = ? WHERE id = ?`, checkedAt, id)
+	return err
+}
+
 func (p *SqlPaymentRepo) UpdateTransaction(id int, payload model.Transaction) (*model.Transaction, error) {
+	ctx := context.Background()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the row so concurrent webhooks for the same transaction cannot both emit the payment event
+	var previousStatus model.PaymentStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM transactions WHERE id = ? FOR UPDATE`, id).Scan(&previousStatus)
+	if err != nil {
+		return nil, err
+	}
+
 	const query = `
 		UPDATE transactions
-		SET provider = ?, transaction_id = ?, meta_data = ?, entity_id = ?, amount = ?, 
+		SET provider = ?, transaction_id = ?, meta_data = ?, entity_id = ?, amount = ?, currency = ?,
 		    entity_payment_type = ?, status = ?, paid_at = ?, updated_at = NOW()
 		WHERE id = ?
 	`
@@ -102,12 +252,13 @@ func (p *SqlPaymentRepo) UpdateTransaction(id int, payload model.Transaction) (*
 		return nil, err
 	}
 
-	_, err = p.db.Exec(query,
+	_, err = tx.ExecContext(ctx, query,
 		payload.Provider,
 		payload.TransactionId,
 		string(metaDataJson),
 		payload.EntityId,
-		payload.Amount,
+		payload.Amount.Amount,
+		payload.Amount.Currency,
 		payload.EntityPaymentType,
 		payload.Status,
 		payload.PaidAt,
@@ -118,9 +269,90 @@ func (p *SqlPaymentRepo) UpdateTransaction(id int, payload model.Transaction) (*
 	}
 
 	payload.ID = id
+	if payload.Status == model.PaymentStatusSuccessful && previousStatus != model.PaymentStatusSuccessful {
+		if err := enqueuePaymentMadeEvent(ctx, tx, payload); err != nil {
+			return nil, err
+		}
+		if err := ledger.PostPayment(ctx, tx, payload); err != nil {
+			return nil, err
+		}
+	}
+	if payload.Status == model.PaymentStatusFailed && previousStatus != model.PaymentStatusFailed && payload.EntityPaymentType == model.EntityPaymentTypeOrderPayment {
+		if err := enqueueOrderPaymentFailedEvent(ctx, tx, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return &payload, nil
 }
 
+func (p *SqlPaymentRepo) MergeTransactionMetaData(id int, metaData map[string]string) error {
+	metaDataJson, err := json.Marshal(metaData)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.Exec(`UPDATE transactions SET meta_data = JSON_MERGE_PATCH(COALESCE(meta_data, JSON_OBJECT()), ?), updated_at = NOW() WHERE id = ?`, string(metaDataJson), id)
+	return err
+}
+
+// enqueuePaymentMadeEvent informs the service that owns the paid for entity, it is written in the transaction of the status change
+func enqueuePaymentMadeEvent(ctx context.Context, tx *sql.Tx, payload model.Transaction) error {
+	var (
+		envelope *events.Envelope
+		err      error
+	)
+	switch payload.EntityPaymentType {
+	case model.EntityPaymentTypeOrderPayment:
+		envelope, err = events.NewEnvelope(ctx, eventProducer, events.OrderPaymnentMade, events.OrderPaymentMadePayload{
+			TransactionId: payload.ID,
+			Reference:     payload.TransactionId,
+			Provider:      string(payload.Provider),
+			OrderId:       payload.EntityId,
+			UserId:        utils.ParseInt(payload.MetaData["userId"]),
+			Amount:        payload.Amount,
+			PaidAt:        payload.PaidAt,
+		})
+	case model.EntityPaymentTypeVendorSubscriptionPayment:
+		envelope, err = events.NewEnvelope(ctx, eventProducer, events.VendorSubscriptionPaymnentMade, events.VendorSubscriptionPaymentMadePayload{
+			TransactionId:  payload.ID,
+			Reference:      payload.TransactionId,
+			Provider:       string(payload.Provider),
+			SubscriptionId: payload.EntityId,
+			VendorId:       utils.ParseInt(payload.MetaData["vendorId"]),
+			Amount:         payload.Amount,
+			PaidAt:         payload.PaidAt,
+		})
+	default:
+		return fmt.Errorf("unknown entity payment type: %s", payload.EntityPaymentType)
+	}
+	if err != nil {
+		return err
+	}
+
+	return outbox.Enqueue(ctx, tx, outbox.MySQL, events.PaymentTopic, strconv.Itoa(payload.EntityId), envelope)
+}
+
+// enqueueOrderPaymentFailedEvent lets order-service cancel the checkout of the order instead of waiting for it to time out
+func enqueueOrderPaymentFailedEvent(ctx context.Context, tx *sql.Tx, payload model.Transaction) error {
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.OrderPaymentFailed, events.OrderPaymentFailedPayload{
+		TransactionId: payload.ID,
+		Reference:     payload.TransactionId,
+		Provider:      string(payload.Provider),
+		OrderId:       payload.EntityId,
+		UserId:        utils.ParseInt(payload.MetaData["userId"]),
+		Amount:        payload.Amount,
+		Reason:        payload.MetaData["gatewayResponse"],
+	})
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, tx, outbox.MySQL, events.PaymentTopic, strconv.Itoa(payload.EntityId), envelope)
+}
+
 func (p *SqlPaymentRepo) GetTransactions(pagination *types.PaginationPayload, filter *model.TransactionFilter) ([]model.Transaction, int, error) {
 	var filters []string
 	var args []interface{}
@@ -138,13 +370,17 @@ func (p *SqlPaymentRepo) GetTransactions(pagination *types.PaginationPayload, fi
 			filters = append(filters, "entity_payment_type = ?")
 			args = append(args, filter.EntityPaymentType)
 		}
+		if filter.EntityId != 0 {
+			filters = append(filters, "entity_id = ?")
+			args = append(args, filter.EntityId)
+		}
 		if filter.PaidAt != nil {
 			filters = append(filters, "DATE(paid_at) = DATE(?)")
 			args = append(args, filter.PaidAt)
 		}
-		if filter.Amount > 0 {
-			filters = append(filters, "amount = ?")
-			args = append(args, filter.Amount)
+		if !filter.Amount.IsZero() {
+			filters = append(filters, "amount = ? AND currency = ?")
+			args = append(args, filter.Amount.Amount, filter.Amount.Currency)
 		}
 	}
 
@@ -157,7 +393,7 @@ func (p *SqlPaymentRepo) GetTransactions(pagination *types.PaginationPayload, fi
 	offset := (pagination.Offset - 1) * limit
 
 	query := fmt.Sprintf(`
-		SELECT id, provider, transaction_id, meta_data, entity_id, amount, entity_payment_type, status, paid_at, created_at, updated_at
+		SELECT id, provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type, status, paid_at, created_at, updated_at
 		FROM transactions
 		%s
 		ORDER BY created_at DESC
@@ -182,7 +418,8 @@ func (p *SqlPaymentRepo) GetTransactions(pagination *types.PaginationPayload, fi
 			&tx.TransactionId,
 			&metaDataStr,
 			&tx.EntityId,
-			&tx.Amount,
+			&tx.Amount.Amount,
+			&tx.Amount.Currency,
 			&tx.EntityPaymentType,
 			&tx.Status,
 			&tx.PaidAt,
@@ -192,7 +429,9 @@ func (p *SqlPaymentRepo) GetTransactions(pagination *types.PaginationPayload, fi
 		if err != nil {
 			return nil, 0, err
 		}
-		json.Unmarshal([]byte(metaDataStr), &tx.MetaData)
+		if err := json.Unmarshal([]byte(metaDataStr), &tx.MetaData); err != nil {
+			return nil, 0, fmt.Errorf("error decoding the meta data of transaction %d: %w", tx.ID, err)
+		}
 		results = append(results, tx)
 	}
 
@@ -206,3 +445,1071 @@ func (p *SqlPaymentRepo) GetTransactions(pagination *types.PaginationPayload, fi
 
 	return results, total, nil
 }
+
+func (p *SqlPaymentRepo) CreateReconciliationReport(report model.ReconciliationReport) (*model.ReconciliationReport, error) {
+	const query = `
+		INSERT INTO reconciliation_reports (started_at, finished_at, checked, matched, fixed, mismatched_amount, unknown_at_provider, failed, items)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	itemsJson, err := json.Marshal(report.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := p.db.Exec(query,
+		report.StartedAt,
+		report.FinishedAt,
+		report.Checked,
+		report.Matched,
+		report.Fixed,
+		report.MismatchedAmount,
+		report.UnknownAtProvider,
+		report.Failed,
+		string(itemsJson),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	insertedID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	report.ID = int(insertedID)
+	return &report, nil
+}
+
+func (p *SqlPaymentRepo) GetReconciliationReports(pagination *types.PaginationPayload) ([]model.ReconciliationReport, int, error) {
+	limit := pagination.Limit
+	offset := (pagination.Offset - 1) * limit
+
+	const query = `
+		SELECT id, started_at, finished_at, checked, matched, fixed, mismatched_amount, unknown_at_provider, failed, created_at, updated_at
+		FROM reconciliation_reports
+		ORDER BY started_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := p.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []model.ReconciliationReport
+	for rows.Next() {
+		var report model.ReconciliationReport
+		err := rows.Scan(
+			&report.ID,
+			&report.StartedAt,
+			&report.FinishedAt,
+			&report.Checked,
+			&report.Matched,
+			&report.Fixed,
+			&report.MismatchedAmount,
+			&report.UnknownAtProvider,
+			&report.Failed,
+			&report.CreatedAt,
+			&report.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, report)
+	}
+
+	var total int
+	err = p.db.QueryRow(`SELECT COUNT(*) FROM reconciliation_reports`).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+func (p *SqlPaymentRepo) GetReconciliationReportById(id int) (*model.ReconciliationReport, error) {
+	const query = `
+		SELECT id, started_at, finished_at, checked, matched, fixed, mismatched_amount, unknown_at_provider, failed, items, created_at, updated_at
+		FROM reconciliation_reports WHERE id = ?
+	`
+
+	var report model.ReconciliationReport
+	var itemsStr sql.NullString
+	err := p.db.QueryRow(query, id).Scan(
+		&report.ID,
+		&report.StartedAt,
+		&report.FinishedAt,
+		&report.Checked,
+		&report.Matched,
+		&report.Fixed,
+		&report.MismatchedAmount,
+		&report.UnknownAtProvider,
+		&report.Failed,
+		&itemsStr,
+		&report.CreatedAt,
+		&report.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if itemsStr.Valid {
+		if err := json.Unmarshal([]byte(itemsStr.String), &report.Items); err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+const refundColumns = `id, transaction_id, reference, provider_refund_id, idempotency_key, amount, currency, reason, items, status, failure_reason, refunded_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRefund(row rowScanner) (*model.Refund, error) {
+	var refund model.Refund
+	var providerRefundId, itemsStr, failureReason sql.NullString
+	err := row.Scan(
+		&refund.ID,
+		&refund.TransactionId,
+		&refund.Reference,
+		&providerRefundId,
+		&refund.IdempotencyKey,
+		&refund.Amount.Amount,
+		&refund.Amount.Currency,
+		&refund.Reason,
+		&itemsStr,
+		&refund.Status,
+		&failureReason,
+		&refund.RefundedAt,
+		&refund.CreatedAt,
+		&refund.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	refund.ProviderRefundId = providerRefundId.String
+	refund.FailureReason = failureReason.String
+	if itemsStr.Valid {
+		if err := json.Unmarshal([]byte(itemsStr.String), &refund.Items); err != nil {
+			return nil, err
+		}
+	}
+	return &refund, nil
+}
+
+func (p *SqlPaymentRepo) getRefund(query string, args ...any) (*model.Refund, error) {
+	refund, err := scanRefund(p.db.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return refund, nil
+}
+
+// CreateRefund locks the transaction while checking what is left to refund, so concurrent refunds cannot return more than was paid
+func (p *SqlPaymentRepo) CreateRefund(refund model.Refund) (*model.Refund, bool, error) {
+	ctx := context.Background()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		status   model.PaymentStatus
+		amount   money.Money
+		entityId int
+	)
+	err = tx.QueryRowContext(ctx, `SELECT status, amount, currency, entity_id FROM transactions WHERE id = ? FOR UPDATE`, refund.TransactionId).Scan(&status, &amount.Amount, &amount.Currency, &entityId)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := scanRefund(tx.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refunds WHERE idempotency_key = ?`, refund.IdempotencyKey))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, false, err
+	}
+	if existing != nil {
+		if existing.TransactionId != refund.TransactionId {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		return existing, false, nil
+	}
+
+	if status != model.PaymentStatusSuccessful {
+		return nil, false, ErrTransactionNotRefundable
+	}
+	refunded := money.New(0, amount.Currency)
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE transaction_id = ? AND status != ?`, refund.TransactionId, model.RefundStatusFailed).Scan(&refunded.Amount)
+	if err != nil {
+		return nil, false, err
+	}
+	left, err := amount.Sub(refunded)
+	if err != nil {
+		return nil, false, err
+	}
+	if refund.Amount.IsZero() {
+		// the whole amount left
+		refund.Amount = left
+	}
+	if !refund.Amount.SameCurrency(amount) {
+		return nil, false, fmt.Errorf("%w: the transaction was paid in %s", money.ErrCurrencyMismatch, amount.Currency)
+	}
+	if !refund.Amount.IsPositive() || refund.Amount.Amount > left.Amount {
+		return nil, false, fmt.Errorf("%w: %s of %s refunded", ErrRefundExceedsAmount, refunded, amount)
+	}
+	if len(refund.Items) > 0 {
+		if err := checkRefundItems(ctx, tx, entityId, refund); err != nil {
+			return nil, false, err
+		}
+	}
+
+	itemsJson, err := json.Marshal(refund.Items)
+	if err != nil {
+		return nil, false, err
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO refunds (transaction_id, reference, idempotency_key, amount, currency, reason, items, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, refund.TransactionId, refund.Reference, refund.IdempotencyKey, refund.Amount.Amount, refund.Amount.Currency, refund.Reason, string(itemsJson), refund.Status)
+	if err != nil {
+		return nil, false, err
+	}
+	insertedID, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	refund.ID = int(insertedID)
+	return &refund, true, nil
+}
+
+// checkRefundItems checks that every item of the refund is an item of the order and that it returns no more than what is left of the amount paid for the item,
+// it is called with the transaction locked so the refunds of the items cannot change
+func checkRefundItems(ctx context.Context, tx *sql.Tx, orderId int, refund model.Refund) error {
+	rows, err := tx.QueryContext(ctx, `SELECT order_item_id, amount, currency FROM ledger_order_items WHERE order_id = ?`, orderId)
+	if err != nil {
+		return err
+	}
+	left := map[int]money.Money{}
+	for rows.Next() {
+		var (
+			orderItemId int
+			amount      money.Money
+		)
+		if err := rows.Scan(&orderItemId, &amount.Amount, &amount.Currency); err != nil {
+			rows.Close()
+			return err
+		}
+		left[orderItemId] = amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT items FROM refunds WHERE transaction_id = ? AND status != ?`, refund.TransactionId, model.RefundStatusFailed)
+	if err != nil {
+		return err
+	}
+	var refundedItems []model.RefundItem
+	for rows.Next() {
+		var itemsStr sql.NullString
+		if err := rows.Scan(&itemsStr); err != nil {
+			rows.Close()
+			return err
+		}
+		if !itemsStr.Valid {
+			continue
+		}
+		var items []model.RefundItem
+		if err := json.Unmarshal([]byte(itemsStr.String), &items); err != nil {
+			rows.Close()
+			return err
+		}
+		refundedItems = append(refundedItems, items...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, item := range refundedItems {
+		if amount, ok := left[item.OrderItemId]; ok {
+			if left[item.OrderItemId], err = amount.Sub(item.Amount); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, item := range refund.Items {
+		amount, ok := left[item.OrderItemId]
+		if !ok {
+			return fmt.Errorf("%w: %d of order %d", ErrRefundItemNotInOrder, item.OrderItemId, orderId)
+		}
+		if !item.Amount.SameCurrency(amount) {
+			return fmt.Errorf("%w: item %d was paid in %s", money.ErrCurrencyMismatch, item.OrderItemId, amount.Currency)
+		}
+		if item.Amount.Amount > amount.Amount {
+			return fmt.Errorf("%w: only %s is left to refund on item %d", ErrRefundExceedsAmount, amount, item.OrderItemId)
+		}
+	}
+	return nil
+}
+
+func (p *SqlPaymentRepo) UpdateRefund(id int, payload model.Refund) (*model.Refund, error) {
+	ctx := context.Background()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the row so concurrent webhooks for the same refund cannot both emit the refunded event
+	var previousStatus model.RefundStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM refunds WHERE id = ? FOR UPDATE`, id).Scan(&previousStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var providerRefundId, failureReason *string
+	if payload.ProviderRefundId != "" {
+		providerRefundId = &payload.ProviderRefundId
+	}
+	if payload.FailureReason != "" {
+		failureReason = &payload.FailureReason
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refunds
+		SET provider_refund_id = ?, status = ?, failure_reason = ?, refunded_at = ?, updated_at = NOW()
+		WHERE id = ?
+	`, providerRefundId, payload.Status, failureReason, payload.RefundedAt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload.ID = id
+	if payload.Status == model.RefundStatusProcessed && previousStatus != model.RefundStatusProcessed {
+		transaction, err := getRefundedTransaction(ctx, tx, payload.TransactionId)
+		if err != nil {
+			return nil, err
+		}
+		if err := enqueueRefundedEvent(ctx, tx, payload, *transaction); err != nil {
+			return nil, err
+		}
+		if err := ledger.PostRefund(ctx, tx, payload, *transaction); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+func getRefundedTransaction(ctx context.Context, tx *sql.Tx, id int) (*model.Transaction, error) {
+	var (
+		transaction model.Transaction
+		metaDataStr string
+	)
+	err := tx.QueryRowContext(ctx, `SELECT id, provider, transaction_id, meta_data, entity_id, amount, currency, entity_payment_type FROM transactions WHERE id = ?`, id).Scan(
+		&transaction.ID,
+		&transaction.Provider,
+		&transaction.TransactionId,
+		&metaDataStr,
+		&transaction.EntityId,
+		&transaction.Amount.Amount,
+		&transaction.Amount.Currency,
+		&transaction.EntityPaymentType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metaDataStr), &transaction.MetaData); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// enqueueRefundedEvent informs the service that owns the refunded entity, it is written in the transaction of the status change
+func enqueueRefundedEvent(ctx context.Context, tx *sql.Tx, refund model.Refund, transaction model.Transaction) error {
+	// only orders can be refunded for now
+	if transaction.EntityPaymentType != model.EntityPaymentTypeOrderPayment {
+		return nil
+	}
+
+	var refunded int64
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE transaction_id = ? AND status = ?`, refund.TransactionId, model.RefundStatusProcessed).Scan(&refunded)
+	if err != nil {
+		return err
+	}
+
+	items := make([]events.OrderRefundedItem, len(refund.Items))
+	for i, item := range refund.Items {
+		items[i] = events.OrderRefundedItem{OrderItemId: item.OrderItemId, Amount: item.Amount}
+	}
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.OrderRefunded, events.OrderRefundedPayload{
+		RefundId:      refund.ID,
+		TransactionId: transaction.ID,
+		Reference:     refund.Reference,
+		Provider:      string(transaction.Provider),
+		OrderId:       transaction.EntityId,
+		UserId:        utils.ParseInt(transaction.MetaData["userId"]),
+		Amount:        refund.Amount,
+		FullRefund:    refunded >= transaction.Amount.Amount,
+		Items:         items,
+		RefundedAt:    refund.RefundedAt,
+	})
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, tx, outbox.MySQL, events.PaymentTopic, strconv.Itoa(transaction.EntityId), envelope)
+}
+
+func (p *SqlPaymentRepo) GetRefundById(id int) (*model.Refund, error) {
+	return p.getRefund(`SELECT `+refundColumns+` FROM refunds WHERE id = ?`, id)
+}
+
+func (p *SqlPaymentRepo) GetRefundByReference(reference string) (*model.Refund, error) {
+	return p.getRefund(`SELECT `+refundColumns+` FROM refunds WHERE reference = ?`, reference)
+}
+
+func (p *SqlPaymentRepo) GetRefundByProviderRefundId(providerRefundId string) (*model.Refund, error) {
+	return p.getRefund(`SELECT `+refundColumns+` FROM refunds WHERE provider_refund_id = ?`, providerRefundId)
+}
+
+func (p *SqlPaymentRepo) GetUnmatchedRefund(transactionId int, amount money.Money) (*model.Refund, error) {
+	return p.getRefund(`SELECT `+refundColumns+` FROM refunds WHERE transaction_id = ? AND status = ? AND provider_refund_id IS NULL AND amount = ? AND currency = ? ORDER BY created_at ASC, id ASC LIMIT 1`, transactionId, model.RefundStatusPending, amount.Amount, amount.Currency)
+}
+
+func (p *SqlPaymentRepo) GetUnmatchedRefunds(createdBefore time.Time, limit int) ([]model.Refund, error) {
+	rows, err := p.db.Query(`SELECT `+refundColumns+` FROM refunds WHERE status = ? AND provider_refund_id IS NULL AND created_at < ? ORDER BY created_at ASC LIMIT ?`, model.RefundStatusPending, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *refund)
+	}
+	return results, rows.Err()
+}
+
+func (p *SqlPaymentRepo) GetRefundsByTransactionId(transactionId int) ([]model.Refund, error) {
+	rows, err := p.db.Query(`SELECT `+refundColumns+` FROM refunds WHERE transaction_id = ? ORDER BY created_at ASC`, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *refund)
+	}
+	return results, rows.Err()
+}
+
+// SavePayoutAccount saves the account of the store, the recipient code registered with the provider is cleared when the bank or number changes
+func (p *SqlPaymentRepo) SavePayoutAccount(account model.PayoutAccount) error {
+	_, err := p.db.Exec(`
+		INSERT INTO payout_accounts (store_id, vendor_id, name, bank, number, swift_code)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			recipient_code = IF(bank = VALUES(bank) AND number = VALUES(number), recipient_code, NULL),
+			vendor_id = VALUES(vendor_id), name = VALUES(name), bank = VALUES(bank), number = VALUES(number), swift_code = VALUES(swift_code), updated_at = NOW()
+	`, account.StoreId, account.VendorId, account.Name, account.Bank, account.Number, account.SwiftCode)
+	return err
+}
+
+func (p *SqlPaymentRepo) GetPayoutAccount(storeId int) (*model.PayoutAccount, error) {
+	var (
+		account       model.PayoutAccount
+		recipientCode sql.NullString
+	)
+	err := p.db.QueryRow(`
+		SELECT store_id, vendor_id, name, bank, number, swift_code, recipient_code, created_at, updated_at
+		FROM payout_accounts
+		WHERE store_id = ?
+	`, storeId).Scan(
+		&account.StoreId,
+		&account.VendorId,
+		&account.Name,
+		&account.Bank,
+		&account.Number,
+		&account.SwiftCode,
+		&recipientCode,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	account.RecipientCode = recipientCode.String
+	return &account, nil
+}
+
+// SetPayoutRecipientCode saves the code the provider registered the account under, only while the account is still the one that was registered
+func (p *SqlPaymentRepo) SetPayoutRecipientCode(storeId int, number string, recipientCode string) error {
+	_, err := p.db.Exec(`UPDATE payout_accounts SET recipient_code = ? WHERE store_id = ? AND number = ?`, recipientCode, storeId, number)
+	return err
+}
+
+func (p *SqlPaymentRepo) CreatePayoutBatch(batch model.PayoutBatch) (*model.PayoutBatch, error) {
+	result, err := p.db.Exec(`INSERT INTO payout_batches (currency, started_at) VALUES (?, ?)`, batch.TotalAmount.Currency, batch.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	batch.ID = int(id)
+	return &batch, nil
+}
+
+func (p *SqlPaymentRepo) UpdatePayoutBatch(id int, payload model.PayoutBatch) (*model.PayoutBatch, error) {
+	_, err := p.db.Exec(`
+		UPDATE payout_batches
+		SET payouts = ?, total_amount = ?, skipped = ?, finished_at = ?, updated_at = NOW()
+		WHERE id = ?
+	`, payload.Payouts, payload.TotalAmount.Amount, payload.Skipped, payload.FinishedAt, id)
+	if err != nil {
+		return nil, err
+	}
+	payload.ID = id
+	return &payload, nil
+}
+
+func (p *SqlPaymentRepo) GetPayoutBatches(pagination *types.PaginationPayload) ([]model.PayoutBatch, int, error) {
+	limit := pagination.Limit
+	offset := (pagination.Offset - 1) * limit
+
+	rows, err := p.db.Query(`
+		SELECT id, currency, payouts, total_amount, skipped, started_at, finished_at, created_at, updated_at
+		FROM payout_batches
+		ORDER BY started_at DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []model.PayoutBatch
+	for rows.Next() {
+		var (
+			batch      model.PayoutBatch
+			finishedAt sql.NullTime
+		)
+		err := rows.Scan(
+			&batch.ID,
+			&batch.TotalAmount.Currency,
+			&batch.Payouts,
+			&batch.TotalAmount.Amount,
+			&batch.Skipped,
+			&batch.StartedAt,
+			&finishedAt,
+			&batch.CreatedAt,
+			&batch.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		batch.FinishedAt = finishedAt.Time
+		results = append(results, batch)
+	}
+
+	var total int
+	err = p.db.QueryRow(`SELECT COUNT(*) FROM payout_batches`).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+const payoutColumns = `id, batch_id, store_id, reference, provider, provider_transfer_id, amount, currency, bank, account_number, status, failure_reason, paid_at, created_at, updated_at`
+
+func scanPayout(row rowScanner) (*model.Payout, error) {
+	var payout model.Payout
+	var providerTransferId, failureReason sql.NullString
+	err := row.Scan(
+		&payout.ID,
+		&payout.BatchId,
+		&payout.StoreId,
+		&payout.Reference,
+		&payout.Provider,
+		&providerTransferId,
+		&payout.Amount.Amount,
+		&payout.Amount.Currency,
+		&payout.Bank,
+		&payout.AccountNumber,
+		&payout.Status,
+		&failureReason,
+		&payout.PaidAt,
+		&payout.CreatedAt,
+		&payout.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	payout.ProviderTransferId = providerTransferId.String
+	payout.FailureReason = failureReason.String
+	return &payout, nil
+}
+
+func (p *SqlPaymentRepo) getPayout(query string, args ...any) (*model.Payout, error) {
+	payout, err := scanPayout(p.db.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return payout, nil
+}
+
+// CreatePayout saves the payout and takes its amount from the payable of the vendor in the ledger, in one transaction
+func (p *SqlPaymentRepo) CreatePayout(payout model.Payout) (*model.Payout, error) {
+	ctx := context.Background()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO payouts (batch_id, store_id, reference, provider, amount, currency, bank, account_number, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, payout.BatchId, payout.StoreId, payout.Reference, payout.Provider, payout.Amount.Amount, payout.Amount.Currency, payout.Bank, payout.AccountNumber, payout.Status)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	payout.ID = int(id)
+	payout.UpdatedAt = time.Now()
+
+	if err := ledger.PostPayout(ctx, tx, payout); err != nil {
+		return nil, err
+	}
+	if err := enqueuePayoutUpdatedEvent(ctx, tx, payout); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// UpdatePayout locks the payout so concurrent webhooks cannot both settle it, a paid or failed payout cannot change status (ErrPayoutSettled)
+func (p *SqlPaymentRepo) UpdatePayout(id int, payload model.Payout) (*model.Payout, error) {
+	ctx := context.Background()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previousStatus model.PayoutStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM payouts WHERE id = ? FOR UPDATE`, id).Scan(&previousStatus)
+	if err != nil {
+		return nil, err
+	}
+	if previousStatus.Final() && payload.Status != previousStatus {
+		return nil, ErrPayoutSettled
+	}
+
+	var providerTransferId, failureReason *string
+	if payload.ProviderTransferId != "" {
+		providerTransferId = &payload.ProviderTransferId
+	}
+	if payload.FailureReason != "" {
+		failureReason = &payload.FailureReason
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE payouts
+		SET provider_transfer_id = ?, status = ?, failure_reason = ?, paid_at = ?, updated_at = NOW()
+		WHERE id = ?
+	`, providerTransferId, payload.Status, failureReason, payload.PaidAt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload.ID = id
+	payload.UpdatedAt = time.Now()
+	if payload.Status != previousStatus {
+		if payload.Status.Final() {
+			if err := ledger.PostPayoutSettled(ctx, tx, payload); err != nil {
+				return nil, err
+			}
+		}
+		if err := enqueuePayoutUpdatedEvent(ctx, tx, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// enqueuePayoutUpdatedEvent informs vendor-service of the payout, it is written in the transaction of the change
+func enqueuePayoutUpdatedEvent(ctx context.Context, tx *sql.Tx, payout model.Payout) error {
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.PayoutUpdated, events.PayoutUpdatedPayload{
+		PayoutId:      payout.ID,
+		BatchId:       payout.BatchId,
+		StoreId:       payout.StoreId,
+		Reference:     payout.Reference,
+		Provider:      string(payout.Provider),
+		Amount:        payout.Amount,
+		Status:        string(payout.Status),
+		FailureReason: payout.FailureReason,
+		Bank:          payout.Bank,
+		AccountNumber: payout.AccountNumber,
+		PaidAt:        payout.PaidAt,
+		UpdatedAt:     payout.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	// keyed by the payout so its updates are consumed in order
+	return outbox.Enqueue(ctx, tx, outbox.MySQL, events.PaymentTopic, "payout-"+strconv.Itoa(payout.ID), envelope)
+}
+
+func (p *SqlPaymentRepo) GetPayoutById(id int) (*model.Payout, error) {
+	return p.getPayout(`SELECT `+payoutColumns+` FROM payouts WHERE id = ?`, id)
+}
+
+func (p *SqlPaymentRepo) GetPayoutByReference(reference string) (*model.Payout, error) {
+	return p.getPayout(`SELECT `+payoutColumns+` FROM payouts WHERE reference = ?`, reference)
+}
+
+func (p *SqlPaymentRepo) GetPayouts(pagination *types.PaginationPayload, filter *model.PayoutFilter) ([]model.Payout, int, error) {
+	var filters []string
+	var args []interface{}
+
+	if filter != nil {
+		if filter.StoreId != 0 {
+			filters = append(filters, "store_id = ?")
+			args = append(args, filter.StoreId)
+		}
+		if filter.BatchId != 0 {
+			filters = append(filters, "batch_id = ?")
+			args = append(args, filter.BatchId)
+		}
+		if filter.Status != "" {
+			filters = append(filters, "status = ?")
+			args = append(args, filter.Status)
+		}
+	}
+
+	whereClause := ""
+	if len(filters) > 0 {
+		whereClause = "WHERE " + strings.Join(filters, " AND ")
+	}
+
+	limit := pagination.Limit
+	offset := (pagination.Offset - 1) * limit
+
+	query := fmt.Sprintf(`SELECT %s FROM payouts %s ORDER BY created_at DESC LIMIT ? OFFSET ?`, payoutColumns, whereClause)
+	rows, err := p.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []model.Payout
+	for rows.Next() {
+		payout, err := scanPayout(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, *payout)
+	}
+
+	var total int
+	err = p.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM payouts %s`, whereClause), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+func (p *SqlPaymentRepo) GetPendingPayouts(afterId int, limit int) ([]model.Payout, error) {
+	rows, err := p.db.Query(`SELECT `+payoutColumns+` FROM payouts WHERE status = ? AND id > ? ORDER BY id ASC LIMIT ?`, model.PayoutStatusPending, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.Payout
+	for rows.Next() {
+		payout, err := scanPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *payout)
+	}
+	return results, rows.Err()
+}
+
+const webhookEventColumns = `id, provider, event_id, event_type, headers, body, signature_valid, status, attempts, last_error, received_at, processed_at, created_at, updated_at`
+
+// webhookEventListColumns leaves out the headers and the body, which can be large
+const webhookEventListColumns = `id, provider, event_id, event_type, NULL, '', signature_valid, status, attempts, last_error, received_at, processed_at, created_at, updated_at`
+
+func scanWebhookEvent(row rowScanner) (*model.WebhookEvent, error) {
+	var event model.WebhookEvent
+	var eventId, headersStr, lastError sql.NullString
+	err := row.Scan(
+		&event.ID,
+		&event.Provider,
+		&eventId,
+		&event.EventType,
+		&headersStr,
+		&event.Body,
+		&event.SignatureValid,
+		&event.Status,
+		&event.Attempts,
+		&lastError,
+		&event.ReceivedAt,
+		&event.ProcessedAt,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	event.EventId = eventId.String
+	event.LastError = lastError.String
+	if headersStr.Valid {
+		if err := json.Unmarshal([]byte(headersStr.String), &event.Headers); err != nil {
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+func (p *SqlPaymentRepo) getWebhookEvent(query string, args ...any) (*model.WebhookEvent, error) {
+	event, err := scanWebhookEvent(p.db.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return event, nil
+}
+
+func (p *SqlPaymentRepo) CreateWebhookEvent(event model.WebhookEvent) (*model.WebhookEvent, bool, error) {
+	headersJson, err := json.Marshal(event.Headers)
+	if err != nil {
+		return nil, false, err
+	}
+	var eventId, lastError *string
+	if event.EventId != "" {
+		eventId = &event.EventId
+	}
+	if event.LastError != "" {
+		lastError = &event.LastError
+	}
+	// the unique key on the provider event id ignores the insert of a webhook the provider sent again
+	result, err := p.db.Exec(`
+		INSERT IGNORE INTO webhook_events (provider, event_id, event_type, headers, body, signature_valid, status, last_error, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.Provider, eventId, event.EventType, string(headersJson), event.Body, event.SignatureValid, event.Status, lastError, event.ReceivedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if affected == 0 {
+		existing, err := p.getWebhookEvent(`SELECT `+webhookEventColumns+` FROM webhook_events WHERE provider = ? AND event_id = ?`, event.Provider, event.EventId)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing == nil {
+			return nil, false, fmt.Errorf("webhook %s of %s was not stored", event.EventId, event.Provider)
+		}
+		return existing, false, nil
+	}
+	insertedID, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+	event.ID = int(insertedID)
+	return &event, true, nil
+}
+
+func (p *SqlPaymentRepo) GetWebhookEventById(id int) (*model.WebhookEvent, error) {
+	return p.getWebhookEvent(`SELECT `+webhookEventColumns+` FROM webhook_events WHERE id = ?`, id)
+}
+
+func (p *SqlPaymentRepo) GetWebhookEvents(pagination *types.PaginationPayload, filter *model.WebhookEventFilter) ([]model.WebhookEvent, int, error) {
+	var filters []string
+	var args []interface{}
+
+	if filter != nil {
+		if filter.Provider != "" {
+			filters = append(filters, "provider = ?")
+			args = append(args, filter.Provider)
+		}
+		if filter.EventType != "" {
+			filters = append(filters, "event_type = ?")
+			args = append(args, filter.EventType)
+		}
+		if filter.Status != "" {
+			filters = append(filters, "status = ?")
+			args = append(args, filter.Status)
+		}
+	}
+
+	whereClause := ""
+	if len(filters) > 0 {
+		whereClause = "WHERE " + strings.Join(filters, " AND ")
+	}
+
+	limit := pagination.Limit
+	offset := (pagination.Offset - 1) * limit
+
+	query := fmt.Sprintf(`SELECT %s FROM webhook_events %s ORDER BY received_at DESC, id DESC LIMIT ? OFFSET ?`, webhookEventListColumns, whereClause)
+	rows, err := p.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []model.WebhookEvent
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, *event)
+	}
+
+	var total int
+	err = p.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM webhook_events %s`, whereClause), args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
+
+func (p *SqlPaymentRepo) GetPendingWebhookEvents(staleBefore time.Time, maxAttempts int, limit int) ([]model.WebhookEvent, error) {
+	rows, err := p.db.Query(`
+		SELECT `+webhookEventColumns+` FROM webhook_events
+		WHERE status = ? OR (status = ? AND attempts < ?) OR (status = ? AND updated_at < ?)
+		ORDER BY received_at, id
+		LIMIT ?
+	`, model.WebhookStatusReceived, model.WebhookStatusFailed, maxAttempts, model.WebhookStatusProcessing, staleBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.WebhookEvent
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *event)
+	}
+	return results, rows.Err()
+}
+
+// ClaimWebhookEvent only updates the webhook while it is in a claimable status, so two workers cannot process the same webhook at once
+func (p *SqlPaymentRepo) ClaimWebhookEvent(id int, staleBefore time.Time) (bool, error) {
+	result, err := p.db.Exec(`
+		UPDATE webhook_events SET status = ?, attempts = attempts + 1, updated_at = NOW()
+		WHERE id = ? AND signature_valid AND (status IN (?, ?) OR (status = ? AND updated_at < ?))
+	`, model.WebhookStatusProcessing, id, model.WebhookStatusReceived, model.WebhookStatusFailed, model.WebhookStatusProcessing, staleBefore)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (p *SqlPaymentRepo) FinishWebhookEvent(id int, status model.WebhookStatus, lastError string) error {
+	var errMsg *string
+	if lastError != "" {
+		errMsg = &lastError
+	}
+	var processedAt *time.Time
+	if status == model.WebhookStatusProcessed {
+		now := time.Now()
+		processedAt = &now
+	}
+	_, err := p.db.Exec(`
+		UPDATE webhook_events SET status = ?, last_error = ?, processed_at = COALESCE(?, processed_at), updated_at = NOW()
+		WHERE id = ?
+	`, status, errMsg, processedAt, id)
+	return err
+}
+
+func (p *SqlPaymentRepo) ReplayWebhookEvent(id int) error {
+	result, err := p.db.Exec(`
+		UPDATE webhook_events SET status = ?, last_error = NULL, updated_at = NOW()
+		WHERE id = ? AND signature_valid AND status != ?
+	`, model.WebhookStatusReceived, id, model.WebhookStatusProcessing)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWebhookNotReplayable
+	}
+	return nil
+}
+
+func (p *SqlPaymentRepo) DeleteWebhookEvents(receivedBefore time.Time) (int64, error) {
+	result, err := p.db.Exec(`
+		DELETE FROM webhook_events WHERE status IN (?, ?, ?) AND received_at < ?
+	`, model.WebhookStatusProcessed, model.WebhookStatusFailed, model.WebhookStatusRejected, receivedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
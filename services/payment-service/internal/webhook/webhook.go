@@ -0,0 +1,175 @@
+// Package webhook processes the stored webhooks of the providers in the background, retrying the ones that fail and replaying them on request
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/model"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/providers"
+	"github.com/kaasikodes/shop-ease/services/payment-service/internal/repository"
+)
+
+const (
+	DefaultWorkers     = 4
+	DefaultInterval    = time.Minute
+	DefaultMaxAttempts = 5
+	DefaultStaleAfter  = time.Minute * 10
+	DefaultBatchSize   = 100
+	DefaultQueueSize   = 1000
+)
+
+type Config struct {
+	Workers     int           // webhooks processed at once
+	Interval    time.Duration // time between sweeps for the webhooks that were not queued or failed
+	MaxAttempts int           // a failed webhook is retried until it has been attempted this many times, it can still be replayed after
+	StaleAfter  time.Duration // a webhook processing for longer is assumed abandoned (e.g. the service stopped) and processed again
+	BatchSize   int           // webhooks processed per sweep
+	Retention   time.Duration // settled webhooks received before this are deleted, zero keeps them forever
+}
+
+type Processor struct {
+	store    repository.PaymentRepo
+	registry map[model.PaymentProvider]providers.PaymentGateway
+	config   Config
+	queue    chan int
+}
+
+func NewProcessor(store repository.PaymentRepo, registry map[model.PaymentProvider]providers.PaymentGateway, config Config) *Processor {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = DefaultStaleAfter
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	return &Processor{store: store, registry: registry, config: config, queue: make(chan int, DefaultQueueSize)}
+}
+
+// Enqueue processes the stored webhook in the background, when the queue is full the webhook is left for the next sweep
+func (p *Processor) Enqueue(id int) {
+	select {
+	case p.queue <- id:
+	default:
+		log.Printf("webhook queue is full, webhook %d is left for the next sweep", id)
+	}
+}
+
+// Run processes the queued webhooks and sweeps for the ones left behind until the context is cancelled
+func (p *Processor) Run(ctx context.Context) {
+	for i := 0; i < p.config.Workers; i++ {
+		go p.work(ctx)
+	}
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("shutting down the webhook processor")
+			return
+		case <-ticker.C:
+			p.sweep(ctx)
+			if p.config.Retention > 0 {
+				deleted, err := p.store.DeleteWebhookEvents(time.Now().Add(-p.config.Retention))
+				if err != nil {
+					log.Printf("error deleting old webhooks: %v", err)
+				} else if deleted > 0 {
+					log.Printf("deleted %d webhooks past retention", deleted)
+				}
+			}
+		}
+	}
+}
+
+func (p *Processor) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			if _, err := p.Process(ctx, id); err != nil {
+				log.Printf("error processing webhook %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// sweep processes the webhooks that were not queued (e.g. the queue was full or the service stopped) and retries the failed ones
+func (p *Processor) sweep(ctx context.Context) {
+	pending, err := p.store.GetPendingWebhookEvents(time.Now().Add(-p.config.StaleAfter), p.config.MaxAttempts, p.config.BatchSize)
+	if err != nil {
+		log.Printf("error getting pending webhooks: %v", err)
+		return
+	}
+	for _, event := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := p.Process(ctx, event.ID); err != nil {
+			log.Printf("error processing webhook %d: %v", event.ID, err)
+		}
+	}
+}
+
+// Process hands the stored webhook to its provider and records the result. A webhook that is settled or being processed elsewhere is returned as is
+func (p *Processor) Process(ctx context.Context, id int) (*model.WebhookEvent, error) {
+	claimed, err := p.store.ClaimWebhookEvent(id, time.Now().Add(-p.config.StaleAfter))
+	if err != nil {
+		return nil, err
+	}
+	event, err := p.store.GetWebhookEventById(id)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, fmt.Errorf("webhook %d does not exist", id)
+	}
+	if !claimed {
+		return event, nil
+	}
+
+	status, lastError := model.WebhookStatusProcessed, ""
+	err = p.process(ctx, *event)
+	switch {
+	case errors.Is(err, providers.ErrAmountMismatch):
+		// the transaction is flagged for review, processing the webhook again would not change it
+		log.Printf("%s webhook %d (%s) paid the wrong amount: %v", event.Provider, event.ID, event.EventType, err)
+		lastError = err.Error()
+	case err != nil:
+		log.Printf("error processing %s webhook %d (%s), attempt %d: %v", event.Provider, event.ID, event.EventType, event.Attempts, err)
+		status, lastError = model.WebhookStatusFailed, err.Error()
+	}
+	if err := p.store.FinishWebhookEvent(id, status, lastError); err != nil {
+		// left processing, it is picked up again once stale
+		return nil, err
+	}
+	return p.store.GetWebhookEventById(id)
+}
+
+func (p *Processor) process(ctx context.Context, event model.WebhookEvent) error {
+	gateway, ok := p.registry[event.Provider]
+	if !ok {
+		return fmt.Errorf("provider %s is not registered", event.Provider)
+	}
+	return gateway.ProcessWebhook(ctx, []byte(event.Body))
+}
+
+// Replay processes a stored webhook again, e.g. once what made it fail is fixed. The providers apply the state of a record only once so replaying a processed webhook does not apply it twice
+func (p *Processor) Replay(ctx context.Context, id int) (*model.WebhookEvent, error) {
+	if err := p.store.ReplayWebhookEvent(id); err != nil {
+		return nil, err
+	}
+	return p.Process(ctx, id)
+}
@@ -16,6 +16,13 @@ var (
 	PaymentProviderPaystack PaymentProvider = model.PaymentProviderPaystack
 	PaymentProviderFlutter  PaymentProvider = model.PaymentProviderFlutter
 )
+var (
+	PaymentStatusPending    PaymentStatus = model.PaymentStatusPending
+	PaymentStatusSuccessful PaymentStatus = model.PaymentStatusSuccessful
+	PaymentStatusFailed     PaymentStatus = model.PaymentStatusFailed
+)
+
+const MetaIdempotencyKey = model.MetaIdempotencyKey
 
 type TransactionFilter = model.TransactionFilter
 type Transaction = model.Transaction
@@ -0,0 +1,2 @@
+ALTER TABLE products ALTER COLUMN price TYPE INT USING ROUND(price / 100.0);
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,3 @@
+-- prices are kept in the minor unit (kobo, cents) of the currency of the product, the prices saved before were in naira
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'NGN';
+ALTER TABLE products ALTER COLUMN price TYPE BIGINT USING ROUND(price * 100);
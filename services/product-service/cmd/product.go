@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/kaasikodes/shop-ease/services/product-service/internal/repository"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 )
 
@@ -22,6 +23,14 @@ func (app *application) bulkAddProductsHandler(w http.ResponseWriter, r *http.Re
 		app.badRequestResponse(w, r, errors.New("product list cannot be empty"))
 		return
 	}
+	for i := range input {
+		currency, err := money.ParseCurrency(string(input[i].Price.Currency))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		input[i].Price.Currency = currency
+	}
 
 	if err := app.store.BulkAddProducts(ctx, input); err != nil {
 		app.internalServerError(w, r, err)
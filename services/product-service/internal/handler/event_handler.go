@@ -2,26 +2,12 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"log"
-	"strings"
 
 	"github.com/kaasikodes/shop-ease/services/product-service/internal/repository"
 	"github.com/kaasikodes/shop-ease/shared/events"
 )
 
-type EventPayload struct {
-	Event string          `json:"event"`
-	Data  json.RawMessage `json:"data"`
-}
-type EventVendorUpdatedInventoryPayload struct {
-	InventoryId int `json:"inventoryId"`
-	VendorId    int `json:"vendorId"`
-	StoreId     int `json:"storeId"`
-	ProductId   int `json:"productId"`
-	Quantity    int `json:"quantity"`
-	metaData    map[string]string
-}
 type EventHandler struct {
 	store repository.ProductRepo
 }
@@ -34,19 +20,18 @@ func InitEventHandler(store repository.ProductRepo) *EventHandler {
 
 }
 
-func (p *EventHandler) HandleVendorEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+func (p *EventHandler) HandleVendorEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.VendorAcceptedOrderItem:
-		return p.updateProductGlobalInventory(msg)
+	switch payload := data.(type) {
+	case *events.VendorUpdatedInventoryPayload:
+		return p.updateProductGlobalInventory(ctx, payload)
 	default:
-		log.Printf("unhandled event type: %s", event.Event)
+		log.Printf("unhandled event type: %s", envelope.Type)
 
 	}
 
@@ -54,14 +39,8 @@ func (p *EventHandler) HandleVendorEvents(msg []byte) error {
 
 }
 
-func (p *EventHandler) updateProductGlobalInventory(msg []byte) error {
-	var payload EventVendorUpdatedInventoryPayload
-	if err := json.Unmarshal(msg, &payload); err != nil {
-		log.Printf("an error occured while unmarshaling the event payload: %v", err)
-		return err
-	}
-	ctx := context.Background()
-	err := p.store.UpdateProductInventory(ctx, payload.InventoryId, payload.StoreId, payload.ProductId, payload.Quantity, &payload.metaData)
+func (p *EventHandler) updateProductGlobalInventory(ctx context.Context, payload *events.VendorUpdatedInventoryPayload) error {
+	err := p.store.UpdateProductInventory(ctx, payload.InventoryId, payload.StoreId, payload.ProductId, payload.Quantity, &payload.MetaData)
 	return err
 
 }
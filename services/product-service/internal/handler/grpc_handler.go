@@ -8,10 +8,12 @@ import (
 	"github.com/kaasikodes/shop-ease/services/product-service/internal/model"
 	"github.com/kaasikodes/shop-ease/services/product-service/internal/repository"
 	"github.com/kaasikodes/shop-ease/shared/logger"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/types"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 
 	"github.com/kaasikodes/shop-ease/shared/proto/product"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
@@ -185,3 +187,52 @@ func (n *ProductGrpcHandler) GetDiscounts(ctx context.Context, req *product.GetD
 		Total:     int64(total),
 	}, nil
 }
+
+// GetProductPrices prices the products as they would be sold now, products that do not exist are left out of the list
+func (n *ProductGrpcHandler) GetProductPrices(ctx context.Context, req *product.GetProductPricesRequest) (*product.ProductPriceList, error) {
+	parentCtx, span := n.trace.Start(ctx, "GetProductPrices")
+	defer span.End()
+	span.SetAttributes(attribute.Int("productCount", len(req.ProductIds)))
+	n.logger.WithContext(ctx).Info("Getting product prices")
+
+	now := time.Now()
+	prices, err := n.store.GetProductPrices(parentCtx, req.ProductIds, now)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	resp := make([]*product.ProductPrice, 0, len(prices))
+	for _, productId := range req.ProductIds {
+		price, ok := prices[productId]
+		if !ok {
+			continue
+		}
+		payable, err := price.Payable(now)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		discount, err := price.Amount.Sub(payable)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		item := &product.ProductPrice{
+			ProductId: productId,
+			Price:     money.ToProto(price.Amount),
+			Discount:  money.ToProto(discount),
+			Payable:   money.ToProto(payable),
+		}
+		if price.Discount != nil {
+			item.DiscountId = int64(price.Discount.Id)
+		}
+		resp = append(resp, item)
+	}
+
+	n.logger.WithContext(ctx).Info("Product price retrieval completed")
+	return &product.ProductPriceList{Prices: resp}, nil
+}
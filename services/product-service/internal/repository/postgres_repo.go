@@ -70,9 +70,9 @@ func (s *SqlProductRepo) BulkAddProducts(ctx context.Context, payload []ProductI
 
 	for _, p := range payload {
 		_, err := tx.ExecContext(ctx, `
-			INSERT INTO products (name, description, price, category_label, sub_category_label, tags, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
-		`, p.Name, p.Description, p.Price, p.CategoryLabel, strings.Join(p.SubCategoryLabel, ","), strings.Join(p.Tags, ","))
+			INSERT INTO products (name, description, price, currency, category_label, sub_category_label, tags, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		`, p.Name, p.Description, p.Price.Amount, p.Price.Currency, p.CategoryLabel, strings.Join(p.SubCategoryLabel, ","), strings.Join(p.Tags, ","))
 		if err != nil {
 			return err
 		}
@@ -88,15 +88,15 @@ func (s *SqlProductRepo) DeleteProduct(ctx context.Context, id int) error {
 func (s *SqlProductRepo) UpdateProduct(ctx context.Context, id int, payload ProductInput) error {
 	_, err := s.db.ExecContext(ctx, `
 		UPDATE products
-		SET name = $1, description = $2, price = $3, category_label = $4, sub_category_label = $5, tags = $6, updated_at = NOW()
-		WHERE id = $7
-	`, payload.Name, payload.Description, payload.Price, payload.CategoryLabel, strings.Join(payload.SubCategoryLabel, ","), strings.Join(payload.Tags, ","), id)
+		SET name = $1, description = $2, price = $3, currency = $4, category_label = $5, sub_category_label = $6, tags = $7, updated_at = NOW()
+		WHERE id = $8
+	`, payload.Name, payload.Description, payload.Price.Amount, payload.Price.Currency, payload.CategoryLabel, strings.Join(payload.SubCategoryLabel, ","), strings.Join(payload.Tags, ","), id)
 	return err
 }
 
 func (s *SqlProductRepo) GetProducts(ctx context.Context, pagination *utils.PaginationPayload) ([]model.Product, int, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, name, description, price, tags, created_at, updated_at
+		SELECT id, name, description, price, currency, tags, created_at, updated_at
 		FROM products
 		LIMIT $2 OFFSET $3
 	`, pagination.Limit, pagination.Offset)
@@ -109,7 +109,7 @@ func (s *SqlProductRepo) GetProducts(ctx context.Context, pagination *utils.Pagi
 	for rows.Next() {
 		var p model.Product
 		var tags string
-		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price.Amount, &tags, &p.CreatedAt, &p.UpdatedAt)
+		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price.Amount.Amount, &p.Price.Amount.Currency, &tags, &p.CreatedAt, &p.UpdatedAt)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -123,6 +123,85 @@ func (s *SqlProductRepo) GetProducts(ctx context.Context, pagination *utils.Pagi
 	return products, total, nil
 }
 
+// GetProductPrices returns the price of each product with the discount in effect at the time that takes the most off it
+func (s *SqlProductRepo) GetProductPrices(ctx context.Context, productIds []int64, at time.Time) (map[int64]types.Price, error) {
+	prices := make(map[int64]types.Price, len(productIds))
+	if len(productIds) == 0 {
+		return prices, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, price, currency
+		FROM products
+		WHERE id = ANY($1)
+	`, pq.Array(productIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var price types.Price
+		if err := rows.Scan(&id, &price.Amount.Amount, &price.Amount.Currency); err != nil {
+			return nil, err
+		}
+		prices[id] = price
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	discountRows, err := s.db.QueryContext(ctx, `
+		SELECT
+			da.product_id, d.id, d.name, d.description, d.value, d.value_type, d.effective_at, d.expires_at, d.paid_by, d.created_at, d.updated_at
+		FROM
+			discounts d
+			JOIN discount_applicabilities da ON da.discount_id = d.id
+		WHERE da.product_id = ANY($1) AND d.effective_at <= $2 AND (d.expires_at IS NULL OR d.expires_at > $2)
+	`, pq.Array(productIds), at)
+	if err != nil {
+		return nil, err
+	}
+	defer discountRows.Close()
+	for discountRows.Next() {
+		var productId int64
+		var d model.Discount
+		err := discountRows.Scan(
+			&productId,
+			&d.Id,
+			&d.Name,
+			&d.Description,
+			&d.Value,
+			&d.ValueType,
+			&d.EffectiveAt,
+			&d.ExpiresAt,
+			&d.PaidBy,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		price, ok := prices[productId]
+		if !ok {
+			continue
+		}
+		// the discount that leaves the least to pay is used
+		candidate := types.Price{Amount: price.Amount, Discount: &d}
+		payable, err := candidate.Payable(at)
+		if err != nil {
+			return nil, err
+		}
+		current, err := price.Payable(at)
+		if err != nil {
+			return nil, err
+		}
+		if price.Discount == nil || payable.Amount < current.Amount {
+			prices[productId] = candidate
+		}
+	}
+	return prices, discountRows.Err()
+}
+
 func (s *SqlProductRepo) UpdateProductInventory(ctx context.Context, id int, storeId int, productId int, quantity int, metaData *map[string]string) error {
 	var metaDataJSON []byte
 	var err error
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/kaasikodes/shop-ease/services/product-service/internal/model"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"github.com/kaasikodes/shop-ease/shared/types"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 )
@@ -16,7 +17,7 @@ type CategoryInput struct {
 type ProductInput struct {
 	Name             string
 	Description      string
-	Price            int
+	Price            money.Money // in minor units, the default currency is used when the currency is empty
 	CategoryLabel    string
 	SubCategoryLabel []string
 	Tags             []string
@@ -33,6 +34,7 @@ type ProductRepo interface {
 	DeleteProduct(ctx context.Context, id int) error
 	UpdateProduct(ctx context.Context, id int, payload ProductInput) error
 	GetProducts(ctx context.Context, pagination *utils.PaginationPayload) (result []model.Product, total int, err error)
+	GetProductPrices(ctx context.Context, productIds []int64, at time.Time) (map[int64]types.Price, error) // products that do not exist are left out
 	UpdateProductInventory(ctx context.Context, id int, storeId int, productId int, quantity int, metaData *map[string]string) error
 	// category: bulkAdd, update, delete, get
 	BulkAddCategories(ctx context.Context, payload []CategoryInput) error
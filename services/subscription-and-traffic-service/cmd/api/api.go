@@ -12,6 +12,7 @@ import (
 	vendorplan "github.com/kaasikodes/shop-ease/services/subscription-and-traffic-service/internal/vendor-plan"
 	"github.com/kaasikodes/shop-ease/shared/broker"
 	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/idempotency"
 	"github.com/kaasikodes/shop-ease/shared/logger"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -38,7 +39,8 @@ type application struct {
 	trace   trace.Tracer
 	logger  logger.Logger
 	// message broker
-	broker broker.MessageBroker
+	broker      broker.MessageBroker
+	idempotency *idempotency.Guard
 	// store
 	store struct {
 		plan vendorplan.VendorPlanRepo
@@ -90,6 +92,15 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// run event handler in background
+	// handler to listen to the following events - user interactions: order made for product(order service); item added to wishlist(search & recommend - can change ), payment made for subscription
+	// emits the following events
+	eventHandler := traffic.InitEventHandler(app.store.plan)
+	go func() {
+		app.broker.Subscribe(events.AuthTopic, app.idempotency.Wrap("subscription-and-traffic-service.save-interaction", eventHandler.HandleAuthEvents))
+
+	}()
+
 	app.logger.Info("Api running starting to run on .....", app.config.addr)
 
 	err := server.ListenAndServe()
@@ -100,17 +111,6 @@ func (app *application) run(mux http.Handler) error {
 		server.Run() //has a graceful shutdown built in, consider revisting ...
 
 	}()
-	// run event handler in background
-	// handler to listen to the following events - user interactions: order made for product(order service); item added to wishlist(search & recommend - can change ), payment made for subscription
-	// emits the following events
-	eventHandler := traffic.InitEventHandler(app.store.plan)
-	broker := broker.NewKafkaHelper([]string{":9092"}, events.SubscriptionTopic)
-	defer broker.Close()
-	go func() {
-		broker.Subscribe(events.AuthTopic, eventHandler.HandleAuthEvents)
-
-	}()
-
 	if err != nil {
 		return err
 	}
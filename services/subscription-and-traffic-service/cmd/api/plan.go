@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	vendorplan "github.com/kaasikodes/shop-ease/services/subscription-and-traffic-service/internal/vendor-plan"
+	"github.com/kaasikodes/shop-ease/shared/money"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 )
@@ -32,13 +33,31 @@ func (app *application) createVendorPlan(w http.ResponseWriter, r *http.Request)
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	currency, err := money.ParseCurrency(string(payload.Price.Currency))
+	if err != nil {
+		app.logger.WithContext(parentCtx).Error("Error validating vendor subscription price", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	payload.Price.Currency = currency
+	if !payload.Price.IsPositive() {
+		err := errors.New("the price of a vendor plan must be greater than zero")
+		app.logger.WithContext(parentCtx).Error("Error validating vendor subscription price", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
 
 	span.SetAttributes(
 		attribute.String("name", payload.Name),
 		attribute.String("content", payload.Content),
 		attribute.Int("userInteractions", payload.UserInteractionsAllowed),
 		attribute.Int("durationInSecs", int(payload.DurationInSecs)),
-		attribute.Float64("price", float64(payload.Price)),
+		attribute.Int64("price", payload.Price.Amount),
+		attribute.String("currency", string(payload.Price.Currency)),
 	)
 
 	// saving the vendpor plan in storage repo
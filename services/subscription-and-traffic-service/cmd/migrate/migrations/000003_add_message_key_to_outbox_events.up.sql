@@ -0,0 +1 @@
+ALTER TABLE outbox_events ADD COLUMN message_key VARCHAR(200) NOT NULL DEFAULT '' AFTER topic;
@@ -0,0 +1,10 @@
+-- Events already handled by a consumer of the service, so redelivered events are skipped
+CREATE TABLE IF NOT EXISTS processed_events (
+    consumer VARCHAR(100) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    claimed_at DATETIME NOT NULL,
+    processed_at DATETIME NULL,
+    PRIMARY KEY (consumer, event_id),
+    INDEX idx_processed_events_processed_at (processed_at)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE vendor_plans DROP COLUMN currency;
+UPDATE vendor_plans SET price = ROUND(price / 100);
+ALTER TABLE vendor_plans MODIFY price INT NOT NULL;
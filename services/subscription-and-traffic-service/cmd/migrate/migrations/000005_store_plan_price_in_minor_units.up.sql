@@ -0,0 +1,4 @@
+-- Prices were whole amounts in major units, they are now kept in minor units (e.g. kobo) with their currency
+ALTER TABLE vendor_plans MODIFY price BIGINT NOT NULL;
+UPDATE vendor_plans SET price = price * 100;
+ALTER TABLE vendor_plans ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'NGN' AFTER price;
@@ -1,24 +1,13 @@
 package traffic
 
 import (
-	"encoding/json"
+	"context"
 	"log"
-	"strings"
 
 	vendorplan "github.com/kaasikodes/shop-ease/services/subscription-and-traffic-service/internal/vendor-plan"
 	"github.com/kaasikodes/shop-ease/shared/events"
 )
 
-type EventPayload struct {
-	Event string          `json:"event"`
-	Data  json.RawMessage `json:"data"`
-}
-type UserInteractionPayload struct {
-	VendorId int                                  `json:"vendorId"`
-	UserId   int                                  `json:"userId"`
-	Type     vendorplan.VendorUserInteractionType `json:"type"`
-}
-
 type EventHandler struct {
 	plan vendorplan.VendorPlanRepo
 }
@@ -30,19 +19,20 @@ func InitEventHandler(plan vendorplan.VendorPlanRepo) *EventHandler {
 
 }
 
-func (p *EventHandler) HandleAuthEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+func (p *EventHandler) HandleAuthEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.UserOrderedItemEvent, events.UserInterestedInItemEvent:
-		return p.saveInteraction(msg)
+	switch payload := data.(type) {
+	case *events.UserOrderedItemPayload:
+		return p.saveInteraction(payload.UserId, vendorplan.UserOrderedItem)
+	case *events.UserInterestedInItemPayload:
+		return p.saveInteraction(payload.UserId, vendorplan.UserIntrestedInItem)
 	default:
-		log.Printf("unhandled event type: %s", event.Event)
+		log.Printf("unhandled event type: %s", envelope.Type)
 
 	}
 
@@ -50,13 +40,8 @@ func (p *EventHandler) HandleAuthEvents(msg []byte) error {
 
 }
 
-func (p *EventHandler) saveInteraction(msg []byte) error {
-	var payload UserInteractionPayload
-	if err := json.Unmarshal(msg, &payload); err != nil {
-		log.Printf("an error occured while unmarshaling the event payload: %v", err)
-		return err
-	}
-	_, err := p.plan.CreateVendorUserInteractionRecord(payload.UserId, payload.Type)
+func (p *EventHandler) saveInteraction(userId int, interactionType vendorplan.VendorUserInteractionType) error {
+	_, err := p.plan.CreateVendorUserInteractionRecord(userId, interactionType)
 	return err
 
 }
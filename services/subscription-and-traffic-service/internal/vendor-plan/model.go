@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/money"
 )
 
 type VendorPlanActivationPayload struct {
@@ -13,7 +14,7 @@ type VendorPlanActivationPayload struct {
 type VendorPlanPayload struct {
 	Name                    string        `json:"name" validate:"required,min=5,max=17"`
 	Content                 string        `json:"content" validate:"required,min=5,max=350"`
-	Price                   float32       `json:"price" validate:"required"`
+	Price                   money.Money   `json:"price" validate:"required"` // in minor units, the default currency is used when the currency is empty
 	UserInteractionsAllowed int           `json:"userInteractionsAllowed" validate:"required"`
 	DurationInSecs          time.Duration `json:"duration" validate:"required"` // this in seconds
 }
@@ -37,7 +38,7 @@ type VendorPlan struct {
 	ID                      int           `json:"id"`
 	Name                    string        `json:"name"`
 	Content                 string        `json:"content"`
-	Price                   int           `json:"price"`
+	Price                   money.Money   `json:"price"`
 	UserInteractionsAllowed int           `json:"userInteractionsAllowed"`
 	DurationInSecs          time.Duration `json:"duration"` // this in seconds
 	IsActive                bool          `json:"isActive"`
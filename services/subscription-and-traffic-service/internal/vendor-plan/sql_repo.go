@@ -1,14 +1,21 @@
 package vendorplan
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/money"
+	"github.com/kaasikodes/shop-ease/shared/outbox"
 )
 
+const eventProducer = "subscription-and-traffic-service"
+
 type SqlVendorRepo struct {
 	db *sql.DB
 }
@@ -103,7 +110,7 @@ func (r *SqlVendorRepo) GetVendorPlans(pagination *types.PaginationPayload, filt
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, name, content, price, user_interactions_allowed, duration_in_secs, is_active, created_at, updated_at 
+		SELECT id, name, content, price, currency, user_interactions_allowed, duration_in_secs, is_active, created_at, updated_at 
 		FROM vendor_plans %s 
 		ORDER BY created_at DESC 
 		LIMIT ? OFFSET ?`, whereClause)
@@ -122,7 +129,8 @@ func (r *SqlVendorRepo) GetVendorPlans(pagination *types.PaginationPayload, filt
 			&plan.ID,
 			&plan.Name,
 			&plan.Content,
-			&plan.Price,
+			&plan.Price.Amount,
+			&plan.Price.Currency,
 			&plan.UserInteractionsAllowed,
 			&plan.DurationInSecs,
 			&plan.IsActive,
@@ -141,10 +149,10 @@ func (r *SqlVendorRepo) GetVendorPlans(pagination *types.PaginationPayload, filt
 func (r *SqlVendorRepo) CreateVendorPlan(payload VendorPlanPayload) (*VendorPlan, error) {
 	query := `
 		INSERT INTO vendor_plans 
-		(name, content, price, user_interactions_allowed, duration_in_secs, is_active, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, TRUE, NOW(), NOW())
+		(name, content, price, currency, user_interactions_allowed, duration_in_secs, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, TRUE, NOW(), NOW())
 	`
-	res, err := r.db.Exec(query, payload.Name, payload.Content, int(payload.Price), payload.UserInteractionsAllowed, int64(payload.DurationInSecs.Seconds()))
+	res, err := r.db.Exec(query, payload.Name, payload.Content, payload.Price.Amount, payload.Price.Currency, payload.UserInteractionsAllowed, int64(payload.DurationInSecs.Seconds()))
 	if err != nil {
 		return nil, err
 	}
@@ -155,12 +163,13 @@ func (r *SqlVendorRepo) CreateVendorPlan(payload VendorPlanPayload) (*VendorPlan
 	}
 
 	plan := &VendorPlan{}
-	err = r.db.QueryRow("SELECT id, name, content, price, user_interactions_allowed, duration_in_secs, is_active, created_at, updated_at FROM vendor_plans WHERE id = ?", id).
+	err = r.db.QueryRow("SELECT id, name, content, price, currency, user_interactions_allowed, duration_in_secs, is_active, created_at, updated_at FROM vendor_plans WHERE id = ?", id).
 		Scan(
 			&plan.ID,
 			&plan.Name,
 			&plan.Content,
-			&plan.Price,
+			&plan.Price.Amount,
+			&plan.Price.Currency,
 			&plan.UserInteractionsAllowed,
 			&plan.DurationInSecs,
 			&plan.IsActive,
@@ -194,16 +203,29 @@ func (r *SqlVendorRepo) BulkActivateOrDeactivateVendorPlan(planIds []int, isActi
 }
 
 func (r *SqlVendorRepo) CreateVendorPlanSubscription(planId int, vendorId int) (*VendorSubsription, error) {
+	ctx := context.Background()
 	now := time.Now()
 	expiresAt := now.Add(time.Duration(30*24) * time.Hour) // default 30 days, adjust if needed
 
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var price money.Money
+	err = tx.QueryRowContext(ctx, "SELECT price, currency FROM vendor_plans WHERE id = ?", planId).Scan(&price.Amount, &price.Currency)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
 		INSERT INTO vendor_subscriptions 
 		(plan_id, vendor_id, has_paid, limit_exceeded_at, paid_at, began_at, expires_at, created_at, updated_at)
 		VALUES (?, ?, FALSE, NULL, ?, ?, ?, NOW(), NOW())
 	`
 
-	res, err := r.db.Exec(query, planId, vendorId, now, now, expiresAt)
+	res, err := tx.ExecContext(ctx, query, planId, vendorId, now, now, expiresAt)
 	if err != nil {
 		return nil, err
 	}
@@ -214,7 +236,7 @@ func (r *SqlVendorRepo) CreateVendorPlanSubscription(planId int, vendorId int) (
 	}
 
 	sub := &VendorSubsription{}
-	err = r.db.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		SELECT id, plan_id, vendor_id, has_paid, limit_exceeded_at, paid_at, began_at, expires_at, created_at, updated_at 
 		FROM vendor_subscriptions WHERE id = ?`, id).
 		Scan(&sub.ID, &sub.PlanId, &sub.VendorId, &sub.HasPaid, &sub.LimitExceededAt, &sub.PaidAt, &sub.BeganAt, &sub.ExpiresAt, &sub.CreatedAt, &sub.UpdatedAt)
@@ -222,6 +244,24 @@ func (r *SqlVendorRepo) CreateVendorPlanSubscription(planId int, vendorId int) (
 		return nil, err
 	}
 
+	// the payment service listens for this to initiate the subscription payment
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.VendorSubscriptionCreated, events.VendorSubscriptionCreatedPayload{
+		SubscriptionId: sub.ID,
+		PlanId:         sub.PlanId,
+		VendorId:       sub.VendorId,
+		Amount:         price,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := outbox.Enqueue(ctx, tx, outbox.MySQL, events.SubscriptionTopic, strconv.Itoa(sub.ID), envelope); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return sub, nil
 }
 
@@ -8,8 +8,11 @@ import (
 	"github.com/go-chi/chi"
 	grpc_server "github.com/kaasikodes/shop-ease/services/vendor-service/internal/grpc"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/orders"
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/payouts"
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/reservations"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/seller"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/store"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"github.com/kaasikodes/shop-ease/shared/broker"
 	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
 	"github.com/kaasikodes/shop-ease/shared/logger"
@@ -41,12 +44,15 @@ type application struct {
 	broker broker.MessageBroker
 	// store
 	store struct {
-		store  store.StoreRepo
-		orders orders.OrderRepo
-		seller seller.SellerRepo
+		store        store.StoreRepo
+		orders       orders.OrderRepo
+		seller       seller.SellerRepo
+		payouts      payouts.PayoutRepo
+		reservations reservations.ReservationRepo
 	}
 	// jwt
-	jwt *jwttoken.JwtMaker
+	jwt      *jwttoken.JwtMaker
+	sessions *authz.SessionCache // whether the session of a token was revoked
 }
 
 func (app *application) mount(reg *prometheus.Registry) http.Handler {
@@ -61,6 +67,7 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 		promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}).ServeHTTP(w, r)
 
 	})
+	authorizer := authz.NewAuthorizer(app.unauthorizedErrorResponse, app.forbiddenResponse)
 	r.Route("/v1", func(r chi.Router) {
 		// r.Route("/analytics", func(r chi.Router) {
 
@@ -76,6 +83,8 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 
 		// })
 		r.Route("/orders", func(r chi.Router) {
+			r.Use(app.authMiddleware)
+			r.Use(authorizer.RequireRoles(authz.Vendor, authz.Admin))
 			r.Get("/", app.getOrdersHandler) //get a list of orders that the vendor is part of
 			// r.Get("/:id", app.getOrderByIdHandler) //get a list of items in an order (can filter by order they belong to ) - shows the status(pending,accepted/rejected/processed, shipped, delivered, fulfilled, returned_by_user) of each item
 			// r.Post("/:id/accept", app.acceptOrderHandler)
@@ -86,21 +95,39 @@ func (app *application) mount(reg *prometheus.Registry) http.Handler {
 			// r.Post("/:id/reject/bulk", app.bulkRejectOrderHandler)
 			// r.Post("/:id/ship/bulk", app.bulkShipOrderHandler)
 
+		})
+		r.Route("/reservations", func(r chi.Router) {
+			// checkouts reserve over grpc, these are for operators
+			r.Use(app.authMiddleware)
+			r.Use(authorizer.RequireRoles(authz.Admin))
+			r.Use(authorizer.RequirePermissions(authz.ManageReservations))
+			r.Post("/", app.reserveInventoryHandler)                    // hold stock for an order until it expires
+			r.Get("/{orderId}", app.getReservationHandler)              // reservation of an order
+			r.Post("/{orderId}/commit", app.commitReservationHandler)   // take the held stock of a paid order out of the inventories
+			r.Post("/{orderId}/release", app.releaseReservationHandler) // return the held stock of a canceled order
+
 		})
 		r.Route("/seller", func(r chi.Router) {
 			r.Get("/:sellerId", app.getSellerHandler)
 
 		})
 		r.Route("/store", func(r chi.Router) {
-			r.Post("/", app.createStoreHandler)
-			r.Patch("/:storeId", app.updateStoreHandler)
-			r.Get("/:storeId", app.getStoreHandler)
-			r.Get("/:storeId/products", app.getProductsHandler)                      //products in the store
-			r.Get("/:storeId/inventory", app.getInventoriesHandler)                  //inventories in the store
-			r.Post("/:storeId/inventory/bulk", app.bulkAddInventoryHandler)          // add a multitude of product inventories
-			r.Post("/:storeId/inventory/", app.addInventoryHandler)                  //add inventory for a single product
-			r.Put("/:storeId/inventory/:inventoryId", app.updateInventoryHandler)    //update inventory for a single product, audit
-			r.Delete("/:storeId/inventory/:inventoryId", app.deleteInventoryHandler) //delete inventory for a single product, only if not been used - update audit
+			r.Use(app.authMiddleware)
+			r.Use(authorizer.RequireRoles(authz.Vendor, authz.Admin))
+			// a new store is in the vendor's token from the next refresh on
+			r.With(authorizer.RequirePermissions(authz.ManageStore)).Post("/", app.createStoreHandler)
+			r.Route("/{storeId}", func(r chi.Router) {
+				r.Use(authorizer.RequireStoreAccess("storeId")) // vendors only reach the stores in their token
+				r.With(authorizer.RequirePermissions(authz.ManageStore)).Patch("/", app.updateStoreHandler)
+				r.Get("/", app.getStoreHandler)
+				r.Get("/products", app.getProductsHandler)                                                                                  //products in the store
+				r.Get("/inventory", app.getInventoriesHandler)                                                                              //inventories in the store
+				r.With(authorizer.RequirePermissions(authz.ReadPayouts)).Get("/payouts", app.getStorePayoutsHandler)                        //payouts of the earnings of the store
+				r.With(authorizer.RequirePermissions(authz.ManageInventory)).Post("/inventory/bulk", app.bulkAddInventoryHandler)           // add a multitude of product inventories
+				r.With(authorizer.RequirePermissions(authz.ManageInventory)).Post("/inventory/", app.addInventoryHandler)                   //add inventory for a single product
+				r.With(authorizer.RequirePermissions(authz.ManageInventory)).Put("/inventory/{inventoryId}", app.updateInventoryHandler)    //update inventory for a single product, audit
+				r.With(authorizer.RequirePermissions(authz.ManageInventory)).Delete("/inventory/{inventoryId}", app.deleteInventoryHandler) //delete inventory for a single product, only if not been used - update audit
+			})
 
 			// TODO: r.Get("/{storeId}/performance", app.getStorePerformanceHandler) //get performance score of the store: lets grade by the sold stock in a month/total stock in a month -> would need to communicate with order service or local order repo if exists the former is better.
 
@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"time"
 
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"go.opentelemetry.io/otel/codes"
 )
 
@@ -34,8 +36,22 @@ func (app *application) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Step 4: Add user and claims to context
+		// Step 3: Reject the token of a session that was logged out or revoked, the answer of the auth service is cached for a while
+		if err := app.sessions.Check(ctx, claims); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if errors.Is(err, authz.ErrSessionRevoked) {
+				app.unauthorizedErrorResponse(w, r, err)
+				return
+			}
+			app.logger.WithContext(ctx).Error("Error checking session", err)
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		// Step 4: Add user and claims to context, the claims carry the roles and stores the routes require
 		ctx = context.WithValue(ctx, ContextKeyUser{}, userId)
+		ctx = authz.WithClaims(ctx, claims)
 
 		// Step 5: Call next handler with the new context
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/payouts"
+	"github.com/kaasikodes/shop-ease/shared/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// getStorePayoutsHandler returns the payouts made to the bank account of the store, as reported by payment-service
+func (app *application) getStorePayoutsHandler(w http.ResponseWriter, r *http.Request) {
+
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Store Payouts")
+
+	defer span.End()
+	storeIdStr := chi.URLParam(r, "storeId")
+	storeId, err := strconv.Atoi(storeIdStr)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading storeId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	span.SetAttributes(
+		attribute.Int("storeId", storeId),
+		attribute.String("filter.status", status),
+	)
+
+	app.logger.WithContext(initialTraceCtx).Info("getting payouts for store")
+	result, total, err := app.store.payouts.GetPayouts(utils.GetPaginationFromQuery(r), payouts.PayoutFilter{StoreId: storeId, Status: payouts.PayoutStatus(status)})
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting payouts for store", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.logger.WithContext(initialTraceCtx).Info("Completed getting payouts for store")
+
+	var data = make([]any, len(result))
+	for i, payout := range result {
+		data[i] = payout
+
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Payouts retrieved successfully!", createPaginatedResponse(data, total))
+	return
+
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/reservations"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type ReserveInventoryPayload struct {
+	OrderId    int                            `json:"orderId" validate:"required"`
+	Items      []reservations.ReservationItem `json:"items" validate:"min=1,dive"`
+	TtlSeconds int                            `json:"ttlSeconds" validate:"min=0"` // the default ttl is used when zero, at most a day
+}
+
+// reserveInventoryHandler holds the stock of an order, reserving again for the same order returns the reservation already held
+func (app *application) reserveInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Reserve Inventory")
+
+	defer span.End()
+
+	var payload ReserveInventoryPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading reserve inventory payload as json", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error validating reserve inventory payload", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	for _, item := range payload.Items {
+		if item.Quantity <= 0 || item.ProductId == 0 || item.StoreId == 0 {
+			app.badRequestResponse(w, r, fmt.Errorf("each item requires a productId, storeId and a positive quantity"))
+			return
+		}
+	}
+	span.SetAttributes(
+		attribute.Int("orderId", payload.OrderId),
+		attribute.Int("itemCount", len(payload.Items)),
+		attribute.Int("ttlSeconds", payload.TtlSeconds),
+	)
+
+	ttl := reservations.TTL(int64(payload.TtlSeconds))
+	app.logger.WithContext(initialTraceCtx).Info("reserving inventory for order")
+	reservation, err := app.store.reservations.Reserve(payload.OrderId, payload.Items, ttl)
+	if err != nil {
+		app.reservationErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, "Inventory reserved successfully!", reservation)
+	return
+}
+
+func (app *application) getReservationHandler(w http.ResponseWriter, r *http.Request) {
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Reservation")
+
+	defer span.End()
+	orderId, err := strconv.Atoi(chi.URLParam(r, "orderId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading orderId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("orderId", orderId))
+
+	reservation, err := app.store.reservations.GetReservationByOrderId(orderId)
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting reservation", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if reservation == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("order %d has no reservation", orderId))
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Reservation retrieved successfully!", reservation)
+	return
+}
+
+// commitReservationHandler takes the held stock of a paid order out of the inventories
+func (app *application) commitReservationHandler(w http.ResponseWriter, r *http.Request) {
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Commit Reservation")
+
+	defer span.End()
+	orderId, err := strconv.Atoi(chi.URLParam(r, "orderId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading orderId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("orderId", orderId))
+
+	reservation, err := app.store.reservations.Commit(orderId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.reservationErrorResponse(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Reservation committed successfully!", reservation)
+	return
+}
+
+// releaseReservationHandler returns the held stock of a canceled order to the available stock
+func (app *application) releaseReservationHandler(w http.ResponseWriter, r *http.Request) {
+	initialTraceCtx, span := app.trace.Start(r.Context(), "Release Reservation")
+
+	defer span.End()
+	orderId, err := strconv.Atoi(chi.URLParam(r, "orderId"))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error reading orderId from url", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("orderId", orderId))
+
+	reservation, err := app.store.reservations.Release(orderId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.reservationErrorResponse(w, r, err)
+		return
+	}
+	if reservation == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("order %d has no reservation", orderId))
+		return
+	}
+
+	app.jsonResponse(w, http.StatusOK, "Reservation released successfully!", reservation)
+	return
+}
+
+func (app *application) reservationErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, reservations.ErrInsufficientStock), errors.Is(err, reservations.ErrReservationReleased), errors.Is(err, reservations.ErrReservationCommitted):
+		app.conflictResponse(w, r, err)
+	case errors.Is(err, reservations.ErrReservationNotFound):
+		app.notFoundResponse(w, r, err)
+	default:
+		app.logger.WithContext(r.Context()).Error("Error handling reservation", err)
+		app.internalServerError(w, r, err)
+	}
+}
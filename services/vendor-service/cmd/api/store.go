@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/go-chi/chi"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/store"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/authz"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -16,6 +18,30 @@ import (
 
 type SaveStorePayload = types.Store
 
+var (
+	errNoVendor           = errors.New("the token has no vendor")
+	errVendorNotOwn       = errors.New("a store can only be created for the vendor of the token")
+	errStoreVendorChanged = errors.New("the vendor of a store can not be changed")
+)
+
+// storeVendorId returns the vendor a new store is created for, the vendor of the token. Only an admin can create a store for the vendor in the payload
+func storeVendorId(r *http.Request, requested int) (int, error) {
+	claims, ok := authz.ClaimsFromContext(r.Context())
+	if !ok {
+		return 0, authz.ErrNoClaims
+	}
+	if requested != 0 && slices.Contains(claims.Roles, authz.Admin) {
+		return requested, nil
+	}
+	if claims.VendorID == 0 {
+		return 0, errNoVendor
+	}
+	if requested != 0 && requested != claims.VendorID {
+		return 0, errVendorNotOwn
+	}
+	return claims.VendorID, nil
+}
+
 func (app *application) getInventoriesHandler(w http.ResponseWriter, r *http.Request) {
 
 	initialTraceCtx, span := app.trace.Start(r.Context(), "Get Store Inventories")
@@ -188,6 +214,23 @@ func (app *application) updateStoreHandler(w http.ResponseWriter, r *http.Reques
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	existing, err := app.store.store.GetStoreById(int64(storeId))
+	if err != nil {
+		app.logger.WithContext(initialTraceCtx).Error("Error getting store", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		app.internalServerError(w, r, err)
+		return
+	}
+	if existing == nil {
+		app.notFoundResponse(w, r, fmt.Errorf("store %d does not exist", storeId))
+		return
+	}
+	if payload.VendorId != 0 && payload.VendorId != existing.VendorId {
+		app.badRequestResponse(w, r, errStoreVendorChanged)
+		return
+	}
+	payload.VendorId = existing.VendorId
 
 	span.SetAttributes(
 		attribute.Int("storeId", storeId),
@@ -244,6 +287,18 @@ func (app *application) createStoreHandler(w http.ResponseWriter, r *http.Reques
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	vendorId, err := storeVendorId(r, payload.VendorId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, errVendorNotOwn) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	payload.VendorId = vendorId
 
 	span.SetAttributes(
 		attribute.String("name", payload.Name),
@@ -313,8 +368,8 @@ func (app *application) bulkAddInventoryHandler(w http.ResponseWriter, r *http.R
 		attribute.Int("number of inventory records to be added", len(payload)),
 		attribute.Int("storeId", storeId),
 	)
-	for _, item := range payload {
-		item.StoreId = storeId //specify the storeId for the inventory
+	for i := range payload {
+		payload[i].StoreId = storeId //specify the storeId for the inventory, the one in the body is not checked against the token
 
 	}
 
@@ -374,7 +429,7 @@ func (app *application) addInventoryHandler(w http.ResponseWriter, r *http.Reque
 	app.logger.WithContext(initialTraceCtx).Info("Creating store for vendor/seller")
 	inventories := make([]store.Inventory, 1) //define a payload to match the bulk inventory signature
 	payload.StoreId = storeId
-	inventories[1] = payload
+	inventories[0] = payload
 	err = app.store.store.BulkAddInventory(inventories)
 	if err != nil {
 		app.logger.WithContext(initialTraceCtx).Error("Error creating store for vendor/seller", err)
@@ -415,6 +470,7 @@ func (app *application) updateInventoryHandler(w http.ResponseWriter, r *http.Re
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	payload.StoreId = storeId // the inventory stays in the store of the url, which the token was checked against
 	if err := Validate.Struct(payload); err != nil {
 		app.logger.WithContext(initialTraceCtx).Error("Error validating save store payload", err)
 		span.RecordError(err)
@@ -432,12 +488,15 @@ func (app *application) updateInventoryHandler(w http.ResponseWriter, r *http.Re
 
 	app.logger.WithContext(initialTraceCtx).Info("Creating store for vendor/seller")
 
-	err = app.store.store.UpdateInventory(int64(inventoryId), payload)
+	err = app.store.store.UpdateInventory(int64(storeId), int64(inventoryId), payload)
 	if err != nil {
-		app.logger.WithContext(initialTraceCtx).Error("Error creating store for vendor/seller", err)
+		app.logger.WithContext(initialTraceCtx).Error("Error updating inventory for vendor/seller", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-
+		if errors.Is(err, store.ErrInventoryNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -463,37 +522,22 @@ func (app *application) deleteInventoryHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// get the parameters from the request
-	var payload store.Inventory
-	if err := readJson(w, r, &payload); err != nil {
-		app.logger.WithContext(initialTraceCtx).Error("Error reading save store payload as json", err)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		app.badRequestResponse(w, r, err)
-		return
-	}
-	if err := Validate.Struct(payload); err != nil {
-		app.logger.WithContext(initialTraceCtx).Error("Error validating save store payload", err)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		app.badRequestResponse(w, r, err)
-		return
-	}
-
 	span.SetAttributes(
-		attribute.Int("productId", payload.ProductId),
-		attribute.Int("unitPrice", *payload.UnitCostPrice),
-		attribute.Int("quantity", payload.Quantity),
+		attribute.Int("inventoryId", inventoryId),
 		attribute.Int("storeId", storeId),
 	)
 
 	app.logger.WithContext(initialTraceCtx).Info("Removing inventory from store for vendor/seller")
 
-	err = app.store.store.UpdateInventory(int64(inventoryId), payload)
+	_, err = app.store.store.DeleteInventory(int64(storeId), int64(inventoryId))
 	if err != nil {
 		app.logger.WithContext(initialTraceCtx).Error("Error removing inventory from store for vendor/seller", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, store.ErrInventoryNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
 
 		app.internalServerError(w, r, err)
 		return
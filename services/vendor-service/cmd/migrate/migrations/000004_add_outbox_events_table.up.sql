@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    topic VARCHAR(200) NOT NULL,
+    message_key VARCHAR(200) NOT NULL DEFAULT '',
+    event_type VARCHAR(200) NOT NULL,
+    payload JSON NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    published_at DATETIME NULL,
+    INDEX idx_outbox_events_published_at (published_at)
+);
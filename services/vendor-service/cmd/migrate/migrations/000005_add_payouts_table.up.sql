@@ -0,0 +1,18 @@
+-- Payouts of the earnings of stores as reported by payment-service
+CREATE TABLE IF NOT EXISTS payouts (
+  id BIGINT PRIMARY KEY, -- id of the payout in payment-service
+  batchId BIGINT NOT NULL,
+  storeId BIGINT NOT NULL,
+  reference VARCHAR(100) NOT NULL,
+  provider VARCHAR(50) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  currency VARCHAR(10) NOT NULL,
+  bank VARCHAR(100) NOT NULL,
+  accountNumber VARCHAR(50) NOT NULL,
+  status VARCHAR(50) NOT NULL,
+  failureReason VARCHAR(255),
+  paidAt TIMESTAMP NULL,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_payouts_storeId (storeId)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE payouts MODIFY currency VARCHAR(10) NOT NULL;
+ALTER TABLE payouts MODIFY amount DECIMAL(20,2) NOT NULL;
+UPDATE payouts SET amount = amount / 100;
+ALTER TABLE payouts MODIFY amount DECIMAL(12,2) NOT NULL;
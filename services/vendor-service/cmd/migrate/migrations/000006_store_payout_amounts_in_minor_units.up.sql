@@ -0,0 +1,5 @@
+-- Payout amounts are kept in minor units (e.g. kobo) of their currency
+ALTER TABLE payouts MODIFY amount DECIMAL(20,2) NOT NULL;
+UPDATE payouts SET amount = amount * 100;
+ALTER TABLE payouts MODIFY amount BIGINT NOT NULL;
+ALTER TABLE payouts MODIFY currency CHAR(3) NOT NULL;
@@ -0,0 +1,19 @@
+-- Stock held for orders until they are paid for or abandoned
+CREATE TABLE IF NOT EXISTS reservations (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  orderId BIGINT NOT NULL,
+  status VARCHAR(50) NOT NULL,
+  createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY uq_reservations_orderId (orderId)
+);
+
+CREATE TABLE IF NOT EXISTS reservation_items (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  reservationId BIGINT NOT NULL,
+  productId BIGINT NOT NULL,
+  storeId BIGINT NOT NULL,
+  quantity INT NOT NULL,
+  FOREIGN KEY (reservationId) REFERENCES reservations(id) ON DELETE CASCADE,
+  INDEX idx_reservation_items_store_product (storeId, productId)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE stores DROP COLUMN lowStockThreshold;
+DROP INDEX idx_reservations_status_expiresAt ON reservations;
+ALTER TABLE reservations DROP COLUMN expiresAt;
@@ -0,0 +1,6 @@
+-- held reservations are released by the sweeper once they expire
+ALTER TABLE reservations ADD COLUMN expiresAt TIMESTAMP NULL;
+CREATE INDEX idx_reservations_status_expiresAt ON reservations (status, expiresAt);
+
+-- product.low_stock is emitted when the available quantity of a product in the store drops to this, zero turns it off
+ALTER TABLE stores ADD COLUMN lowStockThreshold INT NOT NULL DEFAULT 0;
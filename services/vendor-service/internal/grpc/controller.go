@@ -2,7 +2,10 @@ package grpc_server
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/reservations"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/seller"
 	"github.com/kaasikodes/shop-ease/shared/logger"
 	"github.com/kaasikodes/shop-ease/shared/proto/vendor_service"
@@ -10,10 +13,13 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	grpc_codes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Store struct {
-	seller seller.SellerRepo
+	seller       seller.SellerRepo
+	reservations reservations.ReservationRepo
 }
 type GrpcHandler struct {
 	store  Store
@@ -76,3 +82,134 @@ func (n *GrpcHandler) CreateVendor(ctx context.Context, payload *vendor_service.
 	return vendor, nil
 
 }
+
+func (n *GrpcHandler) GetVendorAccess(ctx context.Context, payload *vendor_service.GetVendorAccessRequest) (*vendor_service.VendorAccess, error) {
+
+	_, span := n.trace.Start(ctx, "Getting vendor access")
+	defer span.End()
+	span.SetAttributes(attribute.Int("userId", int(payload.UserId)))
+
+	seller, err := n.store.seller.GetVendorByUserId(payload.UserId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+		return nil, status.Errorf(grpc_codes.Internal, "getting vendor failed: %v", err)
+	}
+	if seller == nil {
+		return nil, status.Errorf(grpc_codes.NotFound, "user %d is not a vendor", payload.UserId)
+	}
+	storeIds, err := n.store.seller.GetStoreIds(int64(seller.ID))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+		return nil, status.Errorf(grpc_codes.Internal, "getting stores failed: %v", err)
+	}
+
+	return &vendor_service.VendorAccess{VendorId: int64(seller.ID), StoreIds: storeIds}, nil
+
+}
+
+func (n *GrpcHandler) ReserveInventory(ctx context.Context, payload *vendor_service.ReserveInventoryRequest) (*vendor_service.Reservation, error) {
+
+	_, span := n.trace.Start(ctx, "Reserving inventory")
+	defer span.End()
+	n.logger.WithContext(ctx).Info("Reserving inventory starts")
+	span.SetAttributes(
+		attribute.Int("orderId", int(payload.OrderId)),
+		attribute.Int("itemCount", len(payload.Items)),
+	)
+	items := make([]reservations.ReservationItem, len(payload.Items))
+	for i, item := range payload.Items {
+		if item.Quantity <= 0 {
+			err := status.Errorf(grpc_codes.InvalidArgument, "quantity of product %d must be positive", item.ProductId)
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+			return nil, err
+		}
+		items[i] = reservations.ReservationItem{ProductId: int(item.ProductId), StoreId: int(item.StoreId), Quantity: int(item.Quantity)}
+	}
+
+	ttl := reservations.TTL(int64(payload.TtlSeconds))
+	reservation, err := n.store.reservations.Reserve(int(payload.OrderId), items, ttl)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+		return nil, reservationError(err)
+	}
+	n.logger.WithContext(ctx).Info("Reserved inventory succesfully!")
+
+	return reservationToProto(reservation), nil
+
+}
+
+func (n *GrpcHandler) CommitReservation(ctx context.Context, payload *vendor_service.ReservationRequest) (*vendor_service.Reservation, error) {
+
+	_, span := n.trace.Start(ctx, "Committing reservation")
+	defer span.End()
+	span.SetAttributes(attribute.Int("orderId", int(payload.OrderId)))
+
+	reservation, err := n.store.reservations.Commit(int(payload.OrderId))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+		return nil, reservationError(err)
+	}
+	n.logger.WithContext(ctx).Info("Committed reservation succesfully!")
+
+	return reservationToProto(reservation), nil
+
+}
+
+func (n *GrpcHandler) ReleaseReservation(ctx context.Context, payload *vendor_service.ReservationRequest) (*vendor_service.Reservation, error) {
+
+	_, span := n.trace.Start(ctx, "Releasing reservation")
+	defer span.End()
+	span.SetAttributes(attribute.Int("orderId", int(payload.OrderId)))
+
+	reservation, err := n.store.reservations.Release(int(payload.OrderId))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+		return nil, reservationError(err)
+	}
+	n.logger.WithContext(ctx).Info("Released reservation succesfully!")
+
+	if reservation == nil {
+		// nothing was held for the order
+		return &vendor_service.Reservation{OrderId: payload.OrderId, Status: string(reservations.ReleasedReservationStatus)}, nil
+	}
+	return reservationToProto(reservation), nil
+
+}
+
+// reservationError maps the errors of a reservation to grpc codes so the caller can tell a lack of stock from a failure
+func reservationError(err error) error {
+	switch {
+	case errors.Is(err, reservations.ErrInsufficientStock):
+		return status.Error(grpc_codes.FailedPrecondition, err.Error())
+	case errors.Is(err, reservations.ErrReservationReleased), errors.Is(err, reservations.ErrReservationCommitted):
+		return status.Error(grpc_codes.Aborted, err.Error())
+	case errors.Is(err, reservations.ErrReservationNotFound):
+		return status.Error(grpc_codes.NotFound, err.Error())
+	}
+	return status.Errorf(grpc_codes.Internal, "reservation failed: %v", err)
+}
+
+func reservationToProto(reservation *reservations.Reservation) *vendor_service.Reservation {
+	items := make([]*vendor_service.ReservationItem, len(reservation.Items))
+	for i, item := range reservation.Items {
+		items[i] = &vendor_service.ReservationItem{ProductId: int64(item.ProductId), StoreId: int64(item.StoreId), Quantity: int32(item.Quantity)}
+	}
+	res := &vendor_service.Reservation{
+		Id:        int64(reservation.ID),
+		OrderId:   int64(reservation.OrderId),
+		Status:    string(reservation.Status),
+		Items:     items,
+		CreatedAt: reservation.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: reservation.UpdatedAt.Format(time.RFC3339),
+	}
+	if reservation.ExpiresAt != nil {
+		res.ExpiresAt = reservation.ExpiresAt.Format(time.RFC3339)
+	}
+	return res
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 
 	"github.com/kaasikodes/shop-ease/services/notification-service/config"
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/reservations"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/seller"
 	"github.com/kaasikodes/shop-ease/shared/database"
 	"github.com/kaasikodes/shop-ease/shared/logger"
@@ -48,7 +49,8 @@ func (s *gRPCServer) Run() error {
 
 	trace := otel.Tracer("app.notification/trace")
 	store := Store{
-		seller: seller.NewSqlSellerRepo(db),
+		seller:       seller.NewSqlSellerRepo(db),
+		reservations: reservations.NewSqlReservationRepo(db),
 	}
 	NewGRPCHandler(grpcServer, store, trace, s.logger)
 	s.logger.Info("The Vendor GRPC SERVER IS UP .....")
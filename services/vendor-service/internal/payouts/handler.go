@@ -0,0 +1,55 @@
+package payouts
+
+import (
+	"context"
+	"log"
+
+	"github.com/kaasikodes/shop-ease/shared/events"
+)
+
+type PayoutEventHandler struct {
+	payouts PayoutRepo
+}
+
+func InitPayoutHandler(payouts PayoutRepo) *PayoutEventHandler {
+	return &PayoutEventHandler{
+		payouts,
+	}
+
+}
+
+func (p *PayoutEventHandler) HandlePaymentEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
+		return err
+	}
+
+	switch payload := data.(type) {
+	case *events.PayoutUpdatedPayload:
+		return p.savePayout(payload)
+	default:
+		log.Printf("unhandled event type: %s", envelope.Type)
+
+	}
+
+	return nil
+
+}
+
+func (p *PayoutEventHandler) savePayout(payload *events.PayoutUpdatedPayload) error {
+	return p.payouts.SavePayout(Payout{
+		ID:            payload.PayoutId,
+		BatchId:       payload.BatchId,
+		StoreId:       payload.StoreId,
+		Reference:     payload.Reference,
+		Provider:      payload.Provider,
+		Amount:        payload.Amount,
+		Bank:          payload.Bank,
+		AccountNumber: payload.AccountNumber,
+		Status:        PayoutStatus(payload.Status),
+		FailureReason: payload.FailureReason,
+		PaidAt:        payload.PaidAt,
+	})
+
+}
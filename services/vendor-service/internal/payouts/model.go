@@ -0,0 +1,38 @@
+package payouts
+
+import (
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+type PayoutStatus string
+
+var (
+	PendingPayoutStatus    PayoutStatus = "pending"
+	ProcessingPayoutStatus PayoutStatus = "processing"
+	PaidPayoutStatus       PayoutStatus = "paid"
+	FailedPayoutStatus     PayoutStatus = "failed" // the amount is paid out again in a later payout
+)
+
+type PayoutFilter struct {
+	StoreId int          `json:"storeId"`
+	Status  PayoutStatus `json:"status"`
+}
+
+// Payout is a payout of the earnings of a store made by payment-service
+type Payout struct {
+	ID            int          `json:"id"`
+	BatchId       int          `json:"batchId"`
+	StoreId       int          `json:"storeId"`
+	Reference     string       `json:"reference"`
+	Provider      string       `json:"provider"`
+	Amount        money.Money  `json:"amount"`
+	Bank          string       `json:"bank"`
+	AccountNumber string       `json:"accountNumber"`
+	Status        PayoutStatus `json:"status"`
+	FailureReason string       `json:"failureReason,omitempty"`
+	PaidAt        *time.Time   `json:"paidAt"`
+	types.Common
+}
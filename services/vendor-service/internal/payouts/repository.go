@@ -0,0 +1,11 @@
+package payouts
+
+import (
+	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+)
+
+type PayoutRepo interface {
+	// save the payout as last reported by payment-service
+	SavePayout(payload Payout) error
+	GetPayouts(pagination *types.PaginationPayload, filter PayoutFilter) (result []Payout, total int, err error)
+}
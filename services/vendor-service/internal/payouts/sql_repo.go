@@ -0,0 +1,106 @@
+package payouts
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+)
+
+type SqlPayoutRepo struct {
+	db *sql.DB
+}
+
+func NewSqlPayoutRepo(db *sql.DB) *SqlPayoutRepo {
+	return &SqlPayoutRepo{db}
+}
+
+// SavePayout saves the payout as last reported by payment-service. A paid or failed payout is final, an event that arrives late (e.g. a redelivered processing event)
+// does not change it. MySQL assigns the columns left to right, so status is assigned last for the others to see the stored status
+func (r *SqlPayoutRepo) SavePayout(payload Payout) error {
+	var failureReason *string
+	if payload.FailureReason != "" {
+		failureReason = &payload.FailureReason
+	}
+	query := `
+		INSERT INTO payouts (id, batchId, storeId, reference, provider, amount, currency, bank, accountNumber, status, failureReason, paidAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			failureReason = IF(status IN (?, ?), failureReason, VALUES(failureReason)),
+			paidAt = IF(status IN (?, ?), paidAt, VALUES(paidAt)),
+			updatedAt = IF(status IN (?, ?), updatedAt, NOW()),
+			status = IF(status IN (?, ?), status, VALUES(status))
+	`
+	_, err := r.db.Exec(query,
+		payload.ID, payload.BatchId, payload.StoreId, payload.Reference, payload.Provider,
+		payload.Amount.Amount, payload.Amount.Currency, payload.Bank, payload.AccountNumber,
+		payload.Status, failureReason, payload.PaidAt,
+		PaidPayoutStatus, FailedPayoutStatus,
+		PaidPayoutStatus, FailedPayoutStatus,
+		PaidPayoutStatus, FailedPayoutStatus,
+		PaidPayoutStatus, FailedPayoutStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving payout: %w", err)
+	}
+	return nil
+}
+
+func (r *SqlPayoutRepo) GetPayouts(pagination *types.PaginationPayload, filter PayoutFilter) ([]Payout, int, error) {
+	var (
+		args    []interface{}
+		payouts []Payout
+		where   []string
+	)
+
+	query := `SELECT id, batchId, storeId, reference, provider, amount, currency, bank, accountNumber, status, failureReason, paidAt, createdAt, updatedAt
+			  FROM payouts`
+	countQuery := `SELECT COUNT(*) FROM payouts`
+
+	if filter.StoreId != 0 {
+		where = append(where, "storeId = ?")
+		args = append(args, filter.StoreId)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	if len(where) > 0 {
+		whereClause := " WHERE " + strings.Join(where, " AND ")
+		query += whereClause
+		countQuery += whereClause
+	}
+
+	var total int
+	if err := r.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting payouts: %w", err)
+	}
+
+	query += " ORDER BY createdAt DESC LIMIT ? OFFSET ?"
+	rows, err := r.db.Query(query, append(args, pagination.Limit, pagination.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching payouts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			payout        Payout
+			failureReason sql.NullString
+		)
+		err := rows.Scan(
+			&payout.ID, &payout.BatchId, &payout.StoreId, &payout.Reference, &payout.Provider,
+			&payout.Amount.Amount, &payout.Amount.Currency, &payout.Bank, &payout.AccountNumber,
+			&payout.Status, &failureReason, &payout.PaidAt, &payout.CreatedAt, &payout.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning payout: %w", err)
+		}
+		payout.FailureReason = failureReason.String
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, total, nil
+}
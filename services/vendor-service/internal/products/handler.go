@@ -1,23 +1,12 @@
 package products
 
 import (
-	"encoding/json"
+	"context"
 	"log"
-	"strings"
 
 	"github.com/kaasikodes/shop-ease/shared/events"
 )
 
-type EventPayload struct {
-	Event string          `json:"event"`
-	Data  json.RawMessage `json:"data"`
-}
-type EventProductPayload struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-}
-
 type ProductEventHandler struct {
 	products ProductRepo
 }
@@ -29,55 +18,45 @@ func InitProductHandler(products ProductRepo) *ProductEventHandler {
 
 }
 
-func (p *ProductEventHandler) HandleProductEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+func (p *ProductEventHandler) HandleProductEvents(ctx context.Context, msg []byte) error {
+	envelope, data, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.ProductCreatedEvent, events.ProductUpdatedEvent:
-		return p.updateProducts(msg)
+	switch payload := data.(type) {
+	case *events.ProductCreatedPayload:
+		return p.updateProducts(payload.ID, payload.Name, payload.Description)
+	case *events.ProductUpdatedPayload:
+		return p.updateProducts(payload.ID, payload.Name, payload.Description)
 	default:
-		log.Printf("unhandled event type: %s", event.Event)
+		log.Printf("unhandled event type: %s", envelope.Type)
 
 	}
 
 	return nil
 
 }
-func (p *ProductEventHandler) HandleAuthEvents(msg []byte) error {
-	// check the event type, and retrieve the msg convert to pay and then save the product
-	var event EventPayload
-	if err := json.Unmarshal(msg, &event.Data); err != nil {
-		log.Printf("an error occured while unmarshaling the event: %v", err)
+func (p *ProductEventHandler) HandleAuthEvents(ctx context.Context, msg []byte) error {
+	envelope, _, err := events.Decode(msg)
+	if err != nil {
+		log.Printf("an error occured while decoding the event: %v", err)
 		return err
 	}
 
-	switch strings.ToLower(event.Event) {
-	case events.ProductCreatedEvent, events.ProductUpdatedEvent:
-		return p.updateProducts(msg)
-	default:
-		log.Printf("unhandled event type: %s", event.Event)
-
-	}
+	// no auth event is of interest to the vendor products yet
+	log.Printf("unhandled event type: %s", envelope.Type)
 
 	return nil
 
 }
 
-func (p *ProductEventHandler) updateProducts(msg []byte) error {
-	var payload EventProductPayload
-	if err := json.Unmarshal(msg, &payload); err != nil {
-		log.Printf("an error occured while unmarshaling the event payload: %v", err)
-		return err
-	}
-	p.products.Save(payload.ID, Product{
-		ID:          payload.ID,
-		Name:        payload.Name,
-		Description: payload.Description,
+func (p *ProductEventHandler) updateProducts(id int, name, description string) error {
+	p.products.Save(id, Product{
+		ID:          id,
+		Name:        name,
+		Description: description,
 	})
 	return nil
 
@@ -0,0 +1,39 @@
+package reservations
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+)
+
+var (
+	ErrInsufficientStock    = errors.New("insufficient stock")
+	ErrReservationReleased  = errors.New("reservation has been released")
+	ErrReservationCommitted = errors.New("reservation has been committed")
+	ErrReservationNotFound  = errors.New("reservation does not exist")
+)
+
+type ReservationStatus string
+
+var (
+	HeldReservationStatus      ReservationStatus = "held"      // counted against the available stock
+	CommittedReservationStatus ReservationStatus = "committed" // taken out of the inventories
+	ReleasedReservationStatus  ReservationStatus = "released"  // returned to the available stock
+)
+
+type ReservationItem struct {
+	ProductId int `json:"productId"`
+	StoreId   int `json:"storeId"`
+	Quantity  int `json:"quantity"`
+}
+
+// Reservation holds the stock of an order until it is paid for or abandoned, an order has at most one reservation
+type Reservation struct {
+	ID        int               `json:"id"`
+	OrderId   int               `json:"orderId"`
+	Status    ReservationStatus `json:"status"`
+	Items     []ReservationItem `json:"items"`
+	ExpiresAt *time.Time        `json:"expiresAt"` // a held reservation is released by the sweeper after this
+	types.Common
+}
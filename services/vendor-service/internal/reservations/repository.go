@@ -0,0 +1,15 @@
+package reservations
+
+import "time"
+
+type ReservationRepo interface {
+	// holds the items for the order until the ttl passes, the reservation already held or committed for the order is returned as is
+	Reserve(orderId int, items []ReservationItem, ttl time.Duration) (*Reservation, error)
+	// takes the held items out of the inventories, the oldest inventory first
+	Commit(orderId int) (*Reservation, error)
+	// returns the held items to the available stock, releasing an order with no reservation is a no-op and returns nil
+	Release(orderId int) (*Reservation, error)
+	GetReservationByOrderId(orderId int) (*Reservation, error)
+	// held reservations that expired before the time, the oldest first
+	GetExpiredReservations(before time.Time, limit int) ([]Reservation, error)
+}
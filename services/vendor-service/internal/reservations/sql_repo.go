@@ -0,0 +1,327 @@
+package reservations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/outbox"
+)
+
+const eventProducer = "vendor-service"
+
+type SqlReservationRepo struct {
+	db *sql.DB
+}
+
+func NewSqlReservationRepo(db *sql.DB) *SqlReservationRepo {
+	return &SqlReservationRepo{db}
+}
+
+func (r *SqlReservationRepo) Reserve(orderId int, items []ReservationItem, ttl time.Duration) (*Reservation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := getReservation(tx, orderId, true)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Status == ReleasedReservationStatus {
+			return nil, fmt.Errorf("%w: order %d", ErrReservationReleased, orderId)
+		}
+		return existing, nil
+	}
+
+	items = mergeItems(items)
+	for _, item := range items {
+		available, err := Available(tx, item.StoreId, item.ProductId)
+		if err != nil {
+			return nil, err
+		}
+		if available < item.Quantity {
+			return nil, fmt.Errorf("%w: product %d in store %d has %d available, %d requested", ErrInsufficientStock, item.ProductId, item.StoreId, available, item.Quantity)
+		}
+		if err := EnqueueLowStockEvent(tx, item.StoreId, item.ProductId, available, available-item.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := tx.Exec(`INSERT INTO reservations (orderId, status, expiresAt) VALUES (?, ?, ?)`, orderId, HeldReservationStatus, time.Now().Add(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("error creating reservation: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		_, err := tx.Exec(`INSERT INTO reservation_items (reservationId, productId, storeId, quantity) VALUES (?, ?, ?, ?)`, id, item.ProductId, item.StoreId, item.Quantity)
+		if err != nil {
+			return nil, fmt.Errorf("error creating reservation item: %w", err)
+		}
+	}
+
+	reservation, err := getReservation(tx, orderId, false)
+	if err != nil {
+		return nil, err
+	}
+	return reservation, tx.Commit()
+}
+
+func (r *SqlReservationRepo) Commit(orderId int) (*Reservation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := getReservation(tx, orderId, true)
+	if err != nil {
+		return nil, err
+	}
+	if reservation == nil {
+		return nil, fmt.Errorf("%w: order %d", ErrReservationNotFound, orderId)
+	}
+	switch reservation.Status {
+	case CommittedReservationStatus:
+		return reservation, nil
+	case ReleasedReservationStatus:
+		return nil, fmt.Errorf("%w: order %d", ErrReservationReleased, orderId)
+	}
+
+	for _, item := range reservation.Items {
+		if err := deductInventory(tx, item); err != nil {
+			return nil, err
+		}
+	}
+	if err := setStatus(tx, reservation, CommittedReservationStatus); err != nil {
+		return nil, err
+	}
+	return reservation, tx.Commit()
+}
+
+func (r *SqlReservationRepo) Release(orderId int) (*Reservation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := getReservation(tx, orderId, true)
+	if err != nil {
+		return nil, err
+	}
+	if reservation == nil {
+		return nil, nil
+	}
+	switch reservation.Status {
+	case ReleasedReservationStatus:
+		return reservation, nil
+	case CommittedReservationStatus:
+		return nil, fmt.Errorf("%w: order %d", ErrReservationCommitted, orderId)
+	}
+
+	if err := setStatus(tx, reservation, ReleasedReservationStatus); err != nil {
+		return nil, err
+	}
+	return reservation, tx.Commit()
+}
+
+func (r *SqlReservationRepo) GetExpiredReservations(before time.Time, limit int) ([]Reservation, error) {
+	rows, err := r.db.Query(`
+		SELECT id, orderId, status, expiresAt, createdAt, updatedAt
+		FROM reservations
+		WHERE status = ? AND expiresAt < ?
+		ORDER BY expiresAt ASC
+		LIMIT ?
+	`, HeldReservationStatus, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting expired reservations: %w", err)
+	}
+	defer rows.Close()
+
+	var reservations []Reservation
+	for rows.Next() {
+		var reservation Reservation
+		if err := rows.Scan(&reservation.ID, &reservation.OrderId, &reservation.Status, &reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning reservation: %w", err)
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations, rows.Err()
+}
+
+func (r *SqlReservationRepo) GetReservationByOrderId(orderId int) (*Reservation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return getReservation(tx, orderId, false)
+}
+
+// mergeItems adds up the items of the same product in the same store and sorts them so reservations lock inventories in the same order
+func mergeItems(items []ReservationItem) []ReservationItem {
+	type key struct{ storeId, productId int }
+	quantities := map[key]int{}
+	for _, item := range items {
+		quantities[key{item.StoreId, item.ProductId}] += item.Quantity
+	}
+	merged := make([]ReservationItem, 0, len(quantities))
+	for k, quantity := range quantities {
+		merged = append(merged, ReservationItem{ProductId: k.productId, StoreId: k.storeId, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].StoreId != merged[j].StoreId {
+			return merged[i].StoreId < merged[j].StoreId
+		}
+		return merged[i].ProductId < merged[j].ProductId
+	})
+	return merged
+}
+
+// Available returns the quantity of the product in the store that is neither sold nor held. It locks the inventories of the product,
+// which serializes the reservations and inventory changes of the product until the transaction ends
+func Available(tx *sql.Tx, storeId int, productId int) (int, error) {
+	var onHand int
+	err := tx.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM inventories WHERE storeId = ? AND productId = ? FOR UPDATE`, storeId, productId).Scan(&onHand)
+	if err != nil {
+		return 0, fmt.Errorf("error getting stock of product %d in store %d: %w", productId, storeId, err)
+	}
+	held, err := heldQuantity(tx, storeId, productId)
+	if err != nil {
+		return 0, err
+	}
+	return onHand - held, nil
+}
+
+func heldQuantity(tx *sql.Tx, storeId int, productId int) (int, error) {
+	var held int
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(ri.quantity), 0)
+		FROM reservation_items ri
+		JOIN reservations r ON r.id = ri.reservationId
+		WHERE r.status = ? AND ri.storeId = ? AND ri.productId = ?
+	`, HeldReservationStatus, storeId, productId).Scan(&held)
+	if err != nil {
+		return 0, fmt.Errorf("error getting held stock of product %d in store %d: %w", productId, storeId, err)
+	}
+	return held, nil
+}
+
+// EnqueueLowStockEvent emits product.low_stock when a reservation or an inventory change takes the available quantity of the product from above the threshold
+// of the store to or below it, so the event is sent once per drop rather than for every change under the threshold
+func EnqueueLowStockEvent(tx *sql.Tx, storeId int, productId int, before int, after int) error {
+	var threshold int
+	err := tx.QueryRow(`SELECT lowStockThreshold FROM stores WHERE id = ?`, storeId).Scan(&threshold)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting low stock threshold of store %d: %w", storeId, err)
+	}
+	if threshold <= 0 || before <= threshold || after > threshold {
+		return nil
+	}
+	ctx := context.Background()
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.ProductLowStockEvent, events.ProductLowStockPayload{
+		ProductId: productId,
+		StoreId:   storeId,
+		Available: after,
+		Threshold: threshold,
+	})
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, tx, outbox.MySQL, events.VendorTopic, strconv.Itoa(storeId), envelope)
+}
+
+// deductInventory takes the quantity of the item out of the inventories of the product, the oldest arrival first
+func deductInventory(tx *sql.Tx, item ReservationItem) error {
+	rows, err := tx.Query(`
+		SELECT id, quantity FROM inventories
+		WHERE storeId = ? AND productId = ? AND quantity > 0
+		ORDER BY arrivalOrProduceDate ASC, id ASC
+		FOR UPDATE
+	`, item.StoreId, item.ProductId)
+	if err != nil {
+		return fmt.Errorf("error getting inventories: %w", err)
+	}
+	type inventory struct{ id, quantity int }
+	var inventories []inventory
+	for rows.Next() {
+		var inv inventory
+		if err := rows.Scan(&inv.id, &inv.quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning inventory: %w", err)
+		}
+		inventories = append(inventories, inv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	remaining := item.Quantity
+	for _, inv := range inventories {
+		if remaining == 0 {
+			break
+		}
+		taken := min(inv.quantity, remaining)
+		if _, err := tx.Exec(`UPDATE inventories SET quantity = quantity - ? WHERE id = ?`, taken, inv.id); err != nil {
+			return fmt.Errorf("error updating inventory: %w", err)
+		}
+		remaining -= taken
+	}
+	if remaining > 0 {
+		// the stock was removed from the inventories while it was held
+		return fmt.Errorf("%w: product %d in store %d is short by %d", ErrInsufficientStock, item.ProductId, item.StoreId, remaining)
+	}
+	return nil
+}
+
+func setStatus(tx *sql.Tx, reservation *Reservation, status ReservationStatus) error {
+	if _, err := tx.Exec(`UPDATE reservations SET status = ? WHERE id = ?`, status, reservation.ID); err != nil {
+		return fmt.Errorf("error updating reservation: %w", err)
+	}
+	reservation.Status = status
+	return nil
+}
+
+// getReservation returns the reservation of the order with its items, nil when the order has none
+func getReservation(tx *sql.Tx, orderId int, forUpdate bool) (*Reservation, error) {
+	query := `SELECT id, orderId, status, expiresAt, createdAt, updatedAt FROM reservations WHERE orderId = ?`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var reservation Reservation
+	err := tx.QueryRow(query, orderId).Scan(&reservation.ID, &reservation.OrderId, &reservation.Status, &reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting reservation: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT productId, storeId, quantity FROM reservation_items WHERE reservationId = ? ORDER BY storeId, productId`, reservation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reservation items: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ReservationItem
+		if err := rows.Scan(&item.ProductId, &item.StoreId, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("error scanning reservation item: %w", err)
+		}
+		reservation.Items = append(reservation.Items, item)
+	}
+	return &reservation, rows.Err()
+}
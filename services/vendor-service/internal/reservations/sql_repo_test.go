@@ -0,0 +1,324 @@
+package reservations
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestRepo(t *testing.T) (*SqlReservationRepo, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewSqlReservationRepo(db), mock
+}
+
+func query(sql string) string {
+	return regexp.QuoteMeta(sql)
+}
+
+// expectReservation expects the reservation of the order to be read, with its items when it exists
+func expectReservation(mock sqlmock.Sqlmock, orderId int, forUpdate bool, status ReservationStatus, items ...ReservationItem) {
+	sql := `SELECT id, orderId, status, expiresAt, createdAt, updatedAt FROM reservations WHERE orderId = ?`
+	if forUpdate {
+		sql += " FOR UPDATE"
+	}
+	rows := sqlmock.NewRows([]string{"id", "orderId", "status", "expiresAt", "createdAt", "updatedAt"})
+	if status == "" {
+		mock.ExpectQuery(query(sql)).WithArgs(orderId).WillReturnRows(rows)
+		return
+	}
+	now := time.Now()
+	mock.ExpectQuery(query(sql)).WithArgs(orderId).WillReturnRows(rows.AddRow(9, orderId, status, now.Add(time.Minute*15), now, now))
+	itemRows := sqlmock.NewRows([]string{"productId", "storeId", "quantity"})
+	for _, item := range items {
+		itemRows.AddRow(item.ProductId, item.StoreId, item.Quantity)
+	}
+	mock.ExpectQuery(query(`SELECT productId, storeId, quantity FROM reservation_items WHERE reservationId = ?`)).WithArgs(9).WillReturnRows(itemRows)
+}
+
+func expectAvailable(mock sqlmock.Sqlmock, storeId, productId, onHand, held int) {
+	mock.ExpectQuery(query(`SELECT COALESCE(SUM(quantity), 0) FROM inventories WHERE storeId = ? AND productId = ? FOR UPDATE`)).
+		WithArgs(storeId, productId).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(onHand))
+	mock.ExpectQuery(query(`SELECT COALESCE(SUM(ri.quantity), 0)`)).
+		WithArgs(HeldReservationStatus, storeId, productId).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(held))
+}
+
+func expectThreshold(mock sqlmock.Sqlmock, storeId, threshold int) {
+	mock.ExpectQuery(query(`SELECT lowStockThreshold FROM stores WHERE id = ?`)).
+		WithArgs(storeId).
+		WillReturnRows(sqlmock.NewRows([]string{"lowStockThreshold"}).AddRow(threshold))
+}
+
+func TestReserveHoldsTheItemsAndWarnsOfLowStock(t *testing.T) {
+	repo, mock := newTestRepo(t)
+	item := ReservationItem{ProductId: 3, StoreId: 4, Quantity: 2}
+
+	mock.ExpectBegin()
+	expectReservation(mock, 100, true, "")
+	// 7 available, the 2 reserved take it to the threshold of the store
+	expectAvailable(mock, 4, 3, 10, 3)
+	expectThreshold(mock, 4, 5)
+	mock.ExpectExec(query(`INSERT INTO outbox_events`)).
+		WithArgs("vendor", "4", "product.low_stock", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(query(`INSERT INTO reservations (orderId, status, expiresAt) VALUES (?, ?, ?)`)).
+		WithArgs(100, HeldReservationStatus, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectExec(query(`INSERT INTO reservation_items (reservationId, productId, storeId, quantity) VALUES (?, ?, ?, ?)`)).
+		WithArgs(9, 3, 4, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectReservation(mock, 100, false, HeldReservationStatus, item)
+	mock.ExpectCommit()
+
+	reservation, err := repo.Reserve(100, []ReservationItem{{ProductId: 3, StoreId: 4, Quantity: 1}, {ProductId: 3, StoreId: 4, Quantity: 1}}, time.Minute*15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.ID != 9 || reservation.Status != HeldReservationStatus || len(reservation.Items) != 1 || reservation.Items[0] != item {
+		t.Errorf("reserved %+v, want the merged item held", reservation)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	for name, tc := range map[string]struct {
+		existing ReservationStatus
+		wantErr  error
+	}{
+		"held reservation is returned again":      {existing: HeldReservationStatus},
+		"committed reservation is returned again": {existing: CommittedReservationStatus},
+		"released order cannot reserve again":     {existing: ReleasedReservationStatus, wantErr: ErrReservationReleased},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo, mock := newTestRepo(t)
+			mock.ExpectBegin()
+			expectReservation(mock, 100, true, tc.existing, ReservationItem{ProductId: 3, StoreId: 4, Quantity: 2})
+			mock.ExpectRollback()
+
+			// no stock is checked or held, the order already has its reservation
+			reservation, err := repo.Reserve(100, []ReservationItem{{ProductId: 3, StoreId: 4, Quantity: 2}}, time.Minute*15)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("reserve returned %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && (reservation.ID != 9 || reservation.Status != tc.existing) {
+				t.Errorf("reserved %+v, want the existing reservation 9", reservation)
+			}
+		})
+	}
+}
+
+func TestReserveRejectsMoreThanIsAvailable(t *testing.T) {
+	repo, mock := newTestRepo(t)
+	mock.ExpectBegin()
+	expectReservation(mock, 100, true, "")
+	expectAvailable(mock, 4, 3, 10, 8)
+	mock.ExpectRollback()
+
+	if _, err := repo.Reserve(100, []ReservationItem{{ProductId: 3, StoreId: 4, Quantity: 3}}, time.Minute*15); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("reserve returned %v, want ErrInsufficientStock", err)
+	}
+}
+
+func TestCommitTakesTheOldestInventoriesFirst(t *testing.T) {
+	repo, mock := newTestRepo(t)
+	mock.ExpectBegin()
+	expectReservation(mock, 100, true, HeldReservationStatus, ReservationItem{ProductId: 3, StoreId: 4, Quantity: 5})
+	mock.ExpectQuery(query(`SELECT id, quantity FROM inventories`)).
+		WithArgs(4, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "quantity"}).AddRow(21, 3).AddRow(22, 10))
+	mock.ExpectExec(query(`UPDATE inventories SET quantity = quantity - ? WHERE id = ?`)).WithArgs(3, 21).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query(`UPDATE inventories SET quantity = quantity - ? WHERE id = ?`)).WithArgs(2, 22).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query(`UPDATE reservations SET status = ? WHERE id = ?`)).WithArgs(CommittedReservationStatus, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reservation, err := repo.Commit(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != CommittedReservationStatus {
+		t.Errorf("reservation is %s, want committed", reservation.Status)
+	}
+}
+
+func TestCommitFailsWhenTheHeldStockWasRemoved(t *testing.T) {
+	repo, mock := newTestRepo(t)
+	mock.ExpectBegin()
+	expectReservation(mock, 100, true, HeldReservationStatus, ReservationItem{ProductId: 3, StoreId: 4, Quantity: 5})
+	mock.ExpectQuery(query(`SELECT id, quantity FROM inventories`)).
+		WithArgs(4, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "quantity"}).AddRow(21, 3))
+	mock.ExpectExec(query(`UPDATE inventories SET quantity = quantity - ? WHERE id = ?`)).WithArgs(3, 21).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	if _, err := repo.Commit(100); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("commit returned %v, want ErrInsufficientStock", err)
+	}
+}
+
+func TestCommitAndReleaseOfAFinishedReservation(t *testing.T) {
+	for name, tc := range map[string]struct {
+		existing   ReservationStatus
+		release    bool
+		wantErr    error
+		wantStatus ReservationStatus
+	}{
+		"commit of a committed reservation":  {existing: CommittedReservationStatus, wantStatus: CommittedReservationStatus},
+		"commit of a released reservation":   {existing: ReleasedReservationStatus, wantErr: ErrReservationReleased},
+		"commit without a reservation":       {wantErr: ErrReservationNotFound},
+		"release of a released reservation":  {existing: ReleasedReservationStatus, release: true, wantStatus: ReleasedReservationStatus},
+		"release of a committed reservation": {existing: CommittedReservationStatus, release: true, wantErr: ErrReservationCommitted},
+		"release without a reservation":      {release: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo, mock := newTestRepo(t)
+			mock.ExpectBegin()
+			expectReservation(mock, 100, true, tc.existing, ReservationItem{ProductId: 3, StoreId: 4, Quantity: 5})
+			mock.ExpectRollback()
+
+			var reservation *Reservation
+			var err error
+			if tc.release {
+				reservation, err = repo.Release(100)
+			} else {
+				reservation, err = repo.Commit(100)
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("returned %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantStatus == "" {
+				if reservation != nil {
+					t.Errorf("returned %+v, want no reservation", reservation)
+				}
+				return
+			}
+			if reservation == nil || reservation.Status != tc.wantStatus {
+				t.Errorf("returned %+v, want the %s reservation", reservation, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReleaseReturnsTheHeldStock(t *testing.T) {
+	repo, mock := newTestRepo(t)
+	mock.ExpectBegin()
+	expectReservation(mock, 100, true, HeldReservationStatus, ReservationItem{ProductId: 3, StoreId: 4, Quantity: 5})
+	mock.ExpectExec(query(`UPDATE reservations SET status = ? WHERE id = ?`)).WithArgs(ReleasedReservationStatus, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reservation, err := repo.Release(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != ReleasedReservationStatus {
+		t.Errorf("reservation is %s, want released", reservation.Status)
+	}
+}
+
+func TestEnqueueLowStockEventOnlyWhenTheThresholdIsCrossed(t *testing.T) {
+	for name, tc := range map[string]struct {
+		threshold     int
+		before, after int
+		wantEvent     bool
+	}{
+		"drops to the threshold":      {threshold: 5, before: 8, after: 5, wantEvent: true},
+		"drops below the threshold":   {threshold: 5, before: 6, after: 0, wantEvent: true},
+		"stays above the threshold":   {threshold: 5, before: 10, after: 6},
+		"already below the threshold": {threshold: 5, before: 4, after: 2},
+		"starts at the threshold":     {threshold: 5, before: 5, after: 3},
+		"rises above the threshold":   {threshold: 5, before: 3, after: 9},
+		"threshold is not set":        {threshold: 0, before: 8, after: 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectBegin()
+			expectThreshold(mock, 4, tc.threshold)
+			if tc.wantEvent {
+				mock.ExpectExec(query(`INSERT INTO outbox_events`)).
+					WithArgs("vendor", "4", "product.low_stock", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			mock.ExpectRollback()
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := EnqueueLowStockEvent(tx, 4, 3, tc.before, tc.after); err != nil {
+				t.Fatal(err)
+			}
+			tx.Rollback()
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// memoryRepo hands the sweeper its expired reservations and records what it releases
+type memoryRepo struct {
+	ReservationRepo
+
+	expired    []Reservation
+	committed  map[int]bool
+	released   []int
+	batchSizes []int
+}
+
+func (m *memoryRepo) GetExpiredReservations(before time.Time, limit int) ([]Reservation, error) {
+	m.batchSizes = append(m.batchSizes, limit)
+	return m.expired, nil
+}
+
+func (m *memoryRepo) Release(orderId int) (*Reservation, error) {
+	if m.committed[orderId] {
+		return nil, ErrReservationCommitted
+	}
+	m.released = append(m.released, orderId)
+	return &Reservation{OrderId: orderId, Status: ReleasedReservationStatus}, nil
+}
+
+func TestSweeperReleasesExpiredReservations(t *testing.T) {
+	repo := &memoryRepo{
+		expired:   []Reservation{{OrderId: 100}, {OrderId: 101}, {OrderId: 102}},
+		committed: map[int]bool{101: true}, // paid for after it was read
+	}
+	NewSweeper(repo, SweeperConfig{BatchSize: 3}).sweep(context.Background())
+
+	if len(repo.batchSizes) != 1 || repo.batchSizes[0] != 3 {
+		t.Errorf("expired reservations were read with limits %v, want 3", repo.batchSizes)
+	}
+	if want := []int{100, 102}; len(repo.released) != len(want) || repo.released[0] != want[0] || repo.released[1] != want[1] {
+		t.Errorf("released orders %v, want %v", repo.released, want)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	for seconds, want := range map[int64]time.Duration{
+		0:      DefaultTTL,
+		-5:     DefaultTTL,
+		600:    time.Minute * 10,
+		604800: MaxTTL,
+	} {
+		if got := TTL(seconds); got != want {
+			t.Errorf("ttl of %d seconds is %s, want %s", seconds, got, want)
+		}
+	}
+}
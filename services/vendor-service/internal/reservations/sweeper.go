@@ -0,0 +1,84 @@
+package reservations
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	DefaultTTL              = time.Minute * 15
+	MaxTTL                  = time.Hour * 24 // a longer hold would keep the stock from other customers long after the order was abandoned
+	DefaultSweepInterval    = time.Minute
+	DefaultSweeperBatchSize = 100
+)
+
+// TTL is how long a reservation asked to be held for the seconds is held, the default when not set and at most MaxTTL
+func TTL(seconds int64) time.Duration {
+	if seconds <= 0 {
+		return DefaultTTL
+	}
+	if seconds > int64(MaxTTL/time.Second) {
+		return MaxTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+type SweeperConfig struct {
+	Interval  time.Duration // time between sweeps for expired reservations
+	BatchSize int           // reservations released per sweep
+}
+
+// Sweeper releases the held reservations that have expired, e.g. the order was abandoned without being canceled
+type Sweeper struct {
+	store  ReservationRepo
+	config SweeperConfig
+}
+
+func NewSweeper(store ReservationRepo, config SweeperConfig) *Sweeper {
+	if config.Interval <= 0 {
+		config.Interval = DefaultSweepInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultSweeperBatchSize
+	}
+	return &Sweeper{store: store, config: config}
+}
+
+// Run releases expired reservations until the context is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("shutting down the reservation sweeper")
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *Sweeper) sweep(ctx context.Context) {
+	expired, err := s.store.GetExpiredReservations(time.Now(), s.config.BatchSize)
+	if err != nil {
+		log.Printf("error getting expired reservations: %v", err)
+		return
+	}
+	for _, reservation := range expired {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := s.store.Release(reservation.OrderId); err != nil {
+			if errors.Is(err, ErrReservationCommitted) {
+				// paid for since it was read
+				continue
+			}
+			log.Printf("error releasing expired reservation of order %d: %v", reservation.OrderId, err)
+			continue
+		}
+		log.Printf("released expired reservation of order %d", reservation.OrderId)
+	}
+}
@@ -9,6 +9,9 @@ type SellerRepo interface {
 	// create vendor
 	CreateVendor(payload Seller) (*Seller, error)
 	GetVendor(sellerId int64) (*Seller, error)
+	GetVendorByUserId(userId int64) (*Seller, error)
+	// ids of the stores the seller owns
+	GetStoreIds(sellerId int64) ([]int64, error)
 }
 
 type SqlSellerRepo struct {
@@ -59,3 +62,42 @@ func (r *SqlSellerRepo) GetVendor(sellerId int64) (*Seller, error) {
 
 	return &seller, nil
 }
+
+// GetVendorByUserId fetches the seller of a user, nil when the user is not a seller
+func (r *SqlSellerRepo) GetVendorByUserId(userId int64) (*Seller, error) {
+	query := `
+		SELECT id, userId, name, email, phone, createdAt, updatedAt
+		FROM sellers
+		WHERE userId = ?
+	`
+
+	var seller Seller
+	err := r.db.QueryRow(query, userId).
+		Scan(&seller.ID, &seller.UserId, &seller.Name, &seller.Email, &seller.Phone, &seller.CreatedAt, &seller.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No vendor found
+		}
+		return nil, fmt.Errorf("error fetching vendor: %w", err)
+	}
+
+	return &seller, nil
+}
+
+func (r *SqlSellerRepo) GetStoreIds(sellerId int64) ([]int64, error) {
+	rows, err := r.db.Query(`SELECT id FROM stores WHERE vendorId = ? ORDER BY id`, sellerId)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stores of vendor: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning store id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -1,12 +1,15 @@
 package store
 
 import (
+	"errors"
 	"time"
 
 	vendor_types "github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
 	"github.com/kaasikodes/shop-ease/shared/types"
 )
 
+var ErrInventoryNotFound = errors.New("inventory does not exist in the store")
+
 type Inventory struct {
 	Id                   int                  `json:"id" `
 	Quantity             int                  `json:"quantity" validate:"required"`
@@ -16,10 +16,10 @@ type StoreRepo interface {
 	GetProducts(pagination *utils.PaginationPayload, filter *types.ProductFilter) (result []types.Product, total int, err error)
 	// Add inventory in bulk
 	BulkAddInventory(payload []Inventory) error
-	// Update inventory
-	UpdateInventory(id int64, payload Inventory) error
-	// delete inventory
-	DeleteInventory(id int64) (*int64, error)
+	// Update inventory of the store, it can not be moved to another store
+	UpdateInventory(storeId int64, id int64, payload Inventory) error
+	// delete inventory of the store
+	DeleteInventory(storeId int64, id int64) (*int64, error)
 	// Get Inventories
 	GetInventories(pagination *utils.PaginationPayload, filter *types.InventoryFilter) (result []Inventory, total int, err error)
 }
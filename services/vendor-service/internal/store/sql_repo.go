@@ -1,14 +1,22 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/kaasikodes/shop-ease/services/vendor-service/internal/reservations"
 	"github.com/kaasikodes/shop-ease/services/vendor-service/pkg/types"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/outbox"
 	"github.com/kaasikodes/shop-ease/shared/utils"
 )
 
+const eventProducer = "vendor-service"
+
 type SqlStoreRepo struct {
 	db *sql.DB
 }
@@ -19,12 +27,19 @@ func NewSqlStoreRepo(db *sql.DB) *SqlStoreRepo {
 }
 
 func (r *SqlStoreRepo) CreateStore(payload Store) (*Store, error) {
+	ctx := context.Background()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO stores (vendorId, name, description, location, lat, long, country, state, lga, landmark, timezone, postalCode, phone, email, bank, number, swiftCode)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO stores (vendorId, name, description, lowStockThreshold, location, lat, long, country, state, lga, landmark, timezone, postalCode, phone, email, bank, number, swiftCode)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := r.db.Exec(query,
-		payload.VendorId, payload.Name, payload.Description,
+	result, err := tx.ExecContext(ctx, query,
+		payload.VendorId, payload.Name, payload.Description, payload.LowStockThreshold,
 		payload.Address.Location, payload.Address.Lat, payload.Address.Long, payload.Address.Country,
 		payload.Address.State, payload.Address.Lga, payload.Address.Landmark, payload.Address.Timezone, payload.Address.PostalCode,
 		payload.Contact.Phone, payload.Contact.Email,
@@ -39,17 +54,32 @@ func (r *SqlStoreRepo) CreateStore(payload Store) (*Store, error) {
 		return nil, fmt.Errorf("failed to retrieve last insert ID: %w", err)
 	}
 
+	payload.ID = int(id)
+	if err := enqueueStoreAccountSavedEvent(ctx, tx, payload); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return r.GetStoreById(id)
 }
 
 func (r *SqlStoreRepo) UpdateStore(id int64, payload Store) (*Store, error) {
+	ctx := context.Background()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE stores
-		SET vendorId = ?, name = ?, description = ?, location = ?, lat = ?, long = ?, country = ?, state = ?, lga = ?, landmark = ?, timezone = ?, postalCode = ?, phone = ?, email = ?, bank = ?, number = ?, swiftCode = ?, updatedAt = NOW()
+		SET vendorId = ?, name = ?, description = ?, lowStockThreshold = ?, location = ?, lat = ?, long = ?, country = ?, state = ?, lga = ?, landmark = ?, timezone = ?, postalCode = ?, phone = ?, email = ?, bank = ?, number = ?, swiftCode = ?, updatedAt = NOW()
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query,
-		payload.VendorId, payload.Name, payload.Description,
+	_, err = tx.ExecContext(ctx, query,
+		payload.VendorId, payload.Name, payload.Description, payload.LowStockThreshold,
 		payload.Address.Location, payload.Address.Lat, payload.Address.Long, payload.Address.Country,
 		payload.Address.State, payload.Address.Lga, payload.Address.Landmark, payload.Address.Timezone, payload.Address.PostalCode,
 		payload.Contact.Phone, payload.Contact.Email,
@@ -60,17 +90,41 @@ func (r *SqlStoreRepo) UpdateStore(id int64, payload Store) (*Store, error) {
 		return nil, fmt.Errorf("error updating store: %w", err)
 	}
 
+	payload.ID = int(id)
+	if err := enqueueStoreAccountSavedEvent(ctx, tx, payload); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return r.GetStoreById(id)
 }
+
+// enqueueStoreAccountSavedEvent informs payment-service of the account the earnings of the store are paid out to, it is written in the transaction of the change
+func enqueueStoreAccountSavedEvent(ctx context.Context, tx *sql.Tx, store Store) error {
+	envelope, err := events.NewEnvelope(ctx, eventProducer, events.VendorStoreAccountSaved, events.VendorStoreAccountSavedPayload{
+		StoreId:   store.ID,
+		VendorId:  store.VendorId,
+		Name:      store.Name,
+		Bank:      store.Account.Bank,
+		Number:    store.Account.Number,
+		SwiftCode: store.Account.SwiftCode,
+	})
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, tx, outbox.MySQL, events.VendorTopic, strconv.Itoa(store.ID), envelope)
+}
 func (r *SqlStoreRepo) GetStoreById(id int64) (*Store, error) {
 	query := `
-		SELECT id, vendorId, name, description, location, lat, long, country, state, lga, landmark, timezone, postalCode, phone, email, bank, number, swiftCode, createdAt, updatedAt
+		SELECT id, vendorId, name, description, lowStockThreshold, location, lat, long, country, state, lga, landmark, timezone, postalCode, phone, email, bank, number, swiftCode, createdAt, updatedAt
 		FROM stores
 		WHERE id = ?
 	`
 	var store Store
 	err := r.db.QueryRow(query, id).Scan(
-		&store.ID, &store.VendorId, &store.Name, &store.Description,
+		&store.ID, &store.VendorId, &store.Name, &store.Description, &store.LowStockThreshold,
 		&store.Address.Location, &store.Address.Lat, &store.Address.Long, &store.Address.Country,
 		&store.Address.State, &store.Address.Lga, &store.Address.Landmark, &store.Address.Timezone, &store.Address.PostalCode,
 		&store.Contact.Phone, &store.Contact.Email,
@@ -164,29 +218,119 @@ func (r *SqlStoreRepo) BulkAddInventory(payload []Inventory) error {
 	return nil
 }
 
-func (r *SqlStoreRepo) UpdateInventory(id int64, payload Inventory) error {
+func (r *SqlStoreRepo) UpdateInventory(storeId int64, id int64, payload Inventory) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the inventory stays in its store but may be moved to another product, the stock of both changes
+	products, err := inventoryProducts(tx, storeId, id, stockKey{storeId: int(storeId), productId: payload.ProductId})
+	if err != nil {
+		return err
+	}
+	before, err := availableStock(tx, products)
+	if err != nil {
+		return err
+	}
 	query := `
 		UPDATE inventories
-		SET quantity = ?, unitCostPrice = ?, productId = ?, storeId = ?, arrivalOrProduceDate = ?, updatedAt = NOW()
-		WHERE id = ?
+		SET quantity = ?, unitCostPrice = ?, productId = ?, arrivalOrProduceDate = ?, updatedAt = NOW()
+		WHERE id = ? AND storeId = ?
 	`
-	_, err := r.db.Exec(query, payload.Quantity, payload.UnitCostPrice, payload.ProductId, payload.StoreId, payload.ArrivalorProduceDate, id)
+	_, err = tx.Exec(query, payload.Quantity, payload.UnitCostPrice, payload.ProductId, payload.ArrivalorProduceDate, id, storeId)
 	if err != nil {
 		return fmt.Errorf("error updating inventory: %w", err)
 	}
-	return nil
+	if err := enqueueLowStockEvents(tx, products, before); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *SqlStoreRepo) DeleteInventory(id int64) (*int64, error) {
+func (r *SqlStoreRepo) DeleteInventory(storeId int64, id int64) (*int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
-	query := `DELETE FROM inventories WHERE id = ?`
-	_, err := r.db.Exec(query, id)
+	products, err := inventoryProducts(tx, storeId, id)
+	if err != nil {
+		return nil, err
+	}
+	before, err := availableStock(tx, products)
+	if err != nil {
+		return nil, err
+	}
+	query := `DELETE FROM inventories WHERE id = ? AND storeId = ?`
+	_, err = tx.Exec(query, id, storeId)
 	if err != nil {
 		return nil, fmt.Errorf("error deleting inventory: %w", err)
 	}
+	if err := enqueueLowStockEvents(tx, products, before); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return &id, nil
 }
+
+type stockKey struct{ storeId, productId int }
+
+// inventoryProducts returns the product of the inventory of the store and the others given, sorted so changes lock inventories in the same order as reservations
+func inventoryProducts(tx *sql.Tx, storeId int64, id int64, others ...stockKey) ([]stockKey, error) {
+	var current stockKey
+	err := tx.QueryRow(`SELECT storeId, productId FROM inventories WHERE id = ? AND storeId = ?`, id, storeId).Scan(&current.storeId, &current.productId)
+	if err == sql.ErrNoRows {
+		return nil, ErrInventoryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting inventory: %w", err)
+	}
+	products := []stockKey{current}
+	for _, other := range others {
+		if !slices.Contains(products, other) {
+			products = append(products, other)
+		}
+	}
+	slices.SortFunc(products, func(a, b stockKey) int {
+		if a.storeId != b.storeId {
+			return a.storeId - b.storeId
+		}
+		return a.productId - b.productId
+	})
+	return products, nil
+}
+
+func availableStock(tx *sql.Tx, products []stockKey) (map[stockKey]int, error) {
+	available := make(map[stockKey]int, len(products))
+	for _, product := range products {
+		quantity, err := reservations.Available(tx, product.storeId, product.productId)
+		if err != nil {
+			return nil, err
+		}
+		available[product] = quantity
+	}
+	return available, nil
+}
+
+// enqueueLowStockEvents emits product.low_stock for the products whose available quantity the change took to or below the threshold of their store
+func enqueueLowStockEvents(tx *sql.Tx, products []stockKey, before map[stockKey]int) error {
+	after, err := availableStock(tx, products)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		if err := reservations.EnqueueLowStockEvent(tx, product.storeId, product.productId, before[product], after[product]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 func (r *SqlStoreRepo) GetInventories(pagination *utils.PaginationPayload, filter *types.InventoryFilter) ([]Inventory, int, error) {
 	var (
 		inventories  []Inventory
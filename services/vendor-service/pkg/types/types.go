@@ -53,9 +53,11 @@ type Store struct {
 	VendorId    int    `json:"vendorId"`
 	Name        string `json:"name" validate:"required,max=100"`
 	Description string `json:"description" validate:"required,max=100"`
-	Address     Address
-	Contact     Contact
-	Account     Account
+	// product.low_stock is emitted when the available quantity of a product drops to this, zero turns it off
+	LowStockThreshold int `json:"lowStockThreshold" validate:"min=0"`
+	Address           Address
+	Contact           Contact
+	Account           Account
 	Common
 }
 type Account struct {
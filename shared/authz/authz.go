@@ -0,0 +1,134 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
+)
+
+type Role = string
+
+const (
+	Admin    Role = "admin"
+	Vendor   Role = "vendor"
+	Customer Role = "customer"
+)
+
+type Permission = string
+
+const (
+	CreateOrder        Permission = "orders:create"
+	ReadOrder          Permission = "orders:read"
+	UpdateOrder        Permission = "orders:update"
+	ManageStore        Permission = "stores:manage"
+	ManageInventory    Permission = "inventory:manage"
+	ReadPayouts        Permission = "payouts:read"
+	ManageReservations Permission = "reservations:manage"
+	ReadPayments       Permission = "payments:read"
+	ManagePayments     Permission = "payments:manage"
+)
+
+// RolePermissions are the permissions each role grants, they are put in the scope claim when the token is issued
+var RolePermissions = map[Role][]Permission{
+	Customer: {CreateOrder, ReadOrder}, // changing the status of an order is left to its vendors and admins
+	Vendor:   {ReadOrder, UpdateOrder, ManageStore, ManageInventory, ReadPayouts},
+	Admin:    {CreateOrder, ReadOrder, UpdateOrder, ManageStore, ManageInventory, ReadPayouts, ManageReservations, ReadPayments, ManagePayments},
+}
+
+// PermissionsFor returns the permissions granted by the roles, without duplicates
+func PermissionsFor(roles []Role) []Permission {
+	var permissions []Permission
+	for _, role := range roles {
+		for _, permission := range RolePermissions[role] {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+type contextKeyClaims struct{}
+
+// WithClaims stores the verified claims of the request, the auth middleware of a service calls it before the requirements below run
+func WithClaims(ctx context.Context, claims *jwttoken.CustomClaims) context.Context {
+	return context.WithValue(ctx, contextKeyClaims{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*jwttoken.CustomClaims, bool) {
+	claims, ok := ctx.Value(contextKeyClaims{}).(*jwttoken.CustomClaims)
+	return claims, ok
+}
+
+var ErrNoClaims = errors.New("request has no verified claims")
+
+// Authorizer enforces route level requirements from the claims of the token, so every service applies the same rules without asking the auth service
+type Authorizer struct {
+	unauthorized func(w http.ResponseWriter, r *http.Request, err error)
+	forbidden    func(w http.ResponseWriter, r *http.Request)
+}
+
+// NewAuthorizer takes the error responses of the service so rejected requests look like its other errors
+func NewAuthorizer(unauthorized func(w http.ResponseWriter, r *http.Request, err error), forbidden func(w http.ResponseWriter, r *http.Request)) *Authorizer {
+	return &Authorizer{unauthorized: unauthorized, forbidden: forbidden}
+}
+
+// RequireRoles lets the request through when the user has any of the roles
+func (a *Authorizer) RequireRoles(roles ...Role) func(http.Handler) http.Handler {
+	return a.require(func(r *http.Request, claims *jwttoken.CustomClaims) bool {
+		for _, role := range roles {
+			if slices.Contains(claims.Roles, role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePermissions lets the request through when the user has all the permissions
+func (a *Authorizer) RequirePermissions(permissions ...Permission) func(http.Handler) http.Handler {
+	return a.require(func(r *http.Request, claims *jwttoken.CustomClaims) bool {
+		for _, permission := range permissions {
+			if !slices.Contains(claims.Scopes, permission) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireStoreAccess lets the request through when the store in the url param is one of the user's stores, admins have access to every store
+func (a *Authorizer) RequireStoreAccess(param string) func(http.Handler) http.Handler {
+	return a.require(func(r *http.Request, claims *jwttoken.CustomClaims) bool {
+		if slices.Contains(claims.Roles, Admin) {
+			return true
+		}
+		storeId, err := strconv.Atoi(chi.URLParam(r, param))
+		if err != nil {
+			return false
+		}
+		return slices.Contains(claims.StoreIDs, storeId)
+	})
+}
+
+func (a *Authorizer) require(allowed func(r *http.Request, claims *jwttoken.CustomClaims) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				a.unauthorized(w, r, ErrNoClaims)
+				return
+			}
+			if !allowed(r, claims) {
+				a.forbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
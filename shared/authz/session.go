@@ -0,0 +1,97 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
+	"github.com/kaasikodes/shop-ease/shared/proto/auth"
+	"google.golang.org/grpc"
+)
+
+const (
+	DefaultSessionCacheTTL = time.Minute
+	maxCachedSessions      = 10000
+)
+
+var ErrSessionRevoked = errors.New("session has been logged out or revoked")
+
+// SessionChecker is the part of the auth service client the cache needs
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, in *auth.IsSessionActiveRequest, opts ...grpc.CallOption) (*auth.IsSessionActiveResponse, error)
+}
+
+type cachedSession struct {
+	active    bool
+	checkedAt time.Time
+}
+
+// SessionCache asks the auth service whether the session of a token is still active and remembers the answer for the ttl,
+// so a logged out or revoked session is rejected within the ttl rather than when its access token expires, without a call per request
+type SessionCache struct {
+	client   SessionChecker
+	ttl      time.Duration
+	mu       sync.Mutex
+	sessions map[string]cachedSession
+	now      func() time.Time
+}
+
+func NewSessionCache(client SessionChecker, ttl time.Duration) *SessionCache {
+	if ttl <= 0 {
+		ttl = DefaultSessionCacheTTL
+	}
+	return &SessionCache{client: client, ttl: ttl, sessions: map[string]cachedSession{}, now: time.Now}
+}
+
+// Check returns ErrSessionRevoked when the session of the claims is no longer active. When the auth service can not be reached
+// the last answer for the session is used however old it is, a session never checked is rejected with the error of the call
+func (c *SessionCache) Check(ctx context.Context, claims *jwttoken.CustomClaims) error {
+	if claims.SessionID == "" {
+		return ErrSessionRevoked
+	}
+	key := claims.UserID + ":" + claims.SessionID
+	c.mu.Lock()
+	cached, ok := c.sessions[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.checkedAt) < c.ttl {
+		return sessionError(cached.active)
+	}
+
+	userId, err := strconv.Atoi(claims.UserID)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.IsSessionActive(ctx, &auth.IsSessionActiveRequest{SessionId: claims.SessionID, UserId: int32(userId)})
+	if err != nil {
+		if ok {
+			return sessionError(cached.active)
+		}
+		return err
+	}
+	c.store(key, res.Active)
+	return sessionError(res.Active)
+}
+
+func (c *SessionCache) store(key string, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.sessions) >= maxCachedSessions {
+		for k, session := range c.sessions {
+			if now.Sub(session.checkedAt) >= c.ttl {
+				delete(c.sessions, k)
+			}
+		}
+	}
+	c.sessions[key] = cachedSession{active: active, checkedAt: now}
+}
+
+func sessionError(active bool) error {
+	if !active {
+		return ErrSessionRevoked
+	}
+	return nil
+}
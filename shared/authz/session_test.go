@@ -0,0 +1,77 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	jwttoken "github.com/kaasikodes/shop-ease/shared/jwt_token"
+	"github.com/kaasikodes/shop-ease/shared/proto/auth"
+	"google.golang.org/grpc"
+)
+
+// stubChecker answers with the active flag or the error it is given
+type stubChecker struct {
+	active bool
+	err    error
+	calls  int
+}
+
+func (s *stubChecker) IsSessionActive(ctx context.Context, in *auth.IsSessionActiveRequest, opts ...grpc.CallOption) (*auth.IsSessionActiveResponse, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &auth.IsSessionActiveResponse{Active: s.active}, nil
+}
+
+func newTestSessionCache(checker *stubChecker) (*SessionCache, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewSessionCache(checker, time.Minute)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestSessionCacheRejectsARevokedSessionOnceTheAnswerExpires(t *testing.T) {
+	checker := &stubChecker{active: true}
+	cache, now := newTestSessionCache(checker)
+	claims := &jwttoken.CustomClaims{UserID: "7", SessionID: "family-1"}
+
+	if err := cache.Check(context.Background(), claims); err != nil {
+		t.Fatalf("active session returned %v", err)
+	}
+	checker.active = false
+	if err := cache.Check(context.Background(), claims); err != nil || checker.calls != 1 {
+		t.Fatalf("got %v after %d calls, want the cached answer", err, checker.calls)
+	}
+	*now = now.Add(time.Minute)
+	if err := cache.Check(context.Background(), claims); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("revoked session returned %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestSessionCacheFallsBackToTheLastAnswerWhenAuthIsUnreachable(t *testing.T) {
+	checker := &stubChecker{active: true}
+	cache, now := newTestSessionCache(checker)
+	claims := &jwttoken.CustomClaims{UserID: "7", SessionID: "family-1"}
+	cache.Check(context.Background(), claims)
+
+	unreachable := errors.New("connection refused")
+	checker.err = unreachable
+	*now = now.Add(time.Hour)
+	if err := cache.Check(context.Background(), claims); err != nil {
+		t.Errorf("checked session returned %v, want the last answer", err)
+	}
+	if err := cache.Check(context.Background(), &jwttoken.CustomClaims{UserID: "8", SessionID: "family-2"}); !errors.Is(err, unreachable) {
+		t.Errorf("unchecked session returned %v, want the error of the call", err)
+	}
+}
+
+func TestSessionCacheRejectsTokensWithoutASession(t *testing.T) {
+	checker := &stubChecker{active: true}
+	cache, _ := newTestSessionCache(checker)
+	if err := cache.Check(context.Background(), &jwttoken.CustomClaims{UserID: "7"}); !errors.Is(err, ErrSessionRevoked) || checker.calls != 0 {
+		t.Errorf("got %v after %d calls, want ErrSessionRevoked without asking auth", err, checker.calls)
+	}
+}
@@ -1,9 +1,52 @@
 package broker
 
+import (
+	"context"
+	"fmt"
+)
+
 type MessageBroker interface {
 	Publish(topic string, messsage []byte) error
-	Subscribe(topic string, handler func(msg []byte) error) error
+	// PublishMessage publishes to the topic, messages of the same key keep their order where the broker supports it and the headers are delivered alongside the message
+	PublishMessage(ctx context.Context, topic string, key string, headers map[string]string, message []byte) error
+	// Subscribe hands every message of the topic to the handler, ctx carries the span the message is handled in
+	Subscribe(topic string, handler func(ctx context.Context, msg []byte) error) error
 	Close() error
 }
 
+const (
+	KafkaBroker    = "kafka"
+	RabbitMQBroker = "rabbitmq"
+)
+
+// Config selects the broker a service uses, each service would set Kind from its env so it can be moved between brokers without a code change
+type Config struct {
+	Kind         string // KafkaBroker (the default) or RabbitMQBroker
+	DefaultTopic string // topic published to when none is given
+	KafkaBrokers []string
+	Kafka        KafkaConfig
+	RabbitMQURL  string
+	RabbitMQ     RabbitMQConfig
+}
+
+func New(config Config) (MessageBroker, error) {
+	switch config.Kind {
+	case "", KafkaBroker:
+		return NewKafkaHelper(config.KafkaBrokers, config.DefaultTopic, config.Kafka), nil
+	case RabbitMQBroker:
+		return NewRabbitMQHelper(config.RabbitMQURL, config.RabbitMQ)
+	}
+	return nil, fmt.Errorf("unknown message broker %q", config.Kind)
+}
+
+// SubscribeWithPolicy subscribes with the retry policy on brokers that move failed messages along retry topics, the others redeliver or dead letter failed messages their own way
+func SubscribeWithPolicy(b MessageBroker, topic string, handler func(ctx context.Context, msg []byte) error, policy RetryPolicy) error {
+	if retrying, ok := b.(interface {
+		SubscribeWithPolicy(topic string, handler func(ctx context.Context, msg []byte) error, policy RetryPolicy) error
+	}); ok {
+		return retrying.SubscribeWithPolicy(topic, handler, policy)
+	}
+	return b.Subscribe(topic, handler)
+}
+
 // Events Definition of Each Service
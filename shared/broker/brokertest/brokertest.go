@@ -0,0 +1,100 @@
+// Package brokertest has helpers to assert on the events published to a broker.MemoryBroker
+package brokertest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/broker"
+	"github.com/kaasikodes/shop-ease/shared/events"
+)
+
+// NewBroker returns a MemoryBroker that is closed when the test ends
+func NewBroker(t testing.TB) *broker.MemoryBroker {
+	t.Helper()
+	b := broker.NewMemoryBroker(broker.MemoryConfig{RedeliveryDelay: time.Millisecond * 10})
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// PublishedEvents returns the envelopes of the events published to the topic in the order they were published
+func PublishedEvents(t testing.TB, b *broker.MemoryBroker, topic string) []*events.Envelope {
+	t.Helper()
+	var envelopes []*events.Envelope
+	for _, msg := range b.Published(topic) {
+		var envelope events.Envelope
+		if err := json.Unmarshal(msg.Value, &envelope); err != nil {
+			t.Fatalf("message published to %s topic is not an event envelope: %v", topic, err)
+		}
+		envelopes = append(envelopes, &envelope)
+	}
+	return envelopes
+}
+
+// AssertPublished fails the test unless an event of the type was published to the topic, the first such event is returned
+func AssertPublished(t testing.TB, b *broker.MemoryBroker, topic string, eventType string) *events.Envelope {
+	t.Helper()
+	if envelope := findEvent(t, b, topic, eventType); envelope != nil {
+		return envelope
+	}
+	t.Fatalf("expected %s event to be published to %s topic, published: %v", eventType, topic, eventTypes(t, b, topic))
+	return nil
+}
+
+// AssertNotPublished fails the test if an event of the type was published to the topic
+func AssertNotPublished(t testing.TB, b *broker.MemoryBroker, topic string, eventType string) {
+	t.Helper()
+	if findEvent(t, b, topic, eventType) != nil {
+		t.Fatalf("expected no %s event to be published to %s topic", eventType, topic)
+	}
+}
+
+// WaitForEvent waits for an event of the type to be published to the topic, for events published by a handler further down a flow
+func WaitForEvent(t testing.TB, b *broker.MemoryBroker, topic string, eventType string, timeout time.Duration) *events.Envelope {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if envelope := findEvent(t, b, topic, eventType); envelope != nil {
+			return envelope
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	t.Fatalf("timed out after %s waiting for %s event on %s topic, published: %v", timeout, eventType, topic, eventTypes(t, b, topic))
+	return nil
+}
+
+// AssertNoFailures fails the test if a consumer group gave up on a message
+func AssertNoFailures(t testing.TB, b *broker.MemoryBroker) {
+	t.Helper()
+	for _, failed := range b.Failed() {
+		t.Errorf("consumer group %s failed to handle message from %s topic after %d attempt(s): %v", failed.Group, failed.Topic, failed.Attempts, failed.Err)
+	}
+}
+
+// Payload decodes the data of the envelope into the payload type of its event
+func Payload[T any](t testing.TB, envelope *events.Envelope) T {
+	t.Helper()
+	var payload T
+	if err := envelope.DecodeData(&payload); err != nil {
+		t.Fatalf("error decoding %s event: %v", envelope.Type, err)
+	}
+	return payload
+}
+
+func findEvent(t testing.TB, b *broker.MemoryBroker, topic string, eventType string) *events.Envelope {
+	for _, envelope := range PublishedEvents(t, b, topic) {
+		if envelope.Type == eventType {
+			return envelope
+		}
+	}
+	return nil
+}
+
+func eventTypes(t testing.TB, b *broker.MemoryBroker, topic string) []string {
+	var types []string
+	for _, envelope := range PublishedEvents(t, b, topic) {
+		types = append(types, envelope.Type)
+	}
+	return types
+}
@@ -0,0 +1,268 @@
+package brokertest_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/broker"
+	"github.com/kaasikodes/shop-ease/shared/broker/brokertest"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+// The sagas below run the event contracts between the services over a MemoryBroker, each service is stood in for by a participant that
+// consumes and publishes the same events as the service does, in its own consumer group
+
+const sagaTimeout = time.Second * 5
+
+func publish(t *testing.T, ctx context.Context, b *broker.MemoryBroker, producer string, topic string, key string, eventType string, data any) error {
+	t.Helper()
+	envelope, err := events.NewEnvelope(ctx, producer, eventType, data)
+	if err != nil {
+		t.Fatalf("error creating %s event: %v", eventType, err)
+	}
+	msg, err := events.Encode(envelope)
+	if err != nil {
+		t.Fatalf("error encoding %s event: %v", eventType, err)
+	}
+	return b.PublishMessage(ctx, topic, key, envelope.Headers(), msg)
+}
+
+func waitIdle(t *testing.T, b *broker.MemoryBroker) {
+	t.Helper()
+	if !b.WaitIdle(sagaTimeout) {
+		t.Fatalf("the saga did not settle within %s", sagaTimeout)
+	}
+}
+
+// paymentService pays for what it is asked to, its provider is unavailable for the first `failures` initiations
+type paymentService struct {
+	t        *testing.T
+	broker   *broker.MemoryBroker
+	failures int
+	decline  bool // the provider declines order payments
+
+	mu       sync.Mutex
+	attempts int
+	shares   map[int][]events.OrderCreatedItem
+}
+
+func (p *paymentService) initiate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts++
+	if p.attempts <= p.failures {
+		return errors.New("provider unavailable")
+	}
+	return nil
+}
+
+func (p *paymentService) handleSubscriptionEvents(ctx context.Context, msg []byte) error {
+	_, data, err := events.Decode(msg)
+	if err != nil {
+		return err
+	}
+	payload, ok := data.(*events.VendorSubscriptionCreatedPayload)
+	if !ok {
+		return nil
+	}
+	if err := p.initiate(); err != nil {
+		// returned so the broker redelivers the event, as the payment-service consumer does
+		return err
+	}
+	paidAt := time.Now()
+	return publish(p.t, ctx, p.broker, "payment-service", events.PaymentTopic, "subscription", events.VendorSubscriptionPaymnentMade, events.VendorSubscriptionPaymentMadePayload{
+		TransactionId:  1,
+		Reference:      "ref-subscription",
+		Provider:       "paystack",
+		SubscriptionId: payload.SubscriptionId,
+		VendorId:       payload.VendorId,
+		Amount:         payload.Amount,
+		PaidAt:         &paidAt,
+	})
+}
+
+func (p *paymentService) handleOrderEvents(ctx context.Context, msg []byte) error {
+	_, data, err := events.Decode(msg)
+	if err != nil {
+		return err
+	}
+	payload, ok := data.(*events.OrderCreatedPayload)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	p.shares[payload.OrderId] = payload.Items
+	p.mu.Unlock()
+	// the payment is started by the checkout of order-service, the outcome the provider reports for it is published here once the order is placed
+	if err := p.initiate(); err != nil {
+		return err
+	}
+
+	if p.decline {
+		return publish(p.t, ctx, p.broker, "payment-service", events.PaymentTopic, "order", events.OrderPaymentFailed, events.OrderPaymentFailedPayload{
+			TransactionId: 2,
+			Reference:     "ref-order",
+			Provider:      "paystack",
+			OrderId:       payload.OrderId,
+			UserId:        payload.UserId,
+			Amount:        payload.Amount,
+			Reason:        "insufficient funds",
+		})
+	}
+	paidAt := time.Now()
+	return publish(p.t, ctx, p.broker, "payment-service", events.PaymentTopic, "order", events.OrderPaymnentMade, events.OrderPaymentMadePayload{
+		TransactionId: 2,
+		Reference:     "ref-order",
+		Provider:      "paystack",
+		OrderId:       payload.OrderId,
+		UserId:        payload.UserId,
+		Amount:        payload.Amount,
+		PaidAt:        &paidAt,
+	})
+}
+
+// subscriptionService activates the subscriptions that were paid for
+type subscriptionService struct {
+	mu     sync.Mutex
+	active map[int]bool
+}
+
+func (s *subscriptionService) handlePaymentEvents(ctx context.Context, msg []byte) error {
+	_, data, err := events.Decode(msg)
+	if err != nil {
+		return err
+	}
+	if payload, ok := data.(*events.VendorSubscriptionPaymentMadePayload); ok {
+		s.mu.Lock()
+		s.active[payload.SubscriptionId] = true
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// orderService moves the orders along with their payment, releasing the reserved stock when it fails
+type orderService struct {
+	mu       sync.Mutex
+	statuses map[int]string
+	released map[int]bool
+}
+
+func (o *orderService) handlePaymentEvents(ctx context.Context, msg []byte) error {
+	_, data, err := events.Decode(msg)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch payload := data.(type) {
+	case *events.OrderPaymentMadePayload:
+		o.statuses[payload.OrderId] = "paid"
+	case *events.OrderPaymentFailedPayload:
+		o.statuses[payload.OrderId] = "payment_failed"
+		o.released[payload.OrderId] = true
+	}
+	return nil
+}
+
+func TestVendorRegistrationSaga(t *testing.T) {
+	b := brokertest.NewBroker(t)
+	payments := &paymentService{t: t, broker: b, failures: 1}
+	subscriptions := &subscriptionService{active: map[int]bool{}}
+	b.Group("payment-service").Subscribe(events.SubscriptionTopic, payments.handleSubscriptionEvents)
+	b.Group("subscription-service").Subscribe(events.PaymentTopic, subscriptions.handlePaymentEvents)
+
+	amount := money.New(500000, money.NGN)
+	err := publish(t, context.Background(), b, "subscription-and-traffic-service", events.SubscriptionTopic, "7", events.VendorSubscriptionCreated, events.VendorSubscriptionCreatedPayload{
+		SubscriptionId: 7,
+		PlanId:         2,
+		VendorId:       3,
+		UserId:         11,
+		Amount:         amount,
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	paid := brokertest.WaitForEvent(t, b, events.PaymentTopic, events.VendorSubscriptionPaymnentMade, sagaTimeout)
+	waitIdle(t, b)
+	brokertest.AssertNoFailures(t, b)
+
+	payload := brokertest.Payload[events.VendorSubscriptionPaymentMadePayload](t, paid)
+	if payload.SubscriptionId != 7 || payload.VendorId != 3 || payload.Amount != amount {
+		t.Errorf("got payment %+v, want the subscription of the vendor paid in full", payload)
+	}
+	if payments.attempts != 2 {
+		t.Errorf("payment initiated %d times, want a retry after the provider was unavailable", payments.attempts)
+	}
+	if !subscriptions.active[7] {
+		t.Error("subscription was not activated after it was paid for")
+	}
+}
+
+func TestOrderPaymentSaga(t *testing.T) {
+	b := brokertest.NewBroker(t)
+	payments := &paymentService{t: t, broker: b, shares: map[int][]events.OrderCreatedItem{}}
+	orders := &orderService{statuses: map[int]string{}, released: map[int]bool{}}
+	b.Group("payment-service").Subscribe(events.OrderTopic, payments.handleOrderEvents)
+	b.Group("order-service").Subscribe(events.PaymentTopic, orders.handlePaymentEvents)
+
+	items := []events.OrderCreatedItem{
+		{ProductId: 1, StoreId: 4, Quantity: 2, AmountToBePaid: money.New(2000, money.NGN)},
+		{ProductId: 5, StoreId: 9, Quantity: 1, AmountToBePaid: money.New(3000, money.NGN)},
+	}
+	err := publish(t, context.Background(), b, "order-service", events.OrderTopic, "21", events.OrderCreated, events.OrderCreatedPayload{
+		OrderId: 21,
+		UserId:  11,
+		Amount:  money.New(5000, money.NGN),
+		Items:   items,
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	brokertest.WaitForEvent(t, b, events.PaymentTopic, events.OrderPaymnentMade, sagaTimeout)
+	waitIdle(t, b)
+	brokertest.AssertNoFailures(t, b)
+	brokertest.AssertNotPublished(t, b, events.PaymentTopic, events.OrderPaymentFailed)
+
+	if len(payments.shares[21]) != len(items) {
+		t.Errorf("recorded shares of %d items, want %d", len(payments.shares[21]), len(items))
+	}
+	if orders.statuses[21] != "paid" {
+		t.Errorf("order status is %q, want paid", orders.statuses[21])
+	}
+}
+
+func TestOrderPaymentSagaCompensatesDeclinedPayment(t *testing.T) {
+	b := brokertest.NewBroker(t)
+	payments := &paymentService{t: t, broker: b, decline: true, shares: map[int][]events.OrderCreatedItem{}}
+	orders := &orderService{statuses: map[int]string{}, released: map[int]bool{}}
+	b.Group("payment-service").Subscribe(events.OrderTopic, payments.handleOrderEvents)
+	b.Group("order-service").Subscribe(events.PaymentTopic, orders.handlePaymentEvents)
+
+	err := publish(t, context.Background(), b, "order-service", events.OrderTopic, "22", events.OrderCreated, events.OrderCreatedPayload{
+		OrderId: 22,
+		UserId:  11,
+		Amount:  money.New(1500, money.NGN),
+		Items:   []events.OrderCreatedItem{{ProductId: 1, StoreId: 4, Quantity: 1, AmountToBePaid: money.New(1500, money.NGN)}},
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	failed := brokertest.WaitForEvent(t, b, events.PaymentTopic, events.OrderPaymentFailed, sagaTimeout)
+	waitIdle(t, b)
+	brokertest.AssertNoFailures(t, b)
+	brokertest.AssertNotPublished(t, b, events.PaymentTopic, events.OrderPaymnentMade)
+
+	if reason := brokertest.Payload[events.OrderPaymentFailedPayload](t, failed).Reason; reason != "insufficient funds" {
+		t.Errorf("got failure reason %q, want the reason of the provider", reason)
+	}
+	if orders.statuses[22] != "payment_failed" || !orders.released[22] {
+		t.Errorf("order is %q with stock released %v, want the payment failed and the stock released", orders.statuses[22], orders.released[22])
+	}
+}
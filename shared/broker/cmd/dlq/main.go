@@ -0,0 +1,101 @@
+// dlq lists, inspects and replays the messages in the dead letter topic of a kafka topic
+//
+//	go run ./shared/broker/cmd/dlq list -topic payment
+//	go run ./shared/broker/cmd/dlq inspect -topic payment -partition 0 -offset 4
+//	go run ./shared/broker/cmd/dlq replay -topic payment -partition 0 -offset 4
+//	go run ./shared/broker/cmd/dlq replay -topic payment -all
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/broker"
+	"github.com/kaasikodes/shop-ease/shared/env"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	brokers := cmd.String("brokers", env.GetString("KAFKA_BROKER_ADDR", ":9092"), "comma separated kafka brokers")
+	topic := cmd.String("topic", "", "source topic whose dead letter topic is used")
+	partition := cmd.Int("partition", 0, "partition of the dead letter")
+	offset := cmd.Int64("offset", -1, "offset of the dead letter")
+	all := cmd.Bool("all", false, "replay every dead letter of the topic")
+	timeout := cmd.Duration("timeout", time.Second*30, "timeout of the command")
+	cmd.Parse(os.Args[2:])
+
+	if *topic == "" {
+		log.Fatal("the -topic flag is required")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	addrs := strings.Split(*brokers, ",")
+
+	switch os.Args[1] {
+	case "list":
+		deadLetters, err := broker.ReadDeadLetters(ctx, addrs, *topic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d message(s) in %s\n", len(deadLetters), broker.DeadLetterTopic(*topic))
+		for _, dl := range deadLetters {
+			fmt.Printf("%d/%d\tattempts=%d\tfailedAt=%s\terror=%s\n", dl.Partition, dl.Offset, dl.Attempts, dl.FailedAt.Format(time.RFC3339), dl.Error)
+		}
+	case "inspect":
+		dl := find(ctx, addrs, *topic, *partition, *offset)
+		fmt.Printf("dead letter:     %s/%d/%d\n", dl.Topic, dl.Partition, dl.Offset)
+		fmt.Printf("original:        %s/%d/%d\n", dl.OriginalTopic, dl.OriginalPartition, dl.OriginalOffset)
+		fmt.Printf("attempts:        %d\n", dl.Attempts)
+		fmt.Printf("failed at:       %s\n", dl.FailedAt.Format(time.RFC3339))
+		fmt.Printf("error:           %s\n", dl.Error)
+		fmt.Printf("key:             %s\n", dl.Key)
+		fmt.Printf("value:\n%s\n", dl.Value)
+	case "replay":
+		if !*all {
+			dl := find(ctx, addrs, *topic, *partition, *offset)
+			if err := broker.ReplayDeadLetter(ctx, addrs, *dl); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("replayed %d/%d to %s\n", dl.Partition, dl.Offset, dl.OriginalTopic)
+			return
+		}
+		deadLetters, err := broker.ReadDeadLetters(ctx, addrs, *topic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, dl := range deadLetters {
+			if err := broker.ReplayDeadLetter(ctx, addrs, dl); err != nil {
+				log.Fatalf("error replaying %d/%d: %v", dl.Partition, dl.Offset, err)
+			}
+		}
+		fmt.Printf("replayed %d message(s) to %s\n", len(deadLetters), *topic)
+	default:
+		usage()
+	}
+
+}
+
+func find(ctx context.Context, brokers []string, topic string, partition int, offset int64) *broker.DeadLetter {
+	if offset < 0 {
+		log.Fatal("the -offset flag is required")
+	}
+	dl, err := broker.FindDeadLetter(ctx, brokers, topic, partition, offset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return dl
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq <list|inspect|replay> -topic <topic> [-partition n -offset n | -all] [-brokers addrs]")
+	os.Exit(2)
+}
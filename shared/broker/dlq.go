@@ -0,0 +1,173 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetter is a message from a dead letter topic along with the metadata of its failure
+type DeadLetter struct {
+	Topic             string // the dead letter topic
+	Partition         int
+	Offset            int64
+	OriginalTopic     string
+	OriginalPartition int
+	OriginalOffset    int64
+	Attempts          int
+	Error             string
+	FailedAt          time.Time
+	Key               []byte
+	Value             []byte
+	Headers           []kafka.Header
+}
+
+func ParseDeadLetter(msg kafka.Message) DeadLetter {
+	dl := DeadLetter{
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		OriginalTopic: headerValue(msg.Headers, HeaderOriginalTopic),
+		Error:         headerValue(msg.Headers, HeaderError),
+		Key:           msg.Key,
+		Value:         msg.Value,
+		Headers:       msg.Headers,
+	}
+	dl.OriginalPartition, _ = strconv.Atoi(headerValue(msg.Headers, HeaderOriginalPartition))
+	dl.OriginalOffset, _ = strconv.ParseInt(headerValue(msg.Headers, HeaderOriginalOffset), 10, 64)
+	dl.Attempts, _ = strconv.Atoi(headerValue(msg.Headers, HeaderAttempts))
+	dl.FailedAt, _ = time.Parse(time.RFC3339Nano, headerValue(msg.Headers, HeaderFailedAt))
+	return dl
+}
+
+// ReadDeadLetters returns every message currently in the dead letter topic of the source topic, reading does not remove them
+func ReadDeadLetters(ctx context.Context, brokers []string, sourceTopic string) ([]DeadLetter, error) {
+	topic := DeadLetterTopic(sourceTopic)
+	partitions, err := readPartitions(ctx, brokers, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadLetters []DeadLetter
+	for _, partition := range partitions {
+		msgs, err := readPartition(ctx, brokers, topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			deadLetters = append(deadLetters, ParseDeadLetter(msg))
+		}
+	}
+	return deadLetters, nil
+}
+
+// FindDeadLetter returns the message at the partition and offset of the dead letter topic of the source topic
+func FindDeadLetter(ctx context.Context, brokers []string, sourceTopic string, partition int, offset int64) (*DeadLetter, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", brokers[0], DeadLetterTopic(sourceTopic), partition)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Seek(offset, kafka.SeekAbsolute); err != nil {
+		return nil, fmt.Errorf("no message at offset %d of partition %d: %w", offset, partition, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	msg, err := conn.ReadMessage(10e6)
+	if err != nil {
+		return nil, err
+	}
+	msg.Topic = DeadLetterTopic(sourceTopic)
+	msg.Partition = partition
+	dl := ParseDeadLetter(msg)
+	return &dl, nil
+}
+
+// ReplayDeadLetter publishes the original message back to the topic it failed on, the retry headers are dropped so it goes through the full retry chain again
+func ReplayDeadLetter(ctx context.Context, brokers []string, dl DeadLetter) error {
+	if dl.OriginalTopic == "" {
+		return fmt.Errorf("dead letter at %s/%d/%d has no original topic", dl.Topic, dl.Partition, dl.Offset)
+	}
+	var headers []kafka.Header
+	for _, h := range dl.Headers {
+		switch h.Key {
+		case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset, HeaderAttempts, HeaderError, HeaderFailedAt, HeaderRetryAt:
+			continue
+		}
+		headers = append(headers, h)
+	}
+
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(brokers...),
+		Balancer: &kafka.Hash{},
+	}
+	defer writer.Close()
+	return writer.WriteMessages(ctx, kafka.Message{
+		Topic:   dl.OriginalTopic,
+		Key:     dl.Key,
+		Value:   dl.Value,
+		Headers: headers,
+	})
+}
+
+func readPartitions(ctx context.Context, brokers []string, topic string) ([]int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+// readPartition reads the partition from its first offset up to the last offset at the time of the call
+func readPartition(ctx context.Context, brokers []string, topic string, partition int) ([]kafka.Message, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", brokers[0], topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := conn.ReadOffsets()
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	if first >= last {
+		return nil, nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: partition,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return nil, err
+	}
+
+	var msgs []kafka.Message
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return msgs, err
+		}
+		msg.Topic = topic
+		msgs = append(msgs, msg)
+		if msg.Offset >= last-1 {
+			return msgs, nil
+		}
+	}
+}
@@ -3,43 +3,98 @@ package broker
 import (
 	"context"
 	"errors"
+	"hash/fnv"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
+const (
+	DefaultDrainTimeout = time.Second * 30
+	// DefaultWriterBatchTimeout bounds how long a write waits for a batch to fill, with kafka-go's default of a second the synchronous single message publishes of the outbox relay would be capped at about one a second per topic
+	DefaultWriterBatchTimeout = time.Millisecond * 10
+)
+
+type KafkaConfig struct {
+	GroupID          string         // consumer group of the service, offsets are only committed when it is set
+	Concurrency      int            // workers per subscribed topic, messages with the same key are always handled in order by the same worker
+	TopicConcurrency map[string]int // overrides Concurrency for the given topics
+	DrainTimeout     time.Duration  // how long Close waits for in-flight messages to be handled
+}
+
 type KafkaHelper struct {
-	writer  *kafka.Writer
+	topic   string                   // default topic, used when publishing without one
+	writers map[string]*kafka.Writer // one per topic published to, including the retry and dead letter topics
 	readers map[string]*kafka.Reader
-	groupID string
+	config  KafkaConfig
 	brokers []string
 	mu      sync.Mutex
 	ctx     context.Context
 	cancel  context.CancelFunc
+
+	// fetching is stopped first on Close, the workers then drain what was already fetched before ctx is canceled
+	fetchCtx     context.Context
+	stopFetching context.CancelFunc
+	workers      sync.WaitGroup
 }
 
-func NewKafkaHelper(brokers []string, topic string) *KafkaHelper {
+func NewKafkaHelper(brokers []string, topic string, config KafkaConfig) *KafkaHelper {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = DefaultDrainTimeout
+	}
 	ctx, cancel := context.WithCancel(context.Background())
+	fetchCtx, stopFetching := context.WithCancel(ctx)
 	helper := &KafkaHelper{
-		writer: kafka.NewWriter(kafka.WriterConfig{
-			Brokers: brokers,
-			Topic:   topic,
-		}),
-		brokers: brokers,
-		readers: make(map[string]*kafka.Reader),
-		ctx:     ctx,
-		cancel:  cancel,
+		topic:        topic,
+		writers:      make(map[string]*kafka.Writer),
+		config:       config,
+		brokers:      brokers,
+		readers:      make(map[string]*kafka.Reader),
+		ctx:          ctx,
+		cancel:       cancel,
+		fetchCtx:     fetchCtx,
+		stopFetching: stopFetching,
 	}
 	return helper
 
 }
 
-func (k *KafkaHelper) Subscribe(topic string, handler func(msg []byte) error) error {
+// Subscribe consumes the topic with the DefaultRetryPolicy
+func (k *KafkaHelper) Subscribe(topic string, handler func(ctx context.Context, msg []byte) error) error {
+	return k.SubscribeWithPolicy(topic, handler, DefaultRetryPolicy)
+}
+
+// SubscribeWithPolicy consumes the topic and every retry topic of the policy. A message the handler fails on is moved down the retry topics, waiting longer at each one, and ends up in the dead letter topic once the retries are exhausted
+func (k *KafkaHelper) SubscribeWithPolicy(topic string, handler func(ctx context.Context, msg []byte) error, policy RetryPolicy) error {
+	policy = policy.withDefaults()
+
+	k.consume(topic, topic, 0, handler, policy)
+	for retry := 1; retry <= policy.MaxRetries; retry++ {
+		k.consume(topic, RetryTopic(topic, retry), retry, handler, policy)
+	}
+	return nil
+
+}
+
+func (k *KafkaHelper) concurrency(topic string) int {
+	if n, ok := k.config.TopicConcurrency[topic]; ok && n > 0 {
+		return n
+	}
+	return k.config.Concurrency
+}
+
+// consume reads the topic of a single step (the source topic is step 0) in the retry chain of the source topic and hands the messages to its workers
+func (k *KafkaHelper) consume(sourceTopic, topic string, retry int, handler func(ctx context.Context, msg []byte) error, policy RetryPolicy) {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     k.brokers,
 		Topic:       topic,
-		GroupID:     k.groupID,
+		GroupID:     k.config.GroupID,
 		StartOffset: kafka.FirstOffset,
 	})
 
@@ -47,51 +102,207 @@ func (k *KafkaHelper) Subscribe(topic string, handler func(msg []byte) error) er
 	k.readers[topic] = reader
 	k.mu.Unlock()
 
-	var errs []error
-	go func(errs []error) {
-		defer reader.Close()
+	offsets := newOffsetTracker(reader, k.config.GroupID != "")
+	queues := make([]chan *trackedMessage, k.concurrency(sourceTopic))
+	for i := range queues {
+		queues[i] = make(chan *trackedMessage, 16)
+		k.workers.Add(1)
+		go func(queue chan *trackedMessage) {
+			defer k.workers.Done()
+			for tracked := range queue {
+				if !k.process(sourceTopic, topic, retry, tracked.msg, handler, policy) {
+					// left uncommitted so it is redelivered once the service is back, and so is everything after it in the partition
+					offsets.abandon(tracked)
+					continue
+				}
+				if err := offsets.complete(k.ctx, tracked); err != nil {
+					log.Printf("error committing offset of %s topic: %v", topic, err)
+				}
+			}
+		}(queues[i])
+	}
+
+	go func() {
+		defer func() {
+			for _, queue := range queues {
+				close(queue)
+			}
+		}()
 		for {
+			msg, err := reader.FetchMessage(k.fetchCtx)
+			if err != nil {
+				if k.fetchCtx.Err() != nil {
+					log.Printf("shutting down the consumer/reader for %s topic", topic)
+					return
+				}
+				log.Printf("error reading message: %v", err)
+				continue
+			}
+			log.Printf("message received: %s", string(msg.Value))
+
+			// messages of the same key (or partition when there is no key) go to the same worker to keep their order
+			queue := queues[workerIndex(msg, len(queues))]
 			select {
-			case <-k.ctx.Done():
+			case queue <- offsets.track(msg):
+			case <-k.fetchCtx.Done():
 				log.Printf("shutting down the consumer/reader for %s topic", topic)
 				return
-			default:
-				msg, err := reader.ReadMessage(context.Background())
-				if err != nil {
-					log.Printf("error reading message: %v", err)
-					errs = append(errs, err)
-					continue
-				}
-				log.Printf("message received: %s", string(msg.Value))
-				err = handler(msg.Value)
-				if err != nil {
-					errs = append(errs, err)
-					log.Printf("client unable to process message: %v", err)
-				}
 			}
 		}
 
-	}(errs)
-	if len(errs) > 0 {
-		return errors.Join(errs...)
+	}()
+
+}
+
+// process hands the message to the handler and moves it along the retry chain if it fails, it returns false if the message was neither handled nor forwarded
+func (k *KafkaHelper) process(sourceTopic, topic string, retry int, msg kafka.Message, handler func(ctx context.Context, msg []byte) error, policy RetryPolicy) bool {
+	if retry > 0 && !k.waitForRetry(msg) {
+		return false
+	}
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
 	}
+	ctx, span := startConsumerSpan("kafka", topic, headers,
+		semconv.MessagingKafkaConsumerGroup(k.config.GroupID),
+		semconv.MessagingKafkaDestinationPartition(msg.Partition),
+		semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		semconv.MessagingKafkaMessageKey(string(msg.Key)),
+	)
+	err := handler(ctx, msg.Value)
+	endSpan(span, err)
+	if err == nil {
+		return true
+	}
+	log.Printf("client unable to process message from %s topic (attempt %d): %v", topic, retry+1, err)
+	if ferr := k.forwardFailure(sourceTopic, retry, msg, err, policy); ferr != nil {
+		log.Printf("error moving failed message from %s topic: %v", topic, ferr)
+		return false
+	}
+	return true
+}
 
-	return nil
+func workerIndex(msg kafka.Message, workers int) int {
+	if workers == 1 {
+		return 0
+	}
+	if len(msg.Key) == 0 {
+		return msg.Partition % workers
+	}
+	h := fnv.New32a()
+	h.Write(msg.Key)
+	return int(h.Sum32() % uint32(workers))
+}
 
+// waitForRetry blocks until the message is due, it returns false if the helper is closed while waiting
+func (k *KafkaHelper) waitForRetry(msg kafka.Message) bool {
+	retryAt, err := time.Parse(time.RFC3339Nano, headerValue(msg.Headers, HeaderRetryAt))
+	if err != nil {
+		return true
+	}
+	wait := time.Until(retryAt)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-k.fetchCtx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
+
+// forwardFailure moves a message that failed at the given step of the retry chain to the next step, which is the dead letter topic after the last retry
+func (k *KafkaHelper) forwardFailure(sourceTopic string, retry int, msg kafka.Message, cause error, policy RetryPolicy) error {
+	headers := failureHeaders(sourceTopic, msg, retry+1, cause)
+
+	next := DeadLetterTopic(sourceTopic)
+	if retry < policy.MaxRetries {
+		next = RetryTopic(sourceTopic, retry+1)
+		headers = setHeader(headers, HeaderRetryAt, time.Now().Add(policy.Backoff(retry+1)).UTC().Format(time.RFC3339Nano))
+	}
+
+	// the message is not committed until it is forwarded, so keep trying (in order) until the helper is closed
+	for {
+		err := k.writerFor(next).WriteMessages(k.ctx, kafka.Message{
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: headers,
+		})
+		if err == nil {
+			return nil
+		}
+		log.Printf("error writing failed message to %s topic: %v", next, err)
+		select {
+		case <-k.fetchCtx.Done():
+			return err
+		case <-time.After(policy.InitialBackoff):
+		}
+	}
+}
+
 func (k *KafkaHelper) Publish(topic string, messsage []byte) error {
-	err := k.writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Value: messsage,
-		},
-	)
+	return k.PublishMessage(context.Background(), topic, "", nil, messsage)
+}
+
+// PublishMessage writes to the partition of the key, so messages of the same key are consumed in order
+func (k *KafkaHelper) PublishMessage(ctx context.Context, topic string, key string, headers map[string]string, message []byte) error {
+	if topic == "" {
+		topic = k.topic
+	}
+	ctx, span, headers := startPublishSpan(ctx, "kafka", topic, headers, semconv.MessagingKafkaMessageKey(key))
+	msg := kafka.Message{
+		Value: message,
+	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	for name, value := range headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: name, Value: []byte(value)})
+	}
+
+	err := k.writerFor(topic).WriteMessages(ctx, msg)
 	if err != nil {
-		log.Printf("failed to write message: %v", err)
+		log.Printf("failed to write message to %s topic: %v", topic, err)
 	}
+	endSpan(span, err)
 	return err
 }
 
+func (k *KafkaHelper) writerFor(topic string) *kafka.Writer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	writer, ok := k.writers[topic]
+	if !ok {
+		writer = &kafka.Writer{
+			Addr:                   kafka.TCP(k.brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			AllowAutoTopicCreation: true,
+			BatchTimeout:           DefaultWriterBatchTimeout,
+		}
+		k.writers[topic] = writer
+	}
+	return writer
+}
+
+// Close stops fetching, waits (up to the drain timeout) for the messages already fetched to be handled and committed, then closes the readers and writers
 func (k *KafkaHelper) Close() error {
+	k.stopFetching()
+
+	drained := make(chan struct{})
+	go func() {
+		k.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(k.config.DrainTimeout):
+		log.Printf("timed out after %s waiting for in-flight messages to be handled", k.config.DrainTimeout)
+	}
+
 	k.cancel() //Broadcast shutdown to all goroutines
 	var errs []error
 
@@ -102,10 +313,72 @@ func (k *KafkaHelper) Close() error {
 			errs = append(errs, err)
 		}
 	}
+	for topic, writer := range k.writers {
+		if err := writer.Close(); err != nil {
+			log.Printf("error closing writer for topic - %s: %v", topic, err)
+			errs = append(errs, err)
+		}
+	}
 	k.mu.Unlock()
 
-	err := k.writer.Close()
-	errs = append(errs, err)
-
 	return errors.Join(errs...)
 }
+
+type trackedMessage struct {
+	msg  kafka.Message
+	done bool
+}
+
+// offsetTracker commits the offset of a partition only once every message fetched before it has been handled, so concurrent workers never commit past a message that is still in flight
+type offsetTracker struct {
+	mu      sync.Mutex
+	reader  *kafka.Reader
+	commit  bool
+	pending map[int][]*trackedMessage // per partition, in the order fetched
+	halted  map[int]bool              // partitions with an abandoned message, nothing past it is committed
+}
+
+func newOffsetTracker(reader *kafka.Reader, commit bool) *offsetTracker {
+	return &offsetTracker{reader: reader, commit: commit, pending: make(map[int][]*trackedMessage), halted: make(map[int]bool)}
+}
+
+func (t *offsetTracker) track(msg kafka.Message) *trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked := &trackedMessage{msg: msg}
+	if !t.halted[msg.Partition] {
+		t.pending[msg.Partition] = append(t.pending[msg.Partition], tracked)
+	}
+	return tracked
+}
+
+func (t *offsetTracker) complete(ctx context.Context, tracked *trackedMessage) error {
+	// the lock is held while committing so commits of a partition never go backwards
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked.done = true
+
+	partition := tracked.msg.Partition
+	if t.halted[partition] {
+		return nil
+	}
+	pending := t.pending[partition]
+	var last *trackedMessage
+	for len(pending) > 0 && pending[0].done {
+		last = pending[0]
+		pending = pending[1:]
+	}
+	t.pending[partition] = pending
+	if last == nil || !t.commit {
+		return nil
+	}
+	return t.reader.CommitMessages(ctx, last.msg)
+}
+
+// abandon stops committing the partition of a message that was neither handled nor forwarded, the messages after it are redelivered along with it
+func (t *offsetTracker) abandon(tracked *trackedMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.halted[tracked.msg.Partition] = true
+	delete(t.pending, tracked.msg.Partition)
+}
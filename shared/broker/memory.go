@@ -0,0 +1,239 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrBrokerClosed = errors.New("broker is closed")
+
+type MemoryConfig struct {
+	MaxDeliveries   int           // times a message is handed to a handler before it is given up on, defaults to 3
+	RedeliveryDelay time.Duration // wait between deliveries of a message the handler failed on
+}
+
+// PublishedMessage is a message as it was published to the MemoryBroker
+type PublishedMessage struct {
+	Topic       string
+	Key         string
+	Headers     map[string]string
+	Value       []byte
+	PublishedAt time.Time
+}
+
+// FailedMessage is a message a consumer group gave up on after MaxDeliveries
+type FailedMessage struct {
+	PublishedMessage
+	Group    string
+	Attempts int
+	Err      error
+}
+
+// MemoryBroker is an in-process MessageBroker for tests and local runs. Every topic keeps a log of its messages which each consumer group reads from the start (like a kafka consumer group with no committed offset), the members of a group take turns handling the messages and a group handles its messages one at a time in the order they were published
+type MemoryBroker struct {
+	bus   *memoryBus
+	group string
+}
+
+func NewMemoryBroker(config MemoryConfig) *MemoryBroker {
+	if config.MaxDeliveries <= 0 {
+		config.MaxDeliveries = 3
+	}
+	bus := &memoryBus{
+		config: config,
+		logs:   make(map[string][]PublishedMessage),
+		groups: make(map[string]*memoryGroup),
+	}
+	bus.cond = sync.NewCond(&bus.mu)
+	return &MemoryBroker{bus: bus, group: "default"}
+}
+
+// Group returns a broker on the same topics whose subscriptions join the consumer group, each service under test would use its own group as it does with KafkaHelper. Closing any of them closes them all
+func (b *MemoryBroker) Group(groupID string) *MemoryBroker {
+	return &MemoryBroker{bus: b.bus, group: groupID}
+}
+
+func (b *MemoryBroker) Publish(topic string, messsage []byte) error {
+	return b.PublishMessage(context.Background(), topic, "", nil, messsage)
+}
+
+func (b *MemoryBroker) PublishMessage(ctx context.Context, topic string, key string, headers map[string]string, message []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, span, headers := startPublishSpan(ctx, "in_memory", topic, headers)
+	defer span.End()
+	msg := PublishedMessage{
+		Topic:       topic,
+		Key:         key,
+		Headers:     make(map[string]string, len(headers)),
+		Value:       append([]byte{}, message...),
+		PublishedAt: time.Now(),
+	}
+	for name, value := range headers {
+		msg.Headers[name] = value
+	}
+
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+	if b.bus.closed {
+		return ErrBrokerClosed
+	}
+	b.bus.logs[topic] = append(b.bus.logs[topic], msg)
+	b.bus.cond.Broadcast()
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, handler func(ctx context.Context, msg []byte) error) error {
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+	if b.bus.closed {
+		return ErrBrokerClosed
+	}
+
+	key := topic + "/" + b.group
+	group, ok := b.bus.groups[key]
+	if !ok {
+		group = &memoryGroup{topic: topic, id: b.group}
+		b.bus.groups[key] = group
+		b.bus.wg.Add(1)
+		go b.bus.dispatch(group)
+	}
+	group.handlers = append(group.handlers, handler)
+	return nil
+}
+
+// Published returns the messages published to the topic in the order they were published, an empty topic returns the messages of every topic
+func (b *MemoryBroker) Published(topic string) []PublishedMessage {
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+	if topic != "" {
+		return append([]PublishedMessage{}, b.bus.logs[topic]...)
+	}
+	var msgs []PublishedMessage
+	for _, topicMsgs := range b.bus.logs {
+		msgs = append(msgs, topicMsgs...)
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].PublishedAt.Before(msgs[j].PublishedAt) })
+	return msgs
+}
+
+// Failed returns the messages consumer groups gave up on
+func (b *MemoryBroker) Failed() []FailedMessage {
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+	return append([]FailedMessage{}, b.bus.failed...)
+}
+
+// WaitIdle blocks until every consumer group has handled every message published to its topic, a handler publishing in turn keeps the broker busy. It returns false if the timeout is reached first
+func (b *MemoryBroker) WaitIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if b.bus.idle() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// Close stops the consumer groups once the messages being handled are done, messages not yet handled are left undelivered
+func (b *MemoryBroker) Close() error {
+	b.bus.mu.Lock()
+	if b.bus.closed {
+		b.bus.mu.Unlock()
+		return nil
+	}
+	b.bus.closed = true
+	b.bus.cond.Broadcast()
+	b.bus.mu.Unlock()
+
+	b.bus.wg.Wait()
+	return nil
+}
+
+type memoryGroup struct {
+	topic    string
+	id       string
+	handlers []func(ctx context.Context, msg []byte) error
+	offset   int // position in the log of the topic of the next message to handle
+	next     int // member to hand the next message to
+	busy     bool
+}
+
+type memoryBus struct {
+	config MemoryConfig
+	mu     sync.Mutex
+	cond   *sync.Cond
+	logs   map[string][]PublishedMessage
+	groups map[string]*memoryGroup
+	failed []FailedMessage
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func (b *memoryBus) dispatch(group *memoryGroup) {
+	defer b.wg.Done()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		for !b.closed && group.offset >= len(b.logs[group.topic]) {
+			b.cond.Wait()
+		}
+		if b.closed {
+			return
+		}
+		msg := b.logs[group.topic][group.offset]
+		handler := group.handlers[group.next%len(group.handlers)]
+		group.next++
+		group.busy = true
+		b.mu.Unlock()
+
+		attempts, err := b.deliver(handler, msg)
+
+		b.mu.Lock()
+		if err != nil {
+			log.Printf("consumer group %s gave up on message from %s topic after %d attempt(s): %v", group.id, group.topic, attempts, err)
+			b.failed = append(b.failed, FailedMessage{PublishedMessage: msg, Group: group.id, Attempts: attempts, Err: err})
+		}
+		group.offset++
+		group.busy = false
+	}
+}
+
+// deliver hands the message to the handler until it succeeds, MaxDeliveries is reached or the broker is closed
+func (b *memoryBus) deliver(handler func(ctx context.Context, msg []byte) error, msg PublishedMessage) (int, error) {
+	var err error
+	attempts := 0
+	for attempts < b.config.MaxDeliveries {
+		attempts++
+		ctx, span := startConsumerSpan("in_memory", msg.Topic, msg.Headers)
+		err = handler(ctx, msg.Value)
+		endSpan(span, err)
+		if err == nil {
+			return attempts, nil
+		}
+		log.Printf("client unable to process message from %s topic (attempt %d): %v", msg.Topic, attempts, err)
+		if attempts < b.config.MaxDeliveries && b.config.RedeliveryDelay > 0 {
+			time.Sleep(b.config.RedeliveryDelay)
+		}
+	}
+	return attempts, err
+}
+
+func (b *memoryBus) idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, group := range b.groups {
+		if group.busy || group.offset < len(b.logs[group.topic]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTimeout = time.Second * 5
+
+func newTestBroker(t *testing.T, config MemoryConfig) *MemoryBroker {
+	t.Helper()
+	b := NewMemoryBroker(config)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// recorder collects the messages handed to a handler
+type recorder struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (r *recorder) handle(ctx context.Context, msg []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, string(msg))
+	return nil
+}
+
+func (r *recorder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.msgs...)
+}
+
+func waitIdle(t *testing.T, b *MemoryBroker) {
+	t.Helper()
+	if !b.WaitIdle(testTimeout) {
+		t.Fatalf("broker was not idle after %s", testTimeout)
+	}
+}
+
+func TestMemoryBrokerFansOutToEveryGroup(t *testing.T) {
+	b := newTestBroker(t, MemoryConfig{})
+	var orders, payments recorder
+	b.Group("order-service").Subscribe("payment", orders.handle)
+	b.Group("vendor-service").Subscribe("payment", payments.handle)
+
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := b.Publish("payment", []byte(msg)); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	waitIdle(t, b)
+
+	for name, r := range map[string]*recorder{"order-service": &orders, "vendor-service": &payments} {
+		got := r.received()
+		if len(got) != 3 || got[0] != "one" || got[1] != "two" || got[2] != "three" {
+			t.Errorf("%s received %v, want every message in order", name, got)
+		}
+	}
+}
+
+func TestMemoryBrokerGroupMembersTakeTurns(t *testing.T) {
+	b := newTestBroker(t, MemoryConfig{})
+	var first, second recorder
+	group := b.Group("payment-service")
+	group.Subscribe("order", first.handle)
+	group.Subscribe("order", second.handle)
+
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		b.Publish("order", []byte(msg))
+	}
+	waitIdle(t, b)
+
+	if got := len(first.received()) + len(second.received()); got != 4 {
+		t.Fatalf("group handled %d messages, want each of the 4 once", got)
+	}
+	if len(first.received()) != 2 || len(second.received()) != 2 {
+		t.Errorf("members handled %v and %v, want them to take turns", first.received(), second.received())
+	}
+}
+
+func TestMemoryBrokerLateGroupReadsFromTheStart(t *testing.T) {
+	b := newTestBroker(t, MemoryConfig{})
+	b.Publish("auth", []byte("user created"))
+
+	var late recorder
+	b.Group("subscription-service").Subscribe("auth", late.handle)
+	waitIdle(t, b)
+
+	if got := late.received(); len(got) != 1 || got[0] != "user created" {
+		t.Errorf("late group received %v, want the message published before it subscribed", got)
+	}
+}
+
+func TestMemoryBrokerRedeliversUntilHandled(t *testing.T) {
+	b := newTestBroker(t, MemoryConfig{MaxDeliveries: 3})
+	attempts := 0
+	b.Subscribe("payment", func(ctx context.Context, msg []byte) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("provider unavailable")
+		}
+		return nil
+	})
+
+	b.Publish("payment", []byte("initiate"))
+	waitIdle(t, b)
+
+	if attempts != 3 {
+		t.Errorf("handler called %d times, want 3", attempts)
+	}
+	if failed := b.Failed(); len(failed) != 0 {
+		t.Errorf("got failed messages %v, want none", failed)
+	}
+}
+
+func TestMemoryBrokerGivesUpAfterMaxDeliveries(t *testing.T) {
+	b := newTestBroker(t, MemoryConfig{MaxDeliveries: 2})
+	handlerErr := errors.New("poison message")
+	var next recorder
+	b.Subscribe("order", func(ctx context.Context, msg []byte) error {
+		if string(msg) == "poison" {
+			return handlerErr
+		}
+		return next.handle(ctx, msg)
+	})
+
+	b.Publish("order", []byte("poison"))
+	b.Publish("order", []byte("healthy"))
+	waitIdle(t, b)
+
+	failed := b.Failed()
+	if len(failed) != 1 {
+		t.Fatalf("got %d failed messages, want 1", len(failed))
+	}
+	if failed[0].Attempts != 2 || !errors.Is(failed[0].Err, handlerErr) || string(failed[0].Value) != "poison" {
+		t.Errorf("got failed message %+v, want the poison message after 2 attempts", failed[0])
+	}
+	if got := next.received(); len(got) != 1 || got[0] != "healthy" {
+		t.Errorf("received %v after the poison message, want the group to move on", got)
+	}
+}
+
+func TestMemoryBrokerKeepsPublishedMessages(t *testing.T) {
+	b := newTestBroker(t, MemoryConfig{})
+	b.PublishMessage(context.Background(), "order", "order-1", map[string]string{"event-type": "order.order_placed"}, []byte("placed"))
+	b.PublishMessage(context.Background(), "payment", "order-1", nil, []byte("paid"))
+
+	orders := b.Published("order")
+	if len(orders) != 1 || orders[0].Key != "order-1" || orders[0].Headers["event-type"] != "order.order_placed" {
+		t.Errorf("got %+v, want the order message with its key and headers", orders)
+	}
+	all := b.Published("")
+	if len(all) != 2 || string(all[0].Value) != "placed" || string(all[1].Value) != "paid" {
+		t.Errorf("got %+v, want every message in the order published", all)
+	}
+}
+
+func TestMemoryBrokerRejectsPublishAfterClose(t *testing.T) {
+	b := NewMemoryBroker(MemoryConfig{})
+	b.Close()
+
+	if err := b.Publish("order", []byte("late")); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("publish after close returned %v, want ErrBrokerClosed", err)
+	}
+	if err := b.Subscribe("order", (&recorder{}).handle); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("subscribe after close returned %v, want ErrBrokerClosed", err)
+	}
+}
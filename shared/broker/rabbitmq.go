@@ -1,65 +1,387 @@
 package broker
 
 import (
-	"github.com/streadway/amqp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// HeaderMessageKey carries the key of a message published to rabbitmq, there are no partitions so a queue keeps the order of all its messages regardless of key
+const HeaderMessageKey = "x-message-key"
+
+const (
+	DefaultRabbitMQExchange       = "shop-ease.events"
+	DefaultRabbitMQPrefetch       = 10
+	DefaultRabbitMQConfirmTimeout = time.Second * 5
+	DefaultRabbitMQReconnectDelay = time.Second * 2
 )
 
-// TODO: Revisit code
+type RabbitMQConfig struct {
+	Exchange       string        // topic exchange messages are published to, the topic is the routing key
+	GroupID        string        // consumers of the same group share a queue per topic (like a kafka consumer group), every group gets its own copy of a message
+	Prefetch       int           // unacknowledged messages a consumer holds at once
+	ConfirmTimeout time.Duration // how long a publish waits for the broker to confirm it
+	ReconnectDelay time.Duration // wait between attempts to reconnect after the connection is lost
+}
+
+type rabbitSubscription struct {
+	topic   string
+	handler func(ctx context.Context, msg []byte) error
+}
+
+type rabbitConsumer struct {
+	channel *amqp.Channel
+	tag     string
+}
+
+// RabbitMQHelper publishes to a topic exchange and consumes through a durable queue per group and topic. Messages are only acknowledged once the handler succeeds, a failed message is dead lettered to the <queue>.dlq queue
 type RabbitMQHelper struct {
-	conn                                     *amqp.Connection
-	channel                                  *amqp.Channel
-	RequeueMsgsWithErrorsWhileBeingProcessed bool //this feature is unique to the rabbitmq implementation consider adding to kafka implemention
+	url    string
+	config RabbitMQConfig
+
+	mu            sync.Mutex // guards everything below, the connection is replaced when it is lost and a channel when it is closed
+	conn          *amqp.Connection
+	channel       *amqp.Channel // publishing channel, in confirm mode
+	subscriptions []rabbitSubscription
+	consumers     []rabbitConsumer
+	closed        bool
+
+	handlers sync.WaitGroup
+
+	RequeueMsgsWithErrorsWhileBeingProcessed bool // requeue a failed message once before dead lettering it
 }
 
-func NewRabbitMQHelper(url string) (*RabbitMQHelper, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
+func NewRabbitMQHelper(url string, config RabbitMQConfig) (*RabbitMQHelper, error) {
+	if config.Exchange == "" {
+		config.Exchange = DefaultRabbitMQExchange
+	}
+	if config.Prefetch <= 0 {
+		config.Prefetch = DefaultRabbitMQPrefetch
+	}
+	if config.ConfirmTimeout <= 0 {
+		config.ConfirmTimeout = DefaultRabbitMQConfirmTimeout
+	}
+	if config.ReconnectDelay <= 0 {
+		config.ReconnectDelay = DefaultRabbitMQReconnectDelay
+	}
+
+	r := &RabbitMQHelper{url: url, config: config, RequeueMsgsWithErrorsWhileBeingProcessed: false}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.connect(); err != nil {
 		return nil, err
 	}
-	ch, err := conn.Channel()
+	return r, nil
+}
+
+func deadLetterExchange(exchange string) string {
+	return exchange + ".dlx"
+}
+
+func (r *RabbitMQHelper) queueName(topic string) string {
+	if r.config.GroupID == "" {
+		return topic
+	}
+	return r.config.GroupID + "." + topic
+}
+
+// connect dials the broker, declares the exchanges and restarts the consumers of every subscription, it is called with mu held
+func (r *RabbitMQHelper) connect() error {
+	conn, err := amqp.Dial(r.url)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	r.conn = conn
+	if err := r.openPublishChannel(); err != nil {
+		conn.Close()
+		return err
+	}
+	r.consumers = nil
+	for _, sub := range r.subscriptions {
+		if err := r.consume(sub); err != nil {
+			conn.Close()
+			return err
+		}
 	}
 
-	return &RabbitMQHelper{conn: conn, channel: ch, RequeueMsgsWithErrorsWhileBeingProcessed: false}, nil
+	go r.reconnectOnClose(conn.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
 }
 
-func (r *RabbitMQHelper) Publish(queue string, message []byte) error {
-	_, err := r.channel.QueueDeclare(queue, true, false, false, false, nil)
+// openPublishChannel opens the publishing channel on the current connection and declares the exchanges on it, it is called with mu held
+func (r *RabbitMQHelper) openPublishChannel() error {
+	ch, err := r.conn.Channel()
 	if err != nil {
 		return err
 	}
+	if err := ch.ExchangeDeclare(r.config.Exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		ch.Close()
+		return err
+	}
+	if err := ch.ExchangeDeclare(deadLetterExchange(r.config.Exchange), amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		ch.Close()
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return err
+	}
+	r.channel = ch
+	go r.reopenOnClose(ch, ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
+}
+
+func (r *RabbitMQHelper) reconnectOnClose(closed chan *amqp.Error) {
+	reason := <-closed
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	log.Printf("rabbitmq connection lost: %v, reconnecting", reason)
+	for !r.closed {
+		err := r.connect()
+		if err == nil {
+			log.Println("rabbitmq connection re-established")
+			return
+		}
+		log.Printf("error reconnecting to rabbitmq: %v", err)
+		r.mu.Unlock()
+		time.Sleep(r.config.ReconnectDelay)
+		r.mu.Lock()
+	}
+}
+
+// reopenOnClose replaces the publishing channel when the broker closes it on its own, e.g. after a publish it could not route or confirm. A channel closed along with its connection is left to reconnectOnClose
+func (r *RabbitMQHelper) reopenOnClose(ch *amqp.Channel, closed chan *amqp.Error) {
+	reason := <-closed
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for !r.closed && r.channel == ch && !r.conn.IsClosed() {
+		log.Printf("rabbitmq publishing channel closed: %v, reopening", reason)
+		err := r.openPublishChannel()
+		if err == nil {
+			return
+		}
+		log.Printf("error reopening rabbitmq publishing channel: %v", err)
+		r.mu.Unlock()
+		time.Sleep(r.config.ReconnectDelay)
+		r.mu.Lock()
+	}
+}
+
+func (r *RabbitMQHelper) Publish(queue string, message []byte) error {
+	return r.PublishMessage(context.Background(), queue, "", nil, message)
+}
+
+// PublishMessage routes the message to the queues bound to the topic and waits for the broker to confirm it
+func (r *RabbitMQHelper) PublishMessage(ctx context.Context, topic string, key string, headers map[string]string, message []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, span, headers := startPublishSpan(ctx, "rabbitmq", topic, headers, semconv.MessagingRabbitmqDestinationRoutingKey(topic))
+	err := r.publish(ctx, topic, key, headers, message)
+	endSpan(span, err)
+	return err
+}
+
+func (r *RabbitMQHelper) publish(ctx context.Context, topic string, key string, headers map[string]string, message []byte) error {
+	table := amqp.Table{}
+	for name, value := range headers {
+		table[name] = value
+	}
+	if key != "" {
+		table[HeaderMessageKey] = key
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrBrokerClosed
+	}
+	ch := r.channel
+	r.mu.Unlock()
 
-	return r.channel.Publish("", queue, false, false, amqp.Publishing{
-		ContentType: "application/json",
-		Body:        message,
+	// the confirmation is correlated to this publish by the library, so publishes do not wait on each other and a late confirmation is simply dropped
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, r.config.Exchange, topic, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		Headers:      table,
+		Body:         message,
 	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.ConfirmTimeout)
+	defer cancel()
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error waiting for the broker to confirm the message to %s: %w", topic, err)
+	}
+	if !acked {
+		// also the case when the channel is closed before the confirmation arrives
+		return fmt.Errorf("message to %s was not confirmed by the broker", topic)
+	}
+	return nil
 }
 
-func (r *RabbitMQHelper) Subscribe(queue string, handler func(msg []byte) error) error {
-	msgs, err := r.channel.Consume(queue, "", true, false, false, false, nil)
+func (r *RabbitMQHelper) Subscribe(topic string, handler func(ctx context.Context, msg []byte) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrBrokerClosed
+	}
+	sub := rabbitSubscription{topic: topic, handler: handler}
+	if err := r.consume(sub); err != nil {
+		return err
+	}
+	// kept so the consumer is restarted after a reconnect
+	r.subscriptions = append(r.subscriptions, sub)
+	return nil
+}
+
+// consume declares the queue of the subscription (and its dead letter queue) and starts consuming it on its own channel, it is called with mu held
+func (r *RabbitMQHelper) consume(sub rabbitSubscription) error {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Qos(r.config.Prefetch, 0, false); err != nil {
+		ch.Close()
+		return err
+	}
+
+	queue := r.queueName(sub.topic)
+	dlx := deadLetterExchange(r.config.Exchange)
+	if _, err := ch.QueueDeclare(queue+".dlq", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return err
+	}
+	if err := ch.QueueBind(queue+".dlq", queue, dlx, false, nil); err != nil {
+		ch.Close()
+		return err
+	}
+	_, err = ch.QueueDeclare(queue, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    dlx,
+		"x-dead-letter-routing-key": queue,
+	})
+	if err != nil {
+		ch.Close()
+		return err
+	}
+	if err := ch.QueueBind(queue, sub.topic, r.config.Exchange, false, nil); err != nil {
+		ch.Close()
+		return err
+	}
+
+	tag := fmt.Sprintf("%s-%d", queue, time.Now().UnixNano())
+	deliveries, err := ch.Consume(queue, tag, false, false, false, false, nil)
 	if err != nil {
+		ch.Close()
 		return err
 	}
+	r.consumers = append(r.consumers, rabbitConsumer{channel: ch, tag: tag})
 
+	r.handlers.Add(1)
 	go func() {
-		for d := range msgs {
-			err := handler(d.Body)
+		defer r.handlers.Done()
+		defer r.reconsume(sub, ch)
+		for d := range deliveries {
+			headers := make(map[string]string, len(d.Headers))
+			for name, value := range d.Headers {
+				if v, ok := value.(string); ok {
+					headers[name] = v
+				}
+			}
+			ctx, span := startConsumerSpan("rabbitmq", sub.topic, headers, semconv.MessagingRabbitmqDestinationRoutingKey(d.RoutingKey))
+			err := sub.handler(ctx, d.Body)
+			endSpan(span, err)
 			if err != nil {
-				d.Ack(true)
-
-			} else {
-				d.Nack(false, r.RequeueMsgsWithErrorsWhileBeingProcessed)
+				log.Printf("client unable to process message from %s queue: %v", queue, err)
+				// a rejected message that is not requeued goes to the dead letter queue
+				requeue := r.RequeueMsgsWithErrorsWhileBeingProcessed && !d.Redelivered
+				if err := d.Nack(false, requeue); err != nil {
+					log.Printf("error rejecting message from %s queue: %v", queue, err)
+				}
+				continue
+			}
+			if err := d.Ack(false); err != nil {
+				log.Printf("error acknowledging message from %s queue: %v", queue, err)
 			}
-
 		}
 	}()
 	return nil
 }
 
+// reconsume restarts the consumer of the subscription when the broker closed its channel on its own, e.g. after an acknowledgement failed.
+// Consumers that were cancelled by Close or whose connection was lost are left alone, the latter are restarted by reconnectOnClose
+func (r *RabbitMQHelper) reconsume(sub rabbitSubscription, ch *amqp.Channel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.removeConsumer(ch) {
+		return
+	}
+	// a reconnect in the meantime restarts every consumer itself
+	conn := r.conn
+	for !r.closed && r.conn == conn && !conn.IsClosed() {
+		log.Printf("rabbitmq channel of %s queue closed, restarting its consumer", r.queueName(sub.topic))
+		err := r.consume(sub)
+		if err == nil {
+			return
+		}
+		log.Printf("error restarting consumer of %s queue: %v", r.queueName(sub.topic), err)
+		r.mu.Unlock()
+		time.Sleep(r.config.ReconnectDelay)
+		r.mu.Lock()
+	}
+}
+
+// removeConsumer drops the consumer of the channel, it returns false if the channel is not one of the current consumers (as is the case after a reconnect). It is called with mu held
+func (r *RabbitMQHelper) removeConsumer(ch *amqp.Channel) bool {
+	for i, consumer := range r.consumers {
+		if consumer.channel == ch {
+			r.consumers = append(r.consumers[:i], r.consumers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Close cancels the consumers, waits for the messages being handled to be acknowledged and then closes the connection
 func (r *RabbitMQHelper) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	var errs []error
+	for _, consumer := range r.consumers {
+		if err := consumer.channel.Cancel(consumer.tag, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.mu.Unlock()
+
+	r.handlers.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err := r.channel.Close(); err != nil {
-		return err
+		errs = append(errs, err)
+	}
+	if err := r.conn.Close(); err != nil {
+		errs = append(errs, err)
 	}
-	return r.conn.Close()
+	return errors.Join(errs...)
 }
@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// headers added to a message as it moves through the retry topics and into the dead letter topic
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderAttempts          = "x-attempts"
+	HeaderError             = "x-error"
+	HeaderFailedAt          = "x-failed-at"
+	HeaderRetryAt           = "x-retry-at"
+)
+
+// RetryPolicy decides how often and after how long a failed message is handed to the handler again before it is dead lettered
+type RetryPolicy struct {
+	MaxRetries     int // a zero value sends failed messages straight to the dead letter topic
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: time.Second * 5,
+	MaxBackoff:     time.Minute * 5,
+	Multiplier:     2,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	return p
+}
+
+// Backoff is how long a message waits in the nth (starting at 1) retry topic
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		backoff *= p.Multiplier
+		if backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+func RetryTopic(topic string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, retry)
+}
+
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// failureHeaders records why and how many times the message failed, the original position is only taken from the message read off the source topic
+func failureHeaders(sourceTopic string, msg kafka.Message, attempts int, cause error) []kafka.Header {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	if headerValue(headers, HeaderOriginalTopic) == "" {
+		headers = setHeader(headers, HeaderOriginalTopic, sourceTopic)
+		headers = setHeader(headers, HeaderOriginalPartition, strconv.Itoa(msg.Partition))
+		headers = setHeader(headers, HeaderOriginalOffset, strconv.FormatInt(msg.Offset, 10))
+	}
+	headers = setHeader(headers, HeaderAttempts, strconv.Itoa(attempts))
+	headers = setHeader(headers, HeaderError, cause.Error())
+	headers = setHeader(headers, HeaderFailedAt, time.Now().UTC().Format(time.RFC3339Nano))
+	return headers
+}
+
+func setHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	for i := range headers {
+		if headers[i].Key == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+	return append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func headerValue(headers []kafka.Header, key string) string {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
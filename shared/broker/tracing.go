@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"context"
+
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/observability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/kaasikodes/shop-ease/shared/broker")
+
+// startPublishSpan starts the producer span of a message and returns the headers with its traceparent injected, so the consumer span continues the trace
+func startPublishSpan(ctx context.Context, system string, topic string, headers map[string]string, attrs ...attribute.KeyValue) (context.Context, trace.Span, map[string]string) {
+	attrs = append(attrs,
+		semconv.MessagingSystem(system),
+		semconv.MessagingOperationPublish,
+		semconv.MessagingDestinationName(topic),
+	)
+	if id := headers[events.HeaderEventID]; id != "" {
+		attrs = append(attrs, semconv.MessagingMessageID(id))
+	}
+	ctx, span := tracer.Start(ctx, topic+" publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+
+	carrier := propagation.MapCarrier{}
+	for name, value := range headers {
+		carrier[name] = value
+	}
+	observability.Propagator.Inject(ctx, carrier)
+	return ctx, span, carrier
+}
+
+// startConsumerSpan starts the span a message is handled in, as a child of the span it was published in when the headers carry one
+func startConsumerSpan(system string, topic string, headers map[string]string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := observability.Propagator.Extract(context.Background(), propagation.MapCarrier(headers))
+	attrs = append(attrs,
+		semconv.MessagingSystem(system),
+		semconv.MessagingOperationProcess,
+		semconv.MessagingDestinationName(topic),
+	)
+	if id := headers[events.HeaderEventID]; id != "" {
+		attrs = append(attrs, semconv.MessagingMessageID(id))
+	}
+	return tracer.Start(ctx, topic+" process", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect is the sql flavour of the service database, the services are split between mysql and postgres
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+)
+
+// Rebind converts the ? placeholders of a query to the placeholder style of the dialect
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
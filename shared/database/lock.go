@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// TryLock takes the named advisory lock of the database without waiting, so a job every replica of a service runs is run by one replica at a time.
+// The lock is held by a connection of its own until unlock is called or the connection drops, ok is false when the lock is held elsewhere
+func TryLock(ctx context.Context, db *sql.DB, dialect Dialect, name string) (unlock func(), ok bool, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	lockQuery, unlockQuery := `SELECT COALESCE(GET_LOCK(?, 0), 0) = 1`, `SELECT RELEASE_LOCK(?)`
+	if dialect == Postgres {
+		lockQuery, unlockQuery = `SELECT pg_try_advisory_lock(hashtext($1))`, `SELECT pg_advisory_unlock(hashtext($1))`
+	}
+	if err := conn.QueryRowContext(ctx, lockQuery, name).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("error taking lock %s: %w", name, err)
+		}
+		return nil, false, nil
+	}
+	return func() {
+		// released on a context of its own, the job may have stopped because its context was cancelled
+		if _, err := conn.ExecContext(context.Background(), unlockQuery, name); err != nil {
+			// the connection is discarded rather than returned to the pool, closing it releases the lock
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
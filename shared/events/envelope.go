@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// headers set on the broker message of an envelope, so the event can be identified (and traced) without decoding it
+const (
+	HeaderEventID     = "event-id"
+	HeaderEventType   = "event-type"
+	HeaderTraceparent = "traceparent"
+)
+
+// Envelope wraps every message sent through the broker so consumers can tell what they received and who sent it
+type Envelope struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	OccurredAt  time.Time       `json:"occurredAt"`
+	Producer    string          `json:"producer"`
+	Traceparent string          `json:"traceparent,omitempty"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// DecodeData unmarshals the data of the envelope into v
+func (e *Envelope) DecodeData(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("error unmarshaling data of %s event: %w", e.Type, err)
+	}
+	return nil
+}
+
+// Headers returns the broker headers of the envelope
+func (e *Envelope) Headers() map[string]string {
+	headers := map[string]string{
+		HeaderEventID:   e.ID,
+		HeaderEventType: e.Type,
+	}
+	if e.Traceparent != "" {
+		headers[HeaderTraceparent] = e.Traceparent
+	}
+	return headers
+}
+
+// NewEnvelope wraps data as the current version of eventType, the trace of ctx (if any) is carried along as the traceparent
+func NewEnvelope(ctx context.Context, producer string, eventType string, data any) (*Envelope, error) {
+	return DefaultRegistry.NewEnvelope(ctx, producer, eventType, data)
+}
+
+// Encode marshals the envelope into the bytes that are published to the broker
+func Encode(envelope *Envelope) ([]byte, error) {
+	return json.Marshal(envelope)
+}
+
+// Decode unmarshals a message from the broker and its data into the payload type registered for the event
+func Decode(msg []byte) (*Envelope, any, error) {
+	return DefaultRegistry.Decode(msg)
+}
+
+func traceparentFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+func newEnvelopeID() string {
+	return uuid.NewString()
+}
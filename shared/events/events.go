@@ -15,9 +15,13 @@ var (
 	// payment sends
 	VendorSubscriptionPaymnentMade = "payment.vendor_subcription_paid_for"
 	OrderPaymnentMade              = "payment.order_paid_for"
+	OrderPaymentFailed             = "payment.order_payment_failed"
+	OrderRefunded                  = "payment.order_refunded"
+	PayoutUpdated                  = "payment.payout_updated"
 	// vendor
 	VendorUpdatedInventory  = "vendor.updated_inventory"
 	VendorAcceptedOrderItem = "vendor.accepted_order_item"
+	VendorStoreAccountSaved = "vendor.store_account_saved"
 )
 
 const (
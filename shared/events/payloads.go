@@ -0,0 +1,164 @@
+package events
+
+import (
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
+
+// Payloads carried in the data of the envelope, one per event name. Changing a field in a way older consumers cannot read requires bumping the version of its schema in the registry.
+// Amounts are money in minor units with their currency
+
+// product
+type ProductCreatedPayload struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+type ProductUpdatedPayload struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+type ProductLowStockPayload struct {
+	ProductId int `json:"productId"`
+	StoreId   int `json:"storeId"`
+	Available int `json:"available"`
+	Threshold int `json:"threshold"`
+}
+
+// auth
+type UserCreatedPayload struct {
+	UserId int    `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+type UserUpdatedPayload struct {
+	UserId int    `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+type UserOrderedItemPayload struct {
+	UserId    int `json:"userId"`
+	VendorId  int `json:"vendorId"`
+	ProductId int `json:"productId"`
+}
+type UserInterestedInItemPayload struct {
+	UserId    int `json:"userId"`
+	VendorId  int `json:"vendorId"`
+	ProductId int `json:"productId"`
+}
+
+// subscription
+type VendorSubscriptionCreatedPayload struct {
+	SubscriptionId int         `json:"subscriptionId"`
+	PlanId         int         `json:"planId"`
+	VendorId       int         `json:"vendorId"`
+	UserId         int         `json:"userId"`
+	Amount         money.Money `json:"amount"`
+}
+
+// order
+type OrderCreatedItem struct {
+	OrderItemId    int         `json:"orderItemId"`
+	ProductId      int         `json:"productId"`
+	StoreId        int         `json:"storeId"`
+	Quantity       int         `json:"quantity"`
+	AmountToBePaid money.Money `json:"amountToBePaid"`
+}
+type OrderCreatedPayload struct {
+	OrderId int                `json:"orderId"`
+	UserId  int                `json:"userId"`
+	Amount  money.Money        `json:"amount"`
+	Items   []OrderCreatedItem `json:"items"`
+}
+
+// payment
+type VendorSubscriptionPaymentMadePayload struct {
+	TransactionId  int         `json:"transactionId"`
+	Reference      string      `json:"reference"`
+	Provider       string      `json:"provider"`
+	SubscriptionId int         `json:"subscriptionId"`
+	VendorId       int         `json:"vendorId"`
+	Amount         money.Money `json:"amount"`
+	PaidAt         *time.Time  `json:"paidAt"`
+}
+type OrderPaymentMadePayload struct {
+	TransactionId int         `json:"transactionId"`
+	Reference     string      `json:"reference"`
+	Provider      string      `json:"provider"`
+	OrderId       int         `json:"orderId"`
+	UserId        int         `json:"userId"`
+	Amount        money.Money `json:"amount"`
+	PaidAt        *time.Time  `json:"paidAt"`
+}
+
+// OrderPaymentFailedPayload is sent when the provider reports the payment of an order failed, the order is not paid by that transaction
+type OrderPaymentFailedPayload struct {
+	TransactionId int         `json:"transactionId"`
+	Reference     string      `json:"reference"`
+	Provider      string      `json:"provider"`
+	OrderId       int         `json:"orderId"`
+	UserId        int         `json:"userId"`
+	Amount        money.Money `json:"amount"`
+	Reason        string      `json:"reason"` // as given by the provider
+}
+
+// OrderRefundedItem is an order item refunded in part or in full, a refund of the whole order has no items
+type OrderRefundedItem struct {
+	OrderItemId int         `json:"orderItemId"`
+	Amount      money.Money `json:"amount"`
+}
+type OrderRefundedPayload struct {
+	RefundId      int                 `json:"refundId"`
+	TransactionId int                 `json:"transactionId"`
+	Reference     string              `json:"reference"`
+	Provider      string              `json:"provider"`
+	OrderId       int                 `json:"orderId"`
+	UserId        int                 `json:"userId"`
+	Amount        money.Money         `json:"amount"`
+	FullRefund    bool                `json:"fullRefund"` // the whole amount paid for the order has been refunded
+	Items         []OrderRefundedItem `json:"items"`
+	RefundedAt    *time.Time          `json:"refundedAt"`
+}
+
+// PayoutUpdatedPayload is sent when a payout to the account of a store is created and every time its status changes
+type PayoutUpdatedPayload struct {
+	PayoutId      int         `json:"payoutId"`
+	BatchId       int         `json:"batchId"`
+	StoreId       int         `json:"storeId"`
+	Reference     string      `json:"reference"`
+	Provider      string      `json:"provider"`
+	Amount        money.Money `json:"amount"`
+	Status        string      `json:"status"`
+	FailureReason string      `json:"failureReason"`
+	Bank          string      `json:"bank"`
+	AccountNumber string      `json:"accountNumber"`
+	PaidAt        *time.Time  `json:"paidAt"`
+	UpdatedAt     time.Time   `json:"updatedAt"`
+}
+
+// vendor
+type VendorUpdatedInventoryPayload struct {
+	InventoryId int               `json:"inventoryId"`
+	VendorId    int               `json:"vendorId"`
+	StoreId     int               `json:"storeId"`
+	ProductId   int               `json:"productId"`
+	Quantity    int               `json:"quantity"`
+	MetaData    map[string]string `json:"metaData"`
+}
+type VendorAcceptedOrderItemPayload struct {
+	OrderItemId int `json:"orderItemId"`
+	OrderId     int `json:"orderId"`
+	StoreId     int `json:"storeId"`
+}
+
+// VendorStoreAccountSavedPayload carries the account the earnings of a store are paid out to, sent when the store is created or updated
+type VendorStoreAccountSavedPayload struct {
+	StoreId   int    `json:"storeId"`
+	VendorId  int    `json:"vendorId"`
+	Name      string `json:"name"` // of the store
+	Bank      string `json:"bank"`
+	Number    string `json:"number"`
+	SwiftCode string `json:"swiftCode"`
+}
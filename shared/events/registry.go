@@ -0,0 +1,156 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownEvent        = errors.New("unknown event type")
+	ErrIncompatibleVersion = errors.New("incompatible event version")
+	ErrInvalidEnvelope     = errors.New("invalid event envelope")
+)
+
+// Schema describes the payload of an event type. Producers always emit Version, consumers accept anything from MinVersion up to Version
+type Schema struct {
+	Type       string
+	Version    int
+	MinVersion int
+	New        func() any // returns a pointer to an empty payload
+}
+
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]Schema)}
+}
+
+func (r *Registry) Register(schema Schema) error {
+	if schema.Type == "" || schema.New == nil {
+		return fmt.Errorf("schema must have a type and a payload constructor")
+	}
+	if schema.Version < 1 {
+		return fmt.Errorf("schema version of %s must be at least 1", schema.Type)
+	}
+	if schema.MinVersion == 0 {
+		schema.MinVersion = schema.Version
+	}
+	if schema.MinVersion > schema.Version {
+		return fmt.Errorf("min version of %s cannot be greater than its version", schema.Type)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.schemas[schema.Type]; exists {
+		return fmt.Errorf("schema for %s is already registered", schema.Type)
+	}
+	r.schemas[schema.Type] = schema
+	return nil
+}
+
+func (r *Registry) Lookup(eventType string) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, ok := r.schemas[eventType]
+	if !ok {
+		return Schema{}, fmt.Errorf("%w: %s", ErrUnknownEvent, eventType)
+	}
+	return schema, nil
+}
+
+// Validate checks that the envelope is well formed and of a type and version this registry can decode
+func (r *Registry) Validate(envelope *Envelope) (Schema, error) {
+	if envelope.ID == "" || envelope.Type == "" {
+		return Schema{}, fmt.Errorf("%w: missing id or type", ErrInvalidEnvelope)
+	}
+	schema, err := r.Lookup(envelope.Type)
+	if err != nil {
+		return Schema{}, err
+	}
+	if envelope.Version < schema.MinVersion || envelope.Version > schema.Version {
+		return Schema{}, fmt.Errorf("%w: %s v%d (supported v%d-v%d)", ErrIncompatibleVersion, envelope.Type, envelope.Version, schema.MinVersion, schema.Version)
+	}
+	return schema, nil
+}
+
+func (r *Registry) NewEnvelope(ctx context.Context, producer string, eventType string, data any) (*Envelope, error) {
+	schema, err := r.Lookup(eventType)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("payload of %s cannot be nil", eventType)
+	}
+	// catch a producer sending the payload of another event before it reaches the consumers
+	if expected := reflect.TypeOf(schema.New()); reflect.TypeOf(data) != expected && reflect.PointerTo(reflect.TypeOf(data)) != expected {
+		return nil, fmt.Errorf("payload %T does not match the schema of %s", data, eventType)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling data of %s event: %w", eventType, err)
+	}
+
+	return &Envelope{
+		ID:          newEnvelopeID(),
+		Type:        eventType,
+		Version:     schema.Version,
+		OccurredAt:  time.Now().UTC(),
+		Producer:    producer,
+		Traceparent: traceparentFromContext(ctx),
+		Data:        raw,
+	}, nil
+}
+
+func (r *Registry) Decode(msg []byte) (*Envelope, any, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	schema, err := r.Validate(&envelope)
+	if err != nil {
+		return &envelope, nil, err
+	}
+	payload := schema.New()
+	if err := envelope.DecodeData(payload); err != nil {
+		return &envelope, nil, err
+	}
+	return &envelope, payload, nil
+}
+
+// DefaultRegistry knows the payload of every event in this package
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	schemas := []Schema{
+		{Type: ProductCreatedEvent, Version: 1, New: func() any { return &ProductCreatedPayload{} }},
+		{Type: ProductUpdatedEvent, Version: 1, New: func() any { return &ProductUpdatedPayload{} }},
+		{Type: ProductLowStockEvent, Version: 1, New: func() any { return &ProductLowStockPayload{} }},
+		{Type: UserCreatedEvent, Version: 1, New: func() any { return &UserCreatedPayload{} }},
+		{Type: UserUpdatedEvent, Version: 1, New: func() any { return &UserUpdatedPayload{} }},
+		{Type: UserOrderedItemEvent, Version: 1, New: func() any { return &UserOrderedItemPayload{} }},
+		{Type: UserInterestedInItemEvent, Version: 1, New: func() any { return &UserInterestedInItemPayload{} }},
+		{Type: VendorSubscriptionCreated, Version: 2, New: func() any { return &VendorSubscriptionCreatedPayload{} }},
+		{Type: OrderCreated, Version: 2, New: func() any { return &OrderCreatedPayload{} }},
+		{Type: VendorSubscriptionPaymnentMade, Version: 2, New: func() any { return &VendorSubscriptionPaymentMadePayload{} }},
+		{Type: OrderPaymnentMade, Version: 2, New: func() any { return &OrderPaymentMadePayload{} }},
+		{Type: OrderPaymentFailed, Version: 1, New: func() any { return &OrderPaymentFailedPayload{} }},
+		{Type: OrderRefunded, Version: 2, New: func() any { return &OrderRefundedPayload{} }},
+		{Type: PayoutUpdated, Version: 2, New: func() any { return &PayoutUpdatedPayload{} }},
+		{Type: VendorUpdatedInventory, Version: 1, New: func() any { return &VendorUpdatedInventoryPayload{} }},
+		{Type: VendorAcceptedOrderItem, Version: 1, New: func() any { return &VendorAcceptedOrderItemPayload{} }},
+		{Type: VendorStoreAccountSaved, Version: 1, New: func() any { return &VendorStoreAccountSavedPayload{} }},
+	}
+	for _, schema := range schemas {
+		if err := DefaultRegistry.Register(schema); err != nil {
+			panic(err)
+		}
+	}
+}
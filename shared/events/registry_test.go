@@ -0,0 +1,126 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type widgetPayload struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	registry := NewRegistry()
+	if err := registry.Register(Schema{Type: "widget.created", Version: 3, MinVersion: 2, New: func() any { return &widgetPayload{} }}); err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	registry := newTestRegistry(t)
+	envelope, err := registry.NewEnvelope(context.Background(), "widget-service", "widget.created", widgetPayload{ID: 7, Name: "bolt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Encode(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, payload, err := registry.Decode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID != envelope.ID || decoded.Type != "widget.created" || decoded.Version != 3 || decoded.Producer != "widget-service" {
+		t.Errorf("decoded envelope %+v, want %+v", decoded, envelope)
+	}
+	widget, ok := payload.(*widgetPayload)
+	if !ok {
+		t.Fatalf("payload is %T, want *widgetPayload", payload)
+	}
+	if *widget != (widgetPayload{ID: 7, Name: "bolt"}) {
+		t.Errorf("decoded payload %+v, want the widget that was sent", *widget)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	registry := newTestRegistry(t)
+	envelope := func(eventType string, version int) []byte {
+		msg, err := json.Marshal(Envelope{ID: "1", Type: eventType, Version: version, Data: json.RawMessage(`{"id":7}`)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	for name, tc := range map[string]struct {
+		msg     []byte
+		wantErr error
+	}{
+		"unknown type":            {msg: envelope("widget.deleted", 3), wantErr: ErrUnknownEvent},
+		"version below the min":   {msg: envelope("widget.created", 1), wantErr: ErrIncompatibleVersion},
+		"version above the limit": {msg: envelope("widget.created", 4), wantErr: ErrIncompatibleVersion},
+		"missing id":              {msg: []byte(`{"type":"widget.created","version":3}`), wantErr: ErrInvalidEnvelope},
+		"not json":                {msg: []byte(`widget`), wantErr: ErrInvalidEnvelope},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, payload, err := registry.Decode(tc.msg); !errors.Is(err, tc.wantErr) || payload != nil {
+				t.Errorf("decode returned %v and %v, want %v", payload, err, tc.wantErr)
+			}
+		})
+	}
+
+	// the versions from the min up to the current one are accepted
+	for _, version := range []int{2, 3} {
+		if _, _, err := registry.Decode(envelope("widget.created", version)); err != nil {
+			t.Errorf("version %d was rejected: %v", version, err)
+		}
+	}
+}
+
+func TestNewEnvelopeRejectsThePayloadOfAnotherEvent(t *testing.T) {
+	registry := newTestRegistry(t)
+	if _, err := registry.NewEnvelope(context.Background(), "widget-service", "widget.created", &ProductCreatedPayload{}); err == nil {
+		t.Error("payload of another event was accepted")
+	}
+	if _, err := registry.NewEnvelope(context.Background(), "widget-service", "widget.deleted", &widgetPayload{}); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("unknown event returned %v, want ErrUnknownEvent", err)
+	}
+}
+
+func TestRegisterRejectsInvalidSchemas(t *testing.T) {
+	registry := newTestRegistry(t)
+	newWidget := func() any { return &widgetPayload{} }
+	for name, schema := range map[string]Schema{
+		"already registered":     {Type: "widget.created", Version: 1, New: newWidget},
+		"no version":             {Type: "widget.updated", New: newWidget},
+		"min above the version":  {Type: "widget.updated", Version: 1, MinVersion: 2, New: newWidget},
+		"no payload constructor": {Type: "widget.updated", Version: 1},
+	} {
+		if err := registry.Register(schema); err == nil {
+			t.Errorf("%s schema was registered", name)
+		}
+	}
+}
+
+func TestDefaultRegistryDecodesItsEvents(t *testing.T) {
+	envelope, err := NewEnvelope(context.Background(), "vendor-service", ProductLowStockEvent, ProductLowStockPayload{ProductId: 1, StoreId: 2, Available: 3, Threshold: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Encode(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := Decode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lowStock, ok := payload.(*ProductLowStockPayload); !ok || lowStock.Available != 3 {
+		t.Errorf("decoded %+v, want the low stock payload that was sent", payload)
+	}
+}
@@ -0,0 +1,147 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	DefaultLease     = time.Minute * 5
+	DefaultRetention = time.Hour * 24 * 7
+	// completeAttempts is how many times marking a handled event as processed is tried, failing that the event is left to its lease and the check of its consumer
+	completeAttempts = 3
+)
+
+// ClaimResult is what a delivery found when it claimed an event
+type ClaimResult int
+
+const (
+	Held      ClaimResult = iota // the event was already processed, or another delivery of it is being processed and its lease has not expired
+	Claimed                      // the event was not seen before
+	TakenOver                    // a delivery claimed the event but did not complete it within its lease, its handler may or may not have taken effect
+)
+
+// Check reports whether the effect of the handler of the event already took place, it is asked before an event whose lease expired is handled again
+type Check func(ctx context.Context, msg []byte) (done bool, err error)
+
+// Store keeps track of the events a consumer has processed, keyed by the id of the event
+type Store interface {
+	// Claim marks the event as being processed by the consumer
+	Claim(ctx context.Context, consumer string, eventId string, lease time.Duration) (ClaimResult, error)
+	// Complete marks a claimed event as processed
+	Complete(ctx context.Context, consumer string, eventId string) error
+	// Release drops the claim of an event that failed, so a redelivery can process it
+	Release(ctx context.Context, consumer string, eventId string) error
+	// Purge deletes processed events older than the time, a redelivery after that is processed again
+	Purge(ctx context.Context, olderThan time.Time) error
+}
+
+type Config struct {
+	Lease     time.Duration // how long a delivery holds an event before another delivery may take it over, should be longer than the slowest handler
+	Retention time.Duration // how long processed events are remembered
+}
+
+// Guard makes event handlers idempotent, a message whose event was already processed by the consumer is acknowledged without calling the handler
+type Guard struct {
+	store  Store
+	config Config
+}
+
+func NewGuard(store Store, config Config) *Guard {
+	if config.Lease <= 0 {
+		config.Lease = DefaultLease
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+	return &Guard{store: store, config: config}
+}
+
+// Wrap returns the handler guarded by the id of the event envelope, consumer names the handler so several handlers can process the same event once each.
+// An event whose lease expired before it was completed is handled again, so Wrap is for handlers whose effect is safe to repeat, WrapChecked is for the others
+func (g *Guard) Wrap(consumer string, handler func(ctx context.Context, msg []byte) error) func(ctx context.Context, msg []byte) error {
+	return g.WrapChecked(consumer, handler, nil)
+}
+
+// WrapChecked is Wrap for handlers that must not take effect twice, an event whose lease expired is only handled again when check reports its effect did not take place
+func (g *Guard) WrapChecked(consumer string, handler func(ctx context.Context, msg []byte) error, check Check) func(ctx context.Context, msg []byte) error {
+	return func(ctx context.Context, msg []byte) error {
+		var event struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(msg, &event); err != nil || event.ID == "" {
+			// nothing to key the message by, leave it to the handler to reject it
+			return handler(ctx, msg)
+		}
+
+		claim, err := g.store.Claim(ctx, consumer, event.ID, g.config.Lease)
+		if err != nil {
+			return err
+		}
+		switch claim {
+		case Held:
+			log.Printf("skipping event %s already processed by %s", event.ID, consumer)
+			return nil
+		case TakenOver:
+			if check == nil {
+				log.Printf("handling event %s again for %s, its lease expired before it was completed", event.ID, consumer)
+				break
+			}
+			done, err := check(ctx, msg)
+			if err != nil {
+				// the claim is kept until its lease expires again so the outcome is checked before the event is handled
+				return err
+			}
+			if done {
+				log.Printf("event %s was handled by %s before its lease expired, completing it", event.ID, consumer)
+				return g.complete(ctx, consumer, event.ID)
+			}
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			if rerr := g.store.Release(ctx, consumer, event.ID); rerr != nil {
+				log.Printf("error releasing event %s for %s: %v", event.ID, consumer, rerr)
+			}
+			return err
+		}
+		return g.complete(ctx, consumer, event.ID)
+	}
+}
+
+// complete marks the handled event as processed, retrying as the handler has taken effect and the event would otherwise be taken over once its lease expires
+func (g *Guard) complete(ctx context.Context, consumer string, eventId string) error {
+	var err error
+	for attempt := 1; attempt <= completeAttempts; attempt++ {
+		if err = g.store.Complete(ctx, consumer, eventId); err == nil {
+			return nil
+		}
+		log.Printf("error completing event %s for %s (attempt %d): %v", eventId, consumer, attempt, err)
+		if attempt == completeAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+// Run purges the processed events outside the retention window every interval until the context is canceled, it is meant to be run in its own goroutine
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.store.Purge(ctx, time.Now().Add(-g.config.Retention)); err != nil {
+				log.Printf("error purging processed events: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps the processed events as keys that expire after the retention window, so Purge has nothing to do.
+// The lease of an event being processed is a key of its own, so a delivery that takes over an expired lease can tell it from a new event
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+	retention time.Duration
+}
+
+func NewRedisStore(client *redis.Client, keyPrefix string, retention time.Duration) *RedisStore {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &RedisStore{client: client, keyPrefix: keyPrefix, retention: retention}
+}
+
+func (r *RedisStore) key(consumer string, eventId string) string {
+	return r.keyPrefix + ":" + consumer + ":" + eventId
+}
+
+func (r *RedisStore) leaseKey(consumer string, eventId string) string {
+	return r.key(consumer, eventId) + ":lease"
+}
+
+func (r *RedisStore) Claim(ctx context.Context, consumer string, eventId string, lease time.Duration) (ClaimResult, error) {
+	// the lease is the expiry of the lease key, once it lapses another delivery can set it
+	claimed, err := r.client.SetNX(ctx, r.leaseKey(consumer, eventId), 1, lease).Result()
+	if err != nil || !claimed {
+		return Held, err
+	}
+	created, err := r.client.SetNX(ctx, r.key(consumer, eventId), statusProcessing, r.retention).Result()
+	if err != nil {
+		return Held, err
+	}
+	if created {
+		return Claimed, nil
+	}
+	status, err := r.client.Get(ctx, r.key(consumer, eventId)).Result()
+	if err != nil {
+		return Held, err
+	}
+	if status == statusProcessed {
+		return Held, nil
+	}
+	return TakenOver, nil
+}
+
+func (r *RedisStore) Complete(ctx context.Context, consumer string, eventId string) error {
+	if err := r.client.Set(ctx, r.key(consumer, eventId), statusProcessed, r.retention).Err(); err != nil {
+		return err
+	}
+	return r.client.Del(ctx, r.leaseKey(consumer, eventId)).Err()
+}
+
+func (r *RedisStore) Release(ctx context.Context, consumer string, eventId string) error {
+	return r.client.Del(ctx, r.key(consumer, eventId), r.leaseKey(consumer, eventId)).Err()
+}
+
+func (r *RedisStore) Purge(ctx context.Context, olderThan time.Time) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/database"
+)
+
+var (
+	statusProcessing = "processing"
+	statusProcessed  = "processed"
+)
+
+// SqlStore keeps the processed events in the processed_events table of the service database
+type SqlStore struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+func NewSqlStore(db *sql.DB, dialect database.Dialect) *SqlStore {
+	return &SqlStore{db: db, dialect: dialect}
+}
+
+func (s *SqlStore) Claim(ctx context.Context, consumer string, eventId string, lease time.Duration) (ClaimResult, error) {
+	now := time.Now().UTC()
+	query := `INSERT IGNORE INTO processed_events (consumer, event_id, status, claimed_at) VALUES (?, ?, ?, ?)`
+	if s.dialect == database.Postgres {
+		query = `INSERT INTO processed_events (consumer, event_id, status, claimed_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	}
+	result, err := s.db.ExecContext(ctx, s.dialect.Rebind(query), consumer, eventId, statusProcessing, now)
+	if err != nil {
+		return Held, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Held, err
+	}
+	if n == 1 {
+		return Claimed, nil
+	}
+
+	// take over the claim of a delivery that did not finish within its lease
+	result, err = s.db.ExecContext(ctx, s.dialect.Rebind(`
+		UPDATE processed_events SET claimed_at = ?
+		WHERE consumer = ? AND event_id = ? AND status = ? AND claimed_at < ?
+	`), now, consumer, eventId, statusProcessing, now.Add(-lease))
+	if err != nil {
+		return Held, err
+	}
+	n, err = result.RowsAffected()
+	if err != nil || n != 1 {
+		return Held, err
+	}
+	return TakenOver, nil
+}
+
+func (s *SqlStore) Complete(ctx context.Context, consumer string, eventId string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`
+		UPDATE processed_events SET status = ?, processed_at = ? WHERE consumer = ? AND event_id = ?
+	`), statusProcessed, time.Now().UTC(), consumer, eventId)
+	return err
+}
+
+func (s *SqlStore) Release(ctx context.Context, consumer string, eventId string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`
+		DELETE FROM processed_events WHERE consumer = ? AND event_id = ? AND status = ?
+	`), consumer, eventId, statusProcessing)
+	return err
+}
+
+func (s *SqlStore) Purge(ctx context.Context, olderThan time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(`
+		DELETE FROM processed_events WHERE status = ? AND processed_at < ?
+	`), statusProcessed, olderThan.UTC())
+	return err
+}
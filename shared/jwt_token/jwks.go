@@ -0,0 +1,207 @@
+package jwttoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJWKSRefreshInterval    = time.Minute * 5
+	DefaultJWKSMinRefetchInterval = time.Second * 30
+	DefaultJWKSTimeout            = time.Second * 5
+)
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the set of public keys served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newJWK(kid string, key crypto.PublicKey) (JWK, error) {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("key %s: unsupported key type %T", kid, key)
+}
+
+// PublicKey decodes the public key of the JWK
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid exponent: %w", k.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: invalid Ed25519 key", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %s", k.Kid, k.Kty)
+}
+
+type JWKSCacheConfig struct {
+	RefreshInterval    time.Duration // time between background fetches of the key set
+	MinRefetchInterval time.Duration // least time between fetches triggered by tokens signed with an unknown key
+	Timeout            time.Duration // timeout of a fetch
+}
+
+// JWKSCache keeps the public keys of the issuer fetched from its JWKS endpoint, so services can verify tokens without holding a secret that can mint them
+type JWKSCache struct {
+	url    string
+	client *http.Client
+	config JWKSCacheConfig
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+}
+
+func NewJWKSCache(url string, config JWKSCacheConfig) *JWKSCache {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = DefaultJWKSRefreshInterval
+	}
+	if config.MinRefetchInterval <= 0 {
+		config.MinRefetchInterval = DefaultJWKSMinRefetchInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultJWKSTimeout
+	}
+	return &JWKSCache{
+		url:    url,
+		client: &http.Client{Timeout: config.Timeout},
+		config: config,
+		keys:   map[string]crypto.PublicKey{},
+	}
+}
+
+// Run fetches the key set at start and then periodically until the context is cancelled
+func (c *JWKSCache) Run(ctx context.Context) {
+	if err := c.Refresh(ctx); err != nil {
+		log.Printf("error fetching jwks from %s: %v", c.url, err)
+	}
+	ticker := time.NewTicker(c.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				// the keys already fetched are kept
+				log.Printf("error fetching jwks from %s: %v", c.url, err)
+			}
+		}
+	}
+}
+
+// Refresh replaces the cached keys with the key set currently served by the issuer
+func (c *JWKSCache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	c.lastFetch = time.Now()
+	c.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	var set JWKS
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return fmt.Errorf("error decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("skipping jwk: %v", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+// PublicKey returns the cached key with the kid, an unknown kid triggers a fetch as the issuer may have rotated its keys since the last one
+func (c *JWKSCache) PublicKey(kid string) (crypto.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	canRefetch := time.Since(c.lastFetch) >= c.config.MinRefetchInterval
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !canRefetch {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	if err := c.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("error fetching jwks: %w", err)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+}
@@ -1,6 +1,9 @@
 package jwttoken
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"net/http"
@@ -13,35 +16,115 @@ import (
 type CustomClaims struct {
 	UserID string `json:"sub"`
 	Email  string `json:"email,omitempty"` // Optional field
+	// SessionID identifies the login session (refresh token family) the token was issued for, services can ask the auth service whether it was revoked
+	SessionID string `json:"sid,omitempty"`
+	// what the user may do, so services authorize requests from the token alone
+	Roles    []string `json:"roles,omitempty"` // active roles
+	Scopes   []string `json:"scope,omitempty"` // permissions granted by the roles
+	VendorID int      `json:"vendorId,omitempty"`
+	StoreIDs []int    `json:"storeIds,omitempty"` // stores of the vendor
 	jwt.RegisteredClaims
 }
 
+// Identity is what a token asserts about its user
+type Identity struct {
+	UserID    string
+	Email     string
+	SessionID string
+	Roles     []string
+	Scopes    []string
+	VendorID  int
+	StoreIDs  []int
+}
+
+// KeyResolver returns the public key that verifies tokens signed with the key of the kid
+type KeyResolver interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
 type JwtMaker struct {
 	secretKey string
+	keys      *KeyStore   // signs with the current asymmetric key when set
+	resolver  KeyResolver // verifies asymmetric signatures when set, HMAC with the secret otherwise
 }
 
+// NewJwtMaker signs and verifies tokens with a shared HMAC secret
 func NewJwtMaker(secret string) *JwtMaker {
 	return &JwtMaker{secretKey: secret}
 }
 
+// NewKeyStoreJwtMaker signs tokens with the RS256/EdDSA signing key of the store and verifies them with any of its keys, this is what the issuer uses
+func NewKeyStoreJwtMaker(keys *KeyStore) *JwtMaker {
+	return &JwtMaker{keys: keys, resolver: keys}
+}
+
+// NewJWKSJwtMaker only verifies tokens, with the public keys of the issuer's JWKS, this is what other services use
+func NewJWKSJwtMaker(jwks *JWKSCache) *JwtMaker {
+	return &JwtMaker{resolver: jwks}
+}
+
+// JWKS returns the public keys verifiers need, it is empty when tokens are signed with a shared secret
+func (j *JwtMaker) JWKS() JWKS {
+	if j.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return j.keys.JWKS()
+}
+
 var (
 	ErrExpiredToken = errors.New("expired token")
 	ErrInvalidToken = errors.New("invalid token")
 	ErrNoAuthHeader = errors.New("authorization header is missing")
 	ErrWrongFormat  = errors.New("authorization header format must be Bearer {token}")
+	// ErrNoSecret is returned when a token would be signed or verified with an empty HMAC secret, which anyone could forge tokens with
+	ErrNoSecret = errors.New("jwt secret is not set")
 )
 
-// CreateToken generates a JWT signed with HS256
+// CreateToken generates a signed JWT
 func (j *JwtMaker) CreateToken(userID, userEmail string, duration time.Duration) (string, error) {
+	return j.CreateSessionToken(userID, userEmail, "", duration)
+}
+
+// CreateSessionToken generates a signed JWT that carries the id of the login session it belongs to
+func (j *JwtMaker) CreateSessionToken(userID, userEmail, sessionID string, duration time.Duration) (string, error) {
+	return j.CreateIdentityToken(Identity{UserID: userID, Email: userEmail, SessionID: sessionID}, duration)
+}
+
+// CreateIdentityToken generates a signed JWT that carries the session, roles, scopes and stores of the user
+func (j *JwtMaker) CreateIdentityToken(identity Identity, duration time.Duration) (string, error) {
 	claims := CustomClaims{
-		UserID: userID,
-		Email:  userEmail,
+		UserID:    identity.UserID,
+		Email:     identity.Email,
+		SessionID: identity.SessionID,
+		Roles:     identity.Roles,
+		Scopes:    identity.Scopes,
+		VendorID:  identity.VendorID,
+		StoreIDs:  identity.StoreIDs,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   userID,
+			Subject:   identity.UserID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if j.keys != nil {
+		key, err := j.keys.SigningKey()
+		if err != nil {
+			return "", err
+		}
+		method, err := key.method()
+		if err != nil {
+			return "", err
+		}
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.PrivateKey)
+	}
+	if j.resolver != nil {
+		return "", ErrSigningUnsupported
+	}
+	if j.secretKey == "" {
+		return "", ErrNoSecret
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(j.secretKey))
 }
@@ -50,12 +133,7 @@ func (j *JwtMaker) CreateToken(userID, userEmail string, duration time.Duration)
 func (j *JwtMaker) VerifyToken(tokenStr string) (*CustomClaims, error) {
 	claims := &CustomClaims{}
 
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.secretKey), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, claims, j.keyFunc)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -75,6 +153,41 @@ func (j *JwtMaker) VerifyToken(tokenStr string) (*CustomClaims, error) {
 	return claims, nil
 }
 
+func (j *JwtMaker) keyFunc(token *jwt.Token) (interface{}, error) {
+	if j.resolver == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if j.secretKey == "" {
+			return nil, ErrNoSecret
+		}
+		return []byte(j.secretKey), nil
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key, err := j.resolver.PublicKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	// the algorithm must match the key, otherwise a token could pick a weaker verification than the key was made for
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v for key %s", token.Header["alg"], kid)
+		}
+	case ed25519.PublicKey:
+		if token.Method != jwt.SigningMethodEdDSA {
+			return nil, fmt.Errorf("unexpected signing method %v for key %s", token.Header["alg"], kid)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for key %s", key, kid)
+	}
+	return key, nil
+}
+
 // ExtractToken extracts token from Authorization header
 func (j *JwtMaker) ExtractToken(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
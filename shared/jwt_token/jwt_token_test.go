@@ -0,0 +1,41 @@
+package jwttoken
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJwtMakerRejectsAnEmptySecret(t *testing.T) {
+	if _, err := NewJwtMaker("").CreateToken("1", "admin@shop-ease.com", time.Minute); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("signing with an empty secret returned %v, want ErrNoSecret", err)
+	}
+
+	// a token anyone could sign, claiming to be an admin
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{
+		UserID:           "1",
+		Roles:            []string{"admin"},
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}).SignedString([]byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJwtMaker("").VerifyToken(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token signed with an empty secret returned %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJwtMakerVerifiesTokensOfItsSecret(t *testing.T) {
+	token, err := NewJwtMaker("secret").CreateToken("1", "user@shop-ease.com", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := NewJwtMaker("secret").VerifyToken(token); err != nil || claims.UserID != "1" {
+		t.Errorf("got %+v and %v, want the claims of user 1", claims, err)
+	}
+	if _, err := NewJwtMaker("other").VerifyToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of another secret returned %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,233 @@
+package jwttoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultKeyReloadInterval = time.Minute
+	DefaultKeyPublishPeriod  = time.Minute * 10 // longer than the default jwks refresh interval of verifiers
+	MinRSAKeyBits            = 2048
+)
+
+var (
+	ErrUnknownKey         = errors.New("unknown signing key")
+	ErrNoSigningKey       = errors.New("no signing key available")
+	ErrSigningUnsupported = errors.New("token signing is not supported by a verify only jwt maker")
+	ErrWeakKey            = errors.New("key is too weak")
+)
+
+// SigningKey is a private key that signs tokens, its id is sent in the kid header so verifiers know which public key to use
+type SigningKey struct {
+	ID         string
+	PrivateKey crypto.Signer
+}
+
+func (k *SigningKey) method() (jwt.SigningMethod, error) {
+	switch key := k.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		if bits := key.N.BitLen(); bits < MinRSAKeyBits {
+			return nil, fmt.Errorf("%w: key %s is a %d bit RSA key, at least %d bits are required", ErrWeakKey, k.ID, bits, MinRSAKeyBits)
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("key %s: unsupported key type %T, only RSA and Ed25519 keys are supported", k.ID, k.PrivateKey)
+}
+
+// KeyStore holds the keys of the issuer, loaded from a directory of PEM encoded private keys named <kid>.pem.
+//
+// Rotation: add the new key to the directory and, once it is picked up (see Run), point the signing key id to it
+// (or leave the signing key id empty and name keys so the new one sorts last, e.g. by date). With the signing key id empty a new key
+// only signs once it has been published for the publish period, so verifiers have fetched it before they see tokens it signed.
+// The old key keeps being published and verified until its file is removed, which should only be done
+// once the tokens it signed have expired, i.e. after the access token duration has passed.
+type KeyStore struct {
+	dir          string
+	signingKeyId string
+	publishFor   time.Duration
+	now          func() time.Time
+
+	mu      sync.RWMutex
+	keys    map[string]*SigningKey
+	signing *SigningKey
+	loaded  map[string]time.Time // when each key was picked up, the keys of the first load count as published already
+}
+
+// LoadKeyStore reads the keys in dir, the key with signingKeyId signs new tokens. When empty the key whose id sorts last among the ones
+// published for at least publishFor does, the default publish period is used when publishFor is zero
+func LoadKeyStore(dir string, signingKeyId string, publishFor time.Duration) (*KeyStore, error) {
+	if publishFor <= 0 {
+		publishFor = DefaultKeyPublishPeriod
+	}
+	k := &KeyStore{dir: dir, signingKeyId: signingKeyId, publishFor: publishFor, now: time.Now}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keys in the directory again, picking up added and removed keys
+func (k *KeyStore) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*SigningKey, len(paths))
+	ids := make([]string, 0, len(paths))
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		privateKey, err := readPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("error reading key %s: %w", id, err)
+		}
+		key := &SigningKey{ID: id, PrivateKey: privateKey}
+		if _, err := key.method(); err != nil {
+			return err
+		}
+		keys[id] = key
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: %s has no .pem keys", ErrNoSigningKey, k.dir)
+	}
+	sort.Strings(ids)
+
+	now := k.now()
+	k.mu.RLock()
+	firstLoad, previous := k.keys == nil, k.loaded
+	k.mu.RUnlock()
+	loaded := make(map[string]time.Time, len(ids))
+	for _, id := range ids {
+		switch at, ok := previous[id]; {
+		case ok:
+			loaded[id] = at
+		case firstLoad:
+			loaded[id] = time.Time{}
+		default:
+			loaded[id] = now
+		}
+	}
+
+	signingKeyId := k.signingKeyId
+	if signingKeyId == "" {
+		// only new keys are left (e.g. the old ones were removed early), one of them has to sign
+		signingKeyId = ids[len(ids)-1]
+		for i := len(ids) - 1; i >= 0; i-- {
+			if now.Sub(loaded[ids[i]]) >= k.publishFor {
+				signingKeyId = ids[i]
+				break
+			}
+		}
+	}
+	signing, ok := keys[signingKeyId]
+	if !ok {
+		return fmt.Errorf("%w: signing key %s is not in %s", ErrNoSigningKey, signingKeyId, k.dir)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+	k.signing = signing
+	k.loaded = loaded
+	return nil
+}
+
+// Run reloads the keys until the context is cancelled, so keys can be rotated without a restart
+func (k *KeyStore) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultKeyReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				// the keys already loaded are kept
+				log.Printf("error reloading jwt signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// SigningKey returns the key new tokens are signed with
+func (k *KeyStore) SigningKey() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return k.signing, nil
+}
+
+// PublicKey returns the public key tokens with the kid are verified with
+func (k *KeyStore) PublicKey(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+// JWKS returns the public keys of the store for publishing
+func (k *KeyStore) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	set := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		if jwk, err := newJWK(id, k.keys[id].PrivateKey.Public()); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
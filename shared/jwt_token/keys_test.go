@@ -0,0 +1,105 @@
+package jwttoken
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKey(t *testing.T, dir string, id string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeEd25519Key(t *testing.T, dir string, id string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, id, key)
+}
+
+func signingKeyId(t *testing.T, keys *KeyStore) string {
+	t.Helper()
+	key, err := keys.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.ID
+}
+
+func TestKeyStoreSignsWithANewKeyOnlyOnceItHasBeenPublished(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2026-01-01")
+	keys, err := LoadKeyStore(dir, "", time.Minute*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	keys.now = func() time.Time { return now }
+
+	writeEd25519Key(t, dir, "2026-02-01")
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.PublicKey("2026-02-01"); err != nil {
+		t.Errorf("new key is not published: %v", err)
+	}
+	if id := signingKeyId(t, keys); id != "2026-01-01" {
+		t.Errorf("signing with %s before the new key was published for the period, want 2026-01-01", id)
+	}
+
+	now = now.Add(time.Minute * 10)
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if id := signingKeyId(t, keys); id != "2026-02-01" {
+		t.Errorf("signing with %s after the publish period, want 2026-02-01", id)
+	}
+}
+
+func TestKeyStoreSignsWithTheNewKeyWhenNoOtherIsLeft(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2026-01-01")
+	keys, err := LoadKeyStore(dir, "", time.Minute*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(filepath.Join(dir, "2026-01-01.pem"))
+	writeEd25519Key(t, dir, "2026-02-01")
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if id := signingKeyId(t, keys); id != "2026-02-01" {
+		t.Errorf("signing with %s, want the only key left", id)
+	}
+}
+
+func TestKeyStoreRejectsWeakRSAKeys(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, dir, "weak", key)
+	if _, err := LoadKeyStore(dir, "", 0); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("loading a 1024 bit RSA key returned %v, want ErrWeakKey", err)
+	}
+}
@@ -0,0 +1,90 @@
+package money
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateSource provides exchange rates, e.g. from a table kept by an admin or an exchange rate api
+type RateSource interface {
+	// Rate returns how many major units of to one major unit of from is worth
+	Rate(ctx context.Context, from, to Currency) (*big.Rat, error)
+}
+
+type Converter struct {
+	source RateSource
+}
+
+func NewConverter(source RateSource) *Converter {
+	return &Converter{source}
+}
+
+// Convert returns the money in the currency, rounded half away from zero to the nearest minor unit of the currency
+func (c *Converter) Convert(ctx context.Context, m Money, to Currency) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	rate, err := c.source.Rate(ctx, m.Currency, to)
+	if err != nil {
+		return Money{}, err
+	}
+	if rate == nil || rate.Sign() <= 0 {
+		return Money{}, fmt.Errorf("%w: invalid rate from %s to %s", ErrRateNotFound, m.Currency, to)
+	}
+
+	// minor units of from -> major units of from -> major units of to -> minor units of to
+	value := new(big.Rat).SetInt64(m.Amount)
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetFrac(pow10(to.Exponent()), pow10(m.Currency.Exponent())))
+	amount, err := round(value)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: to}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// StaticRates is a rate source for fixed rates, the inverse of a rate is used when only the opposite direction is set
+type StaticRates struct {
+	mu    sync.RWMutex
+	rates map[Currency]map[Currency]*big.Rat
+}
+
+func NewStaticRates() *StaticRates {
+	return &StaticRates{rates: make(map[Currency]map[Currency]*big.Rat)}
+}
+
+// Set saves the rate from one currency to another, the rate is a decimal string (e.g. "0.00065") so it is kept exactly
+func (s *StaticRates) Set(from, to Currency, rate string) error {
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() <= 0 {
+		return fmt.Errorf("invalid rate %q from %s to %s", rate, from, to)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rates[from] == nil {
+		s.rates[from] = make(map[Currency]*big.Rat)
+	}
+	s.rates[from][to] = value
+	return nil
+}
+
+func (s *StaticRates) Rate(ctx context.Context, from, to Currency) (*big.Rat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rate, ok := s.rates[from][to]; ok {
+		return new(big.Rat).Set(rate), nil
+	}
+	if rate, ok := s.rates[to][from]; ok {
+		return new(big.Rat).Inv(rate), nil
+	}
+	return nil, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from, to)
+}
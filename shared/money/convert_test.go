@@ -0,0 +1,82 @@
+package money
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestConverter(t *testing.T) *Converter {
+	t.Helper()
+	rates := NewStaticRates()
+	for _, rate := range []struct {
+		from, to Currency
+		rate     string
+	}{
+		{NGN, USD, "0.00065"},
+		{GBP, USD, "1.25"},
+		{USD, XOF, "600.5"},
+	} {
+		if err := rates.Set(rate.from, rate.to, rate.rate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewConverter(rates)
+}
+
+func TestConvert(t *testing.T) {
+	converter := newTestConverter(t)
+	for name, tc := range map[string]struct {
+		from    Money
+		to      Currency
+		want    Money
+		wantErr error
+	}{
+		"rounds half away from zero":          {from: New(150000, NGN), to: USD, want: New(98, USD)}, // 97.5 cents
+		"rounds down below half":              {from: New(149000, NGN), to: USD, want: New(97, USD)}, // 96.85 cents
+		"rounds refunds away from zero":       {from: New(-150000, NGN), to: USD, want: New(-98, USD)},
+		"uses the inverse rate":               {from: New(100, USD), to: GBP, want: New(80, GBP)},
+		"inverse of a fraction":               {from: New(1, USD), to: NGN, want: New(1538, NGN)},   // 1538.46 kobo
+		"to a currency without minor units":   {from: New(150, USD), to: XOF, want: New(901, XOF)},  // 900.75 francs
+		"from a currency without minor units": {from: New(1200, XOF), to: USD, want: New(200, USD)}, // 199.83 cents
+		"same currency":                       {from: New(12345, NGN), to: NGN, want: New(12345, NGN)},
+		"rate not found":                      {from: New(100, EUR), to: NGN, wantErr: ErrRateNotFound},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := converter.Convert(context.Background(), tc.from, tc.to)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("convert returned %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("%s in %s is %s, want %s", tc.from, tc.to, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStaticRatesPrefersTheSetDirectionOverTheInverse(t *testing.T) {
+	rates := NewStaticRates()
+	if err := rates.Set(NGN, USD, "0.0008"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rates.Set(USD, NGN, "1300"); err != nil {
+		t.Fatal(err)
+	}
+	rate, err := rates.Rate(context.Background(), USD, NGN)
+	if err != nil || rate.RatString() != "1300" {
+		t.Errorf("rate from USD to NGN is %v (%v), want the 1300 that was set rather than the inverse 1250", rate, err)
+	}
+	rate, err = rates.Rate(context.Background(), NGN, USD)
+	if err != nil || rate.RatString() != "1/1250" {
+		t.Errorf("rate from NGN to USD is %v (%v), want 1/1250", rate, err)
+	}
+}
+
+func TestStaticRatesRejectsInvalidRates(t *testing.T) {
+	rates := NewStaticRates()
+	for _, rate := range []string{"0", "-1.5", "abc", ""} {
+		if err := rates.Set(NGN, USD, rate); err == nil {
+			t.Errorf("rate %q was accepted", rate)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is an ISO-4217 currency code
+type Currency string
+
+var (
+	NGN Currency = "NGN"
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	GBP Currency = "GBP"
+	GHS Currency = "GHS"
+	KES Currency = "KES"
+	ZAR Currency = "ZAR"
+	XOF Currency = "XOF"
+)
+
+// DefaultCurrency is used for amounts saved before currencies were recorded
+var DefaultCurrency = NGN
+
+// number of minor units (kobo, cents) in a major unit as a power of ten
+var exponents = map[Currency]int{
+	NGN: 2,
+	USD: 2,
+	EUR: 2,
+	GBP: 2,
+	GHS: 2,
+	KES: 2,
+	ZAR: 2,
+	XOF: 0,
+}
+
+// ParseCurrency returns the currency of the code, an empty code is the default currency
+func ParseCurrency(code string) (Currency, error) {
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if _, ok := exponents[currency]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownCurrency, code)
+	}
+	return currency, nil
+}
+
+// Exponent returns the number of decimal places of the currency
+func (c Currency) Exponent() int {
+	if exponent, ok := exponents[c]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func (c Currency) String() string {
+	return string(c)
+}
@@ -0,0 +1,243 @@
+// Package money keeps amounts as integers of the minor unit of their currency (kobo, cents), so they can be added, split and compared without the rounding errors of floats
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch  = errors.New("currencies do not match")
+	ErrUnknownCurrency   = errors.New("unknown currency")
+	ErrOverflow          = errors.New("amount out of range")
+	ErrInvalidPercentage = errors.New("percentage must be between 0 and 100")
+	ErrInvalidRatios     = errors.New("ratios must not be negative and must not all be zero")
+)
+
+type Money struct {
+	Amount   int64    `json:"amount"` // in minor units
+	Currency Currency `json:"currency"`
+}
+
+func New(amount int64, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromMajor converts an amount in major units (e.g. naira) to money, rounding half away from zero to the nearest minor unit
+func FromMajor(amount float64, currency Currency) Money {
+	return Money{Amount: int64(math.Round(amount * math.Pow10(currency.Exponent()))), Currency: currency}
+}
+
+// Major returns the amount in major units, only meant for display and providers that take major units
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(m.Currency.Exponent())
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency
+}
+
+func (m Money) assertSameCurrency(other Money) error {
+	if !m.SameCurrency(other) {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.assertSameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(other.Neg())
+}
+
+// Mul multiplies the amount, e.g. the price of an item by its quantity
+func (m Money) Mul(n int64) (Money, error) {
+	product, err := mulDiv(m.Amount, big.NewInt(n), big.NewInt(1))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Compare returns -1, 0 or 1 when the amount is less than, equal to or greater than the other
+func (m Money) Compare(other Money) (int, error) {
+	if err := m.assertSameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Percent returns the percentage of the amount rounded half away from zero, basis points allow fractions of a percent (1250 is 12.5%)
+func (m Money) Percent(basisPoints int64) (Money, error) {
+	if basisPoints < 0 || basisPoints > 10000 {
+		return Money{}, ErrInvalidPercentage
+	}
+	part, err := mulDiv(m.Amount, big.NewInt(basisPoints), big.NewInt(10000))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: part, Currency: m.Currency}, nil
+}
+
+// ApplyDiscount takes a percentage discount off the amount, returning the discounted amount and the discount. The two always add up to the amount
+func (m Money) ApplyDiscount(percentage int64) (discounted Money, discount Money, err error) {
+	if percentage < 0 || percentage > 100 {
+		return Money{}, Money{}, ErrInvalidPercentage
+	}
+	discount, err = m.Percent(percentage * 100)
+	if err != nil {
+		return Money{}, Money{}, err
+	}
+	discounted, err = m.Sub(discount)
+	return discounted, discount, err
+}
+
+// Allocate splits the amount in proportion to the ratios without losing a minor unit: the remainder left by rounding down is handed out
+// one unit at a time to the parts that lost the most to rounding, the earlier part first on a tie
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	total := new(big.Int)
+	for _, ratio := range ratios {
+		if ratio < 0 {
+			return nil, ErrInvalidRatios
+		}
+		total.Add(total, big.NewInt(ratio))
+	}
+	if total.Sign() == 0 {
+		return nil, ErrInvalidRatios
+	}
+
+	amount := big.NewInt(m.Amount)
+	sign := int64(1)
+	if amount.Sign() < 0 {
+		// allocate the absolute amount so the remainder is handed out the same way for refunds
+		amount.Neg(amount)
+		sign = -1
+	}
+	parts := make([]Money, len(ratios))
+	remainders := make([]*big.Int, len(ratios))
+	allocated := new(big.Int)
+	for i, ratio := range ratios {
+		share, remainder := new(big.Int).QuoRem(new(big.Int).Mul(amount, big.NewInt(ratio)), total, new(big.Int))
+		parts[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+		remainders[i] = remainder
+		allocated.Add(allocated, share)
+	}
+
+	left := new(big.Int).Sub(amount, allocated).Int64()
+	for ; left > 0; left-- {
+		largest := -1
+		for i, remainder := range remainders {
+			if remainder.Sign() > 0 && (largest == -1 || remainder.Cmp(remainders[largest]) > 0) {
+				largest = i
+			}
+		}
+		parts[largest].Amount++
+		remainders[largest] = new(big.Int)
+	}
+	for i := range parts {
+		parts[i].Amount *= sign
+	}
+	return parts, nil
+}
+
+// Split divides the amount into n parts that differ by at most a minor unit
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, ErrInvalidRatios
+	}
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// String formats the money in major units, e.g. NGN 1500.50
+func (m Money) String() string {
+	exponent := m.Currency.Exponent()
+	sign := ""
+	amount := new(big.Int).SetInt64(m.Amount)
+	if amount.Sign() < 0 {
+		sign = "-"
+		amount.Neg(amount)
+	}
+	digits := amount.String()
+	if exponent == 0 {
+		return fmt.Sprintf("%s %s%s", m.Currency, sign, digits)
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return fmt.Sprintf("%s %s%s.%s", m.Currency, sign, digits[:len(digits)-exponent], digits[len(digits)-exponent:])
+}
+
+// Sum adds up the amounts, all of which must be in the currency
+func Sum(currency Currency, values ...Money) (Money, error) {
+	total := New(0, currency)
+	for _, value := range values {
+		var err error
+		if total, err = total.Add(value); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// mulDiv returns amount * num / den rounded half away from zero
+func mulDiv(amount int64, num *big.Int, den *big.Int) (int64, error) {
+	return round(new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(amount), num), den))
+}
+
+func round(value *big.Rat) (int64, error) {
+	num, den := value.Num(), value.Denom()
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	// round away from zero when the remainder is at least half of the denominator
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	if !quotient.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return quotient.Int64(), nil
+}
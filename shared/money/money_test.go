@@ -0,0 +1,157 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestAddAndSub(t *testing.T) {
+	for name, tc := range map[string]struct {
+		a, b    Money
+		sum     Money
+		diff    Money
+		wantErr error
+	}{
+		"same currency":      {a: New(150050, NGN), b: New(49950, NGN), sum: New(200000, NGN), diff: New(100100, NGN)},
+		"below zero":         {a: New(100, USD), b: New(250, USD), sum: New(350, USD), diff: New(-150, USD)},
+		"different currency": {a: New(100, NGN), b: New(100, USD), wantErr: ErrCurrencyMismatch},
+		"overflow":           {a: New(math.MaxInt64, NGN), b: New(1, NGN), wantErr: ErrOverflow},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sum, err := tc.a.Add(tc.b)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("add returned %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if sum != tc.sum {
+				t.Errorf("%s + %s = %s, want %s", tc.a, tc.b, sum, tc.sum)
+			}
+			diff, err := tc.a.Sub(tc.b)
+			if err != nil || diff != tc.diff {
+				t.Errorf("%s - %s = %s (%v), want %s", tc.a, tc.b, diff, err, tc.diff)
+			}
+		})
+	}
+}
+
+func TestMul(t *testing.T) {
+	for name, tc := range map[string]struct {
+		m       Money
+		n       int64
+		want    Money
+		wantErr error
+	}{
+		"by quantity": {m: New(2550, NGN), n: 3, want: New(7650, NGN)},
+		"by zero":     {m: New(2550, NGN), n: 0, want: New(0, NGN)},
+		"overflow":    {m: New(math.MaxInt64/2+1, NGN), n: 2, wantErr: ErrOverflow},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.m.Mul(tc.n)
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && got != tc.want) {
+				t.Errorf("%s * %d = %s (%v), want %s (%v)", tc.m, tc.n, got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPercentRoundsHalfAwayFromZero(t *testing.T) {
+	for name, tc := range map[string]struct {
+		m           Money
+		basisPoints int64
+		want        int64
+	}{
+		"exact":             {m: New(10000, NGN), basisPoints: 1000, want: 1000},
+		"half rounds up":    {m: New(5, NGN), basisPoints: 5000, want: 3},
+		"below half":        {m: New(14, NGN), basisPoints: 1000, want: 1},
+		"half of negative":  {m: New(-5, NGN), basisPoints: 5000, want: -3},
+		"fraction of a per": {m: New(10000, NGN), basisPoints: 1250, want: 1250},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.m.Percent(tc.basisPoints)
+			if err != nil || got.Amount != tc.want {
+				t.Errorf("%d basis points of %s = %d (%v), want %d", tc.basisPoints, tc.m, got.Amount, err, tc.want)
+			}
+		})
+	}
+	if _, err := New(100, NGN).Percent(10001); !errors.Is(err, ErrInvalidPercentage) {
+		t.Errorf("percent above 100 returned %v, want ErrInvalidPercentage", err)
+	}
+}
+
+func TestApplyDiscountPartsAddUpToTheAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount, percentage   int64
+		discounted, discount int64
+	}{
+		{amount: 10000, percentage: 10, discounted: 9000, discount: 1000},
+		{amount: 999, percentage: 15, discounted: 849, discount: 150},
+		{amount: 1, percentage: 50, discounted: 0, discount: 1},
+		{amount: 1234, percentage: 0, discounted: 1234, discount: 0},
+		{amount: 1234, percentage: 100, discounted: 0, discount: 1234},
+	} {
+		discounted, discount, err := New(tc.amount, NGN).ApplyDiscount(tc.percentage)
+		if err != nil || discounted.Amount != tc.discounted || discount.Amount != tc.discount {
+			t.Errorf("%d%% off %d = %d and %d (%v), want %d and %d", tc.percentage, tc.amount, discounted.Amount, discount.Amount, err, tc.discounted, tc.discount)
+		}
+	}
+}
+
+func TestAllocateLosesNoMinorUnit(t *testing.T) {
+	for name, tc := range map[string]struct {
+		amount  int64
+		ratios  []int64
+		want    []int64
+		wantErr error
+	}{
+		"even":                           {amount: 100, ratios: []int64{1, 1}, want: []int64{50, 50}},
+		"remainder to the largest loss":  {amount: 100, ratios: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		"by weight":                      {amount: 1000, ratios: []int64{70, 20, 10}, want: []int64{700, 200, 100}},
+		"a tie goes to the earlier part": {amount: 5, ratios: []int64{3, 7}, want: []int64{2, 3}},
+		"zero ratio":                     {amount: 10, ratios: []int64{0, 1}, want: []int64{0, 10}},
+		"negative amount":                {amount: -100, ratios: []int64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		"negative ratio":                 {amount: 100, ratios: []int64{-1, 2}, wantErr: ErrInvalidRatios},
+		"all zero":                       {amount: 100, ratios: []int64{0, 0}, wantErr: ErrInvalidRatios},
+	} {
+		t.Run(name, func(t *testing.T) {
+			parts, err := New(tc.amount, NGN).Allocate(tc.ratios...)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("allocate returned %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			got := make([]int64, len(parts))
+			for i, part := range parts {
+				got[i] = part.Amount
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("allocate %d by %v = %v, want %v", tc.amount, tc.ratios, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFromMajorAndString(t *testing.T) {
+	for _, tc := range []struct {
+		major  float64
+		money  Money
+		string string
+	}{
+		{major: 1500.5, money: New(150050, NGN), string: "NGN 1500.50"},
+		{major: 0.125, money: New(13, USD), string: "USD 0.13"},
+		{major: -2.5, money: New(-250, GBP), string: "GBP -2.50"},
+		{major: 1500, money: New(1500, XOF), string: "XOF 1500"},
+	} {
+		got := FromMajor(tc.major, tc.money.Currency)
+		if got != tc.money {
+			t.Errorf("from major %v = %+v, want %+v", tc.major, got, tc.money)
+		}
+		if got.String() != tc.string {
+			t.Errorf("%+v formats as %q, want %q", got, got.String(), tc.string)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package money
+
+import (
+	moneypb "github.com/kaasikodes/shop-ease/shared/proto/money"
+)
+
+func ToProto(m Money) *moneypb.Money {
+	return &moneypb.Money{Amount: m.Amount, Currency: string(m.Currency)}
+}
+
+// FromProto returns the money of the message, a missing message is zero in the default currency
+func FromProto(m *moneypb.Money) Money {
+	if m == nil {
+		return New(0, DefaultCurrency)
+	}
+	return New(m.GetAmount(), Currency(m.GetCurrency()))
+}
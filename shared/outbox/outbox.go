@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/database"
+	"github.com/kaasikodes/shop-ease/shared/events"
+)
+
+// Dialect is kept here so the services can refer to the outbox dialects directly
+type Dialect = database.Dialect
+
+const (
+	MySQL    = database.MySQL
+	Postgres = database.Postgres
+)
+
+// Message is a row in the outbox_events table
+type Message struct {
+	ID          int64
+	Topic       string
+	Key         string
+	EventType   string
+	Payload     []byte
+	Attempts    int
+	LastError   *string
+	CreatedAt   time.Time
+	PublishedAt *time.Time
+}
+
+// Enqueue writes the event to the outbox using the transaction of the domain change, so the event only exists (and is later published) if the change is committed. Events of the same key are published in order
+func Enqueue(ctx context.Context, tx *sql.Tx, dialect Dialect, topic string, key string, envelope *events.Envelope) error {
+	payload, err := events.Encode(envelope)
+	if err != nil {
+		return fmt.Errorf("error marshaling outbox event %s: %w", envelope.Type, err)
+	}
+
+	query := dialect.Rebind(`
+		INSERT INTO outbox_events (topic, message_key, event_type, payload, attempts, created_at)
+		VALUES (?, ?, ?, ?, 0, NOW())
+	`)
+	if _, err := tx.ExecContext(ctx, query, topic, key, envelope.Type, string(payload)); err != nil {
+		return fmt.Errorf("error saving outbox event %s: %w", envelope.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/broker"
+	"github.com/kaasikodes/shop-ease/shared/events"
+	"github.com/kaasikodes/shop-ease/shared/observability"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	DefaultPollInterval = time.Second * 2
+	DefaultBatchSize    = 100
+	DefaultMaxAttempts  = 10
+)
+
+type RelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Retention    time.Duration // published events older than this are deleted, zero keeps them forever
+	MaxAttempts  int           // events that failed to publish this many times are parked, they stay in the table with their last error until fixed by hand
+}
+
+// Relay drains the outbox table to the message broker. An event is only marked as published after the broker accepts it, so delivery is at-least-once and consumers should expect duplicates
+type Relay struct {
+	db      *sql.DB
+	dialect Dialect
+	broker  broker.MessageBroker
+	config  RelayConfig
+}
+
+func NewRelay(db *sql.DB, dialect Dialect, broker broker.MessageBroker, config RelayConfig) *Relay {
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	return &Relay{db: db, dialect: dialect, broker: broker, config: config}
+}
+
+// Run polls the outbox until the context is canceled, it is meant to be run in its own goroutine
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("shutting down the outbox relay")
+			return
+		case <-ticker.C:
+			// keep draining while full batches are returned so a backlog does not wait on the ticker
+			for {
+				// a batch with failures is not drained again until the next tick, so failing events are retried at the poll interval
+				published, err := r.drain(ctx)
+				if err != nil {
+					log.Printf("error draining outbox: %v", err)
+					break
+				}
+				if published < r.config.BatchSize {
+					break
+				}
+			}
+			if r.config.Retention > 0 {
+				if err := r.purge(ctx); err != nil {
+					log.Printf("error purging outbox: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// drain publishes a single batch of pending events in insertion order and returns how many were published.
+// A failed event only holds back the later events of its key, the other keys keep being published, and once it reaches the max attempts it is parked so its key is no longer held back either
+func (r *Relay) drain(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets several replicas of a service run a relay without publishing the same rows concurrently
+	rows, err := tx.QueryContext(ctx, r.dialect.Rebind(`
+		SELECT id, topic, message_key, event_type, payload, attempts
+		FROM outbox_events
+		WHERE published_at IS NULL AND attempts < ?
+		ORDER BY id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`), r.config.MaxAttempts, r.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.EventType, &msg.Payload, &msg.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	failedKeys := map[string]bool{}
+	for _, msg := range messages {
+		if failedKeys[msg.Key] {
+			// an earlier event of the same entity failed, publishing this one would reorder them
+			continue
+		}
+		if err := r.publish(ctx, msg); err != nil {
+			failedKeys[msg.Key] = true
+			if msg.Attempts+1 >= r.config.MaxAttempts {
+				log.Printf("parking outbox event %d (%s) after %d attempts: %v", msg.ID, msg.EventType, msg.Attempts+1, err)
+			} else {
+				log.Printf("error publishing outbox event %d (%s): %v", msg.ID, msg.EventType, err)
+			}
+			if _, uerr := tx.ExecContext(ctx, r.dialect.Rebind(`
+				UPDATE outbox_events SET attempts = attempts + 1, last_error = ? WHERE id = ?
+			`), err.Error(), msg.ID); uerr != nil {
+				return 0, uerr
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, r.dialect.Rebind(`
+			UPDATE outbox_events SET attempts = attempts + 1, published_at = NOW() WHERE id = ?
+		`), msg.ID); err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing outbox batch: %w", err)
+	}
+	return published, nil
+}
+
+func (r *Relay) publish(ctx context.Context, msg Message) error {
+	var envelope events.Envelope
+	if err := json.Unmarshal(msg.Payload, &envelope); err != nil {
+		return fmt.Errorf("error unmarshaling outbox event: %w", err)
+	}
+	// continue the trace of the request the event was recorded in
+	headers := envelope.Headers()
+	ctx = observability.Propagator.Extract(ctx, propagation.MapCarrier(headers))
+	return r.broker.PublishMessage(ctx, msg.Topic, msg.Key, headers, msg.Payload)
+}
+
+func (r *Relay) purge(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind(`
+		DELETE FROM outbox_events WHERE published_at IS NOT NULL AND published_at < ?
+	`), time.Now().Add(-r.config.Retention))
+	return err
+}
@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kaasikodes/shop-ease/shared/broker"
+	"github.com/kaasikodes/shop-ease/shared/events"
+)
+
+// failingBroker records the keys it was asked to publish and fails the ones in failKeys
+type failingBroker struct {
+	broker.MessageBroker
+
+	failKeys  map[string]bool
+	published []string
+}
+
+func (b *failingBroker) PublishMessage(ctx context.Context, topic string, key string, headers map[string]string, message []byte) error {
+	b.published = append(b.published, key)
+	if b.failKeys[key] {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func newTestRelay(t *testing.T, b broker.MessageBroker, config RelayConfig) (*Relay, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewRelay(db, MySQL, b, config), mock
+}
+
+func testPayload(t *testing.T) []byte {
+	t.Helper()
+	envelope, err := events.NewEnvelope(context.Background(), "test", events.ProductCreatedEvent, &events.ProductCreatedPayload{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := events.Encode(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func outboxRows(t *testing.T, rows ...Message) *sqlmock.Rows {
+	result := sqlmock.NewRows([]string{"id", "topic", "message_key", "event_type", "payload", "attempts"})
+	for _, row := range rows {
+		result.AddRow(row.ID, "product", row.Key, events.ProductCreatedEvent, testPayload(t), row.Attempts)
+	}
+	return result
+}
+
+func TestDrainHoldsBackOnlyTheKeyOfAFailedEvent(t *testing.T) {
+	b := &failingBroker{failKeys: map[string]bool{"product-1": true}}
+	relay, mock := newTestRelay(t, b, RelayConfig{MaxAttempts: 5, BatchSize: 10})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, topic, message_key, event_type, payload, attempts").
+		WithArgs(5, 10).
+		WillReturnRows(outboxRows(t,
+			Message{ID: 1, Key: "product-1"},
+			Message{ID: 2, Key: "product-1"},
+			Message{ID: 3, Key: "product-2"},
+		))
+	mock.ExpectExec("UPDATE outbox_events SET attempts = attempts \\+ 1, last_error = \\?").
+		WithArgs("broker unavailable", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE outbox_events SET attempts = attempts \\+ 1, published_at = NOW\\(\\)").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	published, err := relay.drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 1 {
+		t.Errorf("published %d events, want 1", published)
+	}
+	// event 2 is not attempted, publishing it before event 1 would reorder product-1
+	if want := []string{"product-1", "product-2"}; len(b.published) != len(want) || b.published[0] != want[0] || b.published[1] != want[1] {
+		t.Errorf("published keys %v, want %v", b.published, want)
+	}
+}
+
+func TestDrainParksAnEventAfterTheMaxAttempts(t *testing.T) {
+	b := &failingBroker{failKeys: map[string]bool{"product-1": true}}
+	relay, mock := newTestRelay(t, b, RelayConfig{MaxAttempts: 3, BatchSize: 10})
+
+	// the last attempt of event 1 fails, its attempts reach the max
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, topic").
+		WithArgs(3, 10).
+		WillReturnRows(outboxRows(t, Message{ID: 1, Key: "product-1", Attempts: 2}))
+	mock.ExpectExec("UPDATE outbox_events SET attempts = attempts \\+ 1, last_error = \\?").
+		WithArgs("broker unavailable", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// the parked event is left out by the attempts filter, so the next event of its key is no longer held back
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, topic").
+		WithArgs(3, 10).
+		WillReturnRows(outboxRows(t, Message{ID: 2, Key: "product-1-next"}))
+	mock.ExpectExec("UPDATE outbox_events SET attempts = attempts \\+ 1, published_at = NOW\\(\\)").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	for i, want := range []int{0, 1} {
+		published, err := relay.drain(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if published != want {
+			t.Errorf("drain %d published %d events, want %d", i+1, published, want)
+		}
+	}
+}
+
+func TestDrainRollsBackWhenMarkingAnEventFails(t *testing.T) {
+	relay, mock := newTestRelay(t, &failingBroker{}, RelayConfig{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, topic").
+		WithArgs(DefaultMaxAttempts, DefaultBatchSize).
+		WillReturnRows(outboxRows(t, Message{ID: 1, Key: "product-1"}))
+	mock.ExpectExec("UPDATE outbox_events SET attempts = attempts \\+ 1, published_at = NOW\\(\\)").
+		WithArgs(1).
+		WillReturnError(errors.New("connection lost"))
+	mock.ExpectRollback()
+
+	if _, err := relay.drain(context.Background()); err == nil {
+		t.Error("drain returned no error, want the error of marking the event")
+	}
+}
+
+// publishedBefore matches a time within a second of the retention cutoff
+type publishedBefore struct {
+	cutoff time.Time
+}
+
+func (p publishedBefore) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	diff := at.Sub(p.cutoff)
+	return diff > -time.Second && diff < time.Second
+}
+
+func TestPurgeDeletesPublishedEventsOlderThanTheRetention(t *testing.T) {
+	retention := time.Hour * 24 * 7
+	relay, mock := newTestRelay(t, &failingBroker{}, RelayConfig{Retention: retention})
+
+	mock.ExpectExec("DELETE FROM outbox_events WHERE published_at IS NOT NULL AND published_at < \\?").
+		WithArgs(publishedBefore{cutoff: time.Now().Add(-retention)}).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+
+	if err := relay.purge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
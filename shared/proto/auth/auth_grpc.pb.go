@@ -19,7 +19,8 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	AuthService_GetUserById_FullMethodName = "/auth.AuthService/GetUserById"
+	AuthService_GetUserById_FullMethodName     = "/auth.AuthService/GetUserById"
+	AuthService_IsSessionActive_FullMethodName = "/auth.AuthService/IsSessionActive"
 )
 
 // AuthServiceClient is the client API for AuthService service.
@@ -27,6 +28,8 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type AuthServiceClient interface {
 	GetUserById(ctx context.Context, in *GetUserByIdRequest, opts ...grpc.CallOption) (*GetUserByIdResponse, error)
+	// IsSessionActive reports whether the session (sid claim) of an access token has not been logged out or revoked
+	IsSessionActive(ctx context.Context, in *IsSessionActiveRequest, opts ...grpc.CallOption) (*IsSessionActiveResponse, error)
 }
 
 type authServiceClient struct {
@@ -47,11 +50,23 @@ func (c *authServiceClient) GetUserById(ctx context.Context, in *GetUserByIdRequ
 	return out, nil
 }
 
+func (c *authServiceClient) IsSessionActive(ctx context.Context, in *IsSessionActiveRequest, opts ...grpc.CallOption) (*IsSessionActiveResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IsSessionActiveResponse)
+	err := c.cc.Invoke(ctx, AuthService_IsSessionActive_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AuthServiceServer is the server API for AuthService service.
 // All implementations must embed UnimplementedAuthServiceServer
 // for forward compatibility.
 type AuthServiceServer interface {
 	GetUserById(context.Context, *GetUserByIdRequest) (*GetUserByIdResponse, error)
+	// IsSessionActive reports whether the session (sid claim) of an access token has not been logged out or revoked
+	IsSessionActive(context.Context, *IsSessionActiveRequest) (*IsSessionActiveResponse, error)
 	mustEmbedUnimplementedAuthServiceServer()
 }
 
@@ -65,6 +80,9 @@ type UnimplementedAuthServiceServer struct{}
 func (UnimplementedAuthServiceServer) GetUserById(context.Context, *GetUserByIdRequest) (*GetUserByIdResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserById not implemented")
 }
+func (UnimplementedAuthServiceServer) IsSessionActive(context.Context, *IsSessionActiveRequest) (*IsSessionActiveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IsSessionActive not implemented")
+}
 func (UnimplementedAuthServiceServer) mustEmbedUnimplementedAuthServiceServer() {}
 func (UnimplementedAuthServiceServer) testEmbeddedByValue()                     {}
 
@@ -104,6 +122,24 @@ func _AuthService_GetUserById_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AuthService_IsSessionActive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IsSessionActiveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).IsSessionActive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_IsSessionActive_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).IsSessionActive(ctx, req.(*IsSessionActiveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AuthService_ServiceDesc is the grpc.ServiceDesc for AuthService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +151,10 @@ var AuthService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetUserById",
 			Handler:    _AuthService_GetUserById_Handler,
 		},
+		{
+			MethodName: "IsSessionActive",
+			Handler:    _AuthService_IsSessionActive_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/auth.proto",
@@ -22,6 +22,7 @@ const (
 	PaymentService_GetTransactions_FullMethodName    = "/payment.PaymentService/GetTransactions"
 	PaymentService_GetTransactionById_FullMethodName = "/payment.PaymentService/GetTransactionById"
 	PaymentService_CreateTransaction_FullMethodName  = "/payment.PaymentService/CreateTransaction"
+	PaymentService_RefundTransaction_FullMethodName  = "/payment.PaymentService/RefundTransaction"
 )
 
 // PaymentServiceClient is the client API for PaymentService service.
@@ -36,6 +37,8 @@ type PaymentServiceClient interface {
 	GetTransactionById(ctx context.Context, in *GetByIdRequest, opts ...grpc.CallOption) (*Transaction, error)
 	// Create transaction
 	CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*CreateTransactionResponse, error)
+	// Refund a paid transaction in full, or in part by amount or order items
+	RefundTransaction(ctx context.Context, in *RefundTransactionRequest, opts ...grpc.CallOption) (*Refund, error)
 }
 
 type paymentServiceClient struct {
@@ -76,6 +79,16 @@ func (c *paymentServiceClient) CreateTransaction(ctx context.Context, in *Create
 	return out, nil
 }
 
+func (c *paymentServiceClient) RefundTransaction(ctx context.Context, in *RefundTransactionRequest, opts ...grpc.CallOption) (*Refund, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Refund)
+	err := c.cc.Invoke(ctx, PaymentService_RefundTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PaymentServiceServer is the server API for PaymentService service.
 // All implementations must embed UnimplementedPaymentServiceServer
 // for forward compatibility.
@@ -88,6 +101,8 @@ type PaymentServiceServer interface {
 	GetTransactionById(context.Context, *GetByIdRequest) (*Transaction, error)
 	// Create transaction
 	CreateTransaction(context.Context, *CreateTransactionRequest) (*CreateTransactionResponse, error)
+	// Refund a paid transaction in full, or in part by amount or order items
+	RefundTransaction(context.Context, *RefundTransactionRequest) (*Refund, error)
 	mustEmbedUnimplementedPaymentServiceServer()
 }
 
@@ -107,6 +122,9 @@ func (UnimplementedPaymentServiceServer) GetTransactionById(context.Context, *Ge
 func (UnimplementedPaymentServiceServer) CreateTransaction(context.Context, *CreateTransactionRequest) (*CreateTransactionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateTransaction not implemented")
 }
+func (UnimplementedPaymentServiceServer) RefundTransaction(context.Context, *RefundTransactionRequest) (*Refund, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RefundTransaction not implemented")
+}
 func (UnimplementedPaymentServiceServer) mustEmbedUnimplementedPaymentServiceServer() {}
 func (UnimplementedPaymentServiceServer) testEmbeddedByValue()                        {}
 
@@ -182,6 +200,24 @@ func _PaymentService_CreateTransaction_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PaymentService_RefundTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefundTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaymentServiceServer).RefundTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PaymentService_RefundTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaymentServiceServer).RefundTransaction(ctx, req.(*RefundTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // PaymentService_ServiceDesc is the grpc.ServiceDesc for PaymentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -201,6 +237,10 @@ var PaymentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateTransaction",
 			Handler:    _PaymentService_CreateTransaction_Handler,
 		},
+		{
+			MethodName: "RefundTransaction",
+			Handler:    _PaymentService_RefundTransaction_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/payment.proto",
@@ -19,8 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ProductService_GetDiscounts_FullMethodName   = "/product.ProductService/GetDiscounts"
-	ProductService_CreateDiscount_FullMethodName = "/product.ProductService/CreateDiscount"
+	ProductService_GetDiscounts_FullMethodName     = "/product.ProductService/GetDiscounts"
+	ProductService_CreateDiscount_FullMethodName   = "/product.ProductService/CreateDiscount"
+	ProductService_GetProductPrices_FullMethodName = "/product.ProductService/GetProductPrices"
 )
 
 // ProductServiceClient is the client API for ProductService service.
@@ -29,6 +30,7 @@ const (
 type ProductServiceClient interface {
 	GetDiscounts(ctx context.Context, in *GetDiscountsRequest, opts ...grpc.CallOption) (*DiscountList, error)
 	CreateDiscount(ctx context.Context, in *CreateDiscountRequest, opts ...grpc.CallOption) (*Discount, error)
+	GetProductPrices(ctx context.Context, in *GetProductPricesRequest, opts ...grpc.CallOption) (*ProductPriceList, error)
 }
 
 type productServiceClient struct {
@@ -59,12 +61,23 @@ func (c *productServiceClient) CreateDiscount(ctx context.Context, in *CreateDis
 	return out, nil
 }
 
+func (c *productServiceClient) GetProductPrices(ctx context.Context, in *GetProductPricesRequest, opts ...grpc.CallOption) (*ProductPriceList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProductPriceList)
+	err := c.cc.Invoke(ctx, ProductService_GetProductPrices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ProductServiceServer is the server API for ProductService service.
 // All implementations must embed UnimplementedProductServiceServer
 // for forward compatibility.
 type ProductServiceServer interface {
 	GetDiscounts(context.Context, *GetDiscountsRequest) (*DiscountList, error)
 	CreateDiscount(context.Context, *CreateDiscountRequest) (*Discount, error)
+	GetProductPrices(context.Context, *GetProductPricesRequest) (*ProductPriceList, error)
 	mustEmbedUnimplementedProductServiceServer()
 }
 
@@ -81,6 +94,9 @@ func (UnimplementedProductServiceServer) GetDiscounts(context.Context, *GetDisco
 func (UnimplementedProductServiceServer) CreateDiscount(context.Context, *CreateDiscountRequest) (*Discount, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateDiscount not implemented")
 }
+func (UnimplementedProductServiceServer) GetProductPrices(context.Context, *GetProductPricesRequest) (*ProductPriceList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProductPrices not implemented")
+}
 func (UnimplementedProductServiceServer) mustEmbedUnimplementedProductServiceServer() {}
 func (UnimplementedProductServiceServer) testEmbeddedByValue()                        {}
 
@@ -138,6 +154,24 @@ func _ProductService_CreateDiscount_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ProductService_GetProductPrices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProductPricesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProductServiceServer).GetProductPrices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProductService_GetProductPrices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProductServiceServer).GetProductPrices(ctx, req.(*GetProductPricesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ProductService_ServiceDesc is the grpc.ServiceDesc for ProductService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,6 +187,10 @@ var ProductService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateDiscount",
 			Handler:    _ProductService_CreateDiscount_Handler,
 		},
+		{
+			MethodName: "GetProductPrices",
+			Handler:    _ProductService_GetProductPrices_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/product.proto",
@@ -19,7 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	VendorService_CreateVendor_FullMethodName = "/vendor_service.VendorService/CreateVendor"
+	VendorService_CreateVendor_FullMethodName       = "/vendor_service.VendorService/CreateVendor"
+	VendorService_GetVendorAccess_FullMethodName    = "/vendor_service.VendorService/GetVendorAccess"
+	VendorService_ReserveInventory_FullMethodName   = "/vendor_service.VendorService/ReserveInventory"
+	VendorService_CommitReservation_FullMethodName  = "/vendor_service.VendorService/CommitReservation"
+	VendorService_ReleaseReservation_FullMethodName = "/vendor_service.VendorService/ReleaseReservation"
 )
 
 // VendorServiceClient is the client API for VendorService service.
@@ -27,6 +31,12 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type VendorServiceClient interface {
 	CreateVendor(ctx context.Context, in *CreateVendorRequest, opts ...grpc.CallOption) (*Vendor, error)
+	// vendor of a user and the stores it owns, auth-service puts them in the access token
+	GetVendorAccess(ctx context.Context, in *GetVendorAccessRequest, opts ...grpc.CallOption) (*VendorAccess, error)
+	// stock of an order is held until the order is paid for (commit) or abandoned (release), all three are idempotent per order
+	ReserveInventory(ctx context.Context, in *ReserveInventoryRequest, opts ...grpc.CallOption) (*Reservation, error)
+	CommitReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*Reservation, error)
+	ReleaseReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*Reservation, error)
 }
 
 type vendorServiceClient struct {
@@ -47,11 +57,57 @@ func (c *vendorServiceClient) CreateVendor(ctx context.Context, in *CreateVendor
 	return out, nil
 }
 
+func (c *vendorServiceClient) GetVendorAccess(ctx context.Context, in *GetVendorAccessRequest, opts ...grpc.CallOption) (*VendorAccess, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VendorAccess)
+	err := c.cc.Invoke(ctx, VendorService_GetVendorAccess_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vendorServiceClient) ReserveInventory(ctx context.Context, in *ReserveInventoryRequest, opts ...grpc.CallOption) (*Reservation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reservation)
+	err := c.cc.Invoke(ctx, VendorService_ReserveInventory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vendorServiceClient) CommitReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*Reservation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reservation)
+	err := c.cc.Invoke(ctx, VendorService_CommitReservation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *vendorServiceClient) ReleaseReservation(ctx context.Context, in *ReservationRequest, opts ...grpc.CallOption) (*Reservation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Reservation)
+	err := c.cc.Invoke(ctx, VendorService_ReleaseReservation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // VendorServiceServer is the server API for VendorService service.
 // All implementations must embed UnimplementedVendorServiceServer
 // for forward compatibility.
 type VendorServiceServer interface {
 	CreateVendor(context.Context, *CreateVendorRequest) (*Vendor, error)
+	// vendor of a user and the stores it owns, auth-service puts them in the access token
+	GetVendorAccess(context.Context, *GetVendorAccessRequest) (*VendorAccess, error)
+	// stock of an order is held until the order is paid for (commit) or abandoned (release), all three are idempotent per order
+	ReserveInventory(context.Context, *ReserveInventoryRequest) (*Reservation, error)
+	CommitReservation(context.Context, *ReservationRequest) (*Reservation, error)
+	ReleaseReservation(context.Context, *ReservationRequest) (*Reservation, error)
 	mustEmbedUnimplementedVendorServiceServer()
 }
 
@@ -65,6 +121,18 @@ type UnimplementedVendorServiceServer struct{}
 func (UnimplementedVendorServiceServer) CreateVendor(context.Context, *CreateVendorRequest) (*Vendor, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateVendor not implemented")
 }
+func (UnimplementedVendorServiceServer) GetVendorAccess(context.Context, *GetVendorAccessRequest) (*VendorAccess, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVendorAccess not implemented")
+}
+func (UnimplementedVendorServiceServer) ReserveInventory(context.Context, *ReserveInventoryRequest) (*Reservation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReserveInventory not implemented")
+}
+func (UnimplementedVendorServiceServer) CommitReservation(context.Context, *ReservationRequest) (*Reservation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitReservation not implemented")
+}
+func (UnimplementedVendorServiceServer) ReleaseReservation(context.Context, *ReservationRequest) (*Reservation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseReservation not implemented")
+}
 func (UnimplementedVendorServiceServer) mustEmbedUnimplementedVendorServiceServer() {}
 func (UnimplementedVendorServiceServer) testEmbeddedByValue()                       {}
 
@@ -104,6 +172,78 @@ func _VendorService_CreateVendor_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _VendorService_GetVendorAccess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVendorAccessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VendorServiceServer).GetVendorAccess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VendorService_GetVendorAccess_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VendorServiceServer).GetVendorAccess(ctx, req.(*GetVendorAccessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VendorService_ReserveInventory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReserveInventoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VendorServiceServer).ReserveInventory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VendorService_ReserveInventory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VendorServiceServer).ReserveInventory(ctx, req.(*ReserveInventoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VendorService_CommitReservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VendorServiceServer).CommitReservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VendorService_CommitReservation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VendorServiceServer).CommitReservation(ctx, req.(*ReservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VendorService_ReleaseReservation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReservationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VendorServiceServer).ReleaseReservation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VendorService_ReleaseReservation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VendorServiceServer).ReleaseReservation(ctx, req.(*ReservationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // VendorService_ServiceDesc is the grpc.ServiceDesc for VendorService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,6 +255,22 @@ var VendorService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateVendor",
 			Handler:    _VendorService_CreateVendor_Handler,
 		},
+		{
+			MethodName: "GetVendorAccess",
+			Handler:    _VendorService_GetVendorAccess_Handler,
+		},
+		{
+			MethodName: "ReserveInventory",
+			Handler:    _VendorService_ReserveInventory_Handler,
+		},
+		{
+			MethodName: "CommitReservation",
+			Handler:    _VendorService_CommitReservation_Handler,
+		},
+		{
+			MethodName: "ReleaseReservation",
+			Handler:    _VendorService_ReleaseReservation_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/vendor.proto",
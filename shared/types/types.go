@@ -1,6 +1,11 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/kaasikodes/shop-ease/shared/money"
+)
 
 type PaginationPayload struct {
 	Limit  int `json:"limit"`
@@ -27,9 +32,18 @@ var (
 )
 
 type Price struct {
-	Amount   int       `json:"amount"`
-	Discount *Discount `json:"discount"`
+	Amount   money.Money `json:"amount"`
+	Discount *Discount   `json:"discount"`
 }
+
+// Payable returns the amount after the discount if the discount is in effect at the time
+func (p Price) Payable(at time.Time) (money.Money, error) {
+	if p.Discount == nil || !p.Discount.ActiveAt(at) {
+		return p.Amount, nil
+	}
+	return p.Discount.Apply(p.Amount)
+}
+
 type DiscountValueType string
 type PaidBy string
 
@@ -59,6 +73,26 @@ type Discount struct {
 	CommonDescriptiveModel
 }
 
+func (d Discount) ActiveAt(at time.Time) bool {
+	return !at.Before(d.EffectiveAt) && (d.ExpiresAt == nil || at.Before(*d.ExpiresAt))
+}
+
+// Apply takes the discount off the price, an amount discount is in major units of the currency of the price and cannot take the price below zero
+func (d Discount) Apply(price money.Money) (money.Money, error) {
+	switch d.ValueType {
+	case PercentageDiscount:
+		discounted, _, err := price.ApplyDiscount(int64(d.Value))
+		return discounted, err
+	case AmountDiscount:
+		discount := money.FromMajor(float64(d.Value), price.Currency)
+		if discount.Amount > price.Amount {
+			return money.New(0, price.Currency), nil
+		}
+		return price.Sub(discount)
+	}
+	return money.Money{}, fmt.Errorf("unknown discount type %s", d.ValueType)
+}
+
 type SharingFormulaBasedOn string
 
 var (